@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/api"
+	"github.com/nightmaker00/go-tasks-api/internal/config"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	"github.com/nightmaker00/go-tasks-api/internal/importer"
+	"github.com/nightmaker00/go-tasks-api/internal/repository"
+	"github.com/nightmaker00/go-tasks-api/internal/service"
+	"github.com/nightmaker00/go-tasks-api/internal/todotxt"
+	"github.com/nightmaker00/go-tasks-api/migrations"
+	"github.com/nightmaker00/go-tasks-api/pkg/db/postgres"
+	"gopkg.in/yaml.v2"
+)
+
+var seedStatuses = []domain.TaskStatus{domain.TaskStatusNew, domain.TaskStatusInProgress, domain.TaskStatusDone}
+
+func runSeed(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := newFlagSet("seed", "seed [--count N]", cfg)
+	count := fs.Int("count", 20, "number of tasks to insert")
+	_ = fs.Parse(args)
+
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	taskService := service.NewTaskService(repository.NewTaskRepository(db), nil)
+
+	for i := 1; i <= *count; i++ {
+		title := fmt.Sprintf("Пример задачи %d", i)
+		description := fmt.Sprintf("Создана командой seed (%d из %d)", i, *count)
+		status := string(seedStatuses[i%len(seedStatuses)])
+		if _, err := taskService.Upsert(ctx, uuid.New(), title, &description, status); err != nil {
+			return fmt.Errorf("seed task %d: %w", i, err)
+		}
+	}
+	log.Printf("inserted %d tasks", *count)
+	return nil
+}
+
+func runExport(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := newFlagSet("export", "export [--format ndjson|json|todotxt] [--status S] [--output FILE]", cfg)
+	format := fs.String("format", "ndjson", "ndjson (one task per line), json (array) or todotxt")
+	status := fs.String("status", "", "export only tasks with the status")
+	output := fs.String("output", "", "file to write, stdout when empty")
+	_ = fs.Parse(args)
+	if *format != "ndjson" && *format != "json" && *format != "todotxt" {
+		return fmt.Errorf("unknown format %q, want ndjson, json or todotxt", *format)
+	}
+
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	taskService := service.NewTaskService(repository.NewTaskRepository(db), nil)
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	w := bufio.NewWriter(out)
+
+	count := 0
+	if *format == "json" {
+		w.WriteString("[")
+	}
+	err = taskService.Export(ctx, *status, func(task domain.Task) error {
+		if *format == "todotxt" {
+			count++
+			w.WriteString(todotxt.Format(task))
+			return w.WriteByte('\n')
+		}
+		data, err := json.Marshal(task)
+		if err != nil {
+			return err
+		}
+		switch {
+		case *format == "ndjson":
+		case count == 0:
+			w.WriteString("\n")
+		default:
+			w.WriteString(",\n")
+		}
+		count++
+		w.Write(data)
+		if *format == "ndjson" {
+			return w.WriteByte('\n')
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		w.WriteString("\n]\n")
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	log.Printf("exported %d tasks", count)
+	return nil
+}
+
+// runImport reads the output of export, either format, and upserts tasks by id.
+// Invalid records are reported and skipped.
+func runImport(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := newFlagSet("import", "import [--input FILE]", cfg)
+	input := fs.String("input", "", "file to read, stdin when empty")
+	_ = fs.Parse(args)
+
+	var in io.Reader = os.Stdin
+	if *input != "" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+	reader := bufio.NewReader(in)
+
+	decoder := json.NewDecoder(reader)
+	if first, err := peekNonSpace(reader); err == nil && first == '[' {
+		if _, err := decoder.Token(); err != nil {
+			return fmt.Errorf("read import: %w", err)
+		}
+	}
+
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	taskService := service.NewTaskService(repository.NewTaskRepository(db), nil)
+
+	var created, updated, failed int
+	for record := 1; decoder.More(); record++ {
+		var task domain.Task
+		if err := decoder.Decode(&task); err != nil {
+			return fmt.Errorf("record %d: %w", record, err)
+		}
+		if task.ID == uuid.Nil {
+			task.ID = uuid.New()
+		}
+		if task.Status == "" {
+			task.Status = domain.TaskStatusNew
+		}
+		description := task.Description
+		inserted, err := taskService.Upsert(ctx, task.ID, task.Title, &description, string(task.Status))
+		switch {
+		case err != nil && isValidation(err):
+			failed++
+			log.Printf("record %d (%s): %v", record, task.ID, err)
+		case err != nil:
+			return fmt.Errorf("record %d: %w", record, err)
+		case inserted:
+			created++
+		default:
+			updated++
+		}
+	}
+	log.Printf("imported: %d created, %d updated, %d failed", created, updated, failed)
+	return nil
+}
+
+// runImportTodoTxt creates tasks from a todo.txt file. Lines with the id of an
+// existing task are skipped, so a file exported earlier can be loaded again.
+func runImportTodoTxt(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := newFlagSet("import-todotxt", "import-todotxt [--input FILE] [--dry-run]", cfg)
+	input := fs.String("input", "", "file to read, stdin when empty")
+	dryRun := fs.Bool("dry-run", false, "validate and report without saving")
+	_ = fs.Parse(args)
+
+	var in io.Reader = os.Stdin
+	if *input != "" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	var records []domain.ImportRecord
+	lines := make(map[int]int)
+	scanner := bufio.NewScanner(in)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		record := todotxt.Parse(scanner.Text())
+		record.Row = len(records) + 1
+		lines[record.Row] = line
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read todo.txt: %w", err)
+	}
+
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	taskService := service.NewTaskService(repository.NewTaskRepository(db), nil)
+
+	report, err := taskService.Import(ctx, records, *dryRun)
+	if err != nil {
+		return err
+	}
+	logImportReport(report, func(row int) string { return fmt.Sprintf("line %d", lines[row]) })
+	return nil
+}
+
+// runImportTracker imports an export file of another tracker. Statuses are mapped with the
+// built-in mapping of the source, overridden by --status-map, a YAML map of source status to
+// task status. Rows that fail validation are listed with their source key.
+func runImportTracker(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := newFlagSet("import-tracker", "import-tracker --source S --input FILE [--status-map FILE] [--default-status S] [--dry-run]", cfg)
+	source := fs.String("source", "", "export format: "+strings.Join(importer.Sources(), ", "))
+	input := fs.String("input", "", "export file to read")
+	statusMap := fs.String("status-map", "", "YAML file mapping source statuses or labels to new, in_progress, done")
+	defaultStatus := fs.String("default-status", "", "status for issues not in the mapping, they fail when empty")
+	dryRun := fs.Bool("dry-run", false, "validate and report without saving")
+	_ = fs.Parse(args)
+	if *source == "" || *input == "" {
+		return errors.New("--source and --input are required")
+	}
+	if *defaultStatus != "" && !importer.ValidStatus(*defaultStatus) {
+		return fmt.Errorf("--default-status %q is not a task status", *defaultStatus)
+	}
+
+	mapping := importer.DefaultMapping(*source)
+	if *statusMap != "" {
+		data, err := os.ReadFile(*statusMap)
+		if err != nil {
+			return err
+		}
+		var custom map[string]string
+		if err := yaml.Unmarshal(data, &custom); err != nil {
+			return fmt.Errorf("read status map: %w", err)
+		}
+		if err := mapping.Merge(custom); err != nil {
+			return fmt.Errorf("read status map: %w", err)
+		}
+	}
+
+	file, err := os.Open(*input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	issues, err := importer.Read(*source, file)
+	if err != nil {
+		return err
+	}
+	records := importer.Records(*source, issues, mapping, domain.TaskStatus(*defaultStatus))
+
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	taskService := service.NewTaskService(repository.NewTaskRepository(db), nil)
+
+	report, err := taskService.Import(ctx, records, *dryRun)
+	if err != nil {
+		return err
+	}
+	logImportReport(report, func(row int) string { return issues[row-1].Key })
+	return nil
+}
+
+// logImportReport logs the skipped and failed rows, named by source, and the totals
+func logImportReport(report *domain.ImportReport, source func(row int) string) {
+	for _, row := range report.Rows {
+		reason := row.Reason
+		for _, field := range row.Errors {
+			reason += fmt.Sprintf("; %s: %s", field.Field, field.Message)
+		}
+		log.Printf("%s %s: %s", row.Result, source(row.Row), reason)
+	}
+	prefix := "imported"
+	if report.DryRun {
+		prefix = "dry run"
+	}
+	log.Printf("%s: %d created, %d skipped, %d failed", prefix, report.Created, report.Skipped, report.Failed)
+}
+
+func runCheckConfig(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := newFlagSet("check-config", "check-config [--skip-db]", cfg)
+	bindServerFlags(fs, cfg)
+	skipDB := fs.Bool("skip-db", false, "do not connect to the database")
+	_ = fs.Parse(args)
+
+	printed := *cfg
+	if printed.Config.Password != "" {
+		printed.Config.Password = "***"
+	}
+	out, err := yaml.Marshal(printed)
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(out)
+
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if *skipDB {
+		fmt.Println("config ok")
+		return nil
+	}
+
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := postgres.NewMigrator(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	pending := 0
+	for _, s := range statuses {
+		if s.AppliedAt == nil {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("database is reachable but %d migrations are pending, run \"app migrate up\"", pending)
+	}
+	fmt.Println("config ok, database reachable, schema up to date")
+	return nil
+}
+
+func runCreateAPIKey(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := newFlagSet("create-api-key", "create-api-key --name NAME", cfg)
+	name := fs.String("name", "", "who or what the key is for")
+	_ = fs.Parse(args)
+	if *name == "" {
+		return errors.New("--name is required")
+	}
+
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	key, prefix, hash, err := api.NewAPIKey()
+	if err != nil {
+		return fmt.Errorf("generate api key: %w", err)
+	}
+	created, err := repository.NewAPIKeyRepository(db).Create(ctx, *name, prefix, hash)
+	if err != nil {
+		return err
+	}
+	log.Printf("created api key %s (%s) for %q, it is shown only once", created.ID, created.Prefix, created.Name)
+	fmt.Println(key)
+	return nil
+}
+
+func isValidation(err error) bool {
+	var v *service.ValidationError
+	return errors.As(err, &v)
+}
+
+func peekNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		if !bytes.ContainsAny(b, " \t\r\n") {
+			return b[0], nil
+		}
+		if _, err := r.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+}
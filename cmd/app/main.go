@@ -2,30 +2,39 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
-	"time"
 
-	"github.com/nightmaker00/go-tasks-api/internal/api"
 	"github.com/nightmaker00/go-tasks-api/internal/config"
-	"github.com/nightmaker00/go-tasks-api/internal/repository"
-	"github.com/nightmaker00/go-tasks-api/internal/service"
-	"github.com/nightmaker00/go-tasks-api/pkg/db/postgres"
-
-	_ "github.com/nightmaker00/go-tasks-api/docs"
-	httpSwagger "github.com/swaggo/http-swagger"
 )
 
-// @title           Tasks API
-// @version         1.0
-// @description     REST API для управления задачами (CRUDL)
-// @description     Реализовано на чистом Go с использованием стандартной библиотеки
-// @host            localhost:8080
-// @BasePath        /
-// @schemes         http
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(ctx context.Context, cfg *config.Config, args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"serve", "serve [--host H] [--port P] [--grpc-port P] [--migrate]", "run the HTTP server (default)", runServe},
+		{"migrate", "migrate up | down [--steps N] | status | baseline VERSION", "manage the database schema", runMigrate},
+		{"seed", "seed [--count N]", "insert sample tasks", runSeed},
+		{"export", "export [--format ndjson|json|todotxt] [--status S] [--output FILE]", "write all tasks to a file or stdout", runExport},
+		{"import", "import [--input FILE]", "create or update tasks from an export", runImport},
+		{"import-todotxt", "import-todotxt [--input FILE] [--dry-run]", "create tasks from a todo.txt file", runImportTodoTxt},
+		{"import-tracker", "import-tracker --source S --input FILE [--status-map FILE] [--default-status S] [--dry-run]", "import a Trello, Jira or GitHub Issues export", runImportTracker},
+		{"check-config", "check-config [--skip-db]", "validate the configuration and database access", runCheckConfig},
+		{"create-api-key", "create-api-key --name NAME", "create an API key and print it once", runCreateAPIKey},
+	}
+}
 
 func main() {
 	cfg, err := config.Load()
@@ -33,51 +42,59 @@ func main() {
 		log.Fatal(err)
 	}
 
-	db, err := postgres.Open(cfg.Config)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer db.Close()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	if err := db.Ping(); err != nil {
-		log.Fatal(err)
+	// without a subcommand the binary serves, as before
+	args := os.Args[1:]
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
 
-	taskRepo := repository.NewTaskRepository(db)
-	taskService := service.NewTaskService(taskRepo)
-	handler := api.NewHandler(taskService)
-
-	mux := http.NewServeMux()
-
-	mux.HandleFunc("/swagger/", httpSwagger.Handler(
-		httpSwagger.URL("/swagger/doc.json"),
-	))
-
-	handler.RegisterRoutes(mux)
-	rootHandler := api.WithCORS(mux)
-
-	server := &http.Server{
-		Addr:         cfg.Server.Address + ":" + cfg.Server.Port,
-		Handler:      rootHandler,
-		ReadTimeout:  time.Duration(cfg.Server.Timeouts.ReadSeconds) * time.Second,
-		WriteTimeout: time.Duration(cfg.Server.Timeouts.WriteSeconds) * time.Second,
-		IdleTimeout:  time.Duration(cfg.Server.Timeouts.IdleSeconds) * time.Second,
-	}
-	//graceful shutdown
-	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatal(err)
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if err := cmd.run(ctx, cfg, args); err != nil {
+				log.Fatal(err)
+			}
+			return
 		}
-	}()
-
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
-	<-stop
+	}
+	usage()
+	os.Exit(2)
+}
 
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: app <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-15s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nFlags override the environment variables, see \"app <command> -h\".")
+}
 
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		log.Fatal(err)
+// newFlagSet returns a flag set with the database flags bound to cfg, their
+// defaults are the values config.Load read from the environment
+func newFlagSet(name, usage string, cfg *config.Config) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: app %s\n\nFlags:\n", usage)
+		fs.PrintDefaults()
 	}
+	fs.StringVar(&cfg.Config.Host, "db-host", cfg.Config.Host, "postgres host (POSTGRES_HOST)")
+	fs.StringVar(&cfg.Config.Port, "db-port", cfg.Config.Port, "postgres port (POSTGRES_PORT)")
+	fs.StringVar(&cfg.Config.User, "db-user", cfg.Config.User, "postgres user (POSTGRES_USER)")
+	fs.StringVar(&cfg.Config.Password, "db-password", cfg.Config.Password, "postgres password (POSTGRES_PASSWORD)")
+	fs.StringVar(&cfg.Config.DBName, "db-name", cfg.Config.DBName, "postgres database (POSTGRES_DB)")
+	fs.StringVar(&cfg.Config.SSLMode, "db-sslmode", cfg.Config.SSLMode, "postgres sslmode (POSTGRES_SSLMODE)")
+	return fs
+}
+
+// bindServerFlags adds the listener flags shared by serve and check-config
+func bindServerFlags(fs *flag.FlagSet, cfg *config.Config) {
+	fs.StringVar(&cfg.Server.Address, "host", cfg.Server.Address, "listen address (SERVER_HOST)")
+	fs.StringVar(&cfg.Server.Port, "port", cfg.Server.Port, "listen port (SERVER_PORT)")
+	fs.StringVar(&cfg.GRPC.Port, "grpc-port", cfg.GRPC.Port, "gRPC listen port (GRPC_PORT)")
+	fs.BoolVar(&cfg.Auth.Required, "auth-required", cfg.Auth.Required, "require an API key (AUTH_REQUIRED)")
+	fs.BoolVar(&cfg.Validation.Requests, "validate-requests", cfg.Validation.Requests, "validate requests against the OpenAPI document (VALIDATE_REQUESTS)")
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nightmaker00/go-tasks-api/internal/config"
+	"github.com/nightmaker00/go-tasks-api/migrations"
+	"github.com/nightmaker00/go-tasks-api/pkg/db/postgres"
+)
+
+func runMigrate(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := newFlagSet("migrate", "migrate up | down [--steps N] | status | baseline VERSION", cfg)
+	steps := fs.Int("steps", 1, "number of migrations to roll back (down)")
+	_ = fs.Parse(args)
+	rest := fs.Args()
+	if len(rest) == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	// allow "migrate down --steps 2"
+	_ = fs.Parse(rest[1:])
+
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := postgres.NewMigrator(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	switch rest[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied %06d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		return err
+	case "down":
+		if *steps <= 0 {
+			return fmt.Errorf("--steps must be positive")
+		}
+		rolledBack, err := migrator.Down(ctx, *steps)
+		for _, m := range rolledBack {
+			fmt.Printf("rolled back %06d_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%06d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+	case "baseline":
+		if len(fs.Args()) != 1 {
+			return fmt.Errorf("usage: migrate baseline VERSION")
+		}
+		version, err := strconv.ParseInt(fs.Args()[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid version %q", fs.Args()[0])
+		}
+		return migrator.Baseline(ctx, version)
+	default:
+		return fmt.Errorf("unknown migrate command %q, want up, down, status or baseline", rest[0])
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/nightmaker00/go-tasks-api/internal/api"
+	"github.com/nightmaker00/go-tasks-api/internal/config"
+	"github.com/nightmaker00/go-tasks-api/internal/events"
+	"github.com/nightmaker00/go-tasks-api/internal/grpcapi"
+	"github.com/nightmaker00/go-tasks-api/internal/outbox"
+	"github.com/nightmaker00/go-tasks-api/internal/repository"
+	"github.com/nightmaker00/go-tasks-api/internal/service"
+	"github.com/nightmaker00/go-tasks-api/internal/webhook"
+	"github.com/nightmaker00/go-tasks-api/migrations"
+	"github.com/nightmaker00/go-tasks-api/pkg/db/postgres"
+	tasksv1 "github.com/nightmaker00/go-tasks-api/pkg/pb/tasks/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+func runServe(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := newFlagSet("serve", "serve [--host H] [--port P] [--grpc-port P] [--migrate]", cfg)
+	bindServerFlags(fs, cfg)
+	migrate := fs.Bool("migrate", false, "apply pending migrations before serving")
+	_ = fs.Parse(args)
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if *migrate {
+		migrator, err := postgres.NewMigrator(db, migrations.FS)
+		if err != nil {
+			return err
+		}
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		for _, m := range applied {
+			log.Printf("applied migration %06d_%s", m.Version, m.Name)
+		}
+	}
+
+	taskRepo := repository.NewTaskRepository(db)
+	broker := events.NewBroker(cfg.Events.BufferSize)
+	relay := outbox.NewRelay(repository.NewOutboxRepository(db), taskRepo, outbox.Config{
+		PollInterval: time.Duration(cfg.Outbox.PollMilliseconds) * time.Millisecond,
+		BatchSize:    cfg.Outbox.BatchSize,
+	})
+	relay.AddLocalSink("bus", outbox.NewBusSink(broker))
+	if cfg.Outbox.File != "" {
+		fileSink, err := outbox.OpenFileSink(cfg.Outbox.File)
+		if err != nil {
+			return err
+		}
+		defer fileSink.Close()
+		relay.AddDurableSink("file", fileSink)
+	}
+	taskService := service.NewTaskService(taskRepo, relay)
+	webhookTargets, err := webhook.NewTargetPolicy(cfg.Webhooks.AllowedNetworks, nil)
+	if err != nil {
+		return err
+	}
+	webhookRepo := repository.NewWebhookRepository(db)
+	webhookService := service.NewWebhookService(webhookRepo, webhookTargets)
+	handler := api.NewHandler(taskService, webhookService, broker, cfg.API)
+	idempotencyRepo := repository.NewIdempotencyRepository(db)
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
+
+	mux := http.NewServeMux()
+
+	handler.RegisterRoutes(mux)
+	spec := handler.OpenAPI()
+	validator := api.NewRequestValidator(spec, cfg.Validation, handler.BodyLimit)
+
+	idempotencyTTL := time.Duration(cfg.Idempotency.TTLSeconds) * time.Second
+	idempotencyLease := time.Duration(cfg.Idempotency.LeaseSeconds) * time.Second
+	var apiHandler http.Handler = api.WithIdempotency(idempotencyRepo, idempotencyTTL, idempotencyLease, handler.BodyLimit, mux)
+	if cfg.Validation.Requests || cfg.Validation.Responses {
+		apiHandler = api.WithValidation(validator, apiHandler)
+	}
+	apiHandler = api.WithContentNegotiation(spec, cfg.API.MaxBodyBytes, apiHandler)
+	apiHandler = api.WithAPIKeyAuth(cfg.Auth, apiKeyRepo, apiHandler)
+	rootHandler := api.WithRequestID(api.WithCompression(cfg.Compression, api.WithCORS(cfg.CORS, mux, apiHandler)))
+
+	server := &http.Server{
+		Addr:         cfg.Server.Address + ":" + cfg.Server.Port,
+		Handler:      rootHandler,
+		ReadTimeout:  time.Duration(cfg.Server.Timeouts.ReadSeconds) * time.Second,
+		WriteTimeout: time.Duration(cfg.Server.Timeouts.WriteSeconds) * time.Second,
+		IdleTimeout:  time.Duration(cfg.Server.Timeouts.IdleSeconds) * time.Second,
+	}
+	// event streams never go idle, end them so Shutdown does not wait for its timeout
+	server.RegisterOnShutdown(broker.Close)
+	//graceful shutdown
+	serveErr := make(chan error, 2)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			serveErr <- err
+		}
+	}()
+
+	var grpcServer *grpc.Server
+	var grpcHealth *health.Server
+	if cfg.GRPC.Enabled {
+		listener, err := net.Listen("tcp", cfg.Server.Address+":"+cfg.GRPC.Port)
+		if err != nil {
+			_ = server.Close()
+			return fmt.Errorf("listen grpc: %w", err)
+		}
+		grpcServer, grpcHealth = newGRPCServer(cfg, grpcapi.NewServer(taskService, broker), apiKeyRepo)
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				serveErr <- err
+			}
+		}()
+	}
+
+	cleanupCtx, stopCleanup := context.WithCancel(context.Background())
+	defer stopCleanup()
+	go cleanupIdempotencyKeys(cleanupCtx, idempotencyRepo, time.Hour)
+	if cfg.Events.RetentionHours > 0 {
+		retention := time.Duration(cfg.Events.RetentionHours) * time.Hour
+		go cleanupTaskEvents(cleanupCtx, taskRepo, retention, time.Hour)
+	}
+	if cfg.Webhooks.Enabled {
+		dispatcher := webhook.NewDispatcher(webhookRepo, webhook.Config{
+			Workers:      cfg.Webhooks.Workers,
+			MaxAttempts:  cfg.Webhooks.MaxAttempts,
+			DisableAfter: cfg.Webhooks.DisableAfter,
+			Timeout:      time.Duration(cfg.Webhooks.TimeoutSeconds) * time.Second,
+			PollInterval: time.Duration(cfg.Webhooks.PollSeconds) * time.Second,
+			BackoffBase:  time.Duration(cfg.Webhooks.BackoffSeconds) * time.Second,
+			BackoffMax:   time.Duration(cfg.Webhooks.MaxBackoffSeconds) * time.Second,
+			Targets:      webhookTargets,
+		})
+		relay.AddDurableSink("webhooks", dispatcher)
+		go dispatcher.Run(cleanupCtx)
+	}
+	relayDone := make(chan struct{})
+	go func() {
+		relay.Run(cleanupCtx)
+		close(relayDone)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = server.Shutdown(shutdownCtx)
+	// hijacked WebSocket connections are not covered by server.Shutdown
+	err = errors.Join(err, handler.Shutdown(shutdownCtx))
+	if grpcServer != nil {
+		// WatchTasks streams have already ended with the broker
+		grpcHealth.Shutdown()
+		stopGRPC(shutdownCtx, grpcServer)
+	}
+	// let the relay finish its batch before the event log file is closed
+	stopCleanup()
+	<-relayDone
+	return err
+}
+
+// newGRPCServer serves tasks.v1.TasksService with the health service and, unless
+// disabled, reflection for tools like grpcurl
+func newGRPCServer(cfg *config.Config, tasks *grpcapi.Server, keys api.APIKeyStore) (*grpc.Server, *health.Server) {
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(grpcapi.UnaryAPIKeyAuth(cfg.Auth, keys)),
+		grpc.ChainStreamInterceptor(grpcapi.StreamAPIKeyAuth(cfg.Auth, keys)),
+	)
+	tasksv1.RegisterTasksServiceServer(server, tasks)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(tasksv1.TasksService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+	if cfg.GRPC.Reflection {
+		reflection.Register(server)
+	}
+	return server, healthServer
+}
+
+// stopGRPC waits for running calls until ctx is done, then closes the remaining ones
+func stopGRPC(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		server.Stop()
+	}
+}
+
+func openDB(ctx context.Context, cfg *config.Config) (*sql.DB, error) {
+	db, err := postgres.Open(cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping postgres: %w", err)
+	}
+	return db, nil
+}
+
+func cleanupIdempotencyKeys(ctx context.Context, repo *repository.IdempotencyRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := repo.DeleteExpired(ctx); err != nil {
+				log.Printf("cleanup idempotency keys: %v", err)
+			}
+		}
+	}
+}
+
+func cleanupTaskEvents(ctx context.Context, repo *repository.TaskRepository, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := repo.DeleteEventsOlderThan(ctx, retention); err != nil {
+				log.Printf("cleanup task events: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/pkg/client"
+)
+
+func runList(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("list", "list [--status S] [--limit N] [--offset N] [--all]")
+	status := fs.String("status", "", "filter by status: new, in_progress or done")
+	limit := fs.Int("limit", 0, "page size, the server default when 0")
+	offset := fs.Int("offset", 0, "number of tasks to skip")
+	all := fs.Bool("all", false, "fetch every page")
+	if _, err := a.parse(fs, args); err != nil {
+		return err
+	}
+	if err := checkStatus(*status); err != nil {
+		return err
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := a.context(ctx)
+	defer cancel()
+
+	opts := client.ListOptions{Status: client.TaskStatus(*status), Limit: *limit, Offset: *offset}
+	var items []client.TaskListItem
+	if *all {
+		it := c.ListAll(ctx, opts)
+		for it.Next() {
+			items = append(items, it.Item())
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+	} else {
+		items, err = c.List(ctx, opts)
+		if err != nil {
+			return err
+		}
+	}
+	if items == nil {
+		items = []client.TaskListItem{}
+	}
+	return a.printList(items)
+}
+
+func runGet(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("get", "get ID...")
+	ids, err := a.parseIDs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := a.context(ctx)
+	defer cancel()
+
+	tasks := make([]client.Task, 0, len(ids))
+	for _, id := range ids {
+		task, err := c.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		tasks = append(tasks, *task)
+	}
+	return a.printTasks(tasks)
+}
+
+func runCreate(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("create", "create --title T [--description D] [--id UUID]")
+	title := fs.String("title", "", "task title, may also be given as arguments")
+	description := fs.String("description", "", "task description")
+	rawID := fs.String("id", "", "client-generated task UUID")
+	rest, err := a.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if *title == "" {
+		*title = strings.Join(rest, " ")
+	}
+	if strings.TrimSpace(*title) == "" {
+		return fmt.Errorf("%w: title is required", errUsage)
+	}
+
+	req := client.CreateTaskRequest{Title: *title, Description: *description}
+	if *rawID != "" {
+		id, err := uuid.Parse(*rawID)
+		if err != nil {
+			return fmt.Errorf("%w: invalid id %q", errUsage, *rawID)
+		}
+		req.ID = &id
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := a.context(ctx)
+	defer cancel()
+
+	id, err := c.Create(ctx, req)
+	if err != nil {
+		return err
+	}
+	return a.printID(id)
+}
+
+func runUpdate(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("update", "update ID [--title T] [--description D] [--status S]")
+	title := fs.String("title", "", "new title")
+	description := fs.String("description", "", "new description, empty string clears it")
+	status := fs.String("status", "", "new status: new, in_progress or done")
+	ids, err := a.parseIDs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(ids) != 1 {
+		return fmt.Errorf("%w: update takes exactly one ID", errUsage)
+	}
+
+	// only flags given on the command line are sent
+	var req client.PatchTaskRequest
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "title":
+			req.Title = title
+		case "description":
+			req.Description = description
+		case "status":
+			s := client.TaskStatus(*status)
+			req.Status = &s
+		}
+	})
+	if req.Title == nil && req.Description == nil && req.Status == nil {
+		return fmt.Errorf("%w: nothing to update", errUsage)
+	}
+	if err := checkStatus(*status); err != nil {
+		return err
+	}
+	return a.patch(ctx, ids, req)
+}
+
+func runDone(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("done", "done ID...")
+	ids, err := a.parseIDs(fs, args)
+	if err != nil {
+		return err
+	}
+	status := client.TaskStatusDone
+	return a.patch(ctx, ids, client.PatchTaskRequest{Status: &status})
+}
+
+func runDelete(ctx context.Context, a *app, args []string) error {
+	fs := a.flagSet("delete", "delete ID...")
+	ids, err := a.parseIDs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := a.context(ctx)
+	defer cancel()
+
+	for _, id := range ids {
+		if err := c.Delete(ctx, id); err != nil {
+			return fmt.Errorf("delete %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func (a *app) patch(ctx context.Context, ids []uuid.UUID, req client.PatchTaskRequest) error {
+	c, err := a.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := a.context(ctx)
+	defer cancel()
+
+	tasks := make([]client.Task, 0, len(ids))
+	for _, id := range ids {
+		task, err := c.Patch(ctx, id, req)
+		if err != nil {
+			return fmt.Errorf("update %s: %w", id, err)
+		}
+		tasks = append(tasks, *task)
+	}
+	return a.printTasks(tasks)
+}
+
+// parseIDs parses the flags and requires at least one task UUID argument
+func (a *app) parseIDs(fs *flag.FlagSet, args []string) ([]uuid.UUID, error) {
+	rest, err := a.parse(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) == 0 {
+		return nil, fmt.Errorf("%w: task ID is required", errUsage)
+	}
+
+	ids := make([]uuid.UUID, 0, len(rest))
+	for _, raw := range rest {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid task ID %q", errUsage, raw)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func checkStatus(status string) error {
+	switch client.TaskStatus(status) {
+	case "", client.TaskStatusNew, client.TaskStatusInProgress, client.TaskStatusDone:
+		return nil
+	default:
+		return fmt.Errorf("%w: invalid status %q, want new, in_progress or done", errUsage, status)
+	}
+}
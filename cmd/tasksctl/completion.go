@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const globalFlags = "--config --profile --server --token -o --output --timeout"
+
+// commandFlags lists the flags of each command for shell completion
+var commandFlags = map[string]string{
+	"list":   "--status --limit --offset --all",
+	"create": "--title --description --id",
+	"update": "--title --description --status",
+	"config": "--use",
+}
+
+const bashCompletion = `# bash completion for tasksctl
+_tasksctl() {
+    local cur prev cmd
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+    cmd="${COMP_WORDS[1]}"
+
+    case "$prev" in
+        --status) COMPREPLY=($(compgen -W "{{statuses}}" -- "$cur")); return ;;
+        -o|--output) COMPREPLY=($(compgen -W "{{outputs}}" -- "$cur")); return ;;
+        --config) COMPREPLY=($(compgen -f -- "$cur")); return ;;
+    esac
+
+    if [ "$COMP_CWORD" -eq 1 ]; then
+        COMPREPLY=($(compgen -W "{{commands}}" -- "$cur"))
+        return
+    fi
+
+    local flags="{{global}}"
+    case "$cmd" in
+{{bashCases}}        completion) COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur")); return ;;
+    esac
+    COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+}
+complete -F _tasksctl tasksctl
+`
+
+const zshCompletion = `#compdef tasksctl
+# zsh completion for tasksctl
+_tasksctl() {
+    local -a commands
+    commands=(
+{{zshCommands}}    )
+
+    if (( CURRENT == 2 )); then
+        _describe 'command' commands
+        return
+    fi
+
+    case "${words[CURRENT-1]}" in
+        --status) compadd {{statuses}}; return ;;
+        -o|--output) compadd {{outputs}}; return ;;
+        --config) _files; return ;;
+    esac
+
+    case "${words[2]}" in
+{{zshCases}}        completion) compadd bash zsh fish; return ;;
+    esac
+    compadd -- {{global}}
+}
+compdef _tasksctl tasksctl
+`
+
+func runCompletion(_ context.Context, a *app, args []string) error {
+	fs := a.flagSet("completion", "completion bash|zsh|fish")
+	rest, err := a.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return fmt.Errorf("%w: completion bash|zsh|fish", errUsage)
+	}
+
+	var script string
+	switch rest[0] {
+	case "bash":
+		script = renderCompletion(bashCompletion)
+	case "zsh":
+		script = renderCompletion(zshCompletion)
+	case "fish":
+		script = fishCompletion()
+	default:
+		return fmt.Errorf("%w: unsupported shell %q", errUsage, rest[0])
+	}
+	_, err = fmt.Fprint(a.stdout, script)
+	return err
+}
+
+func renderCompletion(template string) string {
+	var names []string
+	var bashCases, zshCommands, zshCases strings.Builder
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+		fmt.Fprintf(&zshCommands, "        '%s:%s'\n", cmd.name, cmd.summary)
+		if flags, ok := commandFlags[cmd.name]; ok {
+			fmt.Fprintf(&bashCases, "        %s) flags=\"%s $flags\" ;;\n", cmd.name, flags)
+			fmt.Fprintf(&zshCases, "        %s) compadd -- %s %s; return ;;\n", cmd.name, flags, globalFlags)
+		}
+	}
+
+	return strings.NewReplacer(
+		"{{commands}}", strings.Join(names, " "),
+		"{{statuses}}", "new in_progress done",
+		"{{outputs}}", "table json yaml",
+		"{{global}}", globalFlags,
+		"{{bashCases}}", bashCases.String(),
+		"{{zshCommands}}", zshCommands.String(),
+		"{{zshCases}}", zshCases.String(),
+	).Replace(template)
+}
+
+func fishCompletion() string {
+	var b strings.Builder
+	b.WriteString("# fish completion for tasksctl\n")
+	b.WriteString("complete -c tasksctl -f\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&b, "complete -c tasksctl -n __fish_use_subcommand -a %s -d '%s'\n", cmd.name, cmd.summary)
+		for _, flag := range strings.Fields(commandFlags[cmd.name]) {
+			fmt.Fprintf(&b, "complete -c tasksctl -n '__fish_seen_subcommand_from %s' -l %s\n", cmd.name, strings.TrimPrefix(flag, "--"))
+		}
+	}
+	for _, flag := range strings.Fields(globalFlags) {
+		if strings.HasPrefix(flag, "--") {
+			fmt.Fprintf(&b, "complete -c tasksctl -l %s\n", strings.TrimPrefix(flag, "--"))
+		} else {
+			fmt.Fprintf(&b, "complete -c tasksctl -s %s\n", strings.TrimPrefix(flag, "-"))
+		}
+	}
+	b.WriteString("complete -c tasksctl -l status -x -a 'new in_progress done'\n")
+	b.WriteString("complete -c tasksctl -s o -l output -x -a 'table json yaml'\n")
+	b.WriteString("complete -c tasksctl -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'\n")
+	return b.String()
+}
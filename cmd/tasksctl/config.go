@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+const defaultProfile = "default"
+
+// Config is the tasksctl profile file, by default ~/.config/tasksctl/config.yaml:
+//
+//	current: default
+//	profiles:
+//	  default:
+//	    server: http://localhost:8080
+//	    token: secret
+type Config struct {
+	Current  string             `yaml:"current"`
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+type Profile struct {
+	Server string `yaml:"server"`
+	Token  string `yaml:"token,omitempty"`
+}
+
+func defaultConfigPath() string {
+	if path := os.Getenv("TASKSCTL_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "tasksctl.yaml"
+	}
+	return filepath.Join(dir, "tasksctl", "config.yaml")
+}
+
+// loadConfig returns an empty config when the file does not exist yet
+func loadConfig(path string) (*Config, error) {
+	cfg := &Config{Profiles: map[string]Profile{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("parse config %s: %w", path, err)
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = map[string]Profile{}
+	}
+	return cfg, nil
+}
+
+func saveConfig(path string, cfg *Config) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("encode config: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create config dir: %w", err)
+	}
+	// the file holds API tokens
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	return nil
+}
+
+// profileName picks the profile from the flag, then TASKSCTL_PROFILE, then the config
+func (c *Config) profileName(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if env := os.Getenv("TASKSCTL_PROFILE"); env != "" {
+		return env
+	}
+	if c.Current != "" {
+		return c.Current
+	}
+	return defaultProfile
+}
+
+func runConfig(_ context.Context, a *app, args []string) error {
+	fs := a.flagSet("config", "config view | use NAME | set-profile NAME [--server URL] [--token T] [--use]")
+	use := fs.Bool("use", false, "make the profile current (set-profile)")
+	rest, err := a.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return fmt.Errorf("%w: config needs a subcommand: view, use or set-profile", errUsage)
+	}
+
+	cfg, err := loadConfig(a.opts.configPath)
+	if err != nil {
+		return err
+	}
+
+	switch rest[0] {
+	case "view":
+		view := *cfg
+		view.Profiles = make(map[string]Profile, len(cfg.Profiles))
+		for name, profile := range cfg.Profiles {
+			if profile.Token != "" {
+				profile.Token = "<hidden>"
+			}
+			view.Profiles[name] = profile
+		}
+		out, err := yaml.Marshal(view)
+		if err != nil {
+			return fmt.Errorf("encode config: %w", err)
+		}
+		_, err = a.stdout.Write(out)
+		return err
+	case "use":
+		if len(rest) != 2 {
+			return fmt.Errorf("%w: config use NAME", errUsage)
+		}
+		if _, ok := cfg.Profiles[rest[1]]; !ok {
+			return fmt.Errorf("profile %q not found in %s", rest[1], a.opts.configPath)
+		}
+		cfg.Current = rest[1]
+	case "set-profile":
+		if len(rest) != 2 {
+			return fmt.Errorf("%w: config set-profile NAME [--server URL] [--token T]", errUsage)
+		}
+		profile := cfg.Profiles[rest[1]]
+		if a.opts.server != "" {
+			profile.Server = a.opts.server
+		}
+		if a.opts.token != "" {
+			profile.Token = a.opts.token
+		}
+		if profile.Server == "" {
+			profile.Server = defaultServer
+		}
+		cfg.Profiles[rest[1]] = profile
+		if *use || cfg.Current == "" {
+			cfg.Current = rest[1]
+		}
+	default:
+		return fmt.Errorf("%w: unknown config subcommand %q", errUsage, rest[0])
+	}
+	return saveConfig(a.opts.configPath, cfg)
+}
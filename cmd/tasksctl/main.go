@@ -0,0 +1,201 @@
+// Command tasksctl manages tasks of the tasks API from a terminal:
+//
+//	tasksctl list --status new
+//	tasksctl create --title "Купить молоко"
+//	tasksctl done 5b0c...
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nightmaker00/go-tasks-api/pkg/client"
+)
+
+const defaultServer = "http://localhost:8080"
+
+var errUsage = errors.New("usage")
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(ctx context.Context, a *app, args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"list", "list [--status S] [--limit N] [--offset N] [--all]", "list tasks", runList},
+		{"get", "get ID...", "show tasks", runGet},
+		{"create", "create --title T [--description D] [--id UUID]", "create a task", runCreate},
+		{"update", "update ID [--title T] [--description D] [--status S]", "change task fields", runUpdate},
+		{"done", "done ID...", "mark tasks as done", runDone},
+		{"delete", "delete ID...", "delete tasks", runDelete},
+		{"config", "config view | use NAME | set-profile NAME [--server URL] [--token T] [--use]", "manage profiles", runConfig},
+		{"completion", "completion bash|zsh|fish", "print a shell completion script", runCompletion},
+	}
+}
+
+// globalOptions are accepted by every command
+type globalOptions struct {
+	configPath string
+	profile    string
+	server     string
+	token      string
+	output     string
+	timeout    time.Duration
+}
+
+type app struct {
+	stdout io.Writer
+	stderr io.Writer
+	opts   globalOptions
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	a := &app{stdout: os.Stdout, stderr: os.Stderr}
+	if err := a.run(ctx, os.Args[1:]); err != nil {
+		if !errors.Is(err, flag.ErrHelp) && err != errUsage {
+			fmt.Fprintf(os.Stderr, "tasksctl: %v\n", err)
+		}
+		os.Exit(exitCode(err))
+	}
+}
+
+func (a *app) run(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		a.usage()
+		return nil
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(ctx, a, args[1:])
+		}
+	}
+	a.usage()
+	return fmt.Errorf("%w: unknown command %q", errUsage, args[0])
+}
+
+func (a *app) usage() {
+	fmt.Fprintln(a.stderr, "Usage: tasksctl <command> [flags]")
+	fmt.Fprintln(a.stderr, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(a.stderr, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(a.stderr, "\nGlobal flags:")
+	a.flagSet("tasksctl", "").PrintDefaults()
+}
+
+// flagSet returns a flag set with the global flags already registered
+func (a *app) flagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(a.stderr, "Usage: tasksctl %s\n\nFlags:\n", usage)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&a.opts.configPath, "config", defaultConfigPath(), "path to the config file")
+	fs.StringVar(&a.opts.profile, "profile", "", "profile from the config file (env TASKSCTL_PROFILE)")
+	fs.StringVar(&a.opts.server, "server", "", "API base URL (env TASKSCTL_SERVER)")
+	fs.StringVar(&a.opts.token, "token", "", "bearer token (env TASKSCTL_TOKEN)")
+	fs.StringVar(&a.opts.output, "o", "table", "output format: table, json or yaml")
+	fs.StringVar(&a.opts.output, "output", "table", "output format: table, json or yaml")
+	fs.DurationVar(&a.opts.timeout, "timeout", 30*time.Second, "request timeout")
+	return fs
+}
+
+// parse allows flags after positional arguments, e.g. "get ID -o json"
+func (a *app) parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			// the flag package has already printed the error and usage
+			return nil, errUsage
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		if args[0] == "--" {
+			positional = append(positional, args[1:]...)
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	switch a.opts.output {
+	case "table", "json", "yaml":
+	default:
+		return nil, fmt.Errorf("%w: unknown output format %q", errUsage, a.opts.output)
+	}
+	return positional, nil
+}
+
+// client resolves the server and token: flags, then environment, then the profile
+func (a *app) client() (*client.Client, error) {
+	cfg, err := loadConfig(a.opts.configPath)
+	if err != nil {
+		return nil, err
+	}
+	name := cfg.profileName(a.opts.profile)
+	profile, ok := cfg.Profiles[name]
+	if !ok && a.opts.profile != "" {
+		return nil, fmt.Errorf("profile %q not found in %s", name, a.opts.configPath)
+	}
+
+	server := firstNonEmpty(a.opts.server, os.Getenv("TASKSCTL_SERVER"), profile.Server, defaultServer)
+	token := firstNonEmpty(a.opts.token, os.Getenv("TASKSCTL_TOKEN"), profile.Token)
+
+	opts := []client.Option{client.WithUserAgent("tasksctl")}
+	if token != "" {
+		opts = append(opts, client.WithBearerToken(token))
+	}
+	return client.New(server, opts...)
+}
+
+func (a *app) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if a.opts.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, a.opts.timeout)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// exitCode lets scripts tell usage errors and missing tasks apart from other failures
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	case errors.Is(err, client.ErrNotFound):
+		return 3
+	default:
+		return 1
+	}
+}
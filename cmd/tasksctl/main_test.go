@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/api"
+	"github.com/nightmaker00/go-tasks-api/internal/config"
+	"github.com/nightmaker00/go-tasks-api/internal/events"
+	"github.com/nightmaker00/go-tasks-api/internal/service"
+	"github.com/nightmaker00/go-tasks-api/internal/service/servicetest"
+	"github.com/nightmaker00/go-tasks-api/pkg/client"
+	"gopkg.in/yaml.v2"
+)
+
+// testServer serves the real api.Handler on the in-memory repository and remembers the
+// Authorization header of the last request
+type testServer struct {
+	*httptest.Server
+	mu   sync.Mutex
+	auth string
+}
+
+func (s *testServer) lastAuth() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.auth
+}
+
+// newTestServer also points tasksctl at a config file of its own and clears the
+// environment it reads, so the tests do not see the profiles of the machine
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	t.Setenv("TASKSCTL_CONFIG", filepath.Join(t.TempDir(), "tasksctl", "config.yaml"))
+	for _, name := range []string{"TASKSCTL_PROFILE", "TASKSCTL_SERVER", "TASKSCTL_TOKEN"} {
+		t.Setenv(name, "")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	broker := events.NewBroker(cfg.Events.BufferSize)
+	t.Cleanup(broker.Close)
+	mux := http.NewServeMux()
+	api.NewHandler(service.NewTaskService(servicetest.NewTaskRepository(), nil), nil, broker, cfg.API).RegisterRoutes(mux)
+
+	server := &testServer{}
+	handler := api.WithRequestID(mux)
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.mu.Lock()
+		server.auth = r.Header.Get("Authorization")
+		server.mu.Unlock()
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// tasksctl runs a command like main does and returns what it printed and its exit code
+func tasksctl(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	a := &app{stdout: &stdout, stderr: &stderr}
+	err := a.run(context.Background(), args)
+	if err != nil {
+		t.Logf("tasksctl %s: %v\n%s", strings.Join(args, " "), err, stderr.String())
+		return stdout.String(), exitCode(err)
+	}
+	return stdout.String(), 0
+}
+
+// createTask creates a task through tasksctl and returns its id
+func createTask(t *testing.T, server *testServer, title string) string {
+	t.Helper()
+	out, code := tasksctl(t, "create", "--server", server.URL, "--title", title)
+	id := strings.TrimSpace(out)
+	if code != 0 || uuid.Validate(id) != nil {
+		t.Fatalf("create %q: exit %d, output %q", title, code, out)
+	}
+	return id
+}
+
+func TestFlags(t *testing.T) {
+	server := newTestServer(t)
+	id := createTask(t, server, "first")
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+		// output is a part of what the command prints on success
+		output string
+	}{
+		{name: "no command prints usage", args: nil},
+		{name: "unknown command", args: []string{"archive"}, code: 2},
+		{name: "help flag", args: []string{"list", "-h"}},
+		{name: "unknown flag", args: []string{"list", "--color"}, code: 2},
+		{name: "limit not a number", args: []string{"list", "--limit", "ten"}, code: 2},
+		{name: "invalid status", args: []string{"list", "--status", "archived"}, code: 2},
+		{name: "unknown output format", args: []string{"list", "-o", "xml"}, code: 2},
+		{name: "missing id", args: []string{"get"}, code: 2},
+		{name: "invalid id", args: []string{"get", "42"}, code: 2},
+		{name: "missing task", args: []string{"get", uuid.NewString()}, code: 3},
+		{name: "flags after the id", args: []string{"get", id, "-o", "json"}, output: `"title": "first"`},
+		{name: "create without title", args: []string{"create"}, code: 2},
+		{name: "create with invalid id", args: []string{"create", "--title", "a", "--id", "42"}, code: 2},
+		{name: "title from arguments", args: []string{"create", "--id", "6f1c1b8e-0000-4000-8000-000000000001", "buy", "milk"}, output: "6f1c1b8e-0000-4000-8000-000000000001"},
+		{name: "update without fields", args: []string{"update", id}, code: 2},
+		{name: "update two ids", args: []string{"update", id, id, "--title", "b"}, code: 2},
+		{name: "update with invalid status", args: []string{"update", id, "--status", "archived"}, code: 2},
+		{name: "update sends only given flags", args: []string{"update", id, "--status", "in_progress", "-o", "json"}, output: `"title": "first"`},
+		{name: "done", args: []string{"done", id, "-o", "json"}, output: `"status": "done"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if len(args) > 0 {
+				args = append([]string{args[0], "--server", server.URL}, args[1:]...)
+			}
+			out, code := tasksctl(t, args...)
+			if code != tt.code {
+				t.Fatalf("exit code = %d, want %d", code, tt.code)
+			}
+			if !strings.Contains(out, tt.output) {
+				t.Errorf("output %q does not contain %q", out, tt.output)
+			}
+		})
+	}
+}
+
+func TestOutput(t *testing.T) {
+	server := newTestServer(t)
+	first := createTask(t, server, "first")
+	second := createTask(t, server, "second: with a colon")
+
+	tests := []struct {
+		name  string
+		args  []string
+		check func(t *testing.T, out string)
+	}{
+		{
+			name: "list as a table",
+			args: []string{"list"},
+			check: func(t *testing.T, out string) {
+				lines := strings.Split(strings.TrimRight(out, "\n"), "\n")
+				if len(lines) != 3 || strings.Join(strings.Fields(lines[0]), " ") != "ID STATUS TITLE" {
+					t.Fatalf("table:\n%s", out)
+				}
+				for _, line := range lines[1:] {
+					if !strings.Contains(line, " new ") {
+						t.Errorf("row without status: %q", line)
+					}
+				}
+			},
+		},
+		{
+			name: "list as json",
+			args: []string{"list", "-o", "json"},
+			check: func(t *testing.T, out string) {
+				var items []client.TaskListItem
+				if err := json.Unmarshal([]byte(out), &items); err != nil || len(items) != 2 {
+					t.Fatalf("json %v:\n%s", err, out)
+				}
+			},
+		},
+		{
+			name: "list as yaml",
+			args: []string{"list", "--output", "yaml"},
+			check: func(t *testing.T, out string) {
+				var items []map[string]string
+				if err := yaml.Unmarshal([]byte(out), &items); err != nil || len(items) != 2 {
+					t.Fatalf("yaml %v:\n%s", err, out)
+				}
+				titles := map[string]bool{items[0]["title"]: true, items[1]["title"]: true}
+				if !titles["first"] || !titles["second: with a colon"] {
+					t.Errorf("titles %v:\n%s", titles, out)
+				}
+			},
+		},
+		{
+			name: "empty list as json",
+			args: []string{"list", "--status", "done", "-o", "json"},
+			check: func(t *testing.T, out string) {
+				if strings.TrimSpace(out) != "[]" {
+					t.Errorf("json %q, want []", out)
+				}
+			},
+		},
+		{
+			name: "one task as a json object",
+			args: []string{"get", first, "-o", "json"},
+			check: func(t *testing.T, out string) {
+				var task client.Task
+				if err := json.Unmarshal([]byte(out), &task); err != nil || task.ID.String() != first {
+					t.Fatalf("json %v:\n%s", err, out)
+				}
+			},
+		},
+		{
+			name: "tasks as a yaml list",
+			args: []string{"get", first, second, "-o", "yaml"},
+			check: func(t *testing.T, out string) {
+				var tasks []map[string]string
+				if err := yaml.Unmarshal([]byte(out), &tasks); err != nil || len(tasks) != 2 || tasks[0]["id"] != first {
+					t.Fatalf("yaml %v:\n%s", err, out)
+				}
+			},
+		},
+		{
+			name: "tasks as a table",
+			args: []string{"get", first},
+			check: func(t *testing.T, out string) {
+				if !strings.HasPrefix(out, "ID") || !strings.Contains(out, "UPDATED") || !strings.Contains(out, first) {
+					t.Errorf("table:\n%s", out)
+				}
+			},
+		},
+		{
+			name: "created id as json",
+			args: []string{"create", "--title", "third", "-o", "json"},
+			check: func(t *testing.T, out string) {
+				var created struct {
+					ID uuid.UUID `json:"id"`
+				}
+				if err := json.Unmarshal([]byte(out), &created); err != nil || created.ID == uuid.Nil {
+					t.Fatalf("json %v:\n%s", err, out)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{tt.args[0], "--server", server.URL}, tt.args[1:]...)
+			out, code := tasksctl(t, args...)
+			if code != 0 {
+				t.Fatalf("exit code = %d", code)
+			}
+			tt.check(t, out)
+		})
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	server := newTestServer(t)
+	path := os.Getenv("TASKSCTL_CONFIG")
+
+	// a missing file is an empty config, it is created by the first change
+	if out, code := tasksctl(t, "config", "view"); code != 0 || strings.Contains(out, "server") {
+		t.Fatalf("view without a file: exit code %d, output:\n%s", code, out)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("view wrote the file: %v", err)
+	}
+
+	steps := []struct {
+		name string
+		args []string
+		env  map[string]string
+		code int
+		// auth is the Authorization header the server gets, when the step sends a request
+		auth string
+	}{
+		{name: "set a profile", args: []string{"config", "set-profile", "work", "--server", server.URL, "--token", "work-token"}},
+		{name: "the first profile becomes current", args: []string{"list"}, auth: "Bearer work-token"},
+		{name: "add a second profile", args: []string{"config", "set-profile", "home", "--server", server.URL, "--token", "home-token"}},
+		{name: "adding keeps the current one", args: []string{"list"}, auth: "Bearer work-token"},
+		{name: "profile flag", args: []string{"list", "--profile", "home"}, auth: "Bearer home-token"},
+		{name: "profile from the environment", args: []string{"list"}, env: map[string]string{"TASKSCTL_PROFILE": "home"}, auth: "Bearer home-token"},
+		{name: "token flag wins over the profile", args: []string{"list", "--token", "flag-token"}, auth: "Bearer flag-token"},
+		{name: "token from the environment", args: []string{"list"}, env: map[string]string{"TASKSCTL_TOKEN": "env-token"}, auth: "Bearer env-token"},
+		{name: "switch profiles", args: []string{"config", "use", "home"}},
+		{name: "the switched profile is used", args: []string{"list"}, auth: "Bearer home-token"},
+		{name: "unknown profile flag", args: []string{"list", "--profile", "missing"}, code: 1},
+		{name: "use an unknown profile", args: []string{"config", "use", "missing"}, code: 1},
+		{name: "unknown subcommand", args: []string{"config", "remove"}, code: 2},
+		{name: "no subcommand", args: []string{"config"}, code: 2},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			for name, value := range step.env {
+				t.Setenv(name, value)
+			}
+			if _, code := tasksctl(t, step.args...); code != step.code {
+				t.Fatalf("exit code = %d, want %d", code, step.code)
+			}
+			if step.auth != "" && server.lastAuth() != step.auth {
+				t.Errorf("Authorization = %q, want %q", server.lastAuth(), step.auth)
+			}
+		})
+	}
+
+	out, code := tasksctl(t, "config", "view")
+	if code != 0 || strings.Contains(out, "-token") || !strings.Contains(out, "<hidden>") || !strings.Contains(out, "current: home") {
+		t.Errorf("config view: exit code %d, output:\n%s", code, out)
+	}
+
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if cfg.Current != "home" || cfg.Profiles["work"].Token != "work-token" || cfg.Profiles["home"].Server != server.URL {
+		t.Errorf("config file: %+v", cfg)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	// the file holds the tokens
+	for file, want := range map[string]os.FileMode{path: 0o600, filepath.Dir(path): 0o700} {
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("stat: %v", err)
+		}
+		if mode := info.Mode().Perm(); mode != want {
+			t.Errorf("%s has mode %o, want %o", file, mode, want)
+		}
+	}
+}
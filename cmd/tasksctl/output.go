@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/pkg/client"
+	"gopkg.in/yaml.v2"
+)
+
+func (a *app) printList(items []client.TaskListItem) error {
+	if a.opts.output != "table" {
+		return a.printData(items)
+	}
+	w := tabwriter.NewWriter(a.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS\tTITLE")
+	for _, item := range items {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", item.ID, item.Status, item.Title)
+	}
+	return w.Flush()
+}
+
+func (a *app) printTasks(tasks []client.Task) error {
+	if a.opts.output != "table" {
+		// a single task is printed as an object so scripts can use it directly
+		if len(tasks) == 1 {
+			return a.printData(tasks[0])
+		}
+		return a.printData(tasks)
+	}
+	w := tabwriter.NewWriter(a.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS\tTITLE\tDESCRIPTION\tUPDATED")
+	for _, task := range tasks {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", task.ID, task.Status, task.Title,
+			task.Description, task.UpdatedAt.Local().Format(time.DateTime))
+	}
+	return w.Flush()
+}
+
+func (a *app) printID(id uuid.UUID) error {
+	if a.opts.output != "table" {
+		return a.printData(map[string]uuid.UUID{"id": id})
+	}
+	_, err := fmt.Fprintln(a.stdout, id)
+	return err
+}
+
+// printData writes v as JSON or YAML. YAML is produced from the JSON form so
+// both formats share field names and UUIDs are rendered as strings.
+func (a *app) printData(v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode output: %w", err)
+	}
+	if a.opts.output == "json" {
+		_, err = fmt.Fprintln(a.stdout, string(data))
+		return err
+	}
+
+	var doc any
+	if len(data) > 0 && data[0] == '[' {
+		var list []yaml.MapSlice
+		err = yaml.Unmarshal(data, &list)
+		doc = list
+	} else {
+		var object yaml.MapSlice
+		err = yaml.Unmarshal(data, &object)
+		doc = object
+	}
+	if err != nil {
+		return fmt.Errorf("encode output: %w", err)
+	}
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("encode output: %w", err)
+	}
+	_, err = a.stdout.Write(out)
+	return err
+}
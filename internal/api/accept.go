@@ -0,0 +1,111 @@
+package api
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// preferredMediaType picks the offer the Accept header ranks highest. The first offer is
+// the default when the header is absent or accepts none of them.
+func preferredMediaType(r *http.Request, offers ...string) string {
+	if offer, ok := negotiateMediaType(r, offers...); ok {
+		return offer
+	}
+	return offers[0]
+}
+
+// negotiateMediaType is preferredMediaType that reports false instead of falling back
+// when the Accept header rules out every offer. Each offer takes the q of the most
+// specific range matching it, ties go to the earlier offer.
+func negotiateMediaType(r *http.Request, offers ...string) (string, bool) {
+	header := r.Header.Get("Accept")
+	if header == "" {
+		return offers[0], true
+	}
+
+	qualities := make([]float64, len(offers))
+	specificities := make([]int, len(offers))
+	for i := range specificities {
+		specificities[i] = -1
+	}
+	for _, part := range strings.Split(header, ",") {
+		mediaRange, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if raw, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(raw, 64); err != nil {
+				continue
+			}
+		}
+		for i, offer := range offers {
+			if specificity := mediaRangeSpecificity(mediaRange, offer); specificity > specificities[i] {
+				qualities[i], specificities[i] = q, specificity
+			}
+		}
+	}
+
+	best := 0
+	for i := range offers {
+		if qualities[i] > qualities[best] {
+			best = i
+		}
+	}
+	if qualities[best] == 0 {
+		return "", false
+	}
+	return offers[best], true
+}
+
+// mediaRangeSpecificity reports how closely a media range matches the type: 2 for an
+// exact match, 1 for type/*, 0 for */*, -1 when it does not match
+func mediaRangeSpecificity(mediaRange, mediaType string) int {
+	switch {
+	case strings.EqualFold(mediaRange, mediaType):
+		return 2
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*"):
+		prefix := strings.TrimSuffix(mediaRange, "*")
+		if strings.HasPrefix(strings.ToLower(mediaType), strings.ToLower(prefix)) {
+			return 1
+		}
+	}
+	return -1
+}
+
+// preferredEncoding picks the content coding the Accept-Encoding header ranks highest,
+// ties go to the earlier offer. It returns "" when the response should not be encoded:
+// the header is absent, or accepts none of the offers.
+func preferredEncoding(r *http.Request, offers ...string) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if coding = strings.ToLower(strings.TrimSpace(coding)); coding == "" {
+			continue
+		}
+		q := 1.0
+		if name, raw, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			var err error
+			if q, err = strconv.ParseFloat(strings.TrimSpace(raw), 64); err != nil {
+				continue
+			}
+		}
+		qualities[coding] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		q, ok := qualities[offer]
+		if !ok {
+			q = qualities["*"]
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/config"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+	apiKeyPrefix = "tsk_"
+)
+
+type APIKeyStore interface {
+	Authenticate(ctx context.Context, keyHash string) (uuid.UUID, bool, error)
+}
+
+type apiKeyIDKey struct{}
+
+// APIKeyID returns the id of the key WithAPIKeyAuth accepted, "" when the request was
+// served without one
+func APIKeyID(ctx context.Context) string {
+	id, _ := ctx.Value(apiKeyIDKey{}).(string)
+	return id
+}
+
+// WithAPIKeyAuth requires a key created by "app create-api-key" in
+// "Authorization: Bearer <key>" or X-API-Key when cfg.Required is set,
+// or in ?token= on cfg.QueryTokenPaths
+func WithAPIKeyAuth(cfg config.Auth, store APIKeyStore, next http.Handler) http.Handler {
+	if !cfg.Required {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isPublicPath(cfg.PublicPaths, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := apiKeyFromRequest(r)
+		tokenPath := isPublicPath(cfg.QueryTokenPaths, r.URL.Path)
+		if key == "" && tokenPath {
+			key = r.URL.Query().Get("token")
+			if _, password, ok := r.BasicAuth(); ok && key == "" {
+				key = password
+			}
+		}
+		if key == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="tasks-api"`)
+			if tokenPath {
+				w.Header().Add("WWW-Authenticate", `Basic realm="tasks-api"`)
+			}
+			writeError(w, http.StatusUnauthorized, codeUnauthorized, "api key is required")
+			return
+		}
+		id, ok, err := store.Authenticate(r.Context(), HashAPIKey(key))
+		if err != nil {
+			log.Printf("authenticate api key: %v", err)
+			writeError(w, http.StatusInternalServerError, codeInternal, "internal server error")
+			return
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="tasks-api", error="invalid_token"`)
+			writeError(w, http.StatusUnauthorized, codeUnauthorized, "invalid api key")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyIDKey{}, id.String())))
+	})
+}
+
+// NewAPIKey returns a random key and its hash. The prefix identifies keys in logs and listings.
+func NewAPIKey() (key, prefix, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+	key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return key, key[:len(apiKeyPrefix)+6], HashAPIKey(key), nil
+}
+
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return key
+	}
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+func isPublicPath(public []string, path string) bool {
+	for _, p := range public {
+		if p == path || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			return true
+		}
+	}
+	return false
+}
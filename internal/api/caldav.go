@@ -0,0 +1,373 @@
+package api
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	"github.com/nightmaker00/go-tasks-api/internal/ical"
+	"github.com/nightmaker00/go-tasks-api/internal/service"
+)
+
+// A minimal read-only CalDAV server (RFC 4791): the principal /caldav/ has one calendar
+// /caldav/tasks/ with a VTODO resource per task. It answers PROPFIND, the calendar-query
+// and calendar-multiget reports and GET; filters of calendar-query are ignored and
+// every task is returned. Writes are rejected by the mux with 405.
+
+const (
+	caldavRoot       = "/caldav/"
+	caldavCollection = "/caldav/tasks/"
+
+	nsDAV          = "DAV:"
+	nsCalDAV       = "urn:ietf:params:xml:ns:caldav"
+	nsCalendarServ = "http://calendarserver.org/ns/"
+
+	caldavMaxBody = 64 << 10
+)
+
+var (
+	propResourceType     = xml.Name{Space: nsDAV, Local: "resourcetype"}
+	propDisplayName      = xml.Name{Space: nsDAV, Local: "displayname"}
+	propCurrentPrincipal = xml.Name{Space: nsDAV, Local: "current-user-principal"}
+	propPrincipalURL     = xml.Name{Space: nsDAV, Local: "principal-URL"}
+	propGetETag          = xml.Name{Space: nsDAV, Local: "getetag"}
+	propGetContentType   = xml.Name{Space: nsDAV, Local: "getcontenttype"}
+	propGetLastModified  = xml.Name{Space: nsDAV, Local: "getlastmodified"}
+	propCalendarHomeSet  = xml.Name{Space: nsCalDAV, Local: "calendar-home-set"}
+	propSupportedComps   = xml.Name{Space: nsCalDAV, Local: "supported-calendar-component-set"}
+	propCalendarData     = xml.Name{Space: nsCalDAV, Local: "calendar-data"}
+	propGetCTag          = xml.Name{Space: nsCalendarServ, Local: "getctag"}
+)
+
+func (h *Handler) registerCalDAV(mux *http.ServeMux) {
+	mux.HandleFunc("OPTIONS "+caldavRoot, caldavOptions)
+	mux.HandleFunc("PROPFIND "+caldavRoot+"{$}", h.caldavPrincipal)
+	mux.HandleFunc("PROPFIND "+caldavCollection+"{$}", h.caldavCalendar)
+	mux.HandleFunc("GET "+caldavCollection+"{$}", h.caldavCalendarData)
+	mux.HandleFunc("REPORT "+caldavCollection+"{$}", h.caldavReport)
+	mux.HandleFunc("PROPFIND "+caldavCollection+"{file}", h.caldavTaskProps)
+	mux.HandleFunc("GET "+caldavCollection+"{file}", h.caldavTask)
+}
+
+func caldavOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("DAV", "1, calendar-access")
+	w.Header().Set("Allow", "OPTIONS, GET, HEAD, PROPFIND, REPORT")
+	w.WriteHeader(http.StatusOK)
+}
+
+// davResource is a response entry: known properties are rendered elements keyed by name
+type davResource struct {
+	href   string
+	status int
+	props  map[xml.Name]string
+}
+
+// calendarEntry is a task rendered as its own calendar object
+type calendarEntry struct {
+	task domain.Task
+	body []byte
+	etag string
+}
+
+func newCalendarEntry(task domain.Task) (calendarEntry, error) {
+	var body bytes.Buffer
+	if err := ical.WriteCalendar(&body, "", []domain.Task{task}); err != nil {
+		return calendarEntry{}, err
+	}
+	return calendarEntry{task: task, body: body.Bytes(), etag: contentETag(body.Bytes())}, nil
+}
+
+func (e calendarEntry) resource() davResource {
+	return davResource{
+		href:   caldavCollection + e.task.ID.String() + ".ics",
+		status: http.StatusOK,
+		props: map[xml.Name]string{
+			propResourceType:    "<D:resourcetype/>",
+			propGetETag:         "<D:getetag>" + escapeXML(e.etag) + "</D:getetag>",
+			propGetContentType:  "<D:getcontenttype>" + ical.ContentType + "; component=VTODO</D:getcontenttype>",
+			propGetLastModified: "<D:getlastmodified>" + e.task.UpdatedAt.UTC().Format(http.TimeFormat) + "</D:getlastmodified>",
+			propCalendarData:    "<C:calendar-data>" + escapeXML(string(e.body)) + "</C:calendar-data>",
+		},
+	}
+}
+
+func principalProps() map[xml.Name]string {
+	href := "<D:href>" + caldavRoot + "</D:href>"
+	return map[xml.Name]string{
+		propCurrentPrincipal: "<D:current-user-principal>" + href + "</D:current-user-principal>",
+		propPrincipalURL:     "<D:principal-URL>" + href + "</D:principal-URL>",
+		propCalendarHomeSet:  "<C:calendar-home-set>" + href + "</C:calendar-home-set>",
+	}
+}
+
+func (h *Handler) caldavPrincipal(w http.ResponseWriter, r *http.Request) {
+	request, ok := readPropfind(w, r)
+	if !ok {
+		return
+	}
+	principal := davResource{href: caldavRoot, status: http.StatusOK, props: principalProps()}
+	principal.props[propResourceType] = "<D:resourcetype><D:collection/><D:principal/></D:resourcetype>"
+	principal.props[propDisplayName] = "<D:displayname>tasks-api</D:displayname>"
+	resources := []davResource{principal}
+
+	if davDepth(r) > 0 {
+		calendar, _, err := h.caldavCalendarResource(r)
+		if err != nil {
+			handleServiceError(w, err)
+			return
+		}
+		resources = append(resources, calendar)
+	}
+	writeMultistatus(w, resources, request)
+}
+
+func (h *Handler) caldavCalendar(w http.ResponseWriter, r *http.Request) {
+	request, ok := readPropfind(w, r)
+	if !ok {
+		return
+	}
+	calendar, entries, err := h.caldavCalendarResource(r)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	resources := []davResource{calendar}
+	if davDepth(r) > 0 {
+		for _, entry := range entries {
+			resources = append(resources, entry.resource())
+		}
+	}
+	writeMultistatus(w, resources, request)
+}
+
+// caldavCalendarResource describes the collection, its ctag changes with any task
+func (h *Handler) caldavCalendarResource(r *http.Request) (davResource, []calendarEntry, error) {
+	tasks := make([]domain.Task, 0)
+	err := h.taskService.Export(r.Context(), "", func(task domain.Task) error {
+		tasks = append(tasks, task)
+		return nil
+	})
+	if err != nil {
+		return davResource{}, nil, err
+	}
+	entries := make([]calendarEntry, 0, len(tasks))
+	var etags strings.Builder
+	for _, task := range tasks {
+		entry, err := newCalendarEntry(task)
+		if err != nil {
+			return davResource{}, nil, err
+		}
+		entries = append(entries, entry)
+		etags.WriteString(entry.etag)
+	}
+	ctag := escapeXML(contentETag([]byte(etags.String())))
+
+	props := principalProps()
+	props[propResourceType] = "<D:resourcetype><D:collection/><C:calendar/></D:resourcetype>"
+	props[propDisplayName] = "<D:displayname>" + calendarName + "</D:displayname>"
+	props[propSupportedComps] = `<C:supported-calendar-component-set><C:comp name="VTODO"/></C:supported-calendar-component-set>`
+	props[propGetCTag] = "<CS:getctag>" + ctag + "</CS:getctag>"
+	props[propGetETag] = "<D:getetag>" + ctag + "</D:getetag>"
+	return davResource{href: caldavCollection, status: http.StatusOK, props: props}, entries, nil
+}
+
+func (h *Handler) caldavCalendarData(w http.ResponseWriter, r *http.Request) {
+	h.serveCalendar(w, r, "", 0, 0)
+}
+
+func (h *Handler) caldavTask(w http.ResponseWriter, r *http.Request) {
+	entry, err := h.caldavEntry(r, r.PathValue("file"))
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeCalendar(w, r, entry.body, entry.task.UpdatedAt)
+}
+
+func (h *Handler) caldavTaskProps(w http.ResponseWriter, r *http.Request) {
+	request, ok := readPropfind(w, r)
+	if !ok {
+		return
+	}
+	entry, err := h.caldavEntry(r, r.PathValue("file"))
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeMultistatus(w, []davResource{entry.resource()}, request)
+}
+
+// caldavEntry loads the task of a resource name "<id>.ics"
+func (h *Handler) caldavEntry(r *http.Request, file string) (calendarEntry, error) {
+	raw, ok := strings.CutSuffix(file, ".ics")
+	id, err := uuid.Parse(raw)
+	if !ok || err != nil {
+		return calendarEntry{}, service.ErrTaskNotFound
+	}
+	task, err := h.taskService.GetByID(r.Context(), id)
+	if err != nil {
+		return calendarEntry{}, err
+	}
+	return newCalendarEntry(*task)
+}
+
+// calendarReport is a calendar-query or calendar-multiget request
+type calendarReport struct {
+	XMLName xml.Name
+	Prop    davPropNames `xml:"DAV: prop"`
+	Hrefs   []string     `xml:"DAV: href"`
+}
+
+func (h *Handler) caldavReport(w http.ResponseWriter, r *http.Request) {
+	var report calendarReport
+	if err := readDAVBody(r, &report); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid report body")
+		return
+	}
+	request := propfind{Prop: report.Prop}
+
+	var resources []davResource
+	switch report.XMLName {
+	case xml.Name{Space: nsCalDAV, Local: "calendar-query"}:
+		_, entries, err := h.caldavCalendarResource(r)
+		if err != nil {
+			handleServiceError(w, err)
+			return
+		}
+		for _, entry := range entries {
+			resources = append(resources, entry.resource())
+		}
+	case xml.Name{Space: nsCalDAV, Local: "calendar-multiget"}:
+		for _, href := range report.Hrefs {
+			entry, err := h.caldavEntry(r, path.Base(href))
+			switch {
+			case errors.Is(err, service.ErrTaskNotFound):
+				resources = append(resources, davResource{href: href, status: http.StatusNotFound})
+			case err != nil:
+				handleServiceError(w, err)
+				return
+			default:
+				resources = append(resources, entry.resource())
+			}
+		}
+	default:
+		writeError(w, http.StatusForbidden, codeUnsupportedReport, "unsupported report "+report.XMLName.Local)
+		return
+	}
+	writeMultistatus(w, resources, request)
+}
+
+// propfind is the PROPFIND body, an empty body means allprop
+type propfind struct {
+	AllProp *struct{}    `xml:"DAV: allprop"`
+	Prop    davPropNames `xml:"DAV: prop"`
+}
+
+// davPropNames collects the names of the requested properties
+type davPropNames []xml.Name
+
+func (p *davPropNames) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			*p = append(*p, t.Name)
+			if err := d.Skip(); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+func readPropfind(w http.ResponseWriter, r *http.Request) (propfind, bool) {
+	var request propfind
+	if err := readDAVBody(r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid propfind body")
+		return request, false
+	}
+	return request, true
+}
+
+func readDAVBody(r *http.Request, dst any) error {
+	body, err := io.ReadAll(io.LimitReader(r.Body, caldavMaxBody))
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	return xml.Unmarshal(body, dst)
+}
+
+// davDepth reads the Depth header, infinity is served as 1
+func davDepth(r *http.Request) int {
+	if strings.TrimSpace(r.Header.Get("Depth")) == "0" {
+		return 0
+	}
+	return 1
+}
+
+// writeMultistatus answers with the requested properties of each resource, unknown ones
+// under 404. allprop returns every property except calendar-data (RFC 4791, 9.6).
+func writeMultistatus(w http.ResponseWriter, resources []davResource, request propfind) {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	fmt.Fprintf(&b, `<D:multistatus xmlns:D="%s" xmlns:C="%s" xmlns:CS="%s">`, nsDAV, nsCalDAV, nsCalendarServ)
+	for _, resource := range resources {
+		b.WriteString("<D:response><D:href>" + escapeXML(resource.href) + "</D:href>")
+		if resource.status != http.StatusOK {
+			b.WriteString("<D:status>" + davStatus(resource.status) + "</D:status></D:response>")
+			continue
+		}
+
+		var found, missing strings.Builder
+		if len(request.Prop) == 0 {
+			for name, value := range resource.props {
+				if name != propCalendarData {
+					found.WriteString(value)
+				}
+			}
+		}
+		for _, name := range request.Prop {
+			if value, ok := resource.props[name]; ok {
+				found.WriteString(value)
+				continue
+			}
+			fmt.Fprintf(&missing, `<%s xmlns="%s"/>`, name.Local, escapeXML(name.Space))
+		}
+		if found.Len() > 0 {
+			b.WriteString("<D:propstat><D:prop>" + found.String() + "</D:prop><D:status>" + davStatus(http.StatusOK) + "</D:status></D:propstat>")
+		}
+		if missing.Len() > 0 {
+			b.WriteString("<D:propstat><D:prop>" + missing.String() + "</D:prop><D:status>" + davStatus(http.StatusNotFound) + "</D:status></D:propstat>")
+		}
+		b.WriteString("</D:response>")
+	}
+	b.WriteString("</D:multistatus>")
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	_, _ = io.WriteString(w, b.String())
+}
+
+func davStatus(status int) string {
+	return fmt.Sprintf("HTTP/1.1 %d %s", status, http.StatusText(status))
+}
+
+func escapeXML(value string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(value))
+	return b.String()
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+const (
+	// maxChangesWait bounds the long poll of GET /tasks/changes
+	maxChangesWait = 60 * time.Second
+	// changesWriteGrace is added to the wait for writing the response
+	changesWriteGrace = 10 * time.Second
+)
+
+// TaskChanges возвращает изменения задач после токена
+func (h *Handler) TaskChanges(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	token := strings.TrimSpace(query.Get("since"))
+	var fields []domain.FieldError
+	wait, err := parseWait(query.Get("wait"))
+	if err != nil {
+		fields = append(fields, domain.FieldError{Field: "wait", Code: "invalid_duration", Message: "invalid wait, up to 60s"})
+	}
+	limit, err := parseIntParam(r, "limit")
+	if err != nil {
+		fields = append(fields, domain.FieldError{Field: "limit", Code: "invalid_integer", Message: "invalid limit"})
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, fields)
+		return
+	}
+
+	var changed <-chan domain.TaskEvent
+	if wait > 0 && token != "" {
+		// subscribe before the first read, so a change committed in between wakes the poll
+		sub := h.events.Subscribe()
+		defer sub.Close()
+		changed = sub.Events()
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + changesWriteGrace))
+	}
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+
+	for {
+		changes, err := h.taskService.Changes(r.Context(), token, limit)
+		if err != nil {
+			handleServiceError(w, err)
+			return
+		}
+		if changed == nil || len(changes.Upserted) > 0 || len(changes.Deleted) > 0 {
+			w.Header().Set("Cache-Control", "no-store")
+			writeJSON(w, http.StatusOK, changes)
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-timeout.C:
+			changed = nil
+		case _, ok := <-changed:
+			// a closed subscription fell behind or the server is stopping, read once more and answer
+			if !ok {
+				changed = nil
+			}
+		}
+	}
+}
+
+// parseWait reads a duration such as 30s, a plain number means seconds
+func parseWait(raw string) (time.Duration, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0, nil
+	}
+	wait, err := time.ParseDuration(raw)
+	if err != nil {
+		seconds, convErr := strconv.Atoi(raw)
+		if convErr != nil {
+			return 0, err
+		}
+		wait = time.Duration(seconds) * time.Second
+	}
+	if wait < 0 || wait > maxChangesWait {
+		return 0, strconv.ErrRange
+	}
+	return wait, nil
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/nightmaker00/go-tasks-api/internal/config"
+)
+
+// compressionEncodings are offered in order of preference
+var compressionEncodings = []string{"zstd", "gzip"}
+
+// compressibleTypes are compressed besides text/*, JSON, XML and the formats of
+// bodyCodecs, other types are mostly compressed already
+var compressibleTypes = map[string]bool{
+	"application/json":       true,
+	"application/x-ndjson":   true,
+	"application/xml":        true,
+	"application/javascript": true,
+}
+
+var gzipWriters = sync.Pool{New: func() any {
+	return gzip.NewWriter(io.Discard)
+}}
+
+var zstdEncoders = sync.Pool{New: func() any {
+	// one goroutine per encoder, the concurrency comes from the requests
+	encoder, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	return encoder
+}}
+
+// WithCompression compresses response bodies with zstd or gzip, whichever Accept-Encoding
+// prefers. Bodies shorter than cfg.MinBytes, event streams and types that are compressed
+// already are sent as they are.
+func WithCompression(cfg config.Compression, next http.Handler) http.Handler {
+	if !cfg.Enabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := preferredEncoding(r, compressionEncodings...)
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, minBytes: cfg.MinBytes, status: http.StatusOK}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter holds back the start of a body until it reaches minBytes, then sends
+// the rest through the encoder. A body that ends earlier goes out uncompressed.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	minBytes    int
+	status      int
+	wroteHeader bool
+	// passthrough is set once the response is known not to be compressed
+	passthrough bool
+	buf         bytes.Buffer
+	encoder     io.WriteCloser
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+	c.status = status
+
+	header := c.Header()
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	short := err == nil && length < c.minBytes
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified ||
+		short || header.Get("Content-Encoding") != "" || !compressible(header.Get("Content-Type")) {
+		c.passthrough = true
+		c.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if !c.wroteHeader {
+		// sniff before the body is compressed, net/http would sniff the compressed bytes
+		if c.Header().Get("Content-Type") == "" {
+			c.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		c.WriteHeader(http.StatusOK)
+	}
+	switch {
+	case c.passthrough:
+		return c.ResponseWriter.Write(p)
+	case c.encoder != nil:
+		return c.encoder.Write(p)
+	}
+	c.buf.Write(p)
+	if c.buf.Len() >= c.minBytes {
+		if err := c.startEncoding(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (c *compressWriter) startEncoding() error {
+	header := c.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Encoding", c.encoding)
+	// the bytes differ from the identity body, a strong validator would claim they do not
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+
+	switch c.encoding {
+	case "zstd":
+		encoder := zstdEncoders.Get().(*zstd.Encoder)
+		encoder.Reset(c.ResponseWriter)
+		c.encoder = encoder
+	default:
+		encoder := gzipWriters.Get().(*gzip.Writer)
+		encoder.Reset(c.ResponseWriter)
+		c.encoder = encoder
+	}
+	_, err := c.encoder.Write(c.buf.Bytes())
+	c.buf.Reset()
+	return err
+}
+
+// FlushError sends what the handler wrote so far, compressed when the body already
+// passed minBytes or as it is when it did not
+func (c *compressWriter) FlushError() error {
+	if c.wroteHeader && !c.passthrough && c.encoder == nil && c.buf.Len() > 0 {
+		if err := c.startEncoding(); err != nil {
+			return err
+		}
+	}
+	if flusher, ok := c.encoder.(interface{ Flush() error }); ok {
+		if err := flusher.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(c.ResponseWriter).Flush()
+}
+
+// Hijack lets WebSocket upgrades through, the upgrader asserts http.Hijacker directly
+func (c *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(c.ResponseWriter).Hijack()
+	if err == nil {
+		c.wroteHeader, c.passthrough = true, true
+	}
+	return conn, rw, err
+}
+
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+func (c *compressWriter) close() {
+	switch {
+	case c.encoder != nil:
+		_ = c.encoder.Close()
+		switch encoder := c.encoder.(type) {
+		case *zstd.Encoder:
+			encoder.Reset(nil)
+			zstdEncoders.Put(encoder)
+		case *gzip.Writer:
+			encoder.Reset(io.Discard)
+			gzipWriters.Put(encoder)
+		}
+	case c.wroteHeader && !c.passthrough:
+		c.ResponseWriter.WriteHeader(c.status)
+		_, _ = c.ResponseWriter.Write(c.buf.Bytes())
+	}
+}
+
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mediaType == "text/event-stream":
+		// events are flushed one by one and must not wait in the encoder
+		return false
+	case strings.HasPrefix(mediaType, "text/"), strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	return compressibleTypes[mediaType] || codecFor(mediaType) != nil
+}
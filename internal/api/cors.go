@@ -1,19 +1,167 @@
 package api
 
-import "net/http"
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nightmaker00/go-tasks-api/internal/config"
+)
+
+// RouteMatcher is implemented by *http.ServeMux and lets preflights
+// be answered only for paths the API actually serves
+type RouteMatcher interface {
+	Handler(r *http.Request) (http.Handler, string)
+}
+
+// WithCORS adds CORS headers for browser clients according to cfg.
+// routes may be nil, then preflights are answered for any path.
+// With cfg.AllowCredentials only the listed origins are allowed, "*" is ignored,
+// config.Validate rejects that combination before it gets here.
+func WithCORS(cfg config.CORS, routes RouteMatcher, next http.Handler) http.Handler {
+	origins := cfg.AllowedOrigins
+	if cfg.AllowCredentials {
+		origins = withoutWildcard(origins)
+	}
+	anyOrigin := allowsAnyOrigin(origins)
+	allowMethods := strings.Join(cfg.AllowedMethods, ", ")
+	allowHeaders := strings.Join(cfg.AllowedHeaders, ", ")
+	exposeHeaders := strings.Join(cfg.ExposedHeaders, ", ")
 
-// withCORS adds CORS headers for browser clients
-func WithCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
 
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
+		header := w.Header()
+		header.Add("Vary", "Origin")
+
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if !originAllowed(origins, origin) {
+			if preflight {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		if !anyOrigin {
+			header.Set("Access-Control-Allow-Origin", origin)
+		} else {
+			header.Set("Access-Control-Allow-Origin", "*")
+		}
+		if cfg.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if exposeHeaders != "" {
+				header.Set("Access-Control-Expose-Headers", exposeHeaders)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		method := r.Header.Get("Access-Control-Request-Method")
+		if !methodAllowed(cfg.AllowedMethods, method) || !headersAllowed(cfg.AllowedHeaders, r.Header.Get("Access-Control-Request-Headers")) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if routes != nil && !routeExists(routes, r, method) {
+			writeError(w, http.StatusNotFound, codeNotFound, "not found")
+			return
+		}
+
+		header.Set("Access-Control-Allow-Methods", allowMethods)
+		if allowHeaders != "" {
+			header.Set("Access-Control-Allow-Headers", allowHeaders)
+		}
+		if cfg.MaxAgeSeconds > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAgeSeconds))
+		}
+		w.WriteHeader(http.StatusNoContent)
 	})
 }
+
+func routeExists(routes RouteMatcher, r *http.Request, method string) bool {
+	probe := r.Clone(r.Context())
+	probe.Method = method
+	_, pattern := routes.Handler(probe)
+	return pattern != ""
+}
+
+func allowsAnyOrigin(origins []string) bool {
+	for _, allowed := range origins {
+		if allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutWildcard(origins []string) []string {
+	listed := make([]string, 0, len(origins))
+	for _, allowed := range origins {
+		if allowed != "*" {
+			listed = append(listed, allowed)
+		}
+	}
+	return listed
+}
+
+func originAllowed(origins []string, origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range origins {
+		allowed = strings.ToLower(allowed)
+		switch {
+		case allowed == "*", allowed == origin:
+			return true
+		case strings.Contains(allowed, "://*."):
+			// https://*.example.com matches any subdomain but not the apex
+			scheme, host, _ := strings.Cut(allowed, "://*.")
+			prefix := scheme + "://"
+			if strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, "."+host) &&
+				len(origin) > len(prefix)+len(host)+1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func methodAllowed(methods []string, method string) bool {
+	for _, allowed := range methods {
+		if strings.EqualFold(allowed, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func headersAllowed(headers []string, requested string) bool {
+	for _, name := range strings.Split(requested, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, allowed := range headers {
+			if allowed == "*" || strings.EqualFold(allowed, name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
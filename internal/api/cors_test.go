@@ -0,0 +1,201 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nightmaker00/go-tasks-api/internal/config"
+)
+
+func TestWithCORS(t *testing.T) {
+	base := config.CORS{
+		AllowedOrigins: []string{"https://app.example.com", "https://*.example.org"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Content-Type", "X-API-Key"},
+		ExposedHeaders: []string{"ETag"},
+		MaxAgeSeconds:  600,
+	}
+	anyOrigin := base
+	anyOrigin.AllowedOrigins = []string{"*"}
+	credentials := base
+	credentials.AllowCredentials = true
+	// rejected by config.Validate, the middleware must still not echo foreign origins
+	anyWithCredentials := anyOrigin
+	anyWithCredentials.AllowCredentials = true
+
+	tests := []struct {
+		name        string
+		cfg         config.CORS
+		method      string
+		path        string
+		headers     map[string]string
+		status      int
+		allowOrigin string
+		credentials bool
+	}{
+		{
+			name:   "no origin",
+			cfg:    base,
+			method: http.MethodGet,
+			path:   "/tasks",
+			status: http.StatusOK,
+		},
+		{
+			name:        "listed origin",
+			cfg:         base,
+			method:      http.MethodGet,
+			path:        "/tasks",
+			headers:     map[string]string{"Origin": "https://app.example.com"},
+			status:      http.StatusOK,
+			allowOrigin: "https://app.example.com",
+		},
+		{
+			name:    "unlisted origin",
+			cfg:     base,
+			method:  http.MethodGet,
+			path:    "/tasks",
+			headers: map[string]string{"Origin": "https://evil.test"},
+			status:  http.StatusOK,
+		},
+		{
+			name:        "subdomain mask",
+			cfg:         base,
+			method:      http.MethodGet,
+			path:        "/tasks",
+			headers:     map[string]string{"Origin": "https://a.example.org"},
+			status:      http.StatusOK,
+			allowOrigin: "https://a.example.org",
+		},
+		{
+			name:    "subdomain mask does not match apex",
+			cfg:     base,
+			method:  http.MethodGet,
+			path:    "/tasks",
+			headers: map[string]string{"Origin": "https://example.org"},
+			status:  http.StatusOK,
+		},
+		{
+			name:        "any origin without credentials",
+			cfg:         anyOrigin,
+			method:      http.MethodGet,
+			path:        "/tasks",
+			headers:     map[string]string{"Origin": "https://evil.test"},
+			status:      http.StatusOK,
+			allowOrigin: "*",
+		},
+		{
+			name:        "credentials echo listed origin",
+			cfg:         credentials,
+			method:      http.MethodGet,
+			path:        "/tasks",
+			headers:     map[string]string{"Origin": "https://app.example.com"},
+			status:      http.StatusOK,
+			allowOrigin: "https://app.example.com",
+			credentials: true,
+		},
+		{
+			name:    "credentials ignore wildcard",
+			cfg:     anyWithCredentials,
+			method:  http.MethodGet,
+			path:    "/tasks",
+			headers: map[string]string{"Origin": "https://evil.test"},
+			status:  http.StatusOK,
+		},
+		{
+			name:   "preflight",
+			cfg:    base,
+			method: http.MethodOptions,
+			path:   "/tasks",
+			headers: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "content-type",
+			},
+			status:      http.StatusNoContent,
+			allowOrigin: "https://app.example.com",
+		},
+		{
+			name:   "preflight with method not allowed",
+			cfg:    base,
+			method: http.MethodOptions,
+			path:   "/tasks",
+			headers: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "DELETE",
+			},
+			status:      http.StatusForbidden,
+			allowOrigin: "https://app.example.com",
+		},
+		{
+			name:   "preflight with header not allowed",
+			cfg:    base,
+			method: http.MethodOptions,
+			path:   "/tasks",
+			headers: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "X-Other",
+			},
+			status:      http.StatusForbidden,
+			allowOrigin: "https://app.example.com",
+		},
+		{
+			name:   "preflight from unlisted origin",
+			cfg:    base,
+			method: http.MethodOptions,
+			path:   "/tasks",
+			headers: map[string]string{
+				"Origin":                        "https://evil.test",
+				"Access-Control-Request-Method": "GET",
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "preflight for unknown route",
+			cfg:    base,
+			method: http.MethodOptions,
+			path:   "/nothing",
+			headers: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "GET",
+			},
+			status:      http.StatusNotFound,
+			allowOrigin: "https://app.example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /tasks", func(w http.ResponseWriter, r *http.Request) {})
+			mux.HandleFunc("POST /tasks", func(w http.ResponseWriter, r *http.Request) {})
+			handler := WithCORS(tt.cfg, mux, mux)
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.allowOrigin)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tt.credentials {
+				t.Errorf("Access-Control-Allow-Credentials = %v, want %v", got, tt.credentials)
+			}
+			if tt.status == http.StatusNoContent {
+				if got := rec.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST" {
+					t.Errorf("Access-Control-Allow-Methods = %q", got)
+				}
+				if got := rec.Header().Get("Access-Control-Max-Age"); got != "600" {
+					t.Errorf("Access-Control-Max-Age = %q", got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	"github.com/nightmaker00/go-tasks-api/internal/service"
+)
+
+const problemContentType = "application/problem+json"
+
+// stable error codes, clients should branch on these instead of messages
+const (
+	codeValidation            = "validation_failed"
+	codeInvalidJSON           = "invalid_json"
+	codeInvalidBody           = "invalid_body"
+	codeInvalidID             = "invalid_id"
+	codeNotFound              = "not_found"
+	codeTaskExists            = "task_exists"
+	codePreconditionFailed    = "precondition_failed"
+	codeBatchAborted          = "batch_aborted"
+	codePayloadTooLarge       = "payload_too_large"
+	codeUnsupportedMediaType  = "unsupported_media_type"
+	codeNotAcceptable         = "not_acceptable"
+	codeInvalidIdempotencyKey = "invalid_idempotency_key"
+	codeIdempotencyKeyReused  = "idempotency_key_reused"
+	codeIdempotencyInProgress = "idempotency_in_progress"
+	codeUnsupportedReport     = "unsupported_report"
+	codeWebSocketHandshake    = "websocket_handshake"
+	codeOriginNotAllowed      = "origin_not_allowed"
+	codeInvalidMessage        = "invalid_message"
+	codeSubscriptionExists    = "subscription_exists"
+	codeSubscriptionNotFound  = "subscription_not_found"
+	codeTooManySubscriptions  = "too_many_subscriptions"
+	codeChangeTokenExpired    = "change_token_expired"
+	codeClientTooSlow         = "client_too_slow"
+	codeQueryTooComplex       = "query_too_complex"
+	codeMethodNotAllowed      = "method_not_allowed"
+	codeUnauthorized          = "unauthorized"
+	codeInternal              = "internal_error"
+)
+
+// problemType builds the RFC 9457 type URI for a code
+func problemType(code string) string {
+	return "urn:tasks-api:problem:" + code
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeProblem(w, domain.Problem{Status: status, Code: code, Detail: message})
+}
+
+func writeValidationError(w http.ResponseWriter, fields []domain.FieldError) {
+	writeProblem(w, domain.Problem{
+		Status: http.StatusBadRequest,
+		Code:   codeValidation,
+		Detail: "invalid request",
+		Errors: fields,
+	})
+}
+
+func writeProblem(w http.ResponseWriter, problem domain.Problem) {
+	problem.Type = problemType(problem.Code)
+	problem.Title = http.StatusText(problem.Status)
+	problem.RequestID = w.Header().Get(requestIDHeader)
+	problem.Error = problem.Detail
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(problem.Status)
+	_ = json.NewEncoder(w).Encode(problem)
+}
+
+func handleServiceError(w http.ResponseWriter, err error) {
+	status, code, message := serviceErrorStatus(err)
+	writeProblem(w, domain.Problem{Status: status, Code: code, Detail: message, Errors: fieldErrors(err)})
+}
+
+func serviceErrorStatus(err error) (int, string, string) {
+	var validation *service.ValidationError
+	switch {
+	case errors.Is(err, service.ErrTaskNotFound):
+		return http.StatusNotFound, codeNotFound, "task not found"
+	case errors.Is(err, service.ErrWebhookNotFound):
+		return http.StatusNotFound, codeNotFound, "webhook not found"
+	case errors.Is(err, service.ErrDeliveryNotFound):
+		return http.StatusNotFound, codeNotFound, "webhook delivery not found"
+	case errors.Is(err, service.ErrTaskExists):
+		return http.StatusConflict, codeTaskExists, "task already exists"
+	case errors.Is(err, service.ErrTaskModified):
+		return http.StatusPreconditionFailed, codePreconditionFailed, "task was modified"
+	case errors.Is(err, service.ErrChangeTokenExpired):
+		return http.StatusGone, codeChangeTokenExpired, "change token expired, sync again from scratch"
+	case errors.Is(err, service.ErrBatchAborted):
+		return http.StatusFailedDependency, codeBatchAborted, "batch aborted"
+	case errors.As(err, &validation),
+		errors.Is(err, service.ErrInvalidTitle),
+		errors.Is(err, service.ErrInvalidStatus),
+		errors.Is(err, service.ErrInvalidLimit),
+		errors.Is(err, service.ErrInvalidOffset),
+		errors.Is(err, service.ErrInvalidID),
+		errors.Is(err, service.ErrInvalidBatch),
+		errors.Is(err, service.ErrInvalidOp):
+		return http.StatusBadRequest, codeValidation, "invalid request"
+	default:
+		return http.StatusInternalServerError, codeInternal, "internal error"
+	}
+}
+
+func fieldErrors(err error) []domain.FieldError {
+	var validation *service.ValidationError
+	if errors.As(err, &validation) {
+		return validation.Fields
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	"github.com/nightmaker00/go-tasks-api/internal/todotxt"
+)
+
+const (
+	eventStreamContentType = "text/event-stream"
+	// eventsReplayPage is how many logged events are read at once while catching up
+	eventsReplayPage = 500
+	// eventsRetry is the reconnection delay suggested to clients, in milliseconds
+	eventsRetry = 3000
+)
+
+// eventFilter selects the events a stream sends, empty fields match everything
+type eventFilter struct {
+	status  domain.TaskStatus
+	project string
+	taskID  uuid.UUID
+}
+
+// match checks the task as the event carries it: the new state, or the last one for a deletion
+func (f eventFilter) match(event domain.TaskEvent) bool {
+	if f.status != "" && event.Task.Status != f.status {
+		return false
+	}
+	if f.taskID != uuid.Nil && event.TaskID != f.taskID {
+		return false
+	}
+	if f.project != "" && !todotxt.HasProject(event.Task.Title, f.project) {
+		return false
+	}
+	return true
+}
+
+// TaskEvents передаёт изменения задач через Server-Sent Events
+func (h *Handler) TaskEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var fields []domain.FieldError
+	filter := eventFilter{
+		status:  domain.TaskStatus(strings.TrimSpace(query.Get("status"))),
+		project: strings.TrimPrefix(strings.TrimSpace(query.Get("project")), "+"),
+	}
+	switch filter.status {
+	case "", domain.TaskStatusNew, domain.TaskStatusInProgress, domain.TaskStatusDone:
+	default:
+		fields = append(fields, domain.FieldError{Field: "status", Code: "invalid_enum", Message: "invalid status"})
+	}
+	if raw := strings.TrimSpace(query.Get("task_id")); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			fields = append(fields, domain.FieldError{Field: "task_id", Code: "invalid_uuid", Message: "invalid task_id"})
+		}
+		filter.taskID = id
+	}
+	lastID, resume, err := lastEventID(r)
+	if err != nil {
+		fields = append(fields, domain.FieldError{Field: "last_event_id", Code: "invalid_integer", Message: "invalid last event id"})
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, fields)
+		return
+	}
+
+	// subscribe before reading the log, so nothing committed meanwhile is missed
+	sub := h.events.Subscribe()
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	header := w.Header()
+	header.Set("Content-Type", eventStreamContentType)
+	header.Set("Cache-Control", "no-store")
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	// the stream lives longer than Server.WriteTimeout allows
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	out := &eventStream{w: bufio.NewWriter(w), rc: rc}
+	fmt.Fprintf(out.w, "retry: %d\n\n", eventsRetry)
+	if err := out.flush(); err != nil {
+		return
+	}
+
+	// live events up to the last replayed one were already sent from the log
+	var replayed int64
+	if resume {
+		replayed, err = h.replayEvents(r.Context(), lastID, func(event domain.TaskEvent) error {
+			if filter.match(event) {
+				out.event(event)
+			}
+			return nil
+		}, out.flush)
+		if err != nil {
+			// a failed write means the client is gone, only a failed read is worth logging
+			if r.Context().Err() == nil {
+				log.Printf("replay task events (request %s): %v", RequestID(r.Context()), err)
+			}
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(time.Duration(h.cfg.EventsHeartbeatSeconds) * time.Second)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			out.w.WriteString(": ping\n\n")
+		case event, ok := <-sub.Events():
+			// closed on shutdown or when the client fell behind, it reconnects with Last-Event-ID
+			if !ok {
+				return
+			}
+			if event.ID <= replayed || !filter.match(event) {
+				continue
+			}
+			out.event(event)
+		}
+		if err := out.flush(); err != nil {
+			return
+		}
+	}
+}
+
+// replayEvents passes the logged events after afterID to fn page by page, calling
+// flush after each page, and returns the id of the last event it read
+func (h *Handler) replayEvents(ctx context.Context, afterID int64, fn func(event domain.TaskEvent) error, flush func() error) (int64, error) {
+	for {
+		events, err := h.taskService.EventsAfter(ctx, afterID, eventsReplayPage)
+		if err != nil {
+			return afterID, err
+		}
+		for _, event := range events {
+			afterID = event.ID
+			if err := fn(event); err != nil {
+				return afterID, err
+			}
+		}
+		if err := flush(); err != nil {
+			return afterID, err
+		}
+		if len(events) < eventsReplayPage {
+			return afterID, nil
+		}
+	}
+}
+
+// lastEventID reads the id to resume after from the Last-Event-ID header, which browsers
+// send on reconnect, or from the last_event_id parameter
+func lastEventID(r *http.Request) (int64, bool, error) {
+	raw := strings.TrimSpace(r.Header.Get("Last-Event-ID"))
+	if raw == "" {
+		raw = strings.TrimSpace(r.URL.Query().Get("last_event_id"))
+	}
+	if raw == "" {
+		return 0, false, nil
+	}
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id < 0 {
+		return 0, false, fmt.Errorf("invalid last event id %q", raw)
+	}
+	return id, true, nil
+}
+
+type eventStream struct {
+	w  *bufio.Writer
+	rc *http.ResponseController
+}
+
+func (s *eventStream) event(event domain.TaskEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("encode task event %d: %v", event.ID, err)
+		return
+	}
+	fmt.Fprintf(s.w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
+
+func (s *eventStream) flush() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
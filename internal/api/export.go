@@ -0,0 +1,204 @@
+package api
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	"github.com/nightmaker00/go-tasks-api/internal/todotxt"
+)
+
+const (
+	// exportFlushRows is how many rows are buffered before they are flushed to the client
+	exportFlushRows = 500
+	// exportWriteTimeout is extended on every flush so long exports outlive Server.WriteTimeout
+	exportWriteTimeout = 30 * time.Second
+)
+
+type exportFormat struct {
+	contentType string
+	extension   string
+}
+
+// exportFormats maps the format query parameter to the response content type and file extension
+var exportFormats = map[string]exportFormat{
+	"csv":     {contentType: "text/csv; charset=utf-8", extension: "csv"},
+	"ndjson":  {contentType: "application/x-ndjson", extension: "ndjson"},
+	"json":    {contentType: "application/json", extension: "json"},
+	"todotxt": {contentType: todoTxtContentType, extension: "txt"},
+}
+
+var exportCSVHeader = []string{"id", "title", "description", "status", "created_at", "updated_at"}
+
+// ExportTasks выгружает все задачи
+func (h *Handler) ExportTasks(w http.ResponseWriter, r *http.Request) {
+	format := strings.TrimSpace(r.URL.Query().Get("format"))
+	if format == "" {
+		format = "json"
+	}
+	spec, ok := exportFormats[format]
+	if !ok {
+		writeValidationError(w, []domain.FieldError{{Field: "format", Code: "invalid_enum", Message: "format must be one of csv, ndjson, json, todotxt"}})
+		return
+	}
+	status := strings.TrimSpace(r.URL.Query().Get("status"))
+
+	out := &exportWriter{w: w, rc: http.NewResponseController(w), format: format, spec: spec}
+	err := h.taskService.Export(r.Context(), status, out.write)
+	if err != nil && !out.started {
+		handleServiceError(w, err)
+		return
+	}
+	if err == nil {
+		err = out.finish()
+	}
+	if err != nil {
+		// the status line is already sent, the truncated body is all the client gets
+		log.Printf("export tasks (request %s): %v", RequestID(r.Context()), err)
+	}
+}
+
+// exportWriter sends the response headers with the first task, so errors that
+// happen before any row is read still get a proper problem response
+type exportWriter struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	format  string
+	spec    exportFormat
+	started bool
+	rows    int
+	buf     *bufio.Writer
+	csv     *csv.Writer
+}
+
+func (e *exportWriter) start() error {
+	e.started = true
+	header := e.w.Header()
+	header.Set("Content-Type", e.spec.contentType)
+	header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="tasks-%s.%s"`,
+		time.Now().UTC().Format("20060102T150405Z"), e.spec.extension))
+	header.Set("Cache-Control", "no-store")
+	e.w.WriteHeader(http.StatusOK)
+	_ = e.rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+
+	e.buf = bufio.NewWriter(e.w)
+	switch e.format {
+	case "csv":
+		e.csv = csv.NewWriter(e.buf)
+		return e.csv.Write(exportCSVHeader)
+	case "json":
+		_, err := e.buf.WriteString("[")
+		return err
+	}
+	return nil
+}
+
+func (e *exportWriter) write(task domain.Task) error {
+	if !e.started {
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	switch e.format {
+	case "csv":
+		err = e.csv.Write([]string{
+			task.ID.String(),
+			csvCell(task.Title),
+			csvCell(task.Description),
+			string(task.Status),
+			task.CreatedAt.UTC().Format(time.RFC3339Nano),
+			task.UpdatedAt.UTC().Format(time.RFC3339Nano),
+		})
+	case "ndjson":
+		err = e.writeJSON(task, "", "\n")
+	case "todotxt":
+		e.buf.WriteString(todotxt.Format(task))
+		err = e.buf.WriteByte('\n')
+	case "json":
+		separator := ",\n"
+		if e.rows == 0 {
+			separator = "\n"
+		}
+		err = e.writeJSON(task, separator, "")
+	}
+	if err != nil {
+		return err
+	}
+
+	e.rows++
+	if e.rows%exportFlushRows == 0 {
+		return e.flush()
+	}
+	return nil
+}
+
+// csvFormulaPrefixes start a cell that spreadsheets evaluate as a formula
+const csvFormulaPrefixes = "=+-@\t\r"
+
+// csvCell quotes a cell a spreadsheet would run as a formula with a leading '.
+// A value that already starts with quotes before such a character gets one more,
+// so csvValue can strip exactly one on import.
+func csvCell(value string) string {
+	if isCSVFormula(value) {
+		return "'" + value
+	}
+	return value
+}
+
+func isCSVFormula(value string) bool {
+	value = strings.TrimLeft(value, "'")
+	return value != "" && strings.IndexByte(csvFormulaPrefixes, value[0]) >= 0
+}
+
+func (e *exportWriter) writeJSON(task domain.Task, before, after string) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	e.buf.WriteString(before)
+	e.buf.Write(data)
+	_, err = e.buf.WriteString(after)
+	return err
+}
+
+// finish closes the document, an export without tasks is still a valid file
+func (e *exportWriter) finish() error {
+	if !e.started {
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+	if e.format == "json" {
+		if e.rows > 0 {
+			e.buf.WriteString("\n")
+		}
+		e.buf.WriteString("]\n")
+	}
+	return e.flush()
+}
+
+func (e *exportWriter) flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if err := e.buf.Flush(); err != nil {
+		return err
+	}
+	if err := e.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	_ = e.rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+	return nil
+}
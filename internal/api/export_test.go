@@ -0,0 +1,140 @@
+package api
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+func TestExportCSVEscapesFormulas(t *testing.T) {
+	tests := []struct {
+		value string
+		cell  string
+	}{
+		{value: "=HYPERLINK(\"http://evil\")", cell: "'=HYPERLINK(\"http://evil\")"},
+		{value: "+1", cell: "'+1"},
+		{value: "-2+3", cell: "'-2+3"},
+		{value: "@SUM(A1)", cell: "'@SUM(A1)"},
+		{value: "\tcmd", cell: "'\tcmd"},
+		{value: "'=already quoted", cell: "''=already quoted"},
+		{value: "plain", cell: "plain"},
+		{value: "'quoted", cell: "'quoted"},
+		{value: "a=b", cell: "a=b"},
+	}
+
+	api := newTestAPI(t, nil)
+	now := time.Now().UTC().Truncate(time.Second)
+	for i, tt := range tests {
+		api.repo.Put(domain.Task{
+			ID: uuid.New(), Title: tt.value, Description: tt.value, Status: domain.TaskStatusNew,
+			CreatedAt: now.Add(time.Duration(i) * time.Second), UpdatedAt: now,
+		})
+	}
+
+	rec := api.do(t, http.MethodGet, "/tasks/export?format=csv", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	exported := rec.Body.String()
+	rows, err := csv.NewReader(strings.NewReader(exported)).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	cells := make(map[string]bool, len(rows))
+	for _, row := range rows[1:] {
+		if row[1] != row[2] {
+			t.Errorf("title %q and description %q are escaped differently", row[1], row[2])
+		}
+		cells[row[1]] = true
+	}
+	for _, tt := range tests {
+		if !cells[tt.cell] {
+			t.Errorf("%q: no cell %q in the export", tt.value, tt.cell)
+		}
+	}
+
+	// the import takes the quotes off again
+	records, err := parseImportCSV(strings.NewReader(exported), mustImportMapping(t, ""))
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	imported := make(map[string]bool, len(records))
+	for _, record := range records {
+		if record.Title != record.Description {
+			t.Errorf("imported title %q and description %q differ", record.Title, record.Description)
+		}
+		imported[record.Title] = true
+	}
+	for _, tt := range tests {
+		if !imported[tt.value] {
+			t.Errorf("%q did not survive export and import", tt.value)
+		}
+	}
+}
+
+// flushRecorder counts the flushes that reach the client and the rows sent before each
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushedAt []int
+}
+
+func (f *flushRecorder) Flush() {
+	f.flushedAt = append(f.flushedAt, strings.Count(f.Body.String(), "\n"))
+	f.ResponseRecorder.Flush()
+}
+
+func TestExportStreamsLargeExports(t *testing.T) {
+	api := newTestAPI(t, nil)
+	total := 2*exportFlushRows + 7
+	now := time.Now().UTC().Truncate(time.Second)
+	for i := 0; i < total; i++ {
+		api.repo.Put(domain.Task{
+			ID: uuid.New(), Title: "task", Status: domain.TaskStatusNew,
+			CreatedAt: now.Add(time.Duration(i) * time.Millisecond), UpdatedAt: now,
+		})
+	}
+
+	for _, format := range []string{"csv", "ndjson", "json", "todotxt"} {
+		t.Run(format, func(t *testing.T) {
+			rec := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+			api.handler.ExportTasks(rec, httptest.NewRequest(http.MethodGet, "/tasks/export?format="+format, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			// rows go out every exportFlushRows and once more at the end
+			if len(rec.flushedAt) != 3 {
+				t.Fatalf("flushed %d times, want 3", len(rec.flushedAt))
+			}
+			if rec.flushedAt[0] >= rec.flushedAt[1] || rec.flushedAt[1] >= rec.flushedAt[2] {
+				t.Errorf("lines at each flush = %v, want them to grow", rec.flushedAt)
+			}
+
+			lines := strings.Count(rec.Body.String(), "\n")
+			want := total
+			switch format {
+			case "csv":
+				want++ // header
+			case "json":
+				want += 2 // brackets
+			}
+			if lines != want {
+				t.Errorf("exported %d lines, want %d", lines, want)
+			}
+		})
+	}
+}
+
+func mustImportMapping(t *testing.T, raw string) map[string]string {
+	t.Helper()
+	mapping, err := parseImportMapping(raw)
+	if err != nil {
+		t.Fatalf("mapping %q: %v", raw, err)
+	}
+	return mapping
+}
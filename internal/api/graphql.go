@@ -0,0 +1,184 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// graphQLRequest is the body of POST /graphql, GET takes the same fields as query parameters
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// graphQLOperation is a request that parsed, validated and passed the limits
+type graphQLOperation struct {
+	doc  *ast.Document
+	kind string
+	req  graphQLRequest
+}
+
+// registerGraphQL builds the schema and serves it. GraphQL describes itself through
+// introspection, so like CalDAV it stays out of the route table.
+func (h *Handler) registerGraphQL(mux *http.ServeMux) {
+	schema, err := h.graphQLSchema()
+	if err != nil {
+		panic(fmt.Sprintf("build graphql schema: %v", err))
+	}
+	h.graphQL = schema
+	mux.HandleFunc("GET /graphql", h.GraphQL)
+	mux.HandleFunc("POST /graphql", h.GraphQL)
+}
+
+// GraphQL serves queries and mutations over HTTP and every operation, subscriptions
+// included, over WebSocket with the graphql-transport-ws protocol. Errors of the request
+// itself, such as a syntax error or a query over the limits, are answered with 400;
+// errors of single fields come with 200 next to the data that could be resolved.
+func (h *Handler) GraphQL(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && websocket.IsWebSocketUpgrade(r) {
+		h.graphQLWebSocket(w, r)
+		return
+	}
+
+	var req graphQLRequest
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		req.Query = query.Get("query")
+		req.OperationName = query.Get("operationName")
+		if raw := query.Get("variables"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &req.Variables); err != nil {
+				writeError(w, http.StatusBadRequest, codeInvalidJSON, "invalid variables")
+				return
+			}
+		}
+	} else {
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != "application/json" {
+			writeError(w, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, "content type must be application/json")
+			return
+		}
+		if !h.decodeJSON(w, r, &req) {
+			return
+		}
+	}
+
+	op, errs := h.prepareGraphQL(req)
+	if errs != nil {
+		writeJSON(w, http.StatusBadRequest, &graphql.Result{Errors: errs})
+		return
+	}
+	switch {
+	case op.kind == ast.OperationTypeSubscription:
+		writeJSON(w, http.StatusBadRequest, &graphql.Result{Errors: (&graphQLError{
+			message: "subscriptions are served over websocket",
+			code:    codeInvalidMessage,
+			status:  http.StatusBadRequest,
+		}).formatted()})
+		return
+	case op.kind == ast.OperationTypeMutation && r.Method == http.MethodGet:
+		// a GET must not change anything, it may be sent by a prefetching browser
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, &graphql.Result{Errors: (&graphQLError{
+			message: "mutations must be sent with POST",
+			code:    codeMethodNotAllowed,
+			status:  http.StatusMethodNotAllowed,
+		}).formatted()})
+		return
+	}
+	writeJSON(w, http.StatusOK, h.executeGraphQL(r.Context(), op))
+}
+
+// prepareGraphQL parses and validates the request and checks it against the depth and
+// complexity limits
+func (h *Handler) prepareGraphQL(req graphQLRequest) (*graphQLOperation, []gqlerrors.FormattedError) {
+	if strings.TrimSpace(req.Query) == "" {
+		return nil, (&graphQLError{message: "query is required", code: codeValidation, status: http.StatusBadRequest}).formatted()
+	}
+	doc, err := parser.Parse(parser.ParseParams{Source: req.Query})
+	if err != nil {
+		return nil, gqlerrors.FormatErrors(err)
+	}
+	if validation := graphql.ValidateDocument(&h.graphQL, doc, nil); !validation.IsValid {
+		return nil, validation.Errors
+	}
+
+	var op *ast.OperationDefinition
+	var count int
+	for _, definition := range doc.Definitions {
+		candidate, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		count++
+		if req.OperationName == "" || (candidate.Name != nil && candidate.Name.Value == req.OperationName) {
+			op = candidate
+		}
+	}
+	switch {
+	case req.OperationName == "" && count > 1:
+		return nil, (&graphQLError{
+			message: "operationName is required for a document with several operations",
+			code:    codeValidation,
+			status:  http.StatusBadRequest,
+		}).formatted()
+	case op == nil:
+		return nil, (&graphQLError{
+			message: fmt.Sprintf("unknown operation %q", req.OperationName),
+			code:    codeValidation,
+			status:  http.StatusBadRequest,
+		}).formatted()
+	}
+
+	if err := checkGraphQLLimits(doc, op, req.Variables, h.cfg.GraphQLMaxDepth, h.cfg.GraphQLMaxComplexity); err != nil {
+		return nil, err.formatted()
+	}
+	return &graphQLOperation{doc: doc, kind: op.Operation, req: req}, nil
+}
+
+func (h *Handler) executeGraphQL(ctx context.Context, op *graphQLOperation) *graphql.Result {
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        h.graphQL,
+		AST:           op.doc,
+		OperationName: op.req.OperationName,
+		Args:          op.req.Variables,
+		Context:       h.withGraphQLLoaders(ctx),
+	})
+	restoreGraphQLExtensions(result)
+	return result
+}
+
+// restoreGraphQLExtensions puts back the extensions of errors returned by deferred
+// resolvers, the executor wraps those one level deeper than it looks for them
+func restoreGraphQLExtensions(result *graphql.Result) {
+	for i, formatted := range result.Errors {
+		if formatted.Extensions != nil {
+			continue
+		}
+		err := formatted.OriginalError()
+		for err != nil {
+			switch e := err.(type) {
+			case *graphQLError:
+				result.Errors[i].Extensions = e.Extensions()
+				err = nil
+			case *gqlerrors.Error:
+				err = e.OriginalError
+			case gqlerrors.FormattedError:
+				err = e.OriginalError()
+			default:
+				err = nil
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// graphQLListSizes are the lengths assumed for list fields queried without a limit
+var graphQLListSizes = map[string]int{
+	"tasks":   100,
+	"history": graphQLDefaultHistory,
+}
+
+// graphQLCostCap keeps the running complexity from overflowing, anything above a limit is rejected anyway
+const graphQLCostCap = 1 << 40
+
+// graphQLCost measures an operation before it runs. Every field costs 1 and the fields
+// below a list count once for every element the list may hold. Introspection fields are
+// free, their size is bounded by the schema.
+type graphQLCost struct {
+	fragments map[string]*ast.FragmentDefinition
+	defaults  map[string]ast.Value
+	variables map[string]interface{}
+}
+
+// checkGraphQLLimits rejects an operation that nests fields deeper than maxDepth or
+// whose complexity is above maxComplexity, a limit of 0 is not checked
+func checkGraphQLLimits(doc *ast.Document, op *ast.OperationDefinition, variables map[string]interface{}, maxDepth, maxComplexity int) *graphQLError {
+	cost := &graphQLCost{
+		fragments: make(map[string]*ast.FragmentDefinition),
+		defaults:  make(map[string]ast.Value),
+		variables: variables,
+	}
+	for _, definition := range doc.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			cost.fragments[fragment.Name.Value] = fragment
+		}
+	}
+	for _, variable := range op.VariableDefinitions {
+		if variable.DefaultValue != nil {
+			cost.defaults[variable.Variable.Name.Value] = variable.DefaultValue
+		}
+	}
+
+	complexity, depth := cost.selectionSet(op.SelectionSet, map[string]bool{})
+	if maxDepth > 0 && depth > maxDepth {
+		return &graphQLError{
+			message: fmt.Sprintf("query depth %d exceeds the limit of %d", depth, maxDepth),
+			code:    codeQueryTooComplex,
+			status:  http.StatusBadRequest,
+		}
+	}
+	if maxComplexity > 0 && complexity > maxComplexity {
+		return &graphQLError{
+			message: fmt.Sprintf("query complexity %d exceeds the limit of %d", complexity, maxComplexity),
+			code:    codeQueryTooComplex,
+			status:  http.StatusBadRequest,
+		}
+	}
+	return nil
+}
+
+// selectionSet returns the complexity of the selections and how deep their fields nest.
+// spread holds the fragments being expanded, validation has already ruled out cycles.
+func (c *graphQLCost) selectionSet(set *ast.SelectionSet, spread map[string]bool) (int, int) {
+	if set == nil {
+		return 0, 0
+	}
+	var complexity, depth int
+	for _, selection := range set.Selections {
+		var cost, nested int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(selection.Name.Value, "__") {
+				continue
+			}
+			cost, nested = c.selectionSet(selection.SelectionSet, spread)
+			cost = min(1+c.listSize(selection)*cost, graphQLCostCap)
+			nested++
+		case *ast.InlineFragment:
+			cost, nested = c.selectionSet(selection.SelectionSet, spread)
+		case *ast.FragmentSpread:
+			name := selection.Name.Value
+			fragment, ok := c.fragments[name]
+			if !ok || spread[name] {
+				continue
+			}
+			spread[name] = true
+			cost, nested = c.selectionSet(fragment.SelectionSet, spread)
+			delete(spread, name)
+		}
+		complexity = min(complexity+cost, graphQLCostCap)
+		depth = max(depth, nested)
+	}
+	return complexity, depth
+}
+
+// listSize is the limit argument of a list field, or the length assumed without one; 1 for other fields
+func (c *graphQLCost) listSize(field *ast.Field) int {
+	size, ok := graphQLListSizes[field.Name.Value]
+	if !ok {
+		return 1
+	}
+	for _, argument := range field.Arguments {
+		if argument.Name.Value != "limit" {
+			continue
+		}
+		if limit, ok := c.intValue(argument.Value); ok && limit > 0 {
+			size = limit
+		}
+	}
+	return size
+}
+
+func (c *graphQLCost) intValue(value ast.Value) (int, bool) {
+	switch value := value.(type) {
+	case *ast.IntValue:
+		n, err := strconv.Atoi(value.Value)
+		return n, err == nil
+	case *ast.Variable:
+		name := value.Name.Value
+		raw, ok := c.variables[name]
+		if !ok || raw == nil {
+			if fallback, ok := c.defaults[name]; ok {
+				return c.intValue(fallback)
+			}
+			return 0, false
+		}
+		switch raw := raw.(type) {
+		case float64:
+			return int(raw), true
+		case int:
+			return raw, true
+		case json.Number:
+			n, err := strconv.Atoi(raw.String())
+			return n, err == nil
+		}
+	}
+	return 0, false
+}
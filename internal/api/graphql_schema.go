@@ -0,0 +1,547 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/location"
+	"github.com/nightmaker00/go-tasks-api/internal/dataloader"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	"github.com/nightmaker00/go-tasks-api/internal/service"
+)
+
+const (
+	// graphQLDefaultHistory is how many events Task.history returns without a limit,
+	// graphQLMaxHistory is the most the service returns per task
+	graphQLDefaultHistory = 20
+	graphQLMaxHistory     = 100
+	// graphQLMaxBatch limits the ids passed to the service in one batched lookup
+	graphQLMaxBatch = 500
+)
+
+// graphQLTask is the source of a Task object. A list item only carries some fields,
+// the rest are loaded for all list items of a response at once.
+type graphQLTask struct {
+	item domain.TaskListItem
+	full *domain.Task
+}
+
+func fullGraphQLTask(task *domain.Task) graphQLTask {
+	return graphQLTask{item: domain.TaskListItem{ID: task.ID, Title: task.Title, Status: task.Status}, full: task}
+}
+
+type historyKey struct {
+	taskID uuid.UUID
+	limit  int
+}
+
+type graphQLLoadersKey struct{}
+
+// graphQLLoaders batch the lookups made while one result is resolved
+type graphQLLoaders struct {
+	tasks   *dataloader.Loader[uuid.UUID, *domain.Task]
+	history *dataloader.Loader[historyKey, []domain.TaskEvent]
+}
+
+func (h *Handler) newGraphQLLoaders() *graphQLLoaders {
+	return &graphQLLoaders{
+		tasks: dataloader.New(func(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*domain.Task, error) {
+			tasks, err := h.taskService.GetByIDs(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			found := make(map[uuid.UUID]*domain.Task, len(tasks))
+			for i := range tasks {
+				found[tasks[i].ID] = &tasks[i]
+			}
+			return found, nil
+		}, graphQLMaxBatch),
+		history: dataloader.New(func(ctx context.Context, keys []historyKey) (map[historyKey][]domain.TaskEvent, error) {
+			byLimit := make(map[int][]uuid.UUID)
+			for _, key := range keys {
+				byLimit[key.limit] = append(byLimit[key.limit], key.taskID)
+			}
+			found := make(map[historyKey][]domain.TaskEvent, len(keys))
+			for limit, ids := range byLimit {
+				events, err := h.taskService.History(ctx, ids, limit)
+				if err != nil {
+					return nil, err
+				}
+				for _, event := range events {
+					key := historyKey{taskID: event.TaskID, limit: limit}
+					found[key] = append(found[key], event)
+				}
+			}
+			return found, nil
+		}, graphQLMaxBatch),
+	}
+}
+
+func (h *Handler) withGraphQLLoaders(ctx context.Context) context.Context {
+	return context.WithValue(ctx, graphQLLoadersKey{}, h.newGraphQLLoaders())
+}
+
+func graphQLLoadersFrom(ctx context.Context) *graphQLLoaders {
+	return ctx.Value(graphQLLoadersKey{}).(*graphQLLoaders)
+}
+
+// graphQLError carries the code and status a service error has in the REST API
+type graphQLError struct {
+	message string
+	code    string
+	status  int
+	fields  []domain.FieldError
+}
+
+func (e *graphQLError) Error() string {
+	return e.message
+}
+
+// formatted reports an error of the request itself, outside of any field
+func (e *graphQLError) formatted() []gqlerrors.FormattedError {
+	return []gqlerrors.FormattedError{{
+		Message:    e.message,
+		Locations:  []location.SourceLocation{},
+		Extensions: e.Extensions(),
+	}}
+}
+
+func (e *graphQLError) Extensions() map[string]interface{} {
+	extensions := map[string]interface{}{"code": e.code, "status": e.status}
+	if len(e.fields) > 0 {
+		extensions["errors"] = e.fields
+	}
+	return extensions
+}
+
+// toGraphQLError maps a service error like handleServiceError does, internal errors are
+// logged and reported without details
+func toGraphQLError(ctx context.Context, err error) error {
+	status, code, message := serviceErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		log.Printf("graphql (request %s): %v", RequestID(ctx), err)
+	}
+	return &graphQLError{message: message, code: code, status: status, fields: fieldErrors(err)}
+}
+
+func graphQLInvalidID(field string) error {
+	return &graphQLError{
+		message: "invalid id",
+		code:    codeInvalidID,
+		status:  http.StatusBadRequest,
+		fields:  []domain.FieldError{{Field: field, Code: "invalid_uuid", Message: "invalid id"}},
+	}
+}
+
+func graphQLID(args map[string]interface{}, name string) (uuid.UUID, error) {
+	raw, _ := args[name].(string)
+	id, err := parseID(raw)
+	if err != nil || id == uuid.Nil {
+		return uuid.Nil, graphQLInvalidID(name)
+	}
+	return id, nil
+}
+
+// graphQLInput reads an optional string field of an input object
+func graphQLInput(input map[string]interface{}, name string) *string {
+	value, ok := input[name].(string)
+	if !ok {
+		return nil
+	}
+	return &value
+}
+
+// graphQLSchema builds the schema. It exposes what the task model has: comments,
+// subtasks and assignees do not exist, the nested data of a task is its change history.
+func (h *Handler) graphQLSchema() (graphql.Schema, error) {
+	statusType := graphql.NewEnum(graphql.EnumConfig{
+		Name: "TaskStatus",
+		Values: graphql.EnumValueConfigMap{
+			"NEW":         {Value: domain.TaskStatusNew},
+			"IN_PROGRESS": {Value: domain.TaskStatusInProgress},
+			"DONE":        {Value: domain.TaskStatusDone},
+		},
+	})
+	eventTypeType := graphql.NewEnum(graphql.EnumConfig{
+		Name: "TaskEventType",
+		Values: graphql.EnumValueConfigMap{
+			"CREATED": {Value: domain.TaskEventCreated},
+			"UPDATED": {Value: domain.TaskEventUpdated},
+			"DELETED": {Value: domain.TaskEventDeleted},
+		},
+	})
+
+	// fullField resolves a field only the full task has, loading it for list items
+	fullField := func(get func(task *domain.Task) interface{}) graphql.FieldResolveFn {
+		return func(p graphql.ResolveParams) (interface{}, error) {
+			source := p.Source.(graphQLTask)
+			if source.full != nil {
+				return get(source.full), nil
+			}
+			load := graphQLLoadersFrom(p.Context).tasks.Load(p.Context, source.item.ID)
+			return func() (interface{}, error) {
+				task, err := load()
+				if err != nil {
+					return nil, toGraphQLError(p.Context, err)
+				}
+				if task == nil {
+					// deleted since the list was read
+					return nil, toGraphQLError(p.Context, service.ErrTaskNotFound)
+				}
+				return get(task), nil
+			}, nil
+		}
+	}
+
+	taskType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Task",
+		Description: "A task. Its nested data is the change history, the task model has no comments, subtasks or assignees.",
+		Fields: graphql.Fields{
+			"id": {
+				Type: graphql.NewNonNull(graphql.ID),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(graphQLTask).item.ID.String(), nil
+				},
+			},
+			"title": {
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(graphQLTask).item.Title, nil
+				},
+			},
+			"status": {
+				Type: graphql.NewNonNull(statusType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(graphQLTask).item.Status, nil
+				},
+			},
+			"description": {
+				Type: graphql.String,
+				Resolve: fullField(func(task *domain.Task) interface{} {
+					if task.Description == "" {
+						return nil
+					}
+					return task.Description
+				}),
+			},
+			"createdAt": {
+				Type:    graphql.NewNonNull(graphql.DateTime),
+				Resolve: fullField(func(task *domain.Task) interface{} { return task.CreatedAt }),
+			},
+			"updatedAt": {
+				Type:    graphql.NewNonNull(graphql.DateTime),
+				Resolve: fullField(func(task *domain.Task) interface{} { return task.UpdatedAt }),
+			},
+		},
+	})
+
+	eventType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "TaskEvent",
+		Description: "A change of a task from the event log",
+		Fields: graphql.Fields{
+			"id": {
+				Type: graphql.NewNonNull(graphql.ID),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return strconv.FormatInt(p.Source.(domain.TaskEvent).ID, 10), nil
+				},
+			},
+			"type": {
+				Type: graphql.NewNonNull(eventTypeType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(domain.TaskEvent).Type, nil
+				},
+			},
+			"taskId": {
+				Type: graphql.NewNonNull(graphql.ID),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(domain.TaskEvent).TaskID.String(), nil
+				},
+			},
+			"seq": {
+				Type:        graphql.NewNonNull(graphql.Int),
+				Description: "Number of the event among the events of its task, from 1 without gaps",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(domain.TaskEvent).Seq, nil
+				},
+			},
+			"occurredAt": {
+				Type: graphql.NewNonNull(graphql.DateTime),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(domain.TaskEvent).OccurredAt, nil
+				},
+			},
+			"task": {
+				Type:        graphql.NewNonNull(taskType),
+				Description: "The task after the change, for a deletion the task before it",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					event := p.Source.(domain.TaskEvent)
+					return fullGraphQLTask(&event.Task), nil
+				},
+			},
+		},
+	})
+
+	taskType.AddFieldConfig("history", &graphql.Field{
+		Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(eventType))),
+		Description: "The newest events of the task, newest first. Events removed by retention are not returned.",
+		Args: graphql.FieldConfigArgument{
+			"limit": {Type: graphql.Int, DefaultValue: graphQLDefaultHistory},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			limit, _ := p.Args["limit"].(int)
+			if limit <= 0 || limit > graphQLMaxHistory {
+				return nil, &graphQLError{
+					message: "invalid request",
+					code:    codeValidation,
+					status:  http.StatusBadRequest,
+					fields:  []domain.FieldError{{Field: "limit", Code: "out_of_range", Message: "limit must be between 1 and 100"}},
+				}
+			}
+			key := historyKey{taskID: p.Source.(graphQLTask).item.ID, limit: limit}
+			load := graphQLLoadersFrom(p.Context).history.Load(p.Context, key)
+			return func() (interface{}, error) {
+				events, err := load()
+				if err != nil {
+					return nil, toGraphQLError(p.Context, err)
+				}
+				if events == nil {
+					events = []domain.TaskEvent{}
+				}
+				return events, nil
+			}, nil
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"task": {
+				Type:        taskType,
+				Description: "The task with the id, null when there is none",
+				Args: graphql.FieldConfigArgument{
+					"id": {Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := graphQLID(p.Args, "id")
+					if err != nil {
+						return nil, err
+					}
+					load := graphQLLoadersFrom(p.Context).tasks.Load(p.Context, id)
+					return func() (interface{}, error) {
+						task, err := load()
+						if err != nil {
+							return nil, toGraphQLError(p.Context, err)
+						}
+						if task == nil {
+							return nil, nil
+						}
+						return fullGraphQLTask(task), nil
+					}, nil
+				},
+			},
+			"tasks": {
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(taskType))),
+				Description: "Tasks ordered by id, like GET /tasks",
+				Args: graphql.FieldConfigArgument{
+					"status": {Type: statusType},
+					"limit":  {Type: graphql.Int, Description: "At most 1000, 100 by default"},
+					"offset": {Type: graphql.Int},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					status, _ := p.Args["status"].(domain.TaskStatus)
+					limit, _ := p.Args["limit"].(int)
+					offset, _ := p.Args["offset"].(int)
+					items, err := h.taskService.List(p.Context, string(status), limit, offset)
+					if err != nil {
+						return nil, toGraphQLError(p.Context, err)
+					}
+					tasks := make([]graphQLTask, len(items))
+					for i, item := range items {
+						tasks[i] = graphQLTask{item: item}
+					}
+					return tasks, nil
+				},
+			},
+		},
+	})
+
+	createInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "CreateTaskInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"id":          {Type: graphql.ID, Description: "Client-chosen id, a task with this id must not exist"},
+			"title":       {Type: graphql.NewNonNull(graphql.String)},
+			"description": {Type: graphql.String},
+		},
+	})
+	updateInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "UpdateTaskInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"title":       {Type: graphql.NewNonNull(graphql.String)},
+			"description": {Type: graphql.String, Description: "Omitted or null clears the description"},
+			"status":      {Type: graphql.NewNonNull(statusType)},
+		},
+	})
+
+	// resultTask reads back a changed task for the mutation result and keeps it for the rest of the response
+	resultTask := func(ctx context.Context, id uuid.UUID) (interface{}, error) {
+		task, err := h.taskService.GetByID(ctx, id)
+		if err != nil {
+			return nil, toGraphQLError(ctx, err)
+		}
+		graphQLLoadersFrom(ctx).tasks.Prime(id, task)
+		return fullGraphQLTask(task), nil
+	}
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createTask": {
+				Type: graphql.NewNonNull(taskType),
+				Args: graphql.FieldConfigArgument{
+					"input": {Type: graphql.NewNonNull(createInput)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					input := p.Args["input"].(map[string]interface{})
+					id := uuid.Nil
+					if _, ok := input["id"]; ok {
+						var err error
+						if id, err = graphQLID(input, "id"); err != nil {
+							return nil, err
+						}
+					}
+					title, _ := input["title"].(string)
+					description, _ := input["description"].(string)
+					id, err := h.taskService.Create(p.Context, id, title, description)
+					if err != nil {
+						return nil, toGraphQLError(p.Context, err)
+					}
+					return resultTask(p.Context, id)
+				},
+			},
+			"updateTask": {
+				Type:        graphql.NewNonNull(taskType),
+				Description: "Replaces the title, description and status, like PUT /tasks/{id}",
+				Args: graphql.FieldConfigArgument{
+					"id":    {Type: graphql.NewNonNull(graphql.ID)},
+					"input": {Type: graphql.NewNonNull(updateInput)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := graphQLID(p.Args, "id")
+					if err != nil {
+						return nil, err
+					}
+					input := p.Args["input"].(map[string]interface{})
+					title, _ := input["title"].(string)
+					status, _ := input["status"].(domain.TaskStatus)
+					err = h.taskService.Update(p.Context, id, title, graphQLInput(input, "description"), string(status))
+					if err != nil {
+						return nil, toGraphQLError(p.Context, err)
+					}
+					return resultTask(p.Context, id)
+				},
+			},
+			"deleteTask": {
+				Type:        graphql.NewNonNull(graphql.ID),
+				Description: "Deletes the task and returns its id, deleting a missing task is not an error",
+				Args: graphql.FieldConfigArgument{
+					"id": {Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, err := graphQLID(p.Args, "id")
+					if err != nil {
+						return nil, err
+					}
+					if err := h.taskService.Delete(p.Context, id); err != nil {
+						return nil, toGraphQLError(p.Context, err)
+					}
+					return id.String(), nil
+				},
+			},
+		},
+	})
+
+	subscription := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Subscription",
+		Fields: graphql.Fields{
+			"taskChanged": {
+				Type:        graphql.NewNonNull(eventType),
+				Description: "Changes committed after the subscription started, narrowed by the task status, project or id",
+				Args: graphql.FieldConfigArgument{
+					"status":  {Type: statusType},
+					"project": {Type: graphql.String, Description: "A +project in the title"},
+					"taskId":  {Type: graphql.ID},
+				},
+				Subscribe: h.subscribeTaskChanged,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if err, ok := p.Source.(error); ok {
+						return nil, err
+					}
+					// every event is resolved on its own, without results cached for earlier ones
+					*graphQLLoadersFrom(p.Context) = *h.newGraphQLLoaders()
+					return p.Source, nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:        query,
+		Mutation:     mutation,
+		Subscription: subscription,
+	})
+}
+
+// subscribeTaskChanged feeds broker events that match the arguments to the subscription
+// until its context ends. A subscriber that falls behind gets an error as its last result.
+func (h *Handler) subscribeTaskChanged(p graphql.ResolveParams) (interface{}, error) {
+	var filter eventFilter
+	filter.status, _ = p.Args["status"].(domain.TaskStatus)
+	if project, ok := p.Args["project"].(string); ok {
+		filter.project = strings.TrimPrefix(strings.TrimSpace(project), "+")
+	}
+	if _, ok := p.Args["taskId"]; ok {
+		id, err := graphQLID(p.Args, "taskId")
+		if err != nil {
+			return nil, err
+		}
+		filter.taskID = id
+	}
+
+	sub := h.events.Subscribe()
+	out := make(chan interface{})
+	go func() {
+		defer close(out)
+		defer sub.Close()
+		for {
+			select {
+			case <-p.Context.Done():
+				return
+			case event, ok := <-sub.Events():
+				var payload interface{} = event
+				if !ok {
+					if !sub.Dropped() {
+						return
+					}
+					payload = &graphQLError{message: "client is too slow", code: codeClientTooSlow, status: http.StatusServiceUnavailable}
+				} else if !filter.match(event) {
+					continue
+				}
+				select {
+				case out <- payload:
+				case <-p.Context.Done():
+					return
+				}
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,380 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// graphQLSubprotocol is the protocol of the graphql-ws client library
+const graphQLSubprotocol = "graphql-transport-ws"
+
+// graphQLInitTimeout is how long a client has to send connection_init
+const graphQLInitTimeout = 10 * time.Second
+
+// graphql-transport-ws message types
+const (
+	gqlConnectionInit = "connection_init"
+	gqlConnectionAck  = "connection_ack"
+	gqlPing           = "ping"
+	gqlPong           = "pong"
+	gqlSubscribe      = "subscribe"
+	gqlNext           = "next"
+	gqlError          = "error"
+	gqlComplete       = "complete"
+)
+
+// graphql-transport-ws close codes
+const (
+	gqlCloseBadRequest      = 4400
+	gqlCloseUnauthorized    = 4401
+	gqlCloseInitTimeout     = 4408
+	gqlCloseSubscriberTaken = 4409
+	gqlCloseTooManyInits    = 4429
+)
+
+type graphQLClientMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type graphQLServerMessage struct {
+	ID      string      `json:"id,omitempty"`
+	Type    string      `json:"type"`
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+func (h *Handler) graphQLWebSocket(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{
+		Subprotocols: []string{graphQLSubprotocol},
+		CheckOrigin:  h.webSocketOriginAllowed,
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			if status == http.StatusForbidden {
+				writeError(w, status, codeOriginNotAllowed, "origin not allowed")
+				return
+			}
+			writeError(w, status, codeWebSocketHandshake, reason.Error())
+		},
+	}
+	if !slices.Contains(websocket.Subprotocols(r), graphQLSubprotocol) {
+		writeError(w, http.StatusBadRequest, codeWebSocketHandshake, "subprotocol "+graphQLSubprotocol+" is required")
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already answered the request
+		return
+	}
+
+	c := newGraphQLConn(h, conn, r.Context())
+	if !h.trackSocket(c) {
+		c.fail(websocket.CloseGoingAway, "server is shutting down")
+		c.run()
+		return
+	}
+	defer h.untrackSocket(c)
+	c.run()
+}
+
+// graphQLConn serves one graphql-transport-ws connection: the reader handles client
+// messages, every operation runs in its own goroutine and the writer owns the socket
+type graphQLConn struct {
+	h        *Handler
+	conn     *websocket.Conn
+	send     chan graphQLServerMessage
+	stop     chan struct{}
+	readDone chan struct{}
+	// ctx carries the values of the handshake request and ends the operations when the connection stops
+	ctx        context.Context
+	cancel     context.CancelFunc
+	operations sync.WaitGroup
+
+	mu        sync.Mutex
+	acked     bool
+	ops       map[string]*graphQLRunning
+	stopOnce  sync.Once
+	closeCode int
+	closeText string
+}
+
+// graphQLRunning is an operation in progress, a later one may reuse its id once it is completed
+type graphQLRunning struct {
+	cancel context.CancelFunc
+}
+
+func newGraphQLConn(h *Handler, conn *websocket.Conn, requestCtx context.Context) *graphQLConn {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(requestCtx))
+	return &graphQLConn{
+		h:        h,
+		conn:     conn,
+		send:     make(chan graphQLServerMessage, h.cfg.WebSocketBuffer),
+		stop:     make(chan struct{}),
+		readDone: make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+		ops:      make(map[string]*graphQLRunning),
+	}
+}
+
+func (c *graphQLConn) run() {
+	initTimer := time.AfterFunc(graphQLInitTimeout, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if !c.acked {
+			c.stopLocked(gqlCloseInitTimeout, "Connection initialisation timeout")
+		}
+	})
+	defer initTimer.Stop()
+
+	go c.read()
+	c.write()
+	c.cancel()
+	c.operations.Wait()
+}
+
+// fail stops the connection, the writer sends a close frame with code unless it is 0
+func (c *graphQLConn) fail(code int, text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopLocked(code, text)
+}
+
+func (c *graphQLConn) stopLocked(code int, text string) {
+	c.stopOnce.Do(func() {
+		c.closeCode, c.closeText = code, text
+		close(c.stop)
+	})
+}
+
+// enqueue waits for room in the send queue. A subscription whose client reads too slowly
+// stops taking events, the broker then drops it and the client gets an error.
+func (c *graphQLConn) enqueue(msg graphQLServerMessage) bool {
+	select {
+	case c.send <- msg:
+		return true
+	case <-c.stop:
+		return false
+	}
+}
+
+func (c *graphQLConn) write() {
+	pingPeriod := time.Duration(c.h.cfg.WebSocketPingSeconds) * time.Second
+	ping := time.NewTicker(pingPeriod)
+	defer ping.Stop()
+	defer c.conn.Close()
+
+	for {
+		select {
+		case msg := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := c.conn.WriteJSON(msg); err != nil {
+				c.fail(0, "")
+				return
+			}
+		case <-ping.C:
+			deadline := time.Now().Add(wsWriteTimeout)
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				c.fail(0, "")
+				return
+			}
+		case <-c.stop:
+			c.mu.Lock()
+			code, text := c.closeCode, c.closeText
+			c.mu.Unlock()
+			if code == 0 {
+				return
+			}
+			deadline := time.Now().Add(wsWriteTimeout)
+			if err := c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), deadline); err != nil {
+				return
+			}
+			select {
+			case <-c.readDone:
+			case <-time.After(wsCloseTimeout):
+			}
+			return
+		}
+	}
+}
+
+func (c *graphQLConn) read() {
+	defer close(c.readDone)
+
+	pongWait := 2 * time.Duration(c.h.cfg.WebSocketPingSeconds) * time.Second
+	c.conn.SetReadLimit(wsMaxMessageBytes)
+	_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		kind, data, err := c.conn.ReadMessage()
+		if err != nil {
+			c.fail(0, "")
+			return
+		}
+		_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		if kind != websocket.TextMessage {
+			c.fail(gqlCloseBadRequest, "text messages only")
+			return
+		}
+
+		var msg graphQLClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.fail(gqlCloseBadRequest, "invalid message")
+			return
+		}
+		switch msg.Type {
+		case gqlConnectionInit:
+			c.mu.Lock()
+			again := c.acked
+			c.acked = true
+			if again {
+				c.stopLocked(gqlCloseTooManyInits, "Too many initialisation requests")
+			}
+			c.mu.Unlock()
+			if again {
+				return
+			}
+			c.enqueue(graphQLServerMessage{Type: gqlConnectionAck})
+		case gqlPing:
+			c.enqueue(graphQLServerMessage{Type: gqlPong})
+		case gqlPong:
+		case gqlSubscribe:
+			if !c.subscribe(msg) {
+				return
+			}
+		case gqlComplete:
+			c.mu.Lock()
+			if running, ok := c.ops[msg.ID]; ok {
+				delete(c.ops, msg.ID)
+				running.cancel()
+			}
+			c.mu.Unlock()
+		default:
+			c.fail(gqlCloseBadRequest, "unknown message type")
+			return
+		}
+	}
+}
+
+// subscribe starts an operation, it returns false when the message closed the connection
+func (c *graphQLConn) subscribe(msg graphQLClientMessage) bool {
+	var req graphQLRequest
+	if msg.ID == "" || json.Unmarshal(msg.Payload, &req) != nil {
+		c.fail(gqlCloseBadRequest, "invalid subscribe message")
+		return false
+	}
+
+	c.mu.Lock()
+	acked := c.acked
+	_, exists := c.ops[msg.ID]
+	full := len(c.ops) >= wsMaxSubscriptions
+	switch {
+	case !acked:
+		c.stopLocked(gqlCloseUnauthorized, "Unauthorized")
+	case exists:
+		c.stopLocked(gqlCloseSubscriberTaken, fmt.Sprintf("Subscriber for %s already exists", msg.ID))
+	}
+	c.mu.Unlock()
+	if !acked || exists {
+		return false
+	}
+	if full {
+		c.enqueue(graphQLServerMessage{ID: msg.ID, Type: gqlError, Payload: (&graphQLError{
+			message: "too many subscriptions",
+			code:    codeTooManySubscriptions,
+			status:  http.StatusBadRequest,
+		}).formatted()})
+		return true
+	}
+
+	op, errs := c.h.prepareGraphQL(req)
+	if errs != nil {
+		c.enqueue(graphQLServerMessage{ID: msg.ID, Type: gqlError, Payload: errs})
+		return true
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	running := &graphQLRunning{cancel: cancel}
+	c.mu.Lock()
+	c.ops[msg.ID] = running
+	c.mu.Unlock()
+	c.operations.Add(1)
+	go func() {
+		defer c.operations.Done()
+		defer cancel()
+		if op.kind == ast.OperationTypeSubscription {
+			c.runSubscription(ctx, msg.ID, running, op)
+		} else {
+			c.runOperation(ctx, msg.ID, running, op)
+		}
+	}()
+	return true
+}
+
+func (c *graphQLConn) runOperation(ctx context.Context, id string, running *graphQLRunning, op *graphQLOperation) {
+	result := c.h.executeGraphQL(ctx, op)
+	if ctx.Err() == nil && c.enqueue(graphQLServerMessage{ID: id, Type: gqlNext, Payload: result}) {
+		c.finish(id, running)
+	}
+}
+
+func (c *graphQLConn) runSubscription(ctx context.Context, id string, running *graphQLRunning, op *graphQLOperation) {
+	results := graphql.ExecuteSubscription(graphql.ExecuteParams{
+		Schema:        c.h.graphQL,
+		AST:           op.doc,
+		OperationName: op.req.OperationName,
+		Args:          op.req.Variables,
+		Context:       c.h.withGraphQLLoaders(ctx),
+	})
+	failed := false
+	for result := range results {
+		// keep draining once stopped, the executor only returns when it may send again
+		if failed || ctx.Err() != nil {
+			continue
+		}
+		restoreGraphQLExtensions(result)
+		msg := graphQLServerMessage{ID: id, Type: gqlNext, Payload: result}
+		if result.Data == nil && result.HasErrors() {
+			// nothing was resolved: the subscription could not start or was dropped
+			msg = graphQLServerMessage{ID: id, Type: gqlError, Payload: result.Errors}
+			failed = true
+		}
+		if !c.enqueue(msg) {
+			failed = true
+		}
+	}
+	if failed {
+		c.forget(id, running)
+		return
+	}
+	c.finish(id, running)
+}
+
+// finish sends complete for an operation the client has not completed itself
+func (c *graphQLConn) finish(id string, running *graphQLRunning) {
+	if c.forget(id, running) {
+		c.enqueue(graphQLServerMessage{ID: id, Type: gqlComplete})
+	}
+}
+
+// forget unregisters the operation and reports whether it was still registered
+func (c *graphQLConn) forget(id string, running *graphQLRunning) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ops[id] != running {
+		return false
+	}
+	delete(c.ops, id)
+	return true
+}
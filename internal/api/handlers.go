@@ -3,63 +3,66 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/graphql-go/graphql"
+	"github.com/nightmaker00/go-tasks-api/internal/config"
 	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	"github.com/nightmaker00/go-tasks-api/internal/events"
 	"github.com/nightmaker00/go-tasks-api/internal/service"
 )
 
 type Handler struct {
-	taskService TaskService
+	taskService    TaskService
+	webhookService WebhookService
+	events         *events.Broker
+	cfg            config.API
+	graphQL        graphql.Schema
+
+	socketsMu    sync.Mutex
+	sockets      map[socket]struct{}
+	socketsDone  sync.WaitGroup
+	shuttingDown bool
 }
 
-func NewHandler(taskService TaskService) *Handler {
-	return &Handler{taskService: taskService}
+func NewHandler(taskService TaskService, webhookService WebhookService, broker *events.Broker, cfg config.API) *Handler {
+	return &Handler{taskService: taskService, webhookService: webhookService, events: broker, cfg: cfg}
 }
 
 // CreateTask создаёт новую задачу
-// @Summary      Создать задачу
-// @Description  Создаёт новую задачу с указанным заголовком и описанием
-// @Tags         tasks
-// @Accept       json
-// @Produce      json
-// @Param        task  body      domain.CreateTaskRequest  true  "Данные задачи"
-// @Success      201   {object}  domain.CreateTaskResponse
-// @Failure      400   {object}  map[string]string  "Неверный запрос"
-// @Failure      500   {object}  map[string]string  "Внутренняя ошибка"
-// @Router       /tasks [post]
 func (h *Handler) CreateTask(w http.ResponseWriter, r *http.Request) {
 	var req domain.CreateTaskRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid json")
+	if !h.decodeJSON(w, r, &req) {
 		return
 	}
-	id, err := h.taskService.Create(r.Context(), req.Title, req.Description)
+	id := uuid.Nil
+	if req.ID != nil {
+		if *req.ID == uuid.Nil {
+			writeError(w, http.StatusBadRequest, codeInvalidID, "invalid id")
+			return
+		}
+		id = *req.ID
+	}
+	id, err := h.taskService.Create(r.Context(), id, req.Title, req.Description)
 	if err != nil {
 		handleServiceError(w, err)
 		return
 	}
+	w.Header().Set("Location", "/tasks/"+id.String())
 	writeJSON(w, http.StatusCreated, domain.CreateTaskResponse{ID: id})
 }
 
 // GetTask получает задачу по ID
-// @Summary      Получить задачу
-// @Description  Возвращает задачу по её UUID
-// @Tags         tasks
-// @Accept       json
-// @Produce      json
-// @Param        id   path      string  true  "UUID задачи"
-// @Success      200  {object}  domain.Task
-// @Failure      400  {object}  map[string]string  "Неверный UUID"
-// @Failure      404  {object}  map[string]string  "Задача не найдена"
-// @Router       /tasks/{id} [get]
 func (h *Handler) GetTask(w http.ResponseWriter, r *http.Request) {
 	id, err := parseID(r.PathValue("id"))
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid id")
+		writeError(w, http.StatusBadRequest, codeInvalidID, "invalid id")
 		return
 	}
 	task, err := h.taskService.GetByID(r.Context(), id)
@@ -67,33 +70,65 @@ func (h *Handler) GetTask(w http.ResponseWriter, r *http.Request) {
 		handleServiceError(w, err)
 		return
 	}
+	etag := taskETag(task)
+	w.Header().Set("ETag", etag)
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 	writeJSON(w, http.StatusOK, toTaskResponse(task))
 }
 
+// taskETag is a strong ETag of the version of the task, its updated_at
+func taskETag(task *domain.Task) string {
+	return fmt.Sprintf(`"%x"`, task.UpdatedAt.UnixMicro())
+}
+
+// parseTaskETag reads the version from a task ETag. The weak prefix is ignored, the
+// compression middleware weakens the ETag of every response it encodes.
+func parseTaskETag(etag string) (time.Time, bool) {
+	etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+	if len(etag) < 3 || etag[0] != '"' || etag[len(etag)-1] != '"' {
+		return time.Time{}, false
+	}
+	micros, err := strconv.ParseInt(etag[1:len(etag)-1], 16, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMicro(micros).UTC(), true
+}
+
 // UpdateTask обновляет задачу
-// @Summary      Обновить задачу
-// @Description  Обновляет данные задачи (заголовок, описание, статус)
-// @Tags         tasks
-// @Accept       json
-// @Produce      json
-// @Param        id    path      string                true  "UUID задачи"
-// @Param        task  body      domain.UpdateTaskRequest  true  "Обновлённые данные"
-// @Success      200   {object}  domain.UpdateTaskResponse
-// @Failure      400   {object}  map[string]string  "Неверный запрос"
-// @Failure      404   {object}  map[string]string  "Задача не найдена"
-// @Router       /tasks/{id} [put]
 func (h *Handler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 	id, err := parseID(r.PathValue("id"))
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid id")
+		writeError(w, http.StatusBadRequest, codeInvalidID, "invalid id")
 		return
 	}
 
 	var req domain.UpdateTaskRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid json")
+	if !h.decodeJSON(w, r, &req) {
 		return
 	}
+	if match := strings.TrimSpace(r.Header.Get("If-Match")); match != "" {
+		h.updateTaskIfMatch(w, r, id, match, req)
+		return
+	}
+	if h.cfg.UpsertOnPut {
+		created, err := h.taskService.Upsert(r.Context(), id, req.Title, req.Description, req.Status)
+		if err != nil {
+			handleServiceError(w, err)
+			return
+		}
+		if created {
+			w.Header().Set("Location", "/tasks/"+id.String())
+			writeJSON(w, http.StatusCreated, domain.UpdateTaskResponse{Status: "created"})
+			return
+		}
+		writeJSON(w, http.StatusOK, domain.UpdateTaskResponse{Status: "updated"})
+		return
+	}
+
 	err = h.taskService.Update(r.Context(), id, req.Title, req.Description, req.Status)
 	if err != nil {
 		handleServiceError(w, err)
@@ -102,20 +137,34 @@ func (h *Handler) UpdateTask(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, domain.UpdateTaskResponse{Status: "updated"})
 }
 
+// updateTaskIfMatch updates the task only in the version named by If-Match, so a change
+// made by someone else since the client read the task answers 412 instead of being lost.
+// "*" only requires the task to exist.
+func (h *Handler) updateTaskIfMatch(w http.ResponseWriter, r *http.Request, id uuid.UUID, match string, req domain.UpdateTaskRequest) {
+	var err error
+	if match == "*" {
+		err = h.taskService.Update(r.Context(), id, req.Title, req.Description, req.Status)
+	} else if version, ok := parseTaskETag(match); ok {
+		err = h.taskService.UpdateIfUnmodified(r.Context(), id, version, req.Title, req.Description, req.Status)
+	} else {
+		err = service.ErrTaskModified
+	}
+	// with upsert the missing task would be created, the condition is what fails (RFC 9110, 13.2.1)
+	if errors.Is(err, service.ErrTaskNotFound) && h.cfg.UpsertOnPut {
+		err = service.ErrTaskModified
+	}
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, domain.UpdateTaskResponse{Status: "updated"})
+}
+
 // DeleteTask удаляет задачу
-// @Summary      Удалить задачу
-// @Description  Удаляет задачу по её UUID (идемпотентная операция)
-// @Tags         tasks
-// @Accept       json
-// @Produce      json
-// @Param        id   path      string  true  "UUID задачи"
-// @Success      204  "No Content"
-// @Failure      400  {object}  map[string]string  "Неверный UUID"
-// @Router       /tasks/{id} [delete]
 func (h *Handler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 	id, err := parseID(r.PathValue("id"))
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid id")
+		writeError(w, http.StatusBadRequest, codeInvalidID, "invalid id")
 		return
 	}
 	if err := h.taskService.Delete(r.Context(), id); err != nil {
@@ -126,27 +175,30 @@ func (h *Handler) DeleteTask(w http.ResponseWriter, r *http.Request) {
 }
 
 // ListTasks получает список задач
-// @Summary      Список задач
-// @Description  Возвращает список задач с фильтрацией по статусу и пагинацией
-// @Tags         tasks
-// @Accept       json
-// @Produce      json
-// @Param        status  query     string  false  "Фильтр по статусу (new, in_progress, done)"
-// @Param        limit   query     int     false  "Лимит записей (по умолчанию 100, максимум 1000)"
-// @Param        offset  query     int     false  "Смещение для пагинации"
-// @Success      200     {array}   domain.TaskListItem
-// @Failure      400     {object}  map[string]string  "Неверные параметры"
-// @Router       /tasks [get]
 func (h *Handler) ListTasks(w http.ResponseWriter, r *http.Request) {
 	status := strings.TrimSpace(r.URL.Query().Get("status"))
+	var fields []domain.FieldError
 	limit, err := parseIntParam(r, "limit")
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid limit")
-		return
+		fields = append(fields, domain.FieldError{Field: "limit", Code: "invalid_integer", Message: "invalid limit"})
 	}
 	offset, err := parseIntParam(r, "offset")
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid offset")
+		fields = append(fields, domain.FieldError{Field: "offset", Code: "invalid_integer", Message: "invalid offset"})
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, fields)
+		return
+	}
+
+	// the version is read before the list, a change made in between is in the list but
+	// not in the ETag, so the client fetches the list once more rather than missing it
+	version, err := h.taskService.ListVersion(r.Context(), status, limit, offset)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	if listNotModified(w, r, version, time.Now()) {
 		return
 	}
 
@@ -155,29 +207,181 @@ func (h *Handler) ListTasks(w http.ResponseWriter, r *http.Request) {
 		handleServiceError(w, err)
 		return
 	}
+	if preferredMediaType(r, "application/json", "text/plain") == "text/plain" {
+		writeTodoTxt(w, items)
+		return
+	}
 	writeJSON(w, http.StatusOK, toTaskListResponse(items))
 }
 
-func handleServiceError(w http.ResponseWriter, err error) {
-	switch {
-	case errors.Is(err, service.ErrTaskNotFound):
-		writeError(w, http.StatusNotFound, "task not found")
-	case errors.Is(err, service.ErrInvalidTitle),
-		errors.Is(err, service.ErrInvalidStatus),
-		errors.Is(err, service.ErrInvalidLimit),
-		errors.Is(err, service.ErrInvalidOffset):
-		writeError(w, http.StatusBadRequest, "invalid request")
-	default:
-		writeError(w, http.StatusInternalServerError, "internal error")
+// listNotModified sets a weak ETag and Last-Modified derived from the version of a list
+// and answers with 304 when the conditional headers show the client has it already.
+// HTTP dates have whole seconds, so Last-Modified is the end of the second of the last
+// change and is left out until that second is over at now: a client holding it has a
+// list that no change of that second can be missing from.
+func listNotModified(w http.ResponseWriter, r *http.Request, version domain.TaskListVersion, now time.Time) bool {
+	var modified int64
+	if !version.LastModified.IsZero() {
+		modified = version.LastModified.UnixMicro()
+	}
+	etag := fmt.Sprintf(`W/"%d-%x"`, version.Count, modified)
+	header := w.Header()
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", "private, no-cache")
+	if !version.LastModified.IsZero() {
+		settled := version.LastModified.Truncate(time.Second)
+		if settled.Before(version.LastModified) {
+			settled = settled.Add(time.Second)
+		}
+		if !now.Before(settled) {
+			header.Set("Last-Modified", settled.UTC().Format(http.TimeFormat))
+		}
 	}
+
+	// If-Modified-Since only counts without If-None-Match (RFC 9110, 13.2.2)
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		if !etagMatches(match, etag) {
+			return false
+		}
+	} else {
+		since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		if err != nil || version.LastModified.IsZero() || version.LastModified.After(since) {
+			return false
+		}
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
 }
 
-func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("POST /tasks", h.CreateTask)
-	mux.HandleFunc("GET /tasks/{id}", h.GetTask)
-	mux.HandleFunc("PUT /tasks/{id}", h.UpdateTask)
-	mux.HandleFunc("DELETE /tasks/{id}", h.DeleteTask)
-	mux.HandleFunc("GET /tasks", h.ListTasks)
+// BatchTasks выполняет пакет операций над задачами
+func (h *Handler) BatchTasks(w http.ResponseWriter, r *http.Request) {
+	req, ok := h.decodeBatch(w, r)
+	if !ok {
+		return
+	}
+
+	outcomes, err := h.taskService.Batch(r.Context(), req.Mode, req.Operations)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	results := make([]domain.BatchItemResult, len(outcomes))
+	for i, outcome := range outcomes {
+		result := domain.BatchItemResult{Index: i, Op: req.Operations[i].Op, Status: batchSuccessStatus(req.Operations[i].Op)}
+		if outcome.ID != uuid.Nil {
+			id := outcome.ID
+			result.ID = &id
+		}
+		if outcome.Err != nil {
+			result.Status, result.Code, result.Error = serviceErrorStatus(outcome.Err)
+			result.Errors = fieldErrors(outcome.Err)
+			if req.Mode != domain.BatchModeBestEffort && result.Status != http.StatusFailedDependency {
+				status = result.Status
+			}
+		}
+		results[i] = result
+	}
+	writeJSON(w, status, domain.BatchResponse{Results: results})
+}
+
+// errTooManyOperations stops decodeBatch at the first operation past MaxBatchSize
+var errTooManyOperations = errors.New("too many operations")
+
+// decodeBatch reads the request token by token and stops at the first operation over
+// the limit, so an oversized batch is not decoded into memory before it is rejected
+func (h *Handler) decodeBatch(w http.ResponseWriter, r *http.Request) (domain.BatchRequest, bool) {
+	var req domain.BatchRequest
+	body := r.Body
+	if h.cfg.MaxBodyBytes > 0 {
+		body = http.MaxBytesReader(w, r.Body, h.cfg.MaxBodyBytes)
+	}
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+
+	err := func() error {
+		if err := expectDelim(decoder, '{'); err != nil {
+			return err
+		}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return err
+			}
+			switch key {
+			case "mode":
+				err = decoder.Decode(&req.Mode)
+			case "operations":
+				err = h.decodeBatchOperations(decoder, &req)
+			default:
+				err = fmt.Errorf("json: unknown field %q", key)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := expectDelim(decoder, '}'); err != nil {
+			return err
+		}
+		if decoder.More() {
+			return errors.New("unexpected data after json value")
+		}
+		return nil
+	}()
+	if errors.Is(err, errTooManyOperations) {
+		writeError(w, http.StatusRequestEntityTooLarge, codePayloadTooLarge, "too many operations")
+		return req, false
+	}
+	if err != nil {
+		writeDecodeError(w, err)
+		return req, false
+	}
+	return req, true
+}
+
+func (h *Handler) decodeBatchOperations(decoder *json.Decoder, req *domain.BatchRequest) error {
+	token, err := decoder.Token()
+	if err != nil || token == nil {
+		return err
+	}
+	if token != json.Delim('[') {
+		return errors.New("operations is not an array")
+	}
+	req.Operations = req.Operations[:0]
+	for decoder.More() {
+		if h.cfg.MaxBatchSize > 0 && len(req.Operations) == h.cfg.MaxBatchSize {
+			return errTooManyOperations
+		}
+		var op domain.BatchOperation
+		if err := decoder.Decode(&op); err != nil {
+			return err
+		}
+		req.Operations = append(req.Operations, op)
+	}
+	return expectDelim(decoder, ']')
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %s", delim)
+	}
+	return nil
+}
+
+func batchSuccessStatus(op domain.BatchOperationType) int {
+	switch op {
+	case domain.BatchOperationCreate:
+		return http.StatusCreated
+	case domain.BatchOperationDelete:
+		return http.StatusNoContent
+	default:
+		return http.StatusOK
+	}
 }
 
 func writeJSON(w http.ResponseWriter, status int, payload any) {
@@ -189,8 +393,48 @@ func writeJSON(w http.ResponseWriter, status int, payload any) {
 	_ = json.NewEncoder(w).Encode(payload)
 }
 
-func writeError(w http.ResponseWriter, status int, message string) {
-	writeJSON(w, status, map[string]string{"error": message})
+// BodyLimit is the largest body the route of r accepts, imports take files up to
+// MaxImportBytes and every other route MaxBodyBytes
+func (h *Handler) BodyLimit(r *http.Request) int64 {
+	if r.Method == http.MethodPost && r.URL.Path == "/tasks/import" {
+		return h.cfg.MaxImportBytes
+	}
+	return h.cfg.MaxBodyBytes
+}
+
+// decodeJSON strictly decodes the request body into dst. It writes the error
+// response itself and reports whether decoding succeeded.
+func (h *Handler) decodeJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	body := r.Body
+	if h.cfg.MaxBodyBytes > 0 {
+		body = http.MaxBytesReader(w, r.Body, h.cfg.MaxBodyBytes)
+	}
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(dst)
+	if err == nil && decoder.More() {
+		err = errors.New("unexpected data after json value")
+	}
+	if err == nil {
+		return true
+	}
+	writeDecodeError(w, err)
+	return false
+}
+
+// writeDecodeError answers a request whose JSON body could not be decoded
+func writeDecodeError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, codePayloadTooLarge, "request body too large")
+		return
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		writeValidationError(w, []domain.FieldError{{Field: strings.Trim(field, `"`), Code: "unknown_field", Message: "unknown field"}})
+		return
+	}
+	writeError(w, http.StatusBadRequest, codeInvalidJSON, "invalid json")
 }
 
 func parseID(raw string) (uuid.UUID, error) {
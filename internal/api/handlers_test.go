@@ -0,0 +1,446 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/config"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+func TestCreateTaskWithID(t *testing.T) {
+	api := newTestAPI(t, nil)
+	id := uuid.New()
+
+	tests := []struct {
+		name     string
+		body     string
+		status   int
+		code     string
+		location string
+	}{
+		{name: "client id", body: `{"id":"` + id.String() + `","title":"a"}`, status: http.StatusCreated, location: "/tasks/" + id.String()},
+		{name: "same id again", body: `{"id":"` + id.String() + `","title":"b"}`, status: http.StatusConflict, code: codeTaskExists},
+		{name: "nil id", body: `{"id":"00000000-0000-0000-0000-000000000000","title":"a"}`, status: http.StatusBadRequest, code: codeInvalidID},
+		{name: "malformed id", body: `{"id":"42","title":"a"}`, status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := api.do(t, http.MethodPost, "/tasks", tt.body)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.location != "" {
+				if got := rec.Header().Get("Location"); got != tt.location {
+					t.Errorf("Location = %q, want %q", got, tt.location)
+				}
+				var resp domain.CreateTaskResponse
+				decodeBody(t, rec, &resp)
+				if resp.ID != id {
+					t.Errorf("id = %s, want %s", resp.ID, id)
+				}
+			}
+			if tt.code != "" {
+				var problem domain.Problem
+				decodeBody(t, rec, &problem)
+				if problem.Code != tt.code {
+					t.Errorf("code = %q, want %q", problem.Code, tt.code)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateTaskUpsert(t *testing.T) {
+	tests := []struct {
+		name       string
+		upsert     bool
+		wantFirst  int
+		wantSecond int
+	}{
+		{name: "upsert off", upsert: false, wantFirst: http.StatusNotFound, wantSecond: http.StatusNotFound},
+		{name: "upsert on", upsert: true, wantFirst: http.StatusCreated, wantSecond: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(t, func(cfg *config.Config) { cfg.API.UpsertOnPut = tt.upsert })
+			target := "/tasks/" + uuid.NewString()
+			body := `{"title":"a","status":"in_progress"}`
+
+			if rec := api.do(t, http.MethodPut, target, body); rec.Code != tt.wantFirst {
+				t.Fatalf("first PUT = %d, want %d: %s", rec.Code, tt.wantFirst, rec.Body)
+			}
+			if rec := api.do(t, http.MethodPut, target, body); rec.Code != tt.wantSecond {
+				t.Fatalf("second PUT = %d, want %d: %s", rec.Code, tt.wantSecond, rec.Body)
+			}
+			if tt.upsert {
+				rec := api.do(t, http.MethodGet, target, "")
+				var task domain.Task
+				decodeBody(t, rec, &task)
+				if task.Status != domain.TaskStatusInProgress {
+					t.Errorf("status = %s, want in_progress", task.Status)
+				}
+			}
+		})
+	}
+}
+
+func TestBatchTasksLimit(t *testing.T) {
+	op := `{"op":"create","title":"a"}`
+	ops := func(n int) string {
+		return `{"operations":[` + strings.TrimSuffix(strings.Repeat(op+",", n), ",") + `]}`
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+	}{
+		{name: "at the limit", body: ops(3), status: http.StatusOK},
+		{name: "over the limit", body: ops(4), status: http.StatusRequestEntityTooLarge, code: codePayloadTooLarge},
+		{name: "mode after operations", body: `{"operations":[` + op + `],"mode":"best_effort"}`, status: http.StatusOK},
+		{name: "unknown field", body: `{"operations":[` + op + `],"extra":1}`, status: http.StatusBadRequest, code: codeValidation},
+		// the validator reports the type of operations, the handler that it cannot decode it
+		{name: "operations not an array", body: `{"operations":{}}`, status: http.StatusBadRequest},
+		{name: "trailing data", body: ops(1) + `{}`, status: http.StatusBadRequest, code: codeInvalidJSON},
+	}
+
+	for _, validate := range []bool{true, false} {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s, validation %v", tt.name, validate), func(t *testing.T) {
+				api := newTestAPI(t, func(cfg *config.Config) {
+					cfg.API.MaxBatchSize = 3
+					cfg.Validation.Requests = validate
+				})
+				rec := api.do(t, http.MethodPost, "/tasks:batch", tt.body)
+				if rec.Code != tt.status {
+					t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+				}
+				if tt.code != "" {
+					var problem domain.Problem
+					decodeBody(t, rec, &problem)
+					if problem.Code != tt.code {
+						t.Errorf("code = %q, want %q", problem.Code, tt.code)
+					}
+				}
+			})
+		}
+	}
+}
+
+// endlessBatch is a batch body whose operations never end
+type endlessBatch struct {
+	pending string
+	read    int
+}
+
+func (b *endlessBatch) Read(p []byte) (int, error) {
+	if b.read == 0 {
+		b.pending = `{"operations":[`
+	}
+	for len(b.pending) < len(p) {
+		b.pending += `{"op":"create","title":"a"},`
+	}
+	n := copy(p, b.pending)
+	b.pending = b.pending[n:]
+	b.read += n
+	return n, nil
+}
+
+func TestBatchTasksStopsReadingAtLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		validate bool
+		header   []string
+	}{
+		{name: "default config", validate: true},
+		{name: "with idempotency key", validate: true, header: []string{idempotencyKeyHeader, "batch-1"}},
+		{name: "without validation", validate: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(t, func(cfg *config.Config) { cfg.Validation.Requests = tt.validate })
+			body := &endlessBatch{}
+			req := httptest.NewRequest(http.MethodPost, "/tasks:batch", body)
+			req.Header.Set("Content-Type", "application/json")
+			for i := 0; i+1 < len(tt.header); i += 2 {
+				req.Header.Set(tt.header[i], tt.header[i+1])
+			}
+			rec := httptest.NewRecorder()
+			api.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusRequestEntityTooLarge {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusRequestEntityTooLarge, rec.Body)
+			}
+			// 500 operations take about 14 KB, far below the 1 MB body limit
+			if body.read > 64<<10 {
+				t.Errorf("read %d bytes of the body before rejecting it", body.read)
+			}
+		})
+	}
+}
+
+// TestValidatorBodyLimit sets the limit the way flags do, after config.Load, and checks
+// that the validator itself rejects a larger body before the handler reads it
+func TestValidatorBodyLimit(t *testing.T) {
+	api := newTestAPI(t, func(cfg *config.Config) { cfg.API.MaxBodyBytes = 64 })
+	tests := []struct {
+		name   string
+		title  string
+		status int
+	}{
+		{name: "under the limit", title: "a", status: http.StatusNoContent},
+		{name: "over the limit", title: strings.Repeat("a", 100), status: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := NewRequestValidator(api.spec, config.Validation{Requests: true}, api.handler.BodyLimit)
+			handler := WithValidation(validator, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(`{"title":"`+tt.title+`"}`))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
+
+func TestListTasksNotModified(t *testing.T) {
+	for _, validate := range []bool{true, false} {
+		// without the validator the handler and the service check the query themselves
+		t.Run(fmt.Sprintf("validation %v", validate), func(t *testing.T) {
+			api := newTestAPI(t, func(cfg *config.Config) { cfg.Validation.Requests = validate })
+			// changes made a while ago, Last-Modified is left out during the second of a change
+			api.repo.Now = func() time.Time { return time.Now().Add(-time.Minute) }
+			var created domain.CreateTaskResponse
+			for _, title := range []string{"a", "b"} {
+				decodeBody(t, api.do(t, http.MethodPost, "/tasks", `{"title":"`+title+`"}`), &created)
+			}
+
+			rec := api.do(t, http.MethodGet, "/tasks", "")
+			etag, modified := rec.Header().Get("ETag"), rec.Header().Get("Last-Modified")
+			if rec.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"2-`) || modified == "" {
+				t.Fatalf("status %d, ETag %q, Last-Modified %q", rec.Code, etag, modified)
+			}
+
+			tests := []struct {
+				name   string
+				target string
+				header []string
+				status int
+			}{
+				{name: "same etag", target: "/tasks", header: []string{"If-None-Match", etag}, status: http.StatusNotModified},
+				{name: "etag among others", target: "/tasks", header: []string{"If-None-Match", `"other", ` + etag}, status: http.StatusNotModified},
+				{name: "other page, same tasks", target: "/tasks?limit=1&offset=1", header: []string{"If-None-Match", etag}, status: http.StatusNotModified},
+				{name: "other filter", target: "/tasks?status=done", header: []string{"If-None-Match", etag}, status: http.StatusOK},
+				{name: "if-modified-since", target: "/tasks", header: []string{"If-Modified-Since", modified}, status: http.StatusNotModified},
+				{name: "if-none-match wins over if-modified-since", target: "/tasks", header: []string{"If-None-Match", `W/"0-0"`, "If-Modified-Since", modified}, status: http.StatusOK},
+				{name: "limit above max", target: "/tasks?limit=5000", header: []string{"If-None-Match", etag}, status: http.StatusBadRequest},
+				{name: "negative limit", target: "/tasks?limit=-1", header: []string{"If-None-Match", etag}, status: http.StatusBadRequest},
+				{name: "negative offset", target: "/tasks?offset=-1", header: []string{"If-None-Match", etag}, status: http.StatusBadRequest},
+				{name: "limit not a number", target: "/tasks?limit=ten", header: []string{"If-None-Match", etag}, status: http.StatusBadRequest},
+				{name: "unknown status", target: "/tasks?status=archived", header: []string{"If-None-Match", etag}, status: http.StatusBadRequest},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					rec := api.do(t, http.MethodGet, tt.target, "", tt.header...)
+					if rec.Code != tt.status {
+						t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+					}
+					if tt.status == http.StatusNotModified && rec.Body.Len() != 0 {
+						t.Errorf("304 with a body: %s", rec.Body)
+					}
+				})
+			}
+
+			rec = api.do(t, http.MethodPut, "/tasks/"+created.ID.String(), `{"title":"b","status":"done"}`)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("update: status = %d: %s", rec.Code, rec.Body)
+			}
+			rec = api.do(t, http.MethodGet, "/tasks", "", "If-None-Match", etag)
+			if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag {
+				t.Errorf("after an update: status %d, ETag %q", rec.Code, rec.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestListNotModifiedWithinASecond(t *testing.T) {
+	changed := time.Date(2024, 3, 4, 12, 0, 0, 300_000_000, time.UTC)
+	tests := []struct {
+		name         string
+		lastModified time.Time
+		now          time.Time
+		since        string
+		header       string
+		status       int
+	}{
+		{name: "second not over", lastModified: changed, now: changed.Add(500 * time.Millisecond), status: http.StatusOK},
+		{name: "second over", lastModified: changed, now: changed.Add(700 * time.Millisecond), header: "Mon, 04 Mar 2024 12:00:01 GMT", status: http.StatusOK},
+		{name: "on a whole second", lastModified: changed.Truncate(time.Second), now: changed, header: "Mon, 04 Mar 2024 12:00:00 GMT", status: http.StatusOK},
+		{name: "client has the second", lastModified: changed, now: changed.Add(time.Minute), since: "Mon, 04 Mar 2024 12:00:01 GMT", header: "Mon, 04 Mar 2024 12:00:01 GMT", status: http.StatusNotModified},
+		// a list taken at 12:00:00.1, the client only knows the second from Date
+		{name: "change later in the same second", lastModified: changed, now: changed.Add(time.Minute), since: "Mon, 04 Mar 2024 12:00:00 GMT", header: "Mon, 04 Mar 2024 12:00:01 GMT", status: http.StatusOK},
+		{name: "change in a later second", lastModified: changed.Add(2 * time.Second), now: changed.Add(time.Minute), since: "Mon, 04 Mar 2024 12:00:01 GMT", header: "Mon, 04 Mar 2024 12:00:03 GMT", status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/tasks", nil)
+			if tt.since != "" {
+				req.Header.Set("If-Modified-Since", tt.since)
+			}
+			rec := httptest.NewRecorder()
+			if !listNotModified(rec, req, domain.TaskListVersion{Count: 1, LastModified: tt.lastModified}, tt.now) {
+				rec.WriteHeader(http.StatusOK)
+			}
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if got := rec.Header().Get("Last-Modified"); got != tt.header {
+				t.Errorf("Last-Modified = %q, want %q", got, tt.header)
+			}
+		})
+	}
+}
+
+// countingExports counts how often the tasks are read for a calendar
+type countingExports struct {
+	TaskService
+	calls int
+}
+
+func (c *countingExports) Export(ctx context.Context, status string, fn func(task domain.Task) error) error {
+	c.calls++
+	return c.TaskService.Export(ctx, status, fn)
+}
+
+func TestTasksCalendar(t *testing.T) {
+	api := newTestAPI(t, nil)
+	api.repo.Now = func() time.Time { return time.Now().Add(-time.Minute) }
+	exports := &countingExports{TaskService: api.handler.taskService}
+	api.handler.taskService = exports
+	var created domain.CreateTaskResponse
+	for _, title := range []string{"a", "b", "c"} {
+		decodeBody(t, api.do(t, http.MethodPost, "/tasks", `{"title":"`+title+`"}`), &created)
+	}
+
+	rec := api.do(t, http.MethodGet, "/tasks.ics", "")
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"3-`) || rec.Header().Get("Last-Modified") == "" {
+		t.Fatalf("status %d, ETag %q, Last-Modified %q", rec.Code, etag, rec.Header().Get("Last-Modified"))
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		header []string
+		status int
+		todos  int
+	}{
+		{name: "all tasks", target: "/tasks.ics", status: http.StatusOK, todos: 3},
+		{name: "page", target: "/tasks.ics?limit=1&offset=1", status: http.StatusOK, todos: 1},
+		{name: "offset past the end", target: "/tasks.ics?offset=5", status: http.StatusOK},
+		{name: "other filter", target: "/tasks.ics?status=done", status: http.StatusOK},
+		{name: "same etag", target: "/tasks.ics", header: []string{"If-None-Match", etag}, status: http.StatusNotModified},
+		{name: "same etag, other page", target: "/tasks.ics?limit=2", header: []string{"If-None-Match", etag}, status: http.StatusNotModified},
+		{name: "unknown status", target: "/tasks.ics?status=archived", status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exports.calls = 0
+			rec := api.do(t, http.MethodGet, tt.target, "", tt.header...)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				// the version alone answers, the tasks are not read
+				if exports.calls != 0 {
+					t.Errorf("read the tasks %d times", exports.calls)
+				}
+				return
+			}
+			body := rec.Body.String()
+			if got := strings.Count(body, "BEGIN:VTODO"); got != tt.todos || !strings.HasSuffix(body, "END:VCALENDAR\r\n") {
+				t.Errorf("%d VTODO, want %d:\n%s", got, tt.todos, body)
+			}
+		})
+	}
+
+	rec = api.do(t, http.MethodDelete, "/tasks/"+created.ID.String(), "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: status = %d: %s", rec.Code, rec.Body)
+	}
+	rec = api.do(t, http.MethodGet, "/tasks.ics", "", "If-None-Match", etag)
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") == etag || strings.Count(rec.Body.String(), "BEGIN:VTODO") != 2 {
+		t.Errorf("after a delete: status %d, ETag %q:\n%s", rec.Code, rec.Header().Get("ETag"), rec.Body)
+	}
+}
+
+func TestGetTaskNotModified(t *testing.T) {
+	api := newTestAPI(t, nil)
+	var created domain.CreateTaskResponse
+	decodeBody(t, api.do(t, http.MethodPost, "/tasks", `{"title":"a"}`), &created)
+	target := "/tasks/" + created.ID.String()
+
+	rec := api.do(t, http.MethodGet, target, "")
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(etag, `"`) {
+		t.Fatalf("status %d, ETag %q, want a strong ETag", rec.Code, etag)
+	}
+	listETag := api.do(t, http.MethodGet, "/tasks", "").Header().Get("ETag")
+
+	tests := []struct {
+		name   string
+		match  string
+		status int
+	}{
+		{name: "same etag", match: etag, status: http.StatusNotModified},
+		{name: "weak form", match: "W/" + etag, status: http.StatusNotModified},
+		{name: "any", match: "*", status: http.StatusNotModified},
+		{name: "etag of the list", match: listETag, status: http.StatusOK},
+		{name: "other etag", match: `"0"`, status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := api.do(t, http.MethodGet, target, "", "If-None-Match", tt.match)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if got := rec.Header().Get("ETag"); got != etag {
+				t.Errorf("ETag = %q, want %q", got, etag)
+			}
+		})
+	}
+
+	// the ETag of a task does not follow other tasks, unlike the one of the list
+	decodeBody(t, api.do(t, http.MethodPost, "/tasks", `{"title":"b"}`), &domain.CreateTaskResponse{})
+	if rec := api.do(t, http.MethodGet, target, "", "If-None-Match", etag); rec.Code != http.StatusNotModified {
+		t.Errorf("after another task was created: status = %d", rec.Code)
+	}
+	if rec := api.do(t, http.MethodGet, "/tasks", "", "If-None-Match", listETag); rec.Code != http.StatusOK {
+		t.Errorf("list after another task was created: status = %d", rec.Code)
+	}
+
+	rec = api.do(t, http.MethodPut, target, `{"title":"a2","status":"new"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("update: status = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := api.do(t, http.MethodGet, target, "", "If-None-Match", etag); rec.Code != http.StatusOK {
+		t.Errorf("after an update: status = %d", rec.Code)
+	}
+}
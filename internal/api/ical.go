@@ -0,0 +1,156 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	"github.com/nightmaker00/go-tasks-api/internal/ical"
+)
+
+const calendarName = "Tasks"
+
+// errCalendarFull stops reading tasks once the calendar has limit of them
+var errCalendarFull = errors.New("calendar is full")
+
+// TasksCalendar отдаёт задачи в формате iCalendar
+func (h *Handler) TasksCalendar(w http.ResponseWriter, r *http.Request) {
+	status := strings.TrimSpace(r.URL.Query().Get("status"))
+	var fields []domain.FieldError
+	limit, err := parseIntParam(r, "limit")
+	if err != nil || limit < 0 {
+		fields = append(fields, domain.FieldError{Field: "limit", Code: "invalid_integer", Message: "invalid limit"})
+	}
+	offset, err := parseIntParam(r, "offset")
+	if err != nil || offset < 0 {
+		fields = append(fields, domain.FieldError{Field: "offset", Code: "invalid_integer", Message: "invalid offset"})
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, fields)
+		return
+	}
+
+	h.serveCalendar(w, r, status, limit, offset)
+}
+
+// serveCalendar sends the calendar of the tasks with the status. Its ETag and
+// Last-Modified are those of the list with the status, like in GET /tasks, so an
+// unchanged calendar gets 304 without reading the tasks, and the tasks are written as
+// they are read rather than held in memory; limit 0 means all of them.
+func (h *Handler) serveCalendar(w http.ResponseWriter, r *http.Request, status string, limit, offset int) {
+	// the version is read before the tasks, see ListTasks
+	version, err := h.taskService.ListVersion(r.Context(), status, 0, 0)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	if listNotModified(w, r, version, time.Now()) {
+		return
+	}
+
+	out := &calendarWriter{w: w, rc: http.NewResponseController(w)}
+	if r.Method != http.MethodHead {
+		skipped, written := 0, 0
+		err = h.taskService.Export(r.Context(), status, func(task domain.Task) error {
+			if skipped < offset {
+				skipped++
+				return nil
+			}
+			if err := out.write(task); err != nil {
+				return err
+			}
+			if written++; limit > 0 && written == limit {
+				return errCalendarFull
+			}
+			return nil
+		})
+		if errors.Is(err, errCalendarFull) {
+			err = nil
+		}
+	}
+	if err != nil && out.enc == nil {
+		handleServiceError(w, err)
+		return
+	}
+	if err == nil {
+		err = out.close()
+	}
+	if err != nil {
+		// the status line is already sent, the truncated calendar is all the client gets
+		log.Printf("tasks calendar (request %s): %v", RequestID(r.Context()), err)
+	}
+}
+
+// calendarWriter sends the response headers with the first task, so an error reading
+// the tasks before it still gets a proper problem response
+type calendarWriter struct {
+	w   http.ResponseWriter
+	rc  *http.ResponseController
+	enc *ical.Encoder
+}
+
+func (c *calendarWriter) start() {
+	c.w.Header().Set("Content-Type", ical.ContentType)
+	c.w.WriteHeader(http.StatusOK)
+	_ = c.rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+	c.enc = ical.NewEncoder(c.w, calendarName)
+}
+
+func (c *calendarWriter) write(task domain.Task) error {
+	if c.enc == nil {
+		c.start()
+	}
+	return c.enc.Encode(task)
+}
+
+func (c *calendarWriter) close() error {
+	if c.enc == nil {
+		c.start()
+	}
+	return c.enc.Close()
+}
+
+// writeCalendar sends an iCalendar body with a strong ETag of its content and answers
+// a matching If-None-Match with 304, so subscribed clients refetch only after changes
+func writeCalendar(w http.ResponseWriter, r *http.Request, body []byte, modified time.Time) {
+	etag := contentETag(body)
+	header := w.Header()
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", "private, no-cache")
+	if !modified.IsZero() {
+		header.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	header.Set("Content-Type", ical.ContentType)
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(body)
+	}
+}
+
+func contentETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches implements the weak comparison If-None-Match uses (RFC 9110, 13.1.2)
+func etagMatches(header, etag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+const (
+	idempotencyKeyHeader    = "Idempotency-Key"
+	idempotencyReplayHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength = 255
+)
+
+type IdempotencyStore interface {
+	Reserve(ctx context.Context, claim *domain.IdempotencyRecord, lease time.Duration) (*domain.IdempotencyRecord, bool, error)
+	Renew(ctx context.Context, claim *domain.IdempotencyRecord, lease time.Duration) error
+	Complete(ctx context.Context, claim *domain.IdempotencyRecord, ttl time.Duration) error
+	Release(ctx context.Context, claim *domain.IdempotencyRecord) error
+}
+
+// WithIdempotency replays stored responses for POST and PATCH requests retried with the
+// same Idempotency-Key header by the same API key. A request holds its key for lease and
+// renews it while it runs, a retry takes over only a lease that was not renewed, so a
+// crashed request does not block the key for ttl. The body is buffered up to bodyLimit
+// of the route, a limit of zero or less leaves it unbounded.
+func WithIdempotency(store IdempotencyStore, ttl, lease time.Duration, bodyLimit func(*http.Request) int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimSpace(r.Header.Get(idempotencyKeyHeader))
+		if key == "" || (r.Method != http.MethodPost && r.Method != http.MethodPatch) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeError(w, http.StatusBadRequest, codeInvalidIdempotencyKey, "invalid idempotency key")
+			return
+		}
+
+		reader := r.Body
+		if limit := bodyLimit(r); limit > 0 {
+			reader = http.MaxBytesReader(w, r.Body, limit)
+		}
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(w, http.StatusRequestEntityTooLarge, codePayloadTooLarge, "request body too large")
+				return
+			}
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := requestFingerprint(r, body)
+		claim := &domain.IdempotencyRecord{
+			APIKeyID:    APIKeyID(r.Context()),
+			Key:         key,
+			Scope:       r.Method + " " + r.URL.Path,
+			Fingerprint: fingerprint,
+			LockID:      uuid.New(),
+		}
+
+		record, reserved, err := store.Reserve(r.Context(), claim, lease)
+		if err != nil {
+			log.Printf("idempotency reserve: %v", err)
+			writeError(w, http.StatusInternalServerError, codeInternal, "internal error")
+			return
+		}
+		if !reserved {
+			switch {
+			case record.Fingerprint != fingerprint:
+				writeError(w, http.StatusUnprocessableEntity, codeIdempotencyKeyReused, "idempotency key reused with different request")
+			case !record.Completed:
+				w.Header().Set("Retry-After", "1")
+				writeError(w, http.StatusConflict, codeIdempotencyInProgress, "request with this idempotency key is in progress")
+			default:
+				replayResponse(w, record)
+			}
+			return
+		}
+
+		// the key outlives a cancelled request, so store the outcome detached from it
+		ctx := context.WithoutCancel(r.Context())
+		stopRenewing := renewLease(ctx, store, claim, lease)
+		finished := false
+		defer func() {
+			stopRenewing()
+			if finished {
+				return
+			}
+			// server errors and panics are not final, the client may retry with the same key
+			if err := store.Release(ctx, claim); err != nil {
+				log.Printf("idempotency release: %v", err)
+			}
+		}()
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if rec.status >= http.StatusInternalServerError {
+			return
+		}
+
+		stopRenewing()
+		finished = true
+		claim.StatusCode = rec.status
+		claim.ContentType = rec.Header().Get("Content-Type")
+		claim.Body = rec.body.Bytes()
+		if err := store.Complete(ctx, claim, ttl); err != nil {
+			log.Printf("idempotency complete: %v", err)
+		}
+	})
+}
+
+// renewLease extends the reservation of claim every third of lease until the returned
+// function is called, which waits for a renewal in progress to end
+func renewLease(ctx context.Context, store IdempotencyStore, claim *domain.IdempotencyRecord, lease time.Duration) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := store.Renew(ctx, claim, lease); err != nil {
+					log.Printf("idempotency renew: %v", err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+}
+
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method))
+	hash.Write([]byte{0})
+	hash.Write([]byte(r.URL.RequestURI()))
+	hash.Write([]byte{0})
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func replayResponse(w http.ResponseWriter, record *domain.IdempotencyRecord) {
+	if record.ContentType != "" {
+		w.Header().Set("Content-Type", record.ContentType)
+	}
+	w.Header().Set(idempotencyReplayHeader, "true")
+	w.WriteHeader(record.StatusCode)
+	_, _ = w.Write(record.Body)
+}
+
+// responseRecorder passes the response through while keeping a copy of it. With jsonOnly
+// it copies only JSON bodies, so streamed responses are not held in memory.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	jsonOnly    bool
+	size        int
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.wroteHeader {
+		return
+	}
+	r.status = status
+	r.wroteHeader = true
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.size += len(p)
+	if !r.jsonOnly || isJSONMediaType(r.Header().Get("Content-Type")) {
+		r.body.Write(p)
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+// Hijack lets WebSocket upgrades through, the upgrader asserts http.Hijacker directly
+// and writes the 101 response on the hijacked connection
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err == nil {
+		r.status, r.wroteHeader = http.StatusSwitchingProtocols, true
+	}
+	return conn, rw, err
+}
+
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
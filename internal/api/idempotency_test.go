@@ -0,0 +1,318 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/config"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+// memoryIdempotencyStore follows the rules of the Postgres store: a record is taken over
+// once it expires, in flight that is when its lease runs out
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	now     time.Time
+	records map[string]domain.IdempotencyRecord
+}
+
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{now: time.Now(), records: make(map[string]domain.IdempotencyRecord)}
+}
+
+func (s *memoryIdempotencyStore) id(claim *domain.IdempotencyRecord) string {
+	return claim.APIKeyID + "\x00" + claim.Key + "\x00" + claim.Scope
+}
+
+func (s *memoryIdempotencyStore) Reserve(_ context.Context, claim *domain.IdempotencyRecord, lease time.Duration) (*domain.IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if record, ok := s.records[s.id(claim)]; ok && !record.ExpiresAt.Before(s.now) {
+		return &record, false, nil
+	}
+	record := *claim
+	record.ExpiresAt = s.now.Add(lease)
+	s.records[s.id(claim)] = record
+	return nil, true, nil
+}
+
+func (s *memoryIdempotencyStore) Renew(_ context.Context, claim *domain.IdempotencyRecord, lease time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[s.id(claim)]
+	if !ok || record.Completed || record.LockID != claim.LockID {
+		return nil
+	}
+	record.ExpiresAt = s.now.Add(lease)
+	s.records[s.id(claim)] = record
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Complete(_ context.Context, claim *domain.IdempotencyRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[s.id(claim)]
+	if !ok || record.Completed || record.LockID != claim.LockID {
+		return nil
+	}
+	record.Completed = true
+	record.StatusCode = claim.StatusCode
+	record.ContentType = claim.ContentType
+	record.Body = append([]byte(nil), claim.Body...)
+	record.ExpiresAt = s.now.Add(ttl)
+	s.records[s.id(claim)] = record
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(_ context.Context, claim *domain.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if record, ok := s.records[s.id(claim)]; ok && !record.Completed && record.LockID == claim.LockID {
+		delete(s.records, s.id(claim))
+	}
+	return nil
+}
+
+func (s *memoryIdempotencyStore) advance(d time.Duration) {
+	s.mu.Lock()
+	s.now = s.now.Add(d)
+	s.mu.Unlock()
+}
+
+func TestWithIdempotency(t *testing.T) {
+	const (
+		ttl   = time.Hour
+		lease = time.Minute
+	)
+
+	type step struct {
+		// before runs ahead of the request, e.g. to move the clock of the store
+		before   func(store *memoryIdempotencyStore)
+		apiKeyID string
+		body     string
+		// status is what the handler answers, panic makes it panic instead
+		status   int
+		panic    bool
+		want     int
+		replayed bool
+		// calls is how often the handler ran after this step
+		calls int
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "retry replays the stored response",
+			steps: []step{
+				{body: `{"title":"a"}`, status: http.StatusCreated, want: http.StatusCreated, calls: 1},
+				{body: `{"title":"a"}`, status: http.StatusCreated, want: http.StatusCreated, replayed: true, calls: 1},
+			},
+		},
+		{
+			name: "different body",
+			steps: []step{
+				{body: `{"title":"a"}`, status: http.StatusCreated, want: http.StatusCreated, calls: 1},
+				{body: `{"title":"b"}`, status: http.StatusCreated, want: http.StatusUnprocessableEntity, calls: 1},
+			},
+		},
+		{
+			name: "other api key does not see the response",
+			steps: []step{
+				{apiKeyID: "key-1", body: `{"title":"a"}`, status: http.StatusCreated, want: http.StatusCreated, calls: 1},
+				{apiKeyID: "key-2", body: `{"title":"a"}`, status: http.StatusCreated, want: http.StatusCreated, calls: 2},
+				{apiKeyID: "key-1", body: `{"title":"a"}`, status: http.StatusCreated, want: http.StatusCreated, replayed: true, calls: 2},
+			},
+		},
+		{
+			name: "server error releases the key",
+			steps: []step{
+				{body: `{"title":"a"}`, status: http.StatusServiceUnavailable, want: http.StatusServiceUnavailable, calls: 1},
+				{body: `{"title":"a"}`, status: http.StatusCreated, want: http.StatusCreated, calls: 2},
+			},
+		},
+		{
+			name: "panic releases the key",
+			steps: []step{
+				{body: `{"title":"a"}`, panic: true, calls: 1},
+				{body: `{"title":"a"}`, status: http.StatusCreated, want: http.StatusCreated, calls: 2},
+			},
+		},
+		{
+			name: "stored response expires",
+			steps: []step{
+				{body: `{"title":"a"}`, status: http.StatusCreated, want: http.StatusCreated, calls: 1},
+				{
+					before: func(store *memoryIdempotencyStore) { store.advance(ttl + time.Second) },
+					body:   `{"title":"a"}`, status: http.StatusCreated, want: http.StatusCreated, calls: 2,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryIdempotencyStore()
+			var status int
+			var panics bool
+			calls := 0
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if panics {
+					panic(http.ErrAbortHandler)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				_, _ = w.Write([]byte(`{}`))
+			})
+			handler := WithIdempotency(store, ttl, lease, noBodyLimit, next)
+
+			for i, s := range tt.steps {
+				if s.before != nil {
+					s.before(store)
+				}
+				status, panics = s.status, s.panic
+				req := httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(s.body))
+				req.Header.Set("Idempotency-Key", "key")
+				if s.apiKeyID != "" {
+					req = req.WithContext(context.WithValue(req.Context(), apiKeyIDKey{}, s.apiKeyID))
+				}
+				rec := httptest.NewRecorder()
+				serveRecovering(handler, rec, req)
+
+				if !s.panic && rec.Code != s.want {
+					t.Errorf("step %d: status = %d, want %d", i, rec.Code, s.want)
+				}
+				if got := rec.Header().Get("Idempotent-Replayed") == "true"; got != s.replayed {
+					t.Errorf("step %d: replayed = %v, want %v", i, got, s.replayed)
+				}
+				if calls != s.calls {
+					t.Errorf("step %d: handler ran %d times, want %d", i, calls, s.calls)
+				}
+			}
+		})
+	}
+}
+
+func TestWithIdempotencyLease(t *testing.T) {
+	store := newMemoryIdempotencyStore()
+	// a reservation of the same request that never completes, as if its process crashed
+	stuck := &domain.IdempotencyRecord{
+		Key:         "key",
+		Scope:       "POST /tasks",
+		Fingerprint: requestFingerprint(httptest.NewRequest(http.MethodPost, "/tasks", nil), []byte(`{}`)),
+		LockID:      uuid.New(),
+	}
+	if _, reserved, _ := store.Reserve(context.Background(), stuck, time.Minute); !reserved {
+		t.Fatal("could not reserve")
+	}
+
+	handler := WithIdempotency(store, time.Hour, time.Minute, noBodyLimit, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(`{}`))
+		req.Header.Set("Idempotency-Key", "key")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := send(); rec.Code != http.StatusConflict || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("within the lease: status = %d, Retry-After = %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	store.advance(time.Minute + time.Second)
+	if rec := send(); rec.Code != http.StatusCreated {
+		t.Fatalf("after the lease: status = %d, want %d", rec.Code, http.StatusCreated)
+	}
+	// the stuck request finishing late must not overwrite the response of the takeover
+	stuck.StatusCode = http.StatusTeapot
+	_ = store.Complete(context.Background(), stuck, time.Hour)
+	if rec := send(); rec.Code != http.StatusCreated || rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("replay: status = %d, replayed = %q", rec.Code, rec.Header().Get("Idempotent-Replayed"))
+	}
+}
+
+func TestWithIdempotencyRenewsLease(t *testing.T) {
+	const lease = 30 * time.Millisecond
+	store := newMemoryIdempotencyStore()
+	send := func(handler http.Handler) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/tasks", strings.NewReader(`{}`))
+		req.Header.Set("Idempotency-Key", "key")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	// waitRenewal waits until the lease runs for more than half of it from the current time
+	waitRenewal := func() {
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			store.mu.Lock()
+			record := store.records[store.id(&domain.IdempotencyRecord{Key: "key", Scope: "POST /tasks"})]
+			renewed := record.ExpiresAt.After(store.now.Add(lease / 2))
+			store.mu.Unlock()
+			if renewed {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Fatal("lease was not renewed")
+	}
+
+	var retry *httptest.ResponseRecorder
+	var handler http.Handler
+	handler = WithIdempotency(store, time.Hour, lease, noBodyLimit, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// outlive the first lease by far, a renewal after each step keeps the key held
+		for i := 0; i < 3; i++ {
+			store.advance(lease * 3 / 4)
+			waitRenewal()
+		}
+		retry = send(handler)
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	if rec := send(handler); rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusCreated)
+	}
+	if retry.Code != http.StatusConflict {
+		t.Errorf("retry during a renewed lease: status = %d, want %d", retry.Code, http.StatusConflict)
+	}
+}
+
+func TestWithIdempotencyBodyLimit(t *testing.T) {
+	api := newTestAPI(t, func(cfg *config.Config) {
+		cfg.API.MaxBodyBytes = 64
+		cfg.API.MaxImportBytes = 1 << 10
+	})
+	csv := "title\n" + strings.Repeat("a", 200) + "\n"
+
+	req := httptest.NewRequest(http.MethodPost, "/tasks/import", strings.NewReader(csv))
+	req.Header.Set("Content-Type", "text/csv")
+	req.Header.Set("Idempotency-Key", "import")
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+	if rec.Code == http.StatusRequestEntityTooLarge {
+		t.Fatalf("import under MaxImportBytes rejected: %s", rec.Body)
+	}
+
+	body := `{"title":"` + strings.Repeat("a", 100) + `"}`
+	if rec := api.do(t, http.MethodPost, "/tasks", body, "Idempotency-Key", "create"); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("create over MaxBodyBytes: status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func noBodyLimit(*http.Request) int64 { return 0 }
+
+// serveRecovering serves the request like net/http does, which recovers a panicking handler
+func serveRecovering(handler http.Handler, w http.ResponseWriter, r *http.Request) {
+	defer func() { _ = recover() }()
+	handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+// importFields are the task fields a column can be mapped to
+var importFields = []string{"id", "title", "description", "status", "created_at", "updated_at"}
+
+// ImportTasks импортирует задачи из CSV или NDJSON
+func (h *Handler) ImportTasks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var fields []domain.FieldError
+	dryRun := false
+	if raw := query.Get("dry_run"); raw != "" {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			fields = append(fields, domain.FieldError{Field: "dry_run", Code: "invalid_boolean", Message: "invalid dry_run"})
+		}
+		dryRun = value
+	}
+	mapping, err := parseImportMapping(query.Get("mapping"))
+	if err != nil {
+		fields = append(fields, domain.FieldError{Field: "mapping", Code: "invalid_mapping", Message: err.Error()})
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, fields)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var parse func(io.Reader, map[string]string) ([]domain.ImportRecord, error)
+	switch mediaType {
+	case "text/csv":
+		parse = parseImportCSV
+	case "application/x-ndjson":
+		parse = parseImportNDJSON
+	default:
+		writeError(w, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, "import accepts text/csv or application/x-ndjson")
+		return
+	}
+
+	body := r.Body
+	if h.cfg.MaxImportBytes > 0 {
+		body = http.MaxBytesReader(w, r.Body, h.cfg.MaxImportBytes)
+	}
+	records, err := parse(body, mapping)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, codePayloadTooLarge, "import file too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, codeInvalidBody, err.Error())
+		return
+	}
+
+	report, err := h.taskService.Import(r.Context(), records, dryRun)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// parseImportMapping reads "title:Summary,description:Details" into field -> column.
+// Fields without a mapping are read from a column of the same name.
+func parseImportMapping(raw string) (map[string]string, error) {
+	mapping := make(map[string]string, len(importFields))
+	for _, field := range importFields {
+		mapping[field] = field
+	}
+	if strings.TrimSpace(raw) == "" {
+		return mapping, nil
+	}
+	for _, pair := range strings.Split(raw, ",") {
+		field, column, ok := strings.Cut(pair, ":")
+		field, column = strings.TrimSpace(field), strings.TrimSpace(column)
+		if !ok || column == "" {
+			return nil, fmt.Errorf("mapping %q: want field:column", pair)
+		}
+		if _, known := mapping[field]; !known {
+			return nil, fmt.Errorf("mapping %q: unknown field, want one of %s", pair, strings.Join(importFields, ", "))
+		}
+		mapping[field] = column
+	}
+	return mapping, nil
+}
+
+// parseImportCSV needs a header row. A malformed file fails as a whole, since
+// after a quoting error the row boundaries can no longer be trusted.
+func parseImportCSV(body io.Reader, mapping map[string]string) ([]domain.ImportRecord, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("csv file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("csv header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	index := make(map[string]int, len(mapping))
+	for field, column := range mapping {
+		if i, ok := columns[strings.ToLower(column)]; ok {
+			index[field] = i
+		}
+	}
+	if _, ok := index["title"]; !ok {
+		return nil, fmt.Errorf("csv header has no %q column for title", mapping["title"])
+	}
+
+	records := make([]domain.ImportRecord, 0)
+	for row := 1; ; row++ {
+		values, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var maxBytes *http.MaxBytesError
+			if errors.As(err, &maxBytes) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("csv row %d: %w", row, err)
+		}
+		if len(values) == 1 && strings.TrimSpace(values[0]) == "" {
+			row--
+			continue
+		}
+		get := func(field string) string {
+			if i, ok := index[field]; ok && i < len(values) {
+				return values[i]
+			}
+			return ""
+		}
+		records = append(records, domain.ImportRecord{
+			Row:         row,
+			ID:          get("id"),
+			Title:       csvValue(get("title")),
+			Description: csvValue(get("description")),
+			Status:      get("status"),
+			CreatedAt:   get("created_at"),
+			UpdatedAt:   get("updated_at"),
+		})
+	}
+	return records, nil
+}
+
+// csvValue undoes csvCell, so an export imports back unchanged
+func csvValue(cell string) string {
+	if strings.HasPrefix(cell, "'") && isCSVFormula(cell) {
+		return cell[1:]
+	}
+	return cell
+}
+
+// parseImportNDJSON reads one object per line. Lines are independent, so a broken
+// line fails only its own row.
+func parseImportNDJSON(body io.Reader, mapping map[string]string) ([]domain.ImportRecord, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+
+	records := make([]domain.ImportRecord, 0)
+	row := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		row++
+		record := domain.ImportRecord{Row: row}
+
+		var object map[string]any
+		if err := json.Unmarshal([]byte(line), &object); err != nil {
+			record.ParseErrors = []domain.FieldError{{Field: "row", Code: "invalid_json", Message: "line is not a JSON object"}}
+			records = append(records, record)
+			continue
+		}
+		values := make(map[string]string, len(mapping))
+		for field, key := range mapping {
+			switch value := object[key].(type) {
+			case nil:
+			case string:
+				values[field] = value
+			default:
+				record.ParseErrors = append(record.ParseErrors, domain.FieldError{Field: field, Code: "invalid_type", Message: "must be a string"})
+			}
+		}
+		record.ID = values["id"]
+		record.Title = values["title"]
+		record.Description = values["description"]
+		record.Status = values["status"]
+		record.CreatedAt = values["created_at"]
+		record.UpdatedAt = values["updated_at"]
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		var maxBytes *http.MaxBytesError
+		if errors.As(err, &maxBytes) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("ndjson line %d: %w", row+1, err)
+	}
+	return records, nil
+}
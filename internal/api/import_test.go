@@ -0,0 +1,216 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/config"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+func TestParseImportCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		mapping string
+		want    []domain.ImportRecord
+		wantErr string
+	}{
+		{
+			name: "export columns",
+			body: "id,title,description,status,created_at,updated_at\n" +
+				"6f1c1f5e-8f5a-4b1e-9a57-6f1d9f0f6a11,Buy milk,\"2 l, cold\",done,2024-01-05T10:00:00Z,2024-01-06T10:00:00Z\n",
+			want: []domain.ImportRecord{{
+				Row: 1, ID: "6f1c1f5e-8f5a-4b1e-9a57-6f1d9f0f6a11", Title: "Buy milk", Description: "2 l, cold",
+				Status: "done", CreatedAt: "2024-01-05T10:00:00Z", UpdatedAt: "2024-01-06T10:00:00Z",
+			}},
+		},
+		{
+			name:    "mapped columns, any case, BOM and blank lines",
+			body:    "\ufeffSummary,DETAILS,Extra\nFirst,one,x\n\nSecond,two,y\n",
+			mapping: "title:Summary,description:details",
+			want: []domain.ImportRecord{
+				{Row: 1, Title: "First", Description: "one"},
+				{Row: 2, Title: "Second", Description: "two"},
+			},
+		},
+		{
+			name: "short rows leave fields empty",
+			body: "title,status\nonly title\n",
+			want: []domain.ImportRecord{{Row: 1, Title: "only title"}},
+		},
+		{name: "empty file", body: "", wantErr: "csv file is empty"},
+		{name: "no title column", body: "name\nx\n", wantErr: `no "title" column`},
+		{name: "title mapped to a missing column", body: "title\nx\n", mapping: "title:Summary", wantErr: `no "Summary" column`},
+		{name: "broken quoting", body: "title\n\"unterminated\n", wantErr: "csv row 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := parseImportCSV(strings.NewReader(tt.body), mustImportMapping(t, tt.mapping))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			assertImportRecords(t, records, tt.want)
+		})
+	}
+}
+
+func TestParseImportNDJSON(t *testing.T) {
+	body := `{"Summary":"First","title":"ignored","status":"new"}` + "\n" +
+		"\n" +
+		`not json` + "\n" +
+		`{"Summary":"Mapped","description":7}` + "\n"
+	records, err := parseImportNDJSON(strings.NewReader(body), mustImportMapping(t, "title:Summary"))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	assertImportRecords(t, records, []domain.ImportRecord{
+		{Row: 1, Title: "First", Status: "new"},
+		{Row: 2, ParseErrors: []domain.FieldError{{Field: "row", Code: "invalid_json"}}},
+		{Row: 3, Title: "Mapped", ParseErrors: []domain.FieldError{{Field: "description", Code: "invalid_type"}}},
+	})
+}
+
+func TestParseImportMapping(t *testing.T) {
+	for _, raw := range []string{"title", "title:", "name:Summary"} {
+		if _, err := parseImportMapping(raw); err == nil {
+			t.Errorf("mapping %q: want an error", raw)
+		}
+	}
+}
+
+func TestImportTasks(t *testing.T) {
+	existing := uuid.New()
+	body := "id,title,status,created_at\n" +
+		existing.String() + ",Taken,new,\n" +
+		",Fresh,done,2024-01-05T10:00:00Z\n" +
+		",,new,\n" +
+		",Bad status,archived,\n" +
+		"not-a-uuid,Bad id,new,yesterday\n"
+
+	tests := []struct {
+		name   string
+		target string
+		stored int
+	}{
+		{name: "import", target: "/tasks/import", stored: 2},
+		{name: "dry run", target: "/tasks/import?dry_run=true", stored: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(t, nil)
+			api.repo.Put(domain.Task{ID: existing, Title: "Taken", Status: domain.TaskStatusNew, CreatedAt: time.Now(), UpdatedAt: time.Now()})
+
+			rec := api.do(t, http.MethodPost, tt.target, body, "Content-Type", "text/csv")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			var report domain.ImportReport
+			decodeBody(t, rec, &report)
+			if report.Total != 5 || report.Created != 1 || report.Skipped != 1 || report.Failed != 3 {
+				t.Errorf("report = %+v, want 5 rows: 1 created, 1 skipped, 3 failed", report)
+			}
+
+			want := []struct {
+				row    int
+				result domain.ImportRowResult
+				fields []string
+			}{
+				{row: 1, result: domain.ImportRowSkipped},
+				{row: 3, result: domain.ImportRowFailed, fields: []string{"title"}},
+				{row: 4, result: domain.ImportRowFailed, fields: []string{"status"}},
+				{row: 5, result: domain.ImportRowFailed, fields: []string{"id", "created_at"}},
+			}
+			if len(report.Rows) != len(want) {
+				t.Fatalf("rows = %+v, want %d", report.Rows, len(want))
+			}
+			for i, w := range want {
+				got := report.Rows[i]
+				if got.Row != w.row || got.Result != w.result {
+					t.Errorf("rows[%d] = row %d %s, want row %d %s", i, got.Row, got.Result, w.row, w.result)
+				}
+				fields := make([]string, 0, len(got.Errors))
+				for _, field := range got.Errors {
+					fields = append(fields, field.Field)
+				}
+				if strings.Join(fields, ",") != strings.Join(w.fields, ",") {
+					t.Errorf("row %d errors on %v, want %v", got.Row, fields, w.fields)
+				}
+			}
+
+			var stored int
+			_ = api.repo.Each(context.Background(), "", func(domain.Task) error {
+				stored++
+				return nil
+			})
+			if stored != tt.stored {
+				t.Errorf("%d tasks stored, want %d", stored, tt.stored)
+			}
+			if dryRun := strings.Contains(tt.target, "dry_run"); dryRun != report.DryRun || dryRun == (len(api.repo.Events()) > 0) {
+				t.Errorf("dry_run = %v with %d events logged", report.DryRun, len(api.repo.Events()))
+			}
+		})
+	}
+}
+
+func TestImportTasksRejects(t *testing.T) {
+	api := newTestAPI(t, func(cfg *config.Config) { cfg.API.MaxImportBytes = 64 })
+
+	tests := []struct {
+		name        string
+		target      string
+		body        string
+		contentType string
+		status      int
+	}{
+		{name: "unknown media type", target: "/tasks/import", body: "title\nx\n", contentType: "application/pdf", status: http.StatusUnsupportedMediaType},
+		{name: "bad dry_run", target: "/tasks/import?dry_run=maybe", body: "title\nx\n", contentType: "text/csv", status: http.StatusBadRequest},
+		{name: "bad mapping", target: "/tasks/import?mapping=owner:Name", body: "title\nx\n", contentType: "text/csv", status: http.StatusBadRequest},
+		{name: "malformed csv", target: "/tasks/import", body: "title\n\"x\n", contentType: "text/csv", status: http.StatusBadRequest},
+		{name: "over the import limit", target: "/tasks/import", body: "title\n" + strings.Repeat("long title\n", 10), contentType: "text/csv", status: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := api.do(t, http.MethodPost, tt.target, tt.body, "Content-Type", tt.contentType)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
+
+func assertImportRecords(t *testing.T, got, want []domain.ImportRecord) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("records = %+v, want %d", got, len(want))
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.Row != w.Row || g.ID != w.ID || g.Title != w.Title || g.Description != w.Description ||
+			g.Status != w.Status || g.CreatedAt != w.CreatedAt || g.UpdatedAt != w.UpdatedAt {
+			t.Errorf("records[%d] = %+v, want %+v", i, g, w)
+		}
+		if len(g.ParseErrors) != len(w.ParseErrors) {
+			t.Errorf("records[%d] parse errors = %+v, want %+v", i, g.ParseErrors, w.ParseErrors)
+			continue
+		}
+		for j := range w.ParseErrors {
+			if g.ParseErrors[j].Field != w.ParseErrors[j].Field || g.ParseErrors[j].Code != w.ParseErrors[j].Code {
+				t.Errorf("records[%d] parse errors = %+v, want %+v", i, g.ParseErrors, w.ParseErrors)
+			}
+		}
+	}
+}
@@ -0,0 +1,567 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// bodyCodec converts the JSON documents of the API to another format and back. Handlers
+// only speak JSON, WithContentNegotiation translates request and response bodies.
+type bodyCodec struct {
+	mediaType string
+	// aliases are accepted in Content-Type and Accept in place of mediaType
+	aliases []string
+	// accepts reports whether a body of the schema has a form in the format, nil when all have
+	accepts func(target bodySchema) bool
+	// fromJSON and toJSON get the schema of the JSON body for formats that need it
+	fromJSON func(raw []byte, source bodySchema) ([]byte, error)
+	toJSON   func(body []byte, target bodySchema) ([]byte, error)
+}
+
+// bodySchema is the schema of a request or response body with the components it refers to
+type bodySchema struct {
+	schema  *Schema
+	schemas map[string]*Schema
+}
+
+// bodyFieldErrors are values of a request body that do not fit the type of their field
+type bodyFieldErrors []domain.FieldError
+
+func (e bodyFieldErrors) Error() string {
+	return fmt.Sprintf("%d fields do not match their type", len(e))
+}
+
+var bodyCodecs = []bodyCodec{
+	{
+		mediaType: "application/msgpack",
+		aliases:   []string{"application/x-msgpack", "application/vnd.msgpack"},
+		fromJSON:  msgpackFromJSON,
+		toJSON:    msgpackToJSON,
+	},
+	{
+		// only the bodies that have a tasks.v1 message, see protobufMessages
+		mediaType: "application/x-protobuf",
+		aliases:   []string{"application/protobuf", "application/vnd.google.protobuf"},
+		accepts:   hasProtobufMessage,
+		fromJSON:  protobufFromJSON,
+		toJSON:    protobufToJSON,
+	},
+	{
+		mediaType: "application/yaml",
+		aliases:   []string{"application/x-yaml", "text/yaml"},
+		fromJSON:  yamlFromJSON,
+		toJSON:    yamlToJSON,
+	},
+}
+
+// codecFor finds the codec of a media type, nil for JSON and types without one
+func codecFor(header string) *bodyCodec {
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return nil
+	}
+	for i := range bodyCodecs {
+		codec := &bodyCodecs[i]
+		if strings.EqualFold(codec.mediaType, mediaType) {
+			return codec
+		}
+		for _, alias := range codec.aliases {
+			if strings.EqualFold(alias, mediaType) {
+				return codec
+			}
+		}
+	}
+	return nil
+}
+
+// WithContentNegotiation lets clients of the operations in doc send and receive the JSON
+// bodies as MessagePack, Protobuf or YAML. Request bodies are converted to JSON before
+// they reach next, 415 when the Content-Type is not supported. JSON responses are
+// converted to the format Accept prefers, 406 when it accepts none the operation produces.
+// Errors stay application/problem+json.
+func WithContentNegotiation(doc *OpenAPIDocument, maxBodyBytes int64, next http.Handler) http.Handler {
+	routes := specRoutes(doc)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, _ := matchSpecRoute(routes, r)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if route.op.RequestBody != nil && r.ContentLength != 0 && !transcodeRequest(w, r, route.op.RequestBody, doc.Components.Schemas, maxBodyBytes) {
+			return
+		}
+
+		offers := responseOffers(route.op)
+		if len(offers) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept")
+		mediaType, ok := negotiateMediaType(r, offers...)
+		if !ok {
+			writeError(w, http.StatusNotAcceptable, codeNotAcceptable, "no acceptable media type, supported: "+strings.Join(withoutAliases(offers), ", "))
+			return
+		}
+		codec := codecFor(mediaType)
+		if codec == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		tw := &transcodingWriter{ResponseWriter: w, codec: codec, mediaType: mediaType, responses: route.op.Responses, schemas: doc.Components.Schemas}
+		next.ServeHTTP(tw, r)
+		tw.finish(r)
+	})
+}
+
+// transcodeRequest replaces a body in the format of a codec with its JSON. It writes the
+// error response itself and reports whether the request may proceed.
+func transcodeRequest(w http.ResponseWriter, r *http.Request, body *openAPIRequestBody, schemas map[string]*Schema, maxBodyBytes int64) bool {
+	header := r.Header.Get("Content-Type")
+	jsonBody, acceptsJSON := body.Content["application/json"]
+	codec := codecFor(header)
+	if codec == nil || !acceptsJSON {
+		if _, ok := matchContentType(body.Content, header); !ok {
+			writeError(w, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, "unsupported content type")
+			return false
+		}
+		return true
+	}
+	if _, ok := body.Content[codec.mediaType]; !ok {
+		writeError(w, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, "unsupported content type")
+		return false
+	}
+
+	reader := r.Body
+	if maxBodyBytes > 0 {
+		reader = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	}
+	raw, err := io.ReadAll(reader)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, codePayloadTooLarge, "request body too large")
+			return false
+		}
+		writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid body")
+		return false
+	}
+	if len(raw) > 0 {
+		if raw, err = codec.toJSON(raw, bodySchema{schema: jsonBody.Schema, schemas: schemas}); err != nil {
+			var fields bodyFieldErrors
+			if errors.As(err, &fields) {
+				writeValidationError(w, fields)
+				return false
+			}
+			writeError(w, http.StatusBadRequest, codeInvalidBody, "invalid "+codec.mediaType+" body")
+			return false
+		}
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(raw))
+	r.ContentLength = int64(len(raw))
+	r.Header.Set("Content-Type", "application/json")
+	return true
+}
+
+// responseOffers lists the media types the operation can answer with: JSON and the
+// formats of bodyCodecs every JSON response has a form in, then its other types.
+// Problem documents are left out, errors are sent whatever the client accepts.
+func responseOffers(op *openAPIOperation) []string {
+	var jsonResponses []openAPIResponse
+	others := make(map[string]bool)
+	for _, response := range op.Responses {
+		for mediaType := range response.Content {
+			switch {
+			case mediaType == "application/json":
+				jsonResponses = append(jsonResponses, response)
+			case mediaType != problemContentType && codecFor(mediaType) == nil:
+				others[mediaType] = true
+			}
+		}
+	}
+
+	var offers []string
+	if len(jsonResponses) > 0 {
+		offers = append(offers, "application/json")
+	codecs:
+		for _, codec := range bodyCodecs {
+			for _, response := range jsonResponses {
+				if _, ok := response.Content[codec.mediaType]; !ok {
+					continue codecs
+				}
+			}
+			offers = append(offers, codec.mediaType)
+			offers = append(offers, codec.aliases...)
+		}
+	}
+	rest := make([]string, 0, len(others))
+	for mediaType := range others {
+		rest = append(rest, mediaType)
+	}
+	sort.Strings(rest)
+	return append(offers, rest...)
+}
+
+func withoutAliases(offers []string) []string {
+	var out []string
+	for _, offer := range offers {
+		if codec := codecFor(offer); codec == nil || codec.mediaType == offer {
+			out = append(out, offer)
+		}
+	}
+	return out
+}
+
+// transcodingWriter holds back a JSON response and sends it in the negotiated format when
+// the handler is done, other responses pass through
+type transcodingWriter struct {
+	http.ResponseWriter
+	codec       *bodyCodec
+	mediaType   string
+	responses   map[string]openAPIResponse
+	schemas     map[string]*Schema
+	status      int
+	wroteHeader bool
+	buffering   bool
+	body        bytes.Buffer
+}
+
+func (t *transcodingWriter) WriteHeader(status int) {
+	if t.wroteHeader {
+		return
+	}
+	t.wroteHeader = true
+	header := t.Header()
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	// attachments are files in the format the request asked for, like the JSON export,
+	// and are streamed as they are
+	if mediaType == "application/json" && header.Get("Content-Disposition") == "" &&
+		status != http.StatusNoContent && status != http.StatusNotModified {
+		t.status, t.buffering = status, true
+		return
+	}
+	t.ResponseWriter.WriteHeader(status)
+}
+
+func (t *transcodingWriter) Write(p []byte) (int, error) {
+	if !t.wroteHeader {
+		t.WriteHeader(http.StatusOK)
+	}
+	if t.buffering {
+		return t.body.Write(p)
+	}
+	return t.ResponseWriter.Write(p)
+}
+
+// FlushError keeps a held back response from being sent early
+func (t *transcodingWriter) FlushError() error {
+	if t.buffering {
+		return nil
+	}
+	return http.NewResponseController(t.ResponseWriter).Flush()
+}
+
+func (t *transcodingWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+func (t *transcodingWriter) finish(r *http.Request) {
+	if !t.buffering {
+		return
+	}
+	body := t.body.Bytes()
+	if len(body) > 0 {
+		source := bodySchema{schemas: t.schemas}
+		if content, ok := t.responses[strconv.Itoa(t.status)].Content[t.codec.mediaType]; ok {
+			source.schema = content.Schema
+		}
+		out, err := t.codec.fromJSON(body, source)
+		if err != nil {
+			// the handler wrote invalid JSON, send it as it is rather than nothing
+			log.Printf("encode %s response %s %s: %v (request %s)", t.codec.mediaType, r.Method, r.URL.Path, err, RequestID(r.Context()))
+		} else {
+			body = out
+			t.Header().Set("Content-Type", t.mediaType)
+		}
+	}
+	t.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	t.ResponseWriter.WriteHeader(t.status)
+	_, _ = t.ResponseWriter.Write(body)
+}
+
+// decodeJSONValue decodes a document with integers kept as int64, so encoders that
+// distinguish them do not turn ids and counters into floats
+func decodeJSONValue(raw []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return plainNumbers(value), nil
+}
+
+func plainNumbers(value any) any {
+	switch value := value.(type) {
+	case json.Number:
+		if n, err := value.Int64(); err == nil {
+			return n
+		}
+		n, _ := value.Float64()
+		return n
+	case map[string]any:
+		for key, item := range value {
+			value[key] = plainNumbers(item)
+		}
+	case []any:
+		for i, item := range value {
+			value[i] = plainNumbers(item)
+		}
+	}
+	return value
+}
+
+func msgpackFromJSON(raw []byte, _ bodySchema) ([]byte, error) {
+	value, err := decodeJSONValue(raw)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	encoder := msgpack.NewEncoder(&buf)
+	encoder.SetSortMapKeys(true)
+	encoder.UseCompactInts(true)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func msgpackToJSON(body []byte, _ bodySchema) ([]byte, error) {
+	var value any
+	if err := msgpack.Unmarshal(body, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// yamlFromJSON writes the document with the keys of its objects in their JSON order
+func yamlFromJSON(raw []byte, _ bodySchema) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	node, err := yamlNode(decoder)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(node)
+}
+
+func yamlNode(decoder *json.Decoder) (*yaml.Node, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	node := &yaml.Node{Kind: yaml.ScalarNode}
+	switch token := token.(type) {
+	case json.Delim:
+		node.Kind = yaml.SequenceNode
+		if token == '{' {
+			node.Kind = yaml.MappingNode
+		}
+		for decoder.More() {
+			if node.Kind == yaml.MappingNode {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key.(string)})
+			}
+			value, err := yamlNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, value)
+		}
+		_, err = decoder.Token()
+		return node, err
+	case json.Number:
+		node.Tag, node.Value = "!!float", token.String()
+		if _, err := token.Int64(); err == nil {
+			node.Tag = "!!int"
+		}
+	case nil:
+		node.Tag, node.Value = "!!null", "null"
+	default:
+		// Encode quotes strings that YAML 1.1 readers take for other types, like "no"
+		if err := node.Encode(token); err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+// yamlToJSON reads scalars by the type of their field rather than by how they look, so
+// "title: no" stays a string and "title: 123" too; a value that cannot have the type of
+// its field is a field error
+func yamlToJSON(body []byte, target bodySchema) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 {
+		// an empty document
+		return []byte("null"), nil
+	}
+	var fields []domain.FieldError
+	value, err := target.yamlValue("", &doc, target.schema, &fields)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) > 0 {
+		return nil, bodyFieldErrors(fields)
+	}
+	return json.Marshal(value)
+}
+
+func (b bodySchema) resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = b.schemas[strings.TrimPrefix(schema.Ref, schemaRefBase)]
+	}
+	return schema
+}
+
+// property finds the schema of a key of an object, also in the parts of an allOf
+func (b bodySchema) property(schema *Schema, key string) *Schema {
+	schema = b.resolve(schema)
+	if schema == nil {
+		return nil
+	}
+	if property, ok := schema.Properties[key]; ok {
+		return property
+	}
+	for _, part := range schema.AllOf {
+		if property := b.property(part, key); property != nil {
+			return property
+		}
+	}
+	return schema.AdditionalProperties
+}
+
+// scalarType is the JSON type a YAML scalar is read as, "" when the schema leaves it open
+func (b bodySchema) scalarType(schema *Schema) schemaType {
+	schema = b.resolve(schema)
+	if schema == nil {
+		return nil
+	}
+	if len(schema.Type) > 0 {
+		return schema.Type
+	}
+	for _, part := range schema.AllOf {
+		if t := b.scalarType(part); len(t) > 0 {
+			return t
+		}
+	}
+	return nil
+}
+
+func (b bodySchema) yamlValue(path string, node *yaml.Node, schema *Schema, fields *[]domain.FieldError) (any, error) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return b.yamlValue(path, node.Content[0], schema, fields)
+	case yaml.AliasNode:
+		return b.yamlValue(path, node.Alias, schema, fields)
+	case yaml.MappingNode:
+		object := make(map[string]any, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			if key.Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("line %d: keys must be scalars", key.Line)
+			}
+			value, err := b.yamlValue(joinPath(path, key.Value), node.Content[i+1], b.property(schema, key.Value), fields)
+			if err != nil {
+				return nil, err
+			}
+			object[key.Value] = value
+		}
+		return object, nil
+	case yaml.SequenceNode:
+		var items *Schema
+		if resolved := b.resolve(schema); resolved != nil {
+			items = resolved.Items
+		}
+		array := make([]any, 0, len(node.Content))
+		for i, item := range node.Content {
+			value, err := b.yamlValue(fmt.Sprintf("%s[%d]", path, i), item, items, fields)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		return array, nil
+	}
+	return b.yamlScalar(path, node, b.scalarType(schema), fields)
+}
+
+func (b bodySchema) yamlScalar(path string, node *yaml.Node, want schemaType, fields *[]domain.FieldError) (any, error) {
+	tag := node.ShortTag()
+	if tag == "!!null" {
+		return nil, nil
+	}
+	fail := func() (any, error) {
+		name := path
+		if name == "" {
+			name = "body"
+		}
+		*fields = append(*fields, fieldError(name, "type", "must be "+describeType(want)))
+		return nil, nil
+	}
+	switch {
+	case want.has("integer") && tag == "!!int":
+		var n int64
+		if err := node.Decode(&n); err != nil {
+			return fail()
+		}
+		return n, nil
+	case want.has("number") && (tag == "!!int" || tag == "!!float"):
+		var n float64
+		if err := node.Decode(&n); err != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+			return fail()
+		}
+		return n, nil
+	case want.has("boolean") && tag == "!!bool":
+		var value bool
+		if err := node.Decode(&value); err != nil {
+			return fail()
+		}
+		return value, nil
+	case want.has("string"):
+		// the text as written, whatever YAML would make of it
+		return node.Value, nil
+	case len(want) > 0:
+		return fail()
+	}
+
+	var value any
+	if err := node.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
@@ -0,0 +1,409 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	tasksv1 "github.com/nightmaker00/go-tasks-api/pkg/pb/tasks/v1"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+func TestContentNegotiationCodecs(t *testing.T) {
+	msgpackBody, err := msgpack.Marshal(map[string]any{"title": "Buy milk", "description": "2 l"})
+	if err != nil {
+		t.Fatalf("encode msgpack: %v", err)
+	}
+	tests := []struct {
+		mediaType string
+		body      string
+		decode    func(body []byte, v any) error
+	}{
+		{mediaType: "application/msgpack", body: string(msgpackBody), decode: msgpack.Unmarshal},
+		{mediaType: "application/x-msgpack", body: string(msgpackBody), decode: msgpack.Unmarshal},
+		{mediaType: "application/yaml", body: "title: Buy milk\ndescription: 2 l\n", decode: yaml.Unmarshal},
+		{mediaType: "text/yaml", body: "{title: Buy milk, description: 2 l}", decode: yaml.Unmarshal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mediaType, func(t *testing.T) {
+			api := newTestAPI(t, nil)
+			rec := api.do(t, http.MethodPost, "/tasks", tt.body, "Content-Type", tt.mediaType, "Accept", tt.mediaType)
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("create: status = %d: %s", rec.Code, rec.Body)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.mediaType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.mediaType)
+			}
+			var created struct {
+				ID string `msgpack:"id" yaml:"id"`
+			}
+			if err := tt.decode(rec.Body.Bytes(), &created); err != nil {
+				t.Fatalf("decode create response: %v", err)
+			}
+			id, err := uuid.Parse(created.ID)
+			if err != nil {
+				t.Fatalf("id %q: %v", created.ID, err)
+			}
+
+			rec = api.do(t, http.MethodGet, "/tasks/"+id.String(), "", "Accept", tt.mediaType)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("get: status = %d: %s", rec.Code, rec.Body)
+			}
+			var task struct {
+				Title       string `msgpack:"title" yaml:"title"`
+				Description string `msgpack:"description" yaml:"description"`
+				Status      string `msgpack:"status" yaml:"status"`
+			}
+			if err := tt.decode(rec.Body.Bytes(), &task); err != nil {
+				t.Fatalf("decode task: %v", err)
+			}
+			if task.Title != "Buy milk" || task.Description != "2 l" || task.Status != string(domain.TaskStatusNew) {
+				t.Errorf("task = %+v", task)
+			}
+			if vary := rec.Header().Values("Vary"); !containsValue(vary, "Accept") {
+				t.Errorf("Vary = %v, want Accept", vary)
+			}
+		})
+	}
+}
+
+func TestYAMLRequestScalarsFollowSchema(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		title       string
+		description string
+	}{
+		{name: "yes and no are strings", body: "title: no\ndescription: yes\n", title: "no", description: "yes"},
+		{name: "numbers are strings", body: "title: 123\ndescription: 1.50\n", title: "123", description: "1.50"},
+		{name: "octal is kept", body: "title: 0755\n", title: "0755"},
+		{name: "dates are strings", body: "title: 2024-01-02\n", title: "2024-01-02"},
+		{name: "quoted strings", body: "title: \"true\"\ndescription: 'null'\n", title: "true", description: "null"},
+		{name: "anchors", body: "title: &t shared\ndescription: *t\n", title: "shared", description: "shared"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(t, nil)
+			rec := api.do(t, http.MethodPost, "/tasks", tt.body, "Content-Type", "application/yaml")
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			var created domain.CreateTaskResponse
+			decodeBody(t, rec, &created)
+
+			rec = api.do(t, http.MethodGet, "/tasks/"+created.ID.String(), "")
+			var task domain.Task
+			decodeBody(t, rec, &task)
+			if task.Title != tt.title || task.Description != tt.description {
+				t.Errorf("title %q, description %q, want %q and %q", task.Title, task.Description, tt.title, tt.description)
+			}
+		})
+	}
+}
+
+func TestYAMLRequestFieldErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		status int
+		fields []string
+	}{
+		{
+			name:   "boolean",
+			target: "/webhooks",
+			body:   "url: https://hooks.example.com/tasks\nactive: false\n",
+			status: http.StatusCreated,
+		},
+		{
+			name:   "yes is not a boolean",
+			target: "/webhooks",
+			body:   "url: https://hooks.example.com/tasks\nactive: yes\n",
+			status: http.StatusBadRequest,
+			fields: []string{"active"},
+		},
+		{
+			name:   "number is not a boolean",
+			target: "/webhooks",
+			body:   "url: https://hooks.example.com/tasks\nactive: 1\n",
+			status: http.StatusBadRequest,
+			fields: []string{"active"},
+		},
+		{
+			name:   "string items",
+			target: "/webhooks",
+			body:   "url: https://hooks.example.com/tasks\nevent_types: [task.created, 12]\n",
+			status: http.StatusBadRequest,
+			// 12 is read as a string and then fails the enum
+			fields: []string{"event_types[1]"},
+		},
+		{
+			name:   "not a document",
+			target: "/tasks",
+			body:   "title: [unclosed\n",
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(t, nil)
+			rec := api.do(t, http.MethodPost, tt.target, tt.body, "Content-Type", "application/yaml")
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.fields == nil {
+				return
+			}
+			var problem domain.Problem
+			decodeBody(t, rec, &problem)
+			var fields []string
+			for _, field := range problem.Errors {
+				fields = append(fields, field.Field)
+			}
+			for _, want := range tt.fields {
+				if !containsValue(fields, want) {
+					t.Errorf("errors on %v, want one on %s: %s", fields, want, rec.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestContentNegotiationErrors(t *testing.T) {
+	api := newTestAPI(t, nil)
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		header []string
+		status int
+		code   string
+	}{
+		{name: "accept nothing offered", method: http.MethodGet, target: "/tasks", header: []string{"Accept", "application/xml"}, status: http.StatusNotAcceptable, code: codeNotAcceptable},
+		{name: "no protobuf message", method: http.MethodGet, target: "/tasks/stats", header: []string{"Accept", "application/x-protobuf"}, status: http.StatusNotAcceptable, code: codeNotAcceptable},
+		{name: "excluded by q=0", method: http.MethodGet, target: "/tasks", header: []string{"Accept", "application/json;q=0, application/msgpack;q=0"}, status: http.StatusNotAcceptable, code: codeNotAcceptable},
+		{name: "wildcard", method: http.MethodGet, target: "/tasks", header: []string{"Accept", "*/*"}, status: http.StatusOK},
+		{name: "unsupported content type", method: http.MethodPost, target: "/tasks", body: "title=a", header: []string{"Content-Type", "application/x-www-form-urlencoded"}, status: http.StatusUnsupportedMediaType, code: codeUnsupportedMediaType},
+		{name: "protobuf body without a message", method: http.MethodPost, target: "/webhooks", body: "\x0a\x01a", header: []string{"Content-Type", "application/x-protobuf"}, status: http.StatusUnsupportedMediaType, code: codeUnsupportedMediaType},
+		{name: "invalid protobuf", method: http.MethodPost, target: "/tasks", body: "\x0a\x05a", header: []string{"Content-Type", "application/x-protobuf"}, status: http.StatusBadRequest, code: codeInvalidBody},
+		{name: "invalid msgpack", method: http.MethodPost, target: "/tasks", body: "\xc1", header: []string{"Content-Type", "application/msgpack"}, status: http.StatusBadRequest, code: codeInvalidBody},
+		{name: "errors stay problem json", method: http.MethodGet, target: "/tasks/" + uuid.NewString(), header: []string{"Accept", "application/msgpack"}, status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := api.do(t, tt.method, tt.target, tt.body, tt.header...)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if rec.Code < 400 {
+				return
+			}
+			if got := rec.Header().Get("Content-Type"); got != problemContentType {
+				t.Errorf("Content-Type = %q, want %s", got, problemContentType)
+			}
+			var problem domain.Problem
+			decodeBody(t, rec, &problem)
+			if tt.code != "" && problem.Code != tt.code {
+				t.Errorf("code = %q, want %q", problem.Code, tt.code)
+			}
+		})
+	}
+}
+
+func TestYAMLFromJSONKeepsKeyOrder(t *testing.T) {
+	out, err := yamlFromJSON([]byte(`[{"title":"no","id":1,"done":true}]`), bodySchema{})
+	if err != nil {
+		t.Fatalf("yamlFromJSON: %v", err)
+	}
+	want := "- title: \"no\"\n  id: 1\n  done: true\n"
+	if string(out) != want {
+		t.Errorf("yaml = %q, want %q", out, want)
+	}
+
+	back, err := yamlToJSON(out, bodySchema{})
+	if err != nil {
+		t.Fatalf("yamlToJSON: %v", err)
+	}
+	var value []map[string]any
+	if err := json.Unmarshal(back, &value); err != nil || value[0]["title"] != "no" || value[0]["done"] != true {
+		t.Errorf("round trip = %s, %v", back, err)
+	}
+}
+
+func containsValue(values []string, want string) bool {
+	for _, value := range values {
+		if value == want {
+			return true
+		}
+	}
+	return false
+}
+
+func TestYAMLResponsesReadBackTheSame(t *testing.T) {
+	api := newTestAPI(t, nil)
+	for _, title := range []string{"yes", "on", "no", "off", "y", "123", "0755", "null", "2024-01-02", "a: b"} {
+		rec := api.do(t, http.MethodPost, "/tasks", "title: "+strconv.Quote(title)+"\n", "Content-Type", "application/yaml")
+		var created domain.CreateTaskResponse
+		decodeBody(t, rec, &created)
+
+		rec = api.do(t, http.MethodGet, "/tasks/"+created.ID.String(), "", "Accept", "application/yaml")
+		var task map[string]any
+		if err := yaml.Unmarshal(rec.Body.Bytes(), &task); err != nil {
+			t.Fatalf("decode %q: %v", rec.Body, err)
+		}
+		if task["title"] != title {
+			t.Errorf("title %q came back as %#v in %q", title, task["title"], rec.Body)
+		}
+		// quoted for YAML 1.1 readers as well, which take yes and on for booleans
+		if strings.Contains(rec.Body.String(), "title: "+title+"\n") && title != "a: b" {
+			t.Errorf("title %q is not quoted: %q", title, rec.Body)
+		}
+
+		back, err := yamlToJSON(rec.Body.Bytes(), bodySchema{})
+		if err != nil || !strings.Contains(string(back), `"title":`+strconv.Quote(title)) {
+			t.Errorf("read back %s, %v", back, err)
+		}
+	}
+}
+
+func TestProtobufBodies(t *testing.T) {
+	api := newTestAPI(t, nil)
+	send := func(t *testing.T, method, target string, msg proto.Message, status int, reply proto.Message) {
+		t.Helper()
+		var body string
+		if msg != nil {
+			raw, err := proto.Marshal(msg)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			body = string(raw)
+		}
+		rec := api.do(t, method, target, body, "Content-Type", "application/x-protobuf", "Accept", "application/x-protobuf")
+		if rec.Code != status {
+			t.Fatalf("%s %s: status = %d, want %d: %s", method, target, rec.Code, status, rec.Body)
+		}
+		if reply == nil {
+			return
+		}
+		if got := rec.Header().Get("Content-Type"); got != "application/x-protobuf" {
+			t.Fatalf("Content-Type = %q", got)
+		}
+		if err := proto.Unmarshal(rec.Body.Bytes(), reply); err != nil {
+			t.Fatalf("unmarshal %T: %v", reply, err)
+		}
+	}
+
+	created := &tasksv1.Task{}
+	send(t, http.MethodPost, "/tasks", &tasksv1.CreateTaskRequest{Title: "Buy milk", Description: "2 l"}, http.StatusCreated, created)
+	if _, err := uuid.Parse(created.GetId()); err != nil {
+		t.Fatalf("id %q: %v", created.GetId(), err)
+	}
+
+	task := &tasksv1.Task{}
+	send(t, http.MethodGet, "/tasks/"+created.GetId(), nil, http.StatusOK, task)
+	if task.GetTitle() != "Buy milk" || task.GetDescription() != "2 l" || task.GetStatus() != tasksv1.TaskStatus_TASK_STATUS_NEW || task.GetCreatedAt() == nil {
+		t.Errorf("task = %v", task)
+	}
+
+	updated := &tasksv1.UpsertTaskResponse{}
+	send(t, http.MethodPut, "/tasks/"+created.GetId(), &tasksv1.UpdateTaskRequest{Title: "Buy oat milk", Status: tasksv1.TaskStatus_TASK_STATUS_DONE}, http.StatusOK, updated)
+	if updated.GetCreated() {
+		t.Errorf("update reported a new task")
+	}
+
+	list := &tasksv1.BatchGetTasksResponse{}
+	send(t, http.MethodGet, "/tasks", nil, http.StatusOK, list)
+	if len(list.GetTasks()) != 1 || list.GetTasks()[0].GetTitle() != "Buy oat milk" || list.GetTasks()[0].GetStatus() != tasksv1.TaskStatus_TASK_STATUS_DONE {
+		t.Errorf("list = %v", list)
+	}
+
+	batch := &tasksv1.BatchTasksResponse{}
+	send(t, http.MethodPost, "/tasks:batch", &tasksv1.BatchTasksRequest{
+		Mode: tasksv1.BatchMode_BATCH_MODE_BEST_EFFORT,
+		Operations: []*tasksv1.BatchOperation{
+			{Op: tasksv1.BatchOperationType_BATCH_OPERATION_TYPE_CREATE, Title: "Second"},
+			{Op: tasksv1.BatchOperationType_BATCH_OPERATION_TYPE_DELETE, Id: uuid.NewString()},
+			{Op: tasksv1.BatchOperationType_BATCH_OPERATION_TYPE_UPDATE, Id: uuid.NewString(), Title: "Missing", Status: tasksv1.TaskStatus_TASK_STATUS_NEW},
+		},
+	}, http.StatusOK, batch)
+	results := batch.GetResults()
+	if len(results) != 3 || results[0].GetCode() != 0 || results[0].GetId() == "" ||
+		results[2].GetCode() != int32(codes.NotFound) || results[2].GetReason() != codeNotFound {
+		t.Errorf("results = %v", results)
+	}
+
+	// requests go through the validator like JSON
+	tests := []struct {
+		name   string
+		method string
+		target string
+		msg    proto.Message
+		field  string
+	}{
+		{name: "empty title", method: http.MethodPost, target: "/tasks", msg: &tasksv1.CreateTaskRequest{Description: "a"}, field: "title"},
+		{name: "invalid id", method: http.MethodPost, target: "/tasks", msg: &tasksv1.CreateTaskRequest{Id: "42", Title: "a"}, field: "id"},
+		{name: "status unspecified", method: http.MethodPut, target: "/tasks/" + created.GetId(), msg: &tasksv1.UpdateTaskRequest{Title: "a"}, field: "status"},
+		{name: "status out of the enum", method: http.MethodPut, target: "/tasks/" + created.GetId(), msg: &tasksv1.UpdateTaskRequest{Title: "a", Status: 42}, field: "status"},
+		{name: "operation unspecified", method: http.MethodPost, target: "/tasks:batch", msg: &tasksv1.BatchTasksRequest{Operations: []*tasksv1.BatchOperation{{Title: "a"}}}, field: "operations[0].op"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := proto.Marshal(tt.msg)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			rec := api.do(t, tt.method, tt.target, string(raw), "Content-Type", "application/x-protobuf")
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			var problem domain.Problem
+			decodeBody(t, rec, &problem)
+			var fields []string
+			for _, field := range problem.Errors {
+				fields = append(fields, field.Field)
+			}
+			if !containsValue(fields, tt.field) {
+				t.Errorf("errors on %v, want one on %s", fields, tt.field)
+			}
+		})
+	}
+}
+
+func TestProtobufIsDocumentedWhereItHasAMessage(t *testing.T) {
+	api := newTestAPI(t, nil)
+	for path, operations := range api.spec.Paths {
+		for method, op := range operations {
+			if op.RequestBody != nil {
+				_, documented := op.RequestBody.Content["application/x-protobuf"]
+				_, hasJSON := op.RequestBody.Content["application/json"]
+				want := hasJSON && hasProtobufMessage(bodySchema{schema: op.RequestBody.Content["application/json"].Schema})
+				if documented != want {
+					t.Errorf("%s %s: protobuf request documented %v, want %v", method, path, documented, want)
+				}
+			}
+			offered := containsValue(responseOffers(op), "application/x-protobuf")
+			switch op.OperationID {
+			case "createTask", "getTask", "updateTask", "listTasks", "batchTasks", "taskChanges":
+				if !offered {
+					t.Errorf("%s does not offer protobuf", op.OperationID)
+				}
+			default:
+				if offered {
+					t.Errorf("%s offers protobuf without a message", op.OperationID)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,469 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+const (
+	openAPIVersion = "3.1.0"
+	apiTitle       = "Tasks API"
+	apiVersion     = "1.0"
+	schemaRefBase  = "#/components/schemas/"
+)
+
+// enumValues lists the allowed values of named string types, the OpenAPI
+// document takes them from here because Go keeps no list of constants
+var enumValues = map[reflect.Type][]any{
+	reflect.TypeOf(domain.TaskStatus("")): {
+		string(domain.TaskStatusNew), string(domain.TaskStatusInProgress), string(domain.TaskStatusDone),
+	},
+	reflect.TypeOf(domain.BatchOperationType("")): {
+		string(domain.BatchOperationCreate), string(domain.BatchOperationUpdate), string(domain.BatchOperationDelete),
+	},
+	reflect.TypeOf(domain.BatchMode("")): {
+		string(domain.BatchModeAtomic), string(domain.BatchModeBestEffort),
+	},
+	reflect.TypeOf(domain.StatsInterval("")): {
+		string(domain.StatsIntervalDay), string(domain.StatsIntervalWeek),
+	},
+	reflect.TypeOf(domain.TaskEventType("")): {
+		string(domain.TaskEventCreated), string(domain.TaskEventUpdated), string(domain.TaskEventDeleted),
+	},
+	reflect.TypeOf(domain.WebhookDeliveryState("")): {
+		string(domain.WebhookDeliveryPending), string(domain.WebhookDeliverySucceeded), string(domain.WebhookDeliveryFailed),
+	},
+}
+
+// route ties a mux pattern to its handler and its OpenAPI description
+type route struct {
+	method  string
+	path    string
+	handler http.HandlerFunc
+	doc     operationDoc
+}
+
+type operationDoc struct {
+	id          string
+	summary     string
+	description string
+	// tag groups the operation in the document, "tasks" when empty
+	tag    string
+	params []paramDoc
+	// body is a zero value of the request type, nil when there is no body
+	body      any
+	responses map[int]responseDoc
+}
+
+type paramDoc struct {
+	name        string
+	in          string
+	description string
+	required    bool
+	schema      *Schema
+}
+
+type responseDoc struct {
+	description string
+	// body is a zero value of the response type, nil for empty responses.
+	// Use responseBodies when the status can carry different media types.
+	body any
+}
+
+// responseBodies lists alternative bodies of one request or status, each under its own media type
+type responseBodies []any
+
+// mediaBody documents a body with an explicit media type, e.g. text/csv.
+// A nil body is documented as a plain string.
+type mediaBody struct {
+	contentType string
+	body        any
+}
+
+// schemaType is a JSON Schema type, a single name or a list like ["string", "null"]
+type schemaType []string
+
+func (t schemaType) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+func (t *schemaType) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaType{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+func (t schemaType) has(name string) bool {
+	for _, item := range t {
+		if item == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Schema is the subset of JSON Schema 2020-12 used by the API document
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 schemaType         `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+}
+
+type openAPIParameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type openAPIMediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required,omitempty"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId,omitempty"`
+	Summary     string                     `json:"summary,omitempty"`
+	Description string                     `json:"description,omitempty"`
+	Tags        []string                   `json:"tags,omitempty"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+// OpenAPIDocument is an OpenAPI 3.1 description of the API built from the route table
+type OpenAPIDocument struct {
+	OpenAPI string `json:"openapi"`
+	Info    struct {
+		Title       string `json:"title"`
+		Version     string `json:"version"`
+		Description string `json:"description,omitempty"`
+	} `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components struct {
+		Schemas map[string]*Schema `json:"schemas"`
+	} `json:"components"`
+}
+
+// OpenAPI describes every route registered by RegisterRoutes
+func (h *Handler) OpenAPI() *OpenAPIDocument {
+	doc := buildOpenAPI(h.routes())
+	// the batch size is configured, the validator enforces it while it reads the body
+	if batch := doc.Components.Schemas["BatchRequest"]; batch != nil && h.cfg.MaxBatchSize > 0 {
+		size := h.cfg.MaxBatchSize
+		batch.Properties["operations"].MaxItems = &size
+	}
+	return doc
+}
+
+func buildOpenAPI(routes []route) *OpenAPIDocument {
+	doc := &OpenAPIDocument{OpenAPI: openAPIVersion}
+	doc.Info.Title = apiTitle
+	doc.Info.Version = apiVersion
+	doc.Info.Description = "REST API для управления задачами (CRUDL)"
+	doc.Paths = make(map[string]map[string]*openAPIOperation)
+	doc.Components.Schemas = make(map[string]*Schema)
+
+	for _, rt := range routes {
+		tag := rt.doc.tag
+		if tag == "" {
+			tag = "tasks"
+		}
+		op := &openAPIOperation{
+			OperationID: rt.doc.id,
+			Summary:     rt.doc.summary,
+			Description: rt.doc.description,
+			Tags:        []string{tag},
+			Responses:   make(map[string]openAPIResponse),
+		}
+		for _, param := range rt.doc.params {
+			op.Parameters = append(op.Parameters, openAPIParameter{
+				Name:        param.name,
+				In:          param.in,
+				Description: param.description,
+				Required:    param.required || param.in == "path",
+				Schema:      param.schema,
+			})
+		}
+		if rt.doc.body != nil {
+			op.RequestBody = &openAPIRequestBody{
+				Required: true,
+				Content:  mediaContent(rt.doc.body, doc.Components.Schemas),
+			}
+		}
+		for status, response := range rt.doc.responses {
+			out := openAPIResponse{Description: response.description}
+			if response.body != nil {
+				out.Content = mediaContent(response.body, doc.Components.Schemas)
+			}
+			op.Responses[strconv.Itoa(status)] = out
+		}
+
+		if doc.Paths[rt.path] == nil {
+			doc.Paths[rt.path] = make(map[string]*openAPIOperation)
+		}
+		doc.Paths[rt.path][strings.ToLower(rt.method)] = op
+	}
+	return doc
+}
+
+// mediaContent documents a body, or each alternative of responseBodies, under its media type:
+// JSON by default, problem+json for domain.Problem, or the one given by mediaBody. A JSON
+// body is listed under the formats of bodyCodecs that accept it, WithContentNegotiation transcodes it.
+func mediaContent(body any, components map[string]*Schema) map[string]openAPIMediaType {
+	bodies, ok := body.(responseBodies)
+	if !ok {
+		bodies = responseBodies{body}
+	}
+	content := make(map[string]openAPIMediaType, len(bodies))
+	for _, body := range bodies {
+		contentType := "application/json"
+		if _, ok := body.(domain.Problem); ok {
+			contentType = problemContentType
+		}
+		schema := &Schema{Type: schemaType{"string"}}
+		if media, ok := body.(mediaBody); ok {
+			contentType, body = media.contentType, media.body
+		}
+		if body != nil {
+			schema = schemaOf(reflect.TypeOf(body), components)
+		}
+		content[contentType] = openAPIMediaType{Schema: schema}
+		if contentType == "application/json" {
+			for _, codec := range bodyCodecs {
+				if codec.accepts == nil || codec.accepts(bodySchema{schema: schema, schemas: components}) {
+					content[codec.mediaType] = openAPIMediaType{Schema: schema}
+				}
+			}
+		}
+	}
+	return content
+}
+
+func (d *OpenAPIDocument) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+func (d *OpenAPIDocument) YAML() ([]byte, error) {
+	// go through JSON so the json tags and omitempty rules apply to YAML as well
+	raw, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	return yamlFromJSON(raw, bodySchema{})
+}
+
+func serveOpenAPI(render func() ([]byte, error), contentType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := render()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, codeInternal, "internal error")
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write(body)
+	}
+}
+
+// swaggerUIPage loads Swagger UI 5, the first release that renders OpenAPI 3.1
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>` + apiTitle + `</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+// serveSwaggerUI answers every path under /swagger/ with the page, /swagger/index.html included
+func serveSwaggerUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = io.WriteString(w, swaggerUIPage)
+}
+
+var (
+	uuidType = reflect.TypeOf(uuid.UUID{})
+	timeType = reflect.TypeOf(time.Time{})
+)
+
+// schemaOf describes t, named structs and enums become components referenced by $ref
+func schemaOf(t reflect.Type, components map[string]*Schema) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		nullable = true
+	}
+
+	switch {
+	case t == uuidType:
+		return withNull(&Schema{Type: schemaType{"string"}, Format: "uuid"}, nullable)
+	case t == timeType:
+		return withNull(&Schema{Type: schemaType{"string"}, Format: "date-time"}, nullable)
+	}
+	if values, ok := enumValues[t]; ok {
+		if _, done := components[t.Name()]; !done {
+			components[t.Name()] = &Schema{Type: schemaType{"string"}, Enum: values}
+		}
+		return &Schema{Ref: schemaRefBase + t.Name()}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		name := t.Name()
+		if _, done := components[name]; !done {
+			// reserve the name first, so self-referencing types terminate
+			components[name] = &Schema{}
+			components[name] = structSchema(t, components)
+		}
+		return &Schema{Ref: schemaRefBase + name}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return withNull(&Schema{Type: schemaType{"string"}, Format: "byte"}, nullable)
+		}
+		return withNull(&Schema{Type: schemaType{"array"}, Items: schemaOf(t.Elem(), components)}, nullable)
+	case reflect.Map:
+		return withNull(&Schema{Type: schemaType{"object"}, AdditionalProperties: schemaOf(t.Elem(), components)}, nullable)
+	case reflect.String:
+		return withNull(&Schema{Type: schemaType{"string"}}, nullable)
+	case reflect.Bool:
+		return withNull(&Schema{Type: schemaType{"boolean"}}, nullable)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return withNull(&Schema{Type: schemaType{"integer"}}, nullable)
+	case reflect.Float32, reflect.Float64:
+		return withNull(&Schema{Type: schemaType{"number"}}, nullable)
+	default:
+		return &Schema{}
+	}
+}
+
+// structSchema reads json, validate, format and enums tags, the same ones swag uses
+func structSchema(t reflect.Type, components map[string]*Schema) *Schema {
+	schema := &Schema{Type: schemaType{"object"}, Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := schemaOf(field.Type, components)
+		if format := field.Tag.Get("format"); format != "" {
+			property.Format = format
+		}
+		if enums := field.Tag.Get("enums"); enums != "" && property.Ref == "" {
+			for _, value := range strings.Split(enums, ",") {
+				property.Enum = append(property.Enum, strings.TrimSpace(value))
+			}
+		}
+		for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+			key, value, _ := strings.Cut(rule, "=")
+			switch key {
+			case "required":
+				schema.Required = append(schema.Required, name)
+			case "min":
+				applyMin(property, value)
+			}
+		}
+		schema.Properties[name] = property
+	}
+	sort.Strings(schema.Required)
+	return schema
+}
+
+func applyMin(schema *Schema, raw string) {
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return
+	}
+	switch {
+	case schema.Type.has("string"):
+		schema.MinLength = &value
+	case schema.Type.has("array"):
+		schema.MinItems = &value
+	case schema.Type.has("integer"), schema.Type.has("number"):
+		minimum := float64(value)
+		schema.Minimum = &minimum
+	}
+}
+
+func withNull(schema *Schema, nullable bool) *Schema {
+	if nullable {
+		schema.Type = append(schema.Type, "null")
+	}
+	return schema
+}
+
+func stringParam(name, in, description string, required bool) paramDoc {
+	return paramDoc{name: name, in: in, description: description, required: required, schema: &Schema{Type: schemaType{"string"}}}
+}
+
+func uuidPathParam(description string) paramDoc {
+	return paramDoc{name: "id", in: "path", description: description, required: true, schema: &Schema{Type: schemaType{"string"}, Format: "uuid"}}
+}
+
+func intParam(name, description string, minimum, maximum *float64) paramDoc {
+	return paramDoc{name: name, in: "query", description: description, schema: &Schema{Type: schemaType{"integer"}, Minimum: minimum, Maximum: maximum}}
+}
+
+func dateParam(name, description string) paramDoc {
+	return paramDoc{name: name, in: "query", description: description, schema: &Schema{Type: schemaType{"string"}, Format: "date"}}
+}
+
+func float(value float64) *float64 {
+	return &value
+}
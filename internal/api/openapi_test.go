@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/config"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+// TestOpenAPIConformance calls every documented operation and checks the status, the
+// content type and the JSON body of the response against the document. An operation
+// without a case fails the test, so a new route needs one.
+func TestOpenAPIConformance(t *testing.T) {
+	api := newTestAPI(t, func(cfg *config.Config) { cfg.Validation.Responses = false })
+
+	now := time.Now().UTC().Truncate(time.Second)
+	task := domain.Task{ID: uuid.New(), Title: "Buy milk +home", Status: domain.TaskStatusNew, CreatedAt: now, UpdatedAt: now}
+	api.repo.Put(task)
+	webhook := &domain.Webhook{
+		ID:         uuid.New(),
+		URL:        "https://hooks.example.com/tasks",
+		EventTypes: []domain.TaskEventType{domain.TaskEventCreated},
+		Secret:     "whsec_0123456789abcdef",
+		Active:     true,
+	}
+	if err := api.webhooks.Create(context.Background(), webhook); err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+	delivery := domain.WebhookDelivery{
+		ID:        uuid.New(),
+		WebhookID: webhook.ID,
+		EventID:   1,
+		EventType: domain.TaskEventCreated,
+		Payload:   []byte(`{}`),
+	}
+	api.webhooks.PutDelivery(delivery)
+
+	taskPath := "/tasks/" + task.ID.String()
+	webhookPath := "/webhooks/" + webhook.ID.String()
+	missing := uuid.NewString()
+
+	tests := []struct {
+		method      string
+		target      string
+		body        string
+		contentType string
+		header      []string
+		status      int
+	}{
+		{method: http.MethodPost, target: "/tasks", body: `{"title":"a"}`, status: http.StatusCreated},
+		{method: http.MethodPost, target: "/tasks", body: `{"title":""}`, status: http.StatusBadRequest},
+		{method: http.MethodPost, target: "/tasks", body: `{"title":"a"}`, contentType: "text/html", status: http.StatusUnsupportedMediaType},
+		{method: http.MethodGet, target: taskPath, status: http.StatusOK},
+		{method: http.MethodGet, target: "/tasks/" + missing, status: http.StatusNotFound},
+		{method: http.MethodGet, target: "/tasks/42", status: http.StatusBadRequest},
+		{method: http.MethodPut, target: taskPath, body: `{"title":"b","status":"in_progress"}`, status: http.StatusOK},
+		{method: http.MethodPut, target: "/tasks/" + missing, body: `{"title":"b","status":"new"}`, status: http.StatusNotFound},
+		{method: http.MethodPut, target: taskPath, body: `{"title":"b","status":"new"}`, header: []string{"If-Match", `"0"`}, status: http.StatusPreconditionFailed},
+		{method: http.MethodGet, target: "/tasks", status: http.StatusOK},
+		{method: http.MethodGet, target: "/tasks", header: []string{"Accept", "text/plain"}, status: http.StatusOK},
+		{method: http.MethodGet, target: "/tasks?limit=5000", status: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/tasks/export?format=json", status: http.StatusOK},
+		{method: http.MethodGet, target: "/tasks/export?format=ndjson", status: http.StatusOK},
+		{method: http.MethodGet, target: "/tasks/export?format=csv", status: http.StatusOK},
+		{method: http.MethodGet, target: "/tasks/export?format=todotxt", status: http.StatusOK},
+		{method: http.MethodGet, target: "/tasks/export?format=xml", status: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/tasks/events?last_event_id=0", status: http.StatusOK},
+		{method: http.MethodGet, target: "/tasks/events?task_id=42", status: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/tasks/changes", status: http.StatusOK},
+		{method: http.MethodGet, target: "/tasks/changes?since=0", status: http.StatusOK},
+		{method: http.MethodGet, target: "/tasks/changes?wait=1h", status: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/tasks/stats", status: http.StatusOK},
+		{method: http.MethodGet, target: "/tasks/stats?interval=week", status: http.StatusOK},
+		{method: http.MethodGet, target: "/tasks/stats?from=2024-02-01&to=2024-01-01", status: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/ws", status: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/tasks.ics", status: http.StatusOK},
+		{method: http.MethodGet, target: "/tasks.ics?limit=-1", status: http.StatusBadRequest},
+		{method: http.MethodPost, target: "/tasks/import", body: "title,status\nc,done\n,new\n", contentType: "text/csv", status: http.StatusOK},
+		{method: http.MethodPost, target: "/tasks/import?dry_run=true", body: `{"title":"d"}` + "\n", contentType: "application/x-ndjson", status: http.StatusOK},
+		{method: http.MethodPost, target: "/tasks/import", body: "title\n", contentType: "application/pdf", status: http.StatusUnsupportedMediaType},
+		{method: http.MethodPost, target: "/tasks:batch", body: `{"operations":[{"op":"create","title":"e"},{"op":"delete","id":"` + missing + `"}]}`, status: http.StatusOK},
+		{method: http.MethodPost, target: "/tasks:batch", body: `{"mode":"atomic","operations":[{"op":"update","id":"` + missing + `","title":"f","status":"new"}]}`, status: http.StatusNotFound},
+		{method: http.MethodPost, target: "/webhooks", body: `{"url":"https://hooks.example.com/new"}`, status: http.StatusCreated},
+		{method: http.MethodPost, target: "/webhooks", body: `{"url":"ftp://hooks.example.com"}`, status: http.StatusBadRequest},
+		{method: http.MethodPost, target: "/webhooks", body: `{"url":"http://169.254.169.254/latest/meta-data"}`, status: http.StatusBadRequest},
+		{method: http.MethodPost, target: "/webhooks", body: `{"url":"https://internal.example.com/hook"}`, status: http.StatusBadRequest},
+		{method: http.MethodGet, target: "/webhooks", status: http.StatusOK},
+		{method: http.MethodGet, target: webhookPath, status: http.StatusOK},
+		{method: http.MethodGet, target: "/webhooks/" + missing, status: http.StatusNotFound},
+		{method: http.MethodPut, target: webhookPath, body: `{"url":"https://hooks.example.com/tasks","active":true}`, status: http.StatusOK},
+		{method: http.MethodPut, target: "/webhooks/" + missing, body: `{"url":"https://hooks.example.com/tasks"}`, status: http.StatusNotFound},
+		{method: http.MethodGet, target: webhookPath + "/deliveries", status: http.StatusOK},
+		{method: http.MethodGet, target: webhookPath + "/deliveries?limit=500", status: http.StatusBadRequest},
+		{method: http.MethodPost, target: webhookPath + "/deliveries/" + delivery.ID.String() + "/redeliver", status: http.StatusAccepted},
+		{method: http.MethodPost, target: webhookPath + "/deliveries/" + missing + "/redeliver", status: http.StatusNotFound},
+		{method: http.MethodDelete, target: "/webhooks/" + missing, status: http.StatusNotFound},
+		{method: http.MethodDelete, target: webhookPath, status: http.StatusNoContent},
+		{method: http.MethodDelete, target: taskPath, status: http.StatusNoContent},
+		{method: http.MethodDelete, target: "/tasks/42", status: http.StatusBadRequest},
+	}
+
+	validator := NewRequestValidator(api.spec, config.Validation{}, nil)
+	routes := specRoutes(api.spec)
+	covered := make(map[string]bool)
+	for _, tt := range tests {
+		name := tt.method + " " + tt.target
+		t.Run(name, func(t *testing.T) {
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			// streams end when the client goes away
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			req := httptest.NewRequest(tt.method, tt.target, body).WithContext(ctx)
+			if tt.body != "" {
+				contentType := tt.contentType
+				if contentType == "" {
+					contentType = "application/json"
+				}
+				req.Header.Set("Content-Type", contentType)
+			}
+			for i := 0; i+1 < len(tt.header); i += 2 {
+				req.Header.Set(tt.header[i], tt.header[i+1])
+			}
+
+			route, _ := matchSpecRoute(routes, req)
+			if route == nil {
+				t.Fatal("no operation in the document")
+			}
+			covered[route.op.OperationID] = true
+
+			rec := httptest.NewRecorder()
+			api.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			problems := validator.checkResponse(route.op, rec.Code, rec.Header().Get("Content-Type"), rec.Body.Bytes(), rec.Body.Len() > 0)
+			for _, problem := range problems {
+				t.Errorf("%s", problem)
+			}
+		})
+	}
+
+	for path, operations := range api.spec.Paths {
+		for method, op := range operations {
+			if !covered[op.OperationID] {
+				t.Errorf("%s %s (%s) has no conformance case", strings.ToUpper(method), path, op.OperationID)
+			}
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	tasksv1 "github.com/nightmaker00/go-tasks-api/pkg/pb/tasks/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// protobufMessage converts the JSON body of one schema to its tasks.v1 message or back.
+// Request bodies become JSON and go through the validator and the handler like JSON
+// sent by the client, so toJSON only renames enum values and keeps the rest as it is.
+type protobufMessage struct {
+	fromJSON func(raw []byte) (proto.Message, error)
+	toJSON   func(body []byte) (any, error)
+}
+
+// protobufMessages lists the bodies that have a tasks.v1 message by the name of their
+// component, "[]" before the name stands for an array of it. Operations whose bodies are
+// missing here do not offer Protobuf.
+var protobufMessages = map[string]protobufMessage{
+	"CreateTaskRequest":  protobufRequest(createTaskFromProto),
+	"UpdateTaskRequest":  protobufRequest(updateTaskFromProto),
+	"BatchRequest":       protobufRequest(batchFromProto),
+	"Task":               protobufResponse(taskToProto),
+	"CreateTaskResponse": protobufResponse(createdTaskToProto),
+	"UpdateTaskResponse": protobufResponse(updatedTaskToProto),
+	"[]TaskListItem":     protobufResponse(taskListToProto),
+	"BatchResponse":      protobufResponse(batchResultsToProto),
+	"TaskChanges":        protobufResponse(changesToProto),
+}
+
+var protoTaskStatuses = map[domain.TaskStatus]tasksv1.TaskStatus{
+	domain.TaskStatusNew:        tasksv1.TaskStatus_TASK_STATUS_NEW,
+	domain.TaskStatusInProgress: tasksv1.TaskStatus_TASK_STATUS_IN_PROGRESS,
+	domain.TaskStatusDone:       tasksv1.TaskStatus_TASK_STATUS_DONE,
+}
+
+var protoBatchOperations = map[domain.BatchOperationType]tasksv1.BatchOperationType{
+	domain.BatchOperationCreate: tasksv1.BatchOperationType_BATCH_OPERATION_TYPE_CREATE,
+	domain.BatchOperationUpdate: tasksv1.BatchOperationType_BATCH_OPERATION_TYPE_UPDATE,
+	domain.BatchOperationDelete: tasksv1.BatchOperationType_BATCH_OPERATION_TYPE_DELETE,
+}
+
+var protoBatchModes = map[domain.BatchMode]tasksv1.BatchMode{
+	domain.BatchModeAtomic:     tasksv1.BatchMode_BATCH_MODE_ATOMIC,
+	domain.BatchModeBestEffort: tasksv1.BatchMode_BATCH_MODE_BEST_EFFORT,
+}
+
+// protoBatchCodes are the google.rpc codes of the error codes of batch results, the
+// same the gRPC service reports
+var protoBatchCodes = map[string]codes.Code{
+	codeValidation:   codes.InvalidArgument,
+	codeNotFound:     codes.NotFound,
+	codeTaskExists:   codes.AlreadyExists,
+	codeBatchAborted: codes.Aborted,
+}
+
+func protobufRequest[M any, PM interface {
+	*M
+	proto.Message
+}](convert func(PM) any) protobufMessage {
+	return protobufMessage{toJSON: func(body []byte) (any, error) {
+		msg := PM(new(M))
+		if err := proto.Unmarshal(body, msg); err != nil {
+			return nil, err
+		}
+		return convert(msg), nil
+	}}
+}
+
+func protobufResponse[T any, M proto.Message](convert func(T) M) protobufMessage {
+	return protobufMessage{fromJSON: func(raw []byte) (proto.Message, error) {
+		var value T
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, err
+		}
+		return convert(value), nil
+	}}
+}
+
+// protobufMessageName is the key of the schema in protobufMessages
+func protobufMessageName(target bodySchema) string {
+	schema := target.schema
+	if schema == nil {
+		return ""
+	}
+	prefix := ""
+	if schema.Ref == "" && schema.Type.has("array") && schema.Items != nil {
+		prefix, schema = "[]", schema.Items
+	}
+	if schema.Ref == "" {
+		return ""
+	}
+	return prefix + strings.TrimPrefix(schema.Ref, schemaRefBase)
+}
+
+func hasProtobufMessage(target bodySchema) bool {
+	_, ok := protobufMessages[protobufMessageName(target)]
+	return ok
+}
+
+func protobufFromJSON(raw []byte, source bodySchema) ([]byte, error) {
+	message := protobufMessages[protobufMessageName(source)]
+	if message.fromJSON == nil {
+		return nil, errors.New("no protobuf message for the response")
+	}
+	msg, err := message.fromJSON(raw)
+	if err != nil {
+		return nil, err
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+}
+
+func protobufToJSON(body []byte, target bodySchema) ([]byte, error) {
+	message := protobufMessages[protobufMessageName(target)]
+	if message.toJSON == nil {
+		return nil, errors.New("no protobuf message for the request")
+	}
+	value, err := message.toJSON(body)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// protoEnumName is the REST value of an enum value, "" when unspecified. A value outside
+// the map is passed on by its proto name, the validator rejects it.
+func protoEnumName[K ~string, V interface {
+	comparable
+	String() string
+}](values map[K]V, value, unspecified V) string {
+	if value == unspecified {
+		return ""
+	}
+	for name, v := range values {
+		if v == value {
+			return string(name)
+		}
+	}
+	return value.String()
+}
+
+func statusFromProto(status tasksv1.TaskStatus) string {
+	return protoEnumName(protoTaskStatuses, status, tasksv1.TaskStatus_TASK_STATUS_UNSPECIFIED)
+}
+
+// putString sets a field of a JSON object when the message has it, proto3 strings are
+// never missing, so an empty one counts as missing
+func putString(object map[string]any, key, value string) {
+	if value != "" {
+		object[key] = value
+	}
+}
+
+func createTaskFromProto(msg *tasksv1.CreateTaskRequest) any {
+	body := map[string]any{"title": msg.GetTitle(), "description": msg.GetDescription()}
+	putString(body, "id", msg.GetId())
+	return body
+}
+
+// updateTaskFromProto leaves id out, the task is the one of the path
+func updateTaskFromProto(msg *tasksv1.UpdateTaskRequest) any {
+	body := map[string]any{"title": msg.GetTitle(), "status": statusFromProto(msg.GetStatus())}
+	if msg.Description != nil {
+		body["description"] = msg.GetDescription()
+	}
+	return body
+}
+
+func batchFromProto(msg *tasksv1.BatchTasksRequest) any {
+	operations := make([]any, len(msg.GetOperations()))
+	for i, op := range msg.GetOperations() {
+		operation := map[string]any{
+			"op": protoEnumName(protoBatchOperations, op.GetOp(), tasksv1.BatchOperationType_BATCH_OPERATION_TYPE_UNSPECIFIED),
+		}
+		putString(operation, "id", op.GetId())
+		putString(operation, "title", op.GetTitle())
+		putString(operation, "status", statusFromProto(op.GetStatus()))
+		if op.Description != nil {
+			operation["description"] = op.GetDescription()
+		}
+		operations[i] = operation
+	}
+	body := map[string]any{"operations": operations}
+	putString(body, "mode", protoEnumName(protoBatchModes, msg.GetMode(), tasksv1.BatchMode_BATCH_MODE_UNSPECIFIED))
+	return body
+}
+
+func protoTimestamp(at time.Time) *timestamppb.Timestamp {
+	if at.IsZero() {
+		return nil
+	}
+	return timestamppb.New(at)
+}
+
+func taskToProto(task domain.Task) *tasksv1.Task {
+	return &tasksv1.Task{
+		Id:          task.ID.String(),
+		Title:       task.Title,
+		Description: task.Description,
+		Status:      protoTaskStatuses[task.Status],
+		CreatedAt:   protoTimestamp(task.CreatedAt),
+		UpdatedAt:   protoTimestamp(task.UpdatedAt),
+	}
+}
+
+// createdTaskToProto sends the id of the new task as a Task, like CreateTask of the gRPC
+// service but without the fields the REST response leaves out
+func createdTaskToProto(created domain.CreateTaskResponse) *tasksv1.Task {
+	return &tasksv1.Task{Id: created.ID.String()}
+}
+
+// updatedTaskToProto tells only whether the task was created, the REST response has no task
+func updatedTaskToProto(updated domain.UpdateTaskResponse) *tasksv1.UpsertTaskResponse {
+	return &tasksv1.UpsertTaskResponse{Created: updated.Status == "created"}
+}
+
+func taskListToProto(items []domain.TaskListItem) *tasksv1.BatchGetTasksResponse {
+	out := &tasksv1.BatchGetTasksResponse{Tasks: make([]*tasksv1.Task, len(items))}
+	for i, item := range items {
+		out.Tasks[i] = &tasksv1.Task{Id: item.ID.String(), Title: item.Title, Status: protoTaskStatuses[item.Status]}
+	}
+	return out
+}
+
+func batchResultsToProto(batch domain.BatchResponse) *tasksv1.BatchTasksResponse {
+	out := &tasksv1.BatchTasksResponse{Results: make([]*tasksv1.BatchResult, len(batch.Results))}
+	for i, result := range batch.Results {
+		item := &tasksv1.BatchResult{
+			Index:   int32(result.Index),
+			Op:      protoBatchOperations[result.Op],
+			Reason:  result.Code,
+			Message: result.Error,
+		}
+		if result.ID != nil {
+			item.Id = result.ID.String()
+		}
+		if result.Code != "" {
+			code, ok := protoBatchCodes[result.Code]
+			if !ok {
+				code = codes.Internal
+			}
+			item.Code = int32(code)
+		}
+		for _, field := range result.Errors {
+			item.Errors = append(item.Errors, &tasksv1.FieldError{Field: field.Field, Code: field.Code, Message: field.Message})
+		}
+		out.Results[i] = item
+	}
+	return out
+}
+
+func changesToProto(changes domain.TaskChanges) *tasksv1.GetChangesResponse {
+	out := &tasksv1.GetChangesResponse{NextToken: changes.NextToken, HasMore: changes.HasMore}
+	for _, task := range changes.Upserted {
+		out.Upserted = append(out.Upserted, taskToProto(task))
+	}
+	for _, tombstone := range changes.Deleted {
+		out.Deleted = append(out.Deleted, &tasksv1.TaskTombstone{Id: tombstone.ID.String(), DeletedAt: protoTimestamp(tombstone.DeletedAt)})
+	}
+	return out
+}
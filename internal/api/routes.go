@@ -0,0 +1,472 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	for _, rt := range h.routes() {
+		mux.HandleFunc(rt.method+" "+rt.path, rt.handler)
+	}
+
+	doc := h.OpenAPI()
+	mux.HandleFunc("GET /openapi.json", serveOpenAPI(doc.JSON, "application/json"))
+	mux.HandleFunc("GET /openapi.yaml", serveOpenAPI(doc.YAML, "application/yaml"))
+	mux.HandleFunc("GET /swagger/", serveSwaggerUI)
+
+	// WebDAV methods have no place in OpenAPI, so CalDAV stays out of the route table
+	if h.cfg.CalDAV {
+		h.registerCalDAV(mux)
+	}
+	if h.cfg.GraphQL {
+		h.registerGraphQL(mux)
+	}
+}
+
+// routes is the single list of endpoints, both the mux and the OpenAPI document are built from it
+func (h *Handler) routes() []route {
+	problem := func(description string) responseDoc {
+		return responseDoc{description: description, body: domain.Problem{}}
+	}
+
+	return []route{
+		{
+			method: http.MethodPost, path: "/tasks", handler: h.CreateTask,
+			doc: operationDoc{
+				id:          "createTask",
+				summary:     "Создать задачу",
+				description: "Создаёт новую задачу. Можно передать собственный UUID в поле id, при совпадении вернётся 409",
+				params: []paramDoc{
+					stringParam(idempotencyKeyHeader, "header", "Ключ идемпотентности для безопасных повторов", false),
+				},
+				body: domain.CreateTaskRequest{},
+				responses: map[int]responseDoc{
+					http.StatusCreated:               {description: "Задача создана", body: domain.CreateTaskResponse{}},
+					http.StatusBadRequest:            problem("Неверный запрос"),
+					http.StatusConflict:              problem("Задача с таким id уже существует или запрос с этим ключом ещё выполняется"),
+					http.StatusRequestEntityTooLarge: problem("Слишком большое тело запроса"),
+					http.StatusUnsupportedMediaType:  problem("Неподдерживаемый Content-Type"),
+					http.StatusUnprocessableEntity:   problem("Ключ идемпотентности использован с другим запросом"),
+					http.StatusInternalServerError:   problem("Внутренняя ошибка"),
+				},
+			},
+		},
+		{
+			method: http.MethodGet, path: "/tasks/{id}", handler: h.GetTask,
+			doc: operationDoc{
+				id:          "getTask",
+				summary:     "Получить задачу",
+				description: "Возвращает задачу и её ETag, который можно передать в If-Match при обновлении",
+				params: []paramDoc{
+					uuidPathParam("UUID задачи"),
+					stringParam("If-None-Match", "header", "ETag полученной ранее задачи", false),
+				},
+				responses: map[int]responseDoc{
+					http.StatusOK:                  {description: "Задача", body: domain.Task{}},
+					http.StatusNotModified:         {description: "Задача не менялась"},
+					http.StatusBadRequest:          problem("Неверный UUID"),
+					http.StatusNotFound:            problem("Задача не найдена"),
+					http.StatusInternalServerError: problem("Внутренняя ошибка"),
+				},
+			},
+		},
+		{
+			method: http.MethodPut, path: "/tasks/{id}", handler: h.UpdateTask,
+			doc: operationDoc{
+				id:      "updateTask",
+				summary: "Обновить задачу",
+				description: "Обновляет заголовок, описание и статус. Если включён TASKS_UPSERT_ON_PUT, отсутствующая задача создаётся (201). " +
+					"С If-Match задача обновляется, только если её ETag не изменился, иначе возвращается 412",
+				params: []paramDoc{
+					uuidPathParam("UUID задачи"),
+					stringParam("If-Match", "header", "ETag задачи, полученный в GET /tasks/{id}", false),
+				},
+				body: domain.UpdateTaskRequest{},
+				responses: map[int]responseDoc{
+					http.StatusOK:                    {description: "Задача обновлена", body: domain.UpdateTaskResponse{}},
+					http.StatusCreated:               {description: "Задача создана", body: domain.UpdateTaskResponse{}},
+					http.StatusBadRequest:            problem("Неверный запрос"),
+					http.StatusNotFound:              problem("Задача не найдена"),
+					http.StatusPreconditionFailed:    problem("Задача изменилась после получения ETag"),
+					http.StatusRequestEntityTooLarge: problem("Слишком большое тело запроса"),
+					http.StatusUnsupportedMediaType:  problem("Неподдерживаемый Content-Type"),
+					http.StatusInternalServerError:   problem("Внутренняя ошибка"),
+				},
+			},
+		},
+		{
+			method: http.MethodDelete, path: "/tasks/{id}", handler: h.DeleteTask,
+			doc: operationDoc{
+				id:          "deleteTask",
+				summary:     "Удалить задачу",
+				description: "Удаляет задачу по её UUID (идемпотентная операция)",
+				params:      []paramDoc{uuidPathParam("UUID задачи")},
+				responses: map[int]responseDoc{
+					http.StatusNoContent:           {description: "Задача удалена"},
+					http.StatusBadRequest:          problem("Неверный UUID"),
+					http.StatusInternalServerError: problem("Внутренняя ошибка"),
+				},
+			},
+		},
+		{
+			method: http.MethodGet, path: "/tasks", handler: h.ListTasks,
+			doc: operationDoc{
+				id:      "listTasks",
+				summary: "Список задач",
+				description: "Возвращает список задач с фильтрацией по статусу и пагинацией. " +
+					"С заголовком Accept: text/plain возвращает строки в формате todo.txt. " +
+					"Поддерживает If-None-Match и If-Modified-Since: если задачи под фильтром не менялись, вернётся 304",
+				params: []paramDoc{
+					{name: "status", in: "query", description: "Фильтр по статусу", schema: &Schema{
+						Type: schemaType{"string"},
+						Enum: enumValues[reflect.TypeOf(domain.TaskStatus(""))],
+					}},
+					intParam("limit", "Лимит записей (по умолчанию 100, максимум 1000)", float(0), float(1000)),
+					intParam("offset", "Смещение для пагинации", float(0), nil),
+					stringParam("If-None-Match", "header", "ETag полученного ранее списка", false),
+					stringParam("If-Modified-Since", "header", "Last-Modified полученного ранее списка", false),
+				},
+				responses: map[int]responseDoc{
+					http.StatusOK: {description: "Задачи", body: responseBodies{
+						[]domain.TaskListItem{},
+						mediaBody{contentType: "text/plain"},
+					}},
+					http.StatusNotModified:         {description: "Задачи не менялись"},
+					http.StatusBadRequest:          problem("Неверные параметры"),
+					http.StatusInternalServerError: problem("Внутренняя ошибка"),
+				},
+			},
+		},
+		{
+			method: http.MethodGet, path: "/tasks/export", handler: h.ExportTasks,
+			doc: operationDoc{
+				id:          "exportTasks",
+				summary:     "Экспорт задач",
+				description: "Потоково выгружает все задачи в формате CSV, NDJSON (задача на строку), JSON или todo.txt",
+				params: []paramDoc{
+					{name: "format", in: "query", description: "Формат выгрузки (по умолчанию json)", schema: &Schema{
+						Type: schemaType{"string"},
+						Enum: []any{"csv", "ndjson", "json", "todotxt"},
+					}},
+					{name: "status", in: "query", description: "Фильтр по статусу", schema: &Schema{
+						Type: schemaType{"string"},
+						Enum: enumValues[reflect.TypeOf(domain.TaskStatus(""))],
+					}},
+				},
+				responses: map[int]responseDoc{
+					http.StatusOK: {description: "Задачи", body: responseBodies{
+						[]domain.Task{},
+						mediaBody{contentType: "application/x-ndjson", body: domain.Task{}},
+						mediaBody{contentType: "text/csv"},
+						mediaBody{contentType: "text/plain"},
+					}},
+					http.StatusBadRequest:          problem("Неверные параметры"),
+					http.StatusInternalServerError: problem("Внутренняя ошибка"),
+				},
+			},
+		},
+		{
+			method: http.MethodGet, path: "/tasks/events", handler: h.TaskEvents,
+			doc: operationDoc{
+				id:      "taskEvents",
+				summary: "Поток изменений задач",
+				description: "Отправляет события task.created, task.updated и task.deleted в формате Server-Sent Events. " +
+					"С заголовком Last-Event-ID сначала досылает пропущенные события из журнала, " +
+					"пока событий нет, раз в несколько секунд отправляется комментарий-пинг",
+				params: []paramDoc{
+					{name: "status", in: "query", description: "Фильтр по статусу", schema: &Schema{
+						Type: schemaType{"string"},
+						Enum: enumValues[reflect.TypeOf(domain.TaskStatus(""))],
+					}},
+					stringParam("project", "query", "Фильтр по проекту (+project в заголовке)", false),
+					{name: "task_id", in: "query", description: "Фильтр по UUID задачи", schema: &Schema{
+						Type: schemaType{"string"}, Format: "uuid",
+					}},
+					intParam("last_event_id", "Продолжить после события, если нельзя передать заголовок", float(0), nil),
+					stringParam("Last-Event-ID", "header", "Продолжить после события", false),
+					stringParam("token", "query", "API-ключ", false),
+				},
+				responses: map[int]responseDoc{
+					http.StatusOK: {description: "Поток событий", body: mediaBody{
+						contentType: eventStreamContentType, body: domain.TaskEvent{},
+					}},
+					http.StatusBadRequest:          problem("Неверные параметры"),
+					http.StatusInternalServerError: problem("Внутренняя ошибка"),
+				},
+			},
+		},
+		{
+			method: http.MethodGet, path: "/tasks/changes", handler: h.TaskChanges,
+			doc: operationDoc{
+				id:      "taskChanges",
+				summary: "Изменения задач",
+				description: "Возвращает задачи, созданные или изменённые после токена since, в последнем состоянии, " +
+					"и удалённые задачи. Без since возвращает только токен текущего состояния. С wait ждёт изменений, " +
+					"если их пока нет. Если токен устарел, возвращается 410 и синхронизацию нужно начать заново",
+				params: []paramDoc{
+					stringParam("since", "query", "Токен из next_token предыдущего ответа", false),
+					stringParam("wait", "query", "Сколько ждать изменений, например 30s (максимум 60s)", false),
+					intParam("limit", "Сколько событий журнала просмотреть (по умолчанию и максимум 1000)", float(0), float(1000)),
+				},
+				responses: map[int]responseDoc{
+					http.StatusOK:                  {description: "Изменения", body: domain.TaskChanges{}},
+					http.StatusBadRequest:          problem("Неверные параметры"),
+					http.StatusGone:                problem("Токен устарел"),
+					http.StatusInternalServerError: problem("Внутренняя ошибка"),
+				},
+			},
+		},
+		{
+			method: http.MethodGet, path: "/tasks/stats", handler: h.TaskStats,
+			doc: operationDoc{
+				id:      "taskStats",
+				summary: "Статистика задач",
+				description: "Возвращает число задач под фильтром, всего и по статусам, и сколько задач создано и завершено " +
+					"за каждый день или неделю периода. Задача считается завершённой в момент, когда она последний раз перешла в статус done; " +
+					"правка завершённой задачи этот момент не меняет, а возврат из done его сбрасывает. " +
+					"Для недель период расширяется до целых недель с понедельника",
+				params: []paramDoc{
+					{name: "status", in: "query", description: "Фильтр по статусу", schema: &Schema{
+						Type: schemaType{"string"},
+						Enum: enumValues[reflect.TypeOf(domain.TaskStatus(""))],
+					}},
+					{name: "interval", in: "query", description: "Группировка по дням или неделям (по умолчанию day)", schema: &Schema{
+						Type: schemaType{"string"},
+						Enum: enumValues[reflect.TypeOf(domain.StatsInterval(""))],
+					}},
+					dateParam("from", "Первый день периода (по умолчанию 30 дней или 12 недель до to)"),
+					dateParam("to", "Последний день периода (по умолчанию сегодня, UTC)"),
+				},
+				responses: map[int]responseDoc{
+					http.StatusOK:                  {description: "Статистика", body: domain.TaskStats{}},
+					http.StatusBadRequest:          problem("Неверные параметры"),
+					http.StatusInternalServerError: problem("Внутренняя ошибка"),
+				},
+			},
+		},
+		{
+			method: http.MethodGet, path: "/ws", handler: h.TaskWebSocket,
+			doc: operationDoc{
+				id:      "taskWebSocket",
+				summary: "WebSocket-подписки на задачи",
+				description: "Переключает соединение на WebSocket. Клиент подписывается на канал tasks (с фильтрами status и project) " +
+					"или task:<id> и получает события с порядковыми номерами seq внутри подписки. " +
+					"Ключ можно передать в параметре token, браузер не умеет отправлять заголовки при подключении",
+				params: []paramDoc{
+					stringParam("token", "query", "API-ключ", false),
+				},
+				responses: map[int]responseDoc{
+					http.StatusSwitchingProtocols: {description: "Соединение переключено на WebSocket"},
+					http.StatusBadRequest:         problem("Запрос не является WebSocket-подключением"),
+					http.StatusForbidden:          problem("Origin не разрешён"),
+				},
+			},
+		},
+		{
+			method: http.MethodGet, path: "/tasks.ics", handler: h.TasksCalendar,
+			doc: operationDoc{
+				id:      "tasksCalendar",
+				summary: "Календарь задач",
+				description: "Возвращает задачи как VTODO календаря iCalendar (RFC 5545) для подписки в календарях. " +
+					"Ключ можно передать в параметре token, если клиент не умеет отправлять заголовки",
+				params: []paramDoc{
+					{name: "status", in: "query", description: "Фильтр по статусу", schema: &Schema{
+						Type: schemaType{"string"},
+						Enum: enumValues[reflect.TypeOf(domain.TaskStatus(""))],
+					}},
+					intParam("limit", "Лимит записей (по умолчанию все)", float(0), nil),
+					intParam("offset", "Смещение для пагинации", float(0), nil),
+					stringParam("token", "query", "API-ключ", false),
+					stringParam("If-None-Match", "header", "ETag полученного ранее календаря", false),
+					stringParam("If-Modified-Since", "header", "Last-Modified полученного ранее календаря", false),
+				},
+				responses: map[int]responseDoc{
+					http.StatusOK:                  {description: "Календарь", body: mediaBody{contentType: "text/calendar"}},
+					http.StatusNotModified:         {description: "Задачи не менялись"},
+					http.StatusBadRequest:          problem("Неверные параметры"),
+					http.StatusInternalServerError: problem("Внутренняя ошибка"),
+				},
+			},
+		},
+		{
+			method: http.MethodPost, path: "/tasks/import", handler: h.ImportTasks,
+			doc: operationDoc{
+				id:      "importTasks",
+				summary: "Импорт задач",
+				description: "Загружает задачи из CSV (первая строка — заголовок) или NDJSON (объект на строку). " +
+					"Каждая строка проверяется как при создании задачи, задачи с существующим id пропускаются",
+				params: []paramDoc{
+					{name: "dry_run", in: "query", description: "Только проверить, ничего не сохранять", schema: &Schema{
+						Type: schemaType{"boolean"},
+					}},
+					stringParam("mapping", "query", "Соответствие полей колонкам, field:Column через запятую", false),
+				},
+				body: responseBodies{
+					mediaBody{contentType: "text/csv"},
+					mediaBody{contentType: "application/x-ndjson"},
+				},
+				responses: map[int]responseDoc{
+					http.StatusOK:                    {description: "Отчёт об импорте", body: domain.ImportReport{}},
+					http.StatusBadRequest:            problem("Неверный файл или параметры"),
+					http.StatusRequestEntityTooLarge: problem("Файл слишком большой"),
+					http.StatusUnsupportedMediaType:  problem("Неподдерживаемый формат"),
+					http.StatusInternalServerError:   problem("Внутренняя ошибка"),
+				},
+			},
+		},
+		{
+			method: http.MethodPost, path: "/tasks:batch", handler: h.BatchTasks,
+			doc: operationDoc{
+				id:      "batchTasks",
+				summary: "Пакетные операции",
+				description: "Выполняет список операций create/update/delete. В режиме atomic всё выполняется в одной транзакции, " +
+					"в режиме best_effort операции независимы",
+				params: []paramDoc{
+					stringParam(idempotencyKeyHeader, "header", "Ключ идемпотентности для безопасных повторов", false),
+				},
+				body: domain.BatchRequest{},
+				responses: map[int]responseDoc{
+					http.StatusOK: {description: "Результаты операций", body: domain.BatchResponse{}},
+					http.StatusBadRequest: {
+						description: "Неверный запрос или операция (atomic)",
+						body:        responseBodies{domain.BatchResponse{}, domain.Problem{}},
+					},
+					http.StatusNotFound:              {description: "Задача из операции не найдена (atomic)", body: domain.BatchResponse{}},
+					http.StatusConflict:              {description: "Конфликт id (atomic)", body: domain.BatchResponse{}},
+					http.StatusRequestEntityTooLarge: problem("Слишком много операций"),
+					http.StatusUnsupportedMediaType:  problem("Неподдерживаемый Content-Type"),
+					http.StatusInternalServerError:   problem("Внутренняя ошибка"),
+				},
+			},
+		},
+		{
+			method: http.MethodPost, path: "/webhooks", handler: h.CreateWebhook,
+			doc: operationDoc{
+				id:      "createWebhook",
+				summary: "Создать вебхук",
+				tag:     "webhooks",
+				description: "Регистрирует адрес, на который отправляются события задач. " +
+					"Ответ содержит secret для проверки подписи, позже он не возвращается",
+				params: []paramDoc{
+					stringParam(idempotencyKeyHeader, "header", "Ключ идемпотентности для безопасных повторов", false),
+				},
+				body: domain.WebhookRequest{},
+				responses: map[int]responseDoc{
+					http.StatusCreated:               {description: "Вебхук создан", body: domain.Webhook{}},
+					http.StatusBadRequest:            problem("Неверный запрос"),
+					http.StatusConflict:              problem("Запрос с этим ключом ещё выполняется"),
+					http.StatusRequestEntityTooLarge: problem("Слишком большое тело запроса"),
+					http.StatusUnsupportedMediaType:  problem("Неподдерживаемый Content-Type"),
+					http.StatusUnprocessableEntity:   problem("Ключ идемпотентности использован с другим запросом"),
+					http.StatusInternalServerError:   problem("Внутренняя ошибка"),
+				},
+			},
+		},
+		{
+			method: http.MethodGet, path: "/webhooks", handler: h.ListWebhooks,
+			doc: operationDoc{
+				id:      "listWebhooks",
+				summary: "Список вебхуков",
+				tag:     "webhooks",
+				responses: map[int]responseDoc{
+					http.StatusOK:                  {description: "Вебхуки", body: []domain.Webhook{}},
+					http.StatusInternalServerError: problem("Внутренняя ошибка"),
+				},
+			},
+		},
+		{
+			method: http.MethodGet, path: "/webhooks/{id}", handler: h.GetWebhook,
+			doc: operationDoc{
+				id:      "getWebhook",
+				summary: "Получить вебхук",
+				tag:     "webhooks",
+				params:  []paramDoc{uuidPathParam("UUID вебхука")},
+				responses: map[int]responseDoc{
+					http.StatusOK:                  {description: "Вебхук", body: domain.Webhook{}},
+					http.StatusBadRequest:          problem("Неверный UUID"),
+					http.StatusNotFound:            problem("Вебхук не найден"),
+					http.StatusInternalServerError: problem("Внутренняя ошибка"),
+				},
+			},
+		},
+		{
+			method: http.MethodPut, path: "/webhooks/{id}", handler: h.UpdateWebhook,
+			doc: operationDoc{
+				id:      "updateWebhook",
+				summary: "Обновить вебхук",
+				tag:     "webhooks",
+				description: "Заменяет адрес, типы событий и фильтры, без secret сохраняется прежний. " +
+					"active=true включает отключённый после ошибок вебхук и сбрасывает счётчик ошибок",
+				params: []paramDoc{uuidPathParam("UUID вебхука")},
+				body:   domain.WebhookRequest{},
+				responses: map[int]responseDoc{
+					http.StatusOK:                    {description: "Вебхук обновлён", body: domain.Webhook{}},
+					http.StatusBadRequest:            problem("Неверный запрос"),
+					http.StatusNotFound:              problem("Вебхук не найден"),
+					http.StatusRequestEntityTooLarge: problem("Слишком большое тело запроса"),
+					http.StatusUnsupportedMediaType:  problem("Неподдерживаемый Content-Type"),
+					http.StatusInternalServerError:   problem("Внутренняя ошибка"),
+				},
+			},
+		},
+		{
+			method: http.MethodDelete, path: "/webhooks/{id}", handler: h.DeleteWebhook,
+			doc: operationDoc{
+				id:      "deleteWebhook",
+				summary: "Удалить вебхук",
+				tag:     "webhooks",
+				params:  []paramDoc{uuidPathParam("UUID вебхука")},
+				responses: map[int]responseDoc{
+					http.StatusNoContent:           {description: "Вебхук удалён"},
+					http.StatusBadRequest:          problem("Неверный UUID"),
+					http.StatusNotFound:            problem("Вебхук не найден"),
+					http.StatusInternalServerError: problem("Внутренняя ошибка"),
+				},
+			},
+		},
+		{
+			method: http.MethodGet, path: "/webhooks/{id}/deliveries", handler: h.WebhookDeliveries,
+			doc: operationDoc{
+				id:          "webhookDeliveries",
+				summary:     "Журнал отправок",
+				tag:         "webhooks",
+				description: "Возвращает отправки вебхука, новые первыми: состояние, число попыток и ответ получателя",
+				params: []paramDoc{
+					uuidPathParam("UUID вебхука"),
+					intParam("limit", "Лимит записей (по умолчанию 100, максимум 100)", float(0), float(100)),
+					intParam("offset", "Смещение для пагинации", float(0), nil),
+				},
+				responses: map[int]responseDoc{
+					http.StatusOK:                  {description: "Отправки", body: []domain.WebhookDelivery{}},
+					http.StatusBadRequest:          problem("Неверные параметры"),
+					http.StatusNotFound:            problem("Вебхук не найден"),
+					http.StatusInternalServerError: problem("Внутренняя ошибка"),
+				},
+			},
+		},
+		{
+			method: http.MethodPost, path: "/webhooks/{id}/deliveries/{delivery_id}/redeliver", handler: h.RedeliverWebhook,
+			doc: operationDoc{
+				id:          "redeliverWebhook",
+				summary:     "Повторить отправку",
+				tag:         "webhooks",
+				description: "Ставит в очередь новую отправку с тем же телом, исходная запись журнала не меняется",
+				params: []paramDoc{
+					uuidPathParam("UUID вебхука"),
+					{name: "delivery_id", in: "path", description: "UUID отправки", required: true, schema: &Schema{
+						Type: schemaType{"string"}, Format: "uuid",
+					}},
+				},
+				responses: map[int]responseDoc{
+					http.StatusAccepted:            {description: "Отправка поставлена в очередь", body: domain.WebhookDelivery{}},
+					http.StatusBadRequest:          problem("Неверный UUID"),
+					http.StatusNotFound:            problem("Вебхук или отправка не найдены"),
+					http.StatusInternalServerError: problem("Внутренняя ошибка"),
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nightmaker00/go-tasks-api/internal/config"
+	"github.com/nightmaker00/go-tasks-api/internal/events"
+	"github.com/nightmaker00/go-tasks-api/internal/service"
+	"github.com/nightmaker00/go-tasks-api/internal/service/servicetest"
+	"github.com/nightmaker00/go-tasks-api/internal/webhook"
+)
+
+// testAPI is a Handler on the in-memory repository behind the middleware of the server
+type testAPI struct {
+	http.Handler
+	repo     *servicetest.TaskRepository
+	webhooks *servicetest.WebhookRepository
+	handler  *Handler
+	spec     *OpenAPIDocument
+}
+
+// newTestAPI builds the server with the default config changed by configure, which may be nil
+func newTestAPI(t *testing.T, configure func(cfg *config.Config)) *testAPI {
+	t.Helper()
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	if configure != nil {
+		configure(cfg)
+	}
+
+	repo := servicetest.NewTaskRepository()
+	broker := events.NewBroker(cfg.Events.BufferSize)
+	t.Cleanup(broker.Close)
+	webhooks := servicetest.NewWebhookRepository()
+	targets, err := webhook.NewTargetPolicy(cfg.Webhooks.AllowedNetworks, hostsResolver{"internal.example.com": "10.0.0.5"})
+	if err != nil {
+		t.Fatalf("webhook targets: %v", err)
+	}
+	handler := NewHandler(service.NewTaskService(repo, nil), service.NewWebhookService(webhooks, targets), broker, cfg.API)
+
+	mux := http.NewServeMux()
+	handler.RegisterRoutes(mux)
+	spec := handler.OpenAPI()
+
+	ttl := time.Duration(cfg.Idempotency.TTLSeconds) * time.Second
+	lease := time.Duration(cfg.Idempotency.LeaseSeconds) * time.Second
+	var apiHandler http.Handler = WithIdempotency(newMemoryIdempotencyStore(), ttl, lease, handler.BodyLimit, mux)
+	if cfg.Validation.Requests || cfg.Validation.Responses {
+		apiHandler = WithValidation(NewRequestValidator(spec, cfg.Validation, handler.BodyLimit), apiHandler)
+	}
+	apiHandler = WithContentNegotiation(spec, cfg.API.MaxBodyBytes, apiHandler)
+	root := WithRequestID(WithCompression(cfg.Compression, WithCORS(cfg.CORS, mux, apiHandler)))
+	return &testAPI{Handler: root, repo: repo, webhooks: webhooks, handler: handler, spec: spec}
+}
+
+// hostsResolver resolves the hosts it lists and puts every other host at a public
+// documentation address, so tests do not depend on DNS
+type hostsResolver map[string]string
+
+func (h hostsResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	if addr, ok := h[host]; ok {
+		return []netip.Addr{netip.MustParseAddr(addr)}, nil
+	}
+	return []netip.Addr{netip.MustParseAddr("203.0.113.10")}, nil
+}
+
+// do sends a request with a JSON body, body may be empty
+func (a *testAPI) do(t *testing.T, method, target, body string, header ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeBody decodes a JSON response into v and fails the test when it is not JSON
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+}
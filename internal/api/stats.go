@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+// TaskStats возвращает статистику задач
+func (h *Handler) TaskStats(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	status := strings.TrimSpace(query.Get("status"))
+	interval := domain.StatsInterval(strings.TrimSpace(query.Get("interval")))
+	var fields []domain.FieldError
+	from, err := parseDateParam(r, "from")
+	if err != nil {
+		fields = append(fields, domain.FieldError{Field: "from", Code: "invalid_date", Message: "invalid from, expected YYYY-MM-DD"})
+	}
+	to, err := parseDateParam(r, "to")
+	if err != nil {
+		fields = append(fields, domain.FieldError{Field: "to", Code: "invalid_date", Message: "invalid to, expected YYYY-MM-DD"})
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, fields)
+		return
+	}
+
+	stats, err := h.taskService.Stats(r.Context(), status, interval, from, to)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// parseDateParam reads a YYYY-MM-DD date in UTC, the zero time when it is absent
+func parseDateParam(r *http.Request, key string) (time.Time, error) {
+	raw := strings.TrimSpace(r.URL.Query().Get(key))
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.DateOnly, raw)
+}
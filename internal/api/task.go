@@ -2,15 +2,27 @@ package api
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/nightmaker00/go-tasks-api/internal/domain"
 )
 
 type TaskService interface {
-	Create(ctx context.Context, title string, description string) (uuid.UUID, error)
+	Create(ctx context.Context, id uuid.UUID, title string, description string) (uuid.UUID, error)
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.Task, error)
+	GetByIDs(ctx context.Context, ids []uuid.UUID) ([]domain.Task, error)
 	Update(ctx context.Context, id uuid.UUID, title string, description *string, status string) error
+	UpdateIfUnmodified(ctx context.Context, id uuid.UUID, version time.Time, title string, description *string, status string) error
+	Upsert(ctx context.Context, id uuid.UUID, title string, description *string, status string) (bool, error)
 	Delete(ctx context.Context, id uuid.UUID) error
 	List(ctx context.Context, status string, limit, offset int) ([]domain.TaskListItem, error)
+	ListVersion(ctx context.Context, status string, limit, offset int) (domain.TaskListVersion, error)
+	Stats(ctx context.Context, status string, interval domain.StatsInterval, from, to time.Time) (*domain.TaskStats, error)
+	Export(ctx context.Context, status string, fn func(task domain.Task) error) error
+	Import(ctx context.Context, records []domain.ImportRecord, dryRun bool) (*domain.ImportReport, error)
+	Batch(ctx context.Context, mode domain.BatchMode, ops []domain.BatchOperation) ([]domain.BatchOutcome, error)
+	EventsAfter(ctx context.Context, afterID int64, limit int) ([]domain.TaskEvent, error)
+	Changes(ctx context.Context, token string, limit int) (*domain.TaskChanges, error)
+	History(ctx context.Context, ids []uuid.UUID, limit int) ([]domain.TaskEvent, error)
 }
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"bufio"
+	"net/http"
+
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	"github.com/nightmaker00/go-tasks-api/internal/todotxt"
+)
+
+const todoTxtContentType = "text/plain; charset=utf-8"
+
+// writeTodoTxt writes list items as todo.txt lines. Items have no description or
+// dates, for a complete file there is GET /tasks/export?format=todotxt.
+func writeTodoTxt(w http.ResponseWriter, items []domain.TaskListItem) {
+	w.Header().Set("Content-Type", todoTxtContentType)
+	w.WriteHeader(http.StatusOK)
+	out := bufio.NewWriter(w)
+	for _, item := range items {
+		out.WriteString(todotxt.Format(domain.Task{ID: item.ID, Title: item.Title, Status: item.Status}))
+		out.WriteByte('\n')
+	}
+	_ = out.Flush()
+}
@@ -0,0 +1,607 @@
+package api
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/config"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+type specRoute struct {
+	method   string
+	segments []string
+	op       *openAPIOperation
+}
+
+// RequestValidator checks requests, and optionally responses, against the OpenAPI document
+type RequestValidator struct {
+	cfg       config.Validation
+	bodyLimit func(*http.Request) int64
+	routes    []specRoute
+	schemas   map[string]*Schema
+}
+
+// NewRequestValidator reads JSON bodies up to bodyLimit of the route, like WithIdempotency,
+// a nil bodyLimit or a limit of zero or less leaves them unbounded
+func NewRequestValidator(doc *OpenAPIDocument, cfg config.Validation, bodyLimit func(*http.Request) int64) *RequestValidator {
+	return &RequestValidator{cfg: cfg, bodyLimit: bodyLimit, routes: specRoutes(doc), schemas: doc.Components.Schemas}
+}
+
+// specRoutes lists the operations of the document in the order they are matched
+func specRoutes(doc *OpenAPIDocument) []specRoute {
+	var routes []specRoute
+	for path, operations := range doc.Paths {
+		for method, op := range operations {
+			routes = append(routes, specRoute{
+				method:   strings.ToUpper(method),
+				segments: strings.Split(strings.Trim(path, "/"), "/"),
+				op:       op,
+			})
+		}
+	}
+	// literal segments win over templated ones, like in http.ServeMux
+	sort.Slice(routes, func(i, j int) bool {
+		return templatedSegments(routes[i].segments) < templatedSegments(routes[j].segments)
+	})
+	return routes
+}
+
+// WithValidation rejects requests that do not match the spec before they reach next
+func WithValidation(v *RequestValidator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, pathValues := v.match(r)
+		if route == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if v.cfg.Requests && !v.validateRequest(w, r, route.op, pathValues) {
+			return
+		}
+		if !v.cfg.Responses {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK, jsonOnly: true}
+		next.ServeHTTP(rec, r)
+		v.validateResponse(r, route.op, rec)
+	})
+}
+
+func (v *RequestValidator) match(r *http.Request) (*specRoute, map[string]string) {
+	return matchSpecRoute(v.routes, r)
+}
+
+// matchSpecRoute finds the operation serving r and the values of its path parameters
+func matchSpecRoute(routes []specRoute, r *http.Request) (*specRoute, map[string]string) {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	for i := range routes {
+		route := &routes[i]
+		if route.method != r.Method || len(route.segments) != len(segments) {
+			continue
+		}
+		values := make(map[string]string)
+		matched := true
+		for j, segment := range route.segments {
+			if name, ok := templateName(segment); ok && segments[j] != "" {
+				values[name] = segments[j]
+				continue
+			}
+			if segment != segments[j] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return route, values
+		}
+	}
+	return nil, nil
+}
+
+// validateRequest writes the error response itself and reports whether the request may proceed
+func (v *RequestValidator) validateRequest(w http.ResponseWriter, r *http.Request, op *openAPIOperation, pathValues map[string]string) bool {
+	var fields []domain.FieldError
+	query := r.URL.Query()
+
+	for _, param := range op.Parameters {
+		var raw string
+		var present bool
+		switch param.In {
+		case "path":
+			raw, present = pathValues[param.Name]
+		case "query":
+			raw = strings.TrimSpace(query.Get(param.Name))
+			present = raw != ""
+		case "header":
+			raw = strings.TrimSpace(r.Header.Get(param.Name))
+			present = raw != ""
+		default:
+			continue
+		}
+
+		if !present {
+			if param.Required {
+				fields = append(fields, fieldError(param.Name, "required", "is required"))
+			}
+			continue
+		}
+		schema := v.resolve(param.Schema)
+		value, err := parseParameter(raw, schema)
+		if err != nil {
+			fields = append(fields, fieldError(param.Name, "type", "must be "+describeType(schema.Type)))
+			continue
+		}
+		v.validateValue(param.Name, value, schema, &fields)
+	}
+
+	if op.RequestBody != nil {
+		ok, bodyFields := v.validateBody(w, r, op.RequestBody)
+		if !ok {
+			return false
+		}
+		fields = append(fields, bodyFields...)
+	}
+
+	if len(fields) > 0 {
+		writeValidationError(w, uniqueFieldErrors(fields))
+		return false
+	}
+	return true
+}
+
+func (v *RequestValidator) validateBody(w http.ResponseWriter, r *http.Request, body *openAPIRequestBody) (bool, []domain.FieldError) {
+	mediaType, ok := matchContentType(body.Content, r.Header.Get("Content-Type"))
+	if r.ContentLength != 0 && !ok {
+		writeError(w, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, "unsupported content type")
+		return false, nil
+	}
+
+	// only JSON bodies are checked here, handlers of other media types stream and limit them
+	if ok && !isJSONMediaType(r.Header.Get("Content-Type")) {
+		return true, nil
+	}
+
+	reader := r.Body
+	if v.bodyLimit != nil {
+		if limit := v.bodyLimit(r); limit > 0 {
+			reader = http.MaxBytesReader(w, r.Body, limit)
+		}
+	}
+	// the body is kept for next as it is read, decodeStream stops at the first array
+	// item past maxItems so an oversized batch is not buffered before it is rejected
+	var raw bytes.Buffer
+	decoder := json.NewDecoder(io.TeeReader(reader, &raw))
+	decoder.UseNumber()
+	value, err := v.decodeStream(decoder, "", mediaType.Schema)
+	if err == nil && decoder.More() {
+		err = errors.New("unexpected data after json value")
+	}
+	if err == nil || err == io.EOF {
+		// keep what the decoder did not need, or the error reading it
+		if _, copyErr := io.Copy(&raw, reader); copyErr != nil {
+			err = copyErr
+		}
+	}
+	r.Body = io.NopCloser(bytes.NewReader(raw.Bytes()))
+
+	var tooLarge *http.MaxBytesError
+	var tooManyItems *tooManyItemsError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, codePayloadTooLarge, "request body too large")
+		return false, nil
+	case errors.As(err, &tooManyItems):
+		writeError(w, http.StatusRequestEntityTooLarge, codePayloadTooLarge, tooManyItems.Error())
+		return false, nil
+	case err == io.EOF && len(bytes.TrimSpace(raw.Bytes())) == 0:
+		if body.Required {
+			return true, []domain.FieldError{fieldError("body", "required", "is required")}
+		}
+		return true, nil
+	case err != nil:
+		writeError(w, http.StatusBadRequest, codeInvalidJSON, "invalid json")
+		return false, nil
+	}
+
+	var fields []domain.FieldError
+	v.validateValue("", value, mediaType.Schema, &fields)
+	return true, fields
+}
+
+// tooManyItemsError stops decodeStream at the first item past the maxItems of an array
+type tooManyItemsError struct {
+	path     string
+	maxItems int
+}
+
+func (e *tooManyItemsError) Error() string {
+	return fmt.Sprintf("%s has more than %d items", e.path, e.maxItems)
+}
+
+// decodeStream decodes the next JSON value token by token, like Decode into an any,
+// and fails with tooManyItemsError as soon as an array outgrows the maxItems of its schema
+func (v *RequestValidator) decodeStream(decoder *json.Decoder, path string, schema *Schema) (any, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	schema = v.resolve(schema)
+	switch token {
+	case json.Delim('{'):
+		object := make(map[string]any)
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			name, _ := key.(string)
+			value, err := v.decodeStream(decoder, joinPath(path, name), bodySchema{schemas: v.schemas}.property(schema, name))
+			if err != nil {
+				return nil, err
+			}
+			object[name] = value
+		}
+		_, err = decoder.Token()
+		return object, err
+	case json.Delim('['):
+		items := []any{}
+		var itemSchema *Schema
+		if schema != nil {
+			itemSchema = schema.Items
+		}
+		for decoder.More() {
+			if schema != nil && schema.MaxItems != nil && len(items) == *schema.MaxItems {
+				return nil, &tooManyItemsError{path: cmp.Or(path, "body"), maxItems: *schema.MaxItems}
+			}
+			item, err := v.decodeStream(decoder, fmt.Sprintf("%s[%d]", path, len(items)), itemSchema)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		_, err = decoder.Token()
+		return items, err
+	default:
+		return token, nil
+	}
+}
+
+func (v *RequestValidator) validateResponse(r *http.Request, op *openAPIOperation, rec *responseRecorder) {
+	for _, problem := range v.checkResponse(op, rec.status, rec.Header().Get("Content-Type"), rec.body.Bytes(), rec.size > 0) {
+		log.Printf("response validation %s %s: %s (request %s)", r.Method, r.URL.Path, problem, RequestID(r.Context()))
+	}
+}
+
+// checkResponse lists how a response of the operation departs from the document: an
+// undocumented status or content type, or a JSON body that does not match its schema
+func (v *RequestValidator) checkResponse(op *openAPIOperation, status int, contentType string, body []byte, hasBody bool) []string {
+	response, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		return []string{fmt.Sprintf("undocumented status %d", status)}
+	}
+	if !hasBody {
+		return nil
+	}
+	mediaType, ok := matchContentType(response.Content, contentType)
+	if !ok {
+		return []string{fmt.Sprintf("%d: undocumented content type %q", status, contentType)}
+	}
+	if !isJSONMediaType(contentType) {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return []string{fmt.Sprintf("%d: invalid json", status)}
+	}
+	var fields []domain.FieldError
+	v.validateValue("", value, mediaType.Schema, &fields)
+	problems := make([]string, 0, len(fields))
+	for _, field := range fields {
+		problems = append(problems, fmt.Sprintf("%d: %s %s", status, field.Field, field.Message))
+	}
+	return problems
+}
+
+// validateValue checks value against schema and appends every mismatch to fields.
+// Unknown object properties are rejected unless the schema declares additionalProperties.
+func (v *RequestValidator) validateValue(path string, value any, schema *Schema, fields *[]domain.FieldError) {
+	schema = v.resolve(schema)
+	if schema == nil {
+		return
+	}
+	for _, part := range schema.AllOf {
+		v.validateValue(path, value, part, fields)
+	}
+	name := path
+	if name == "" {
+		name = "body"
+	}
+
+	if !matchesType(value, schema.Type) {
+		*fields = append(*fields, fieldError(name, "type", "must be "+describeType(schema.Type)))
+		return
+	}
+	if len(schema.Enum) > 0 && !inEnum(value, schema.Enum) {
+		*fields = append(*fields, fieldError(name, "enum", "must be one of: "+joinEnum(schema.Enum)))
+		return
+	}
+
+	switch typed := value.(type) {
+	case string:
+		v.validateString(name, typed, schema, fields)
+	case json.Number:
+		number, _ := typed.Float64()
+		if schema.Minimum != nil && number < *schema.Minimum {
+			*fields = append(*fields, fieldError(name, "minimum", fmt.Sprintf("must be at least %v", *schema.Minimum)))
+		}
+		if schema.Maximum != nil && number > *schema.Maximum {
+			*fields = append(*fields, fieldError(name, "maximum", fmt.Sprintf("must be at most %v", *schema.Maximum)))
+		}
+	case []any:
+		if schema.MinItems != nil && len(typed) < *schema.MinItems {
+			*fields = append(*fields, fieldError(name, "min_items", fmt.Sprintf("must contain at least %d items", *schema.MinItems)))
+		}
+		if schema.MaxItems != nil && len(typed) > *schema.MaxItems {
+			*fields = append(*fields, fieldError(name, "max_items", fmt.Sprintf("must contain at most %d items", *schema.MaxItems)))
+		}
+		for i, item := range typed {
+			v.validateValue(fmt.Sprintf("%s[%d]", path, i), item, schema.Items, fields)
+		}
+	case map[string]any:
+		v.validateObject(path, typed, schema, fields)
+	}
+}
+
+func (v *RequestValidator) validateString(name, value string, schema *Schema, fields *[]domain.FieldError) {
+	length := utf8.RuneCountInString(value)
+	if schema.MinLength != nil && length < *schema.MinLength {
+		*fields = append(*fields, fieldError(name, "min_length", fmt.Sprintf("must be at least %d characters", *schema.MinLength)))
+	}
+	if schema.MaxLength != nil && length > *schema.MaxLength {
+		*fields = append(*fields, fieldError(name, "max_length", fmt.Sprintf("must be at most %d characters", *schema.MaxLength)))
+	}
+	switch schema.Format {
+	case "uuid":
+		if _, err := uuid.Parse(value); err != nil {
+			*fields = append(*fields, fieldError(name, "format", "must be a valid uuid"))
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			*fields = append(*fields, fieldError(name, "format", "must be an RFC 3339 date-time"))
+		}
+	case "date":
+		if _, err := time.Parse(time.DateOnly, value); err != nil {
+			*fields = append(*fields, fieldError(name, "format", "must be a date, YYYY-MM-DD"))
+		}
+	}
+}
+
+func (v *RequestValidator) validateObject(path string, value map[string]any, schema *Schema, fields *[]domain.FieldError) {
+	for _, name := range schema.Required {
+		if _, ok := value[name]; !ok {
+			*fields = append(*fields, fieldError(joinPath(path, name), "required", "is required"))
+		}
+	}
+
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		property, known := schema.Properties[key]
+		if !known {
+			if schema.AdditionalProperties == nil {
+				*fields = append(*fields, fieldError(joinPath(path, key), "unknown_field", "unknown field"))
+				continue
+			}
+			property = schema.AdditionalProperties
+		}
+		// null stands for "not set" on optional properties
+		if value[key] == nil && !contains(schema.Required, key) {
+			continue
+		}
+		v.validateValue(joinPath(path, key), value[key], property, fields)
+	}
+}
+
+func (v *RequestValidator) resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		schema = v.schemas[strings.TrimPrefix(schema.Ref, schemaRefBase)]
+	}
+	return schema
+}
+
+// parseParameter converts a path, query or header value to the JSON type of its schema
+func parseParameter(raw string, schema *Schema) (any, error) {
+	if schema == nil {
+		return raw, nil
+	}
+	switch {
+	case schema.Type.has("integer"):
+		if _, err := strconv.ParseInt(raw, 10, 64); err != nil {
+			return nil, err
+		}
+		return json.Number(raw), nil
+	case schema.Type.has("number"):
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			return nil, err
+		}
+		return json.Number(raw), nil
+	case schema.Type.has("boolean"):
+		return strconv.ParseBool(raw)
+	default:
+		return raw, nil
+	}
+}
+
+func matchesType(value any, types schemaType) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, typ := range types {
+		if matchesSingleType(value, typ) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesSingleType(value any, typ string) bool {
+	switch typ {
+	case "null":
+		return value == nil
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	case "integer":
+		number, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := number.Int64()
+		return err == nil
+	default:
+		return true
+	}
+}
+
+func describeType(types schemaType) string {
+	names := make([]string, 0, len(types))
+	for _, typ := range types {
+		switch typ {
+		case "null":
+			continue
+		case "object", "array", "integer":
+			names = append(names, "an "+typ)
+		default:
+			names = append(names, "a "+typ)
+		}
+	}
+	if len(names) == 0 {
+		return "a value"
+	}
+	return strings.Join(names, " or ")
+}
+
+func inEnum(value any, enum []any) bool {
+	for _, allowed := range enum {
+		if fmt.Sprint(allowed) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinEnum(enum []any) string {
+	values := make([]string, len(enum))
+	for i, value := range enum {
+		values[i] = fmt.Sprint(value)
+	}
+	return strings.Join(values, ", ")
+}
+
+// matchContentType finds the media type entry for a Content-Type header
+func matchContentType(content map[string]openAPIMediaType, header string) (openAPIMediaType, bool) {
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return openAPIMediaType{}, false
+	}
+	for name, entry := range content {
+		if strings.EqualFold(name, mediaType) {
+			return entry, true
+		}
+	}
+	return openAPIMediaType{}, false
+}
+
+func templateName(segment string) (string, bool) {
+	if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+	return "", false
+}
+
+func templatedSegments(segments []string) int {
+	count := 0
+	for _, segment := range segments {
+		if _, ok := templateName(segment); ok {
+			count++
+		}
+	}
+	return count
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func contains(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueFieldErrors drops repeats produced when allOf parts share a constraint
+func uniqueFieldErrors(fields []domain.FieldError) []domain.FieldError {
+	seen := make(map[domain.FieldError]bool, len(fields))
+	unique := fields[:0]
+	for _, field := range fields {
+		if !seen[field] {
+			seen[field] = true
+			unique = append(unique, field)
+		}
+	}
+	return unique
+}
+
+func fieldError(field, code, message string) domain.FieldError {
+	return domain.FieldError{Field: field, Code: code, Message: message}
+}
+
+// isJSONMediaType reports whether a body of the content type is a single JSON document
+func isJSONMediaType(header string) bool {
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+type WebhookService interface {
+	Create(ctx context.Context, req domain.WebhookRequest) (*domain.Webhook, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Webhook, error)
+	List(ctx context.Context) ([]domain.Webhook, error)
+	Update(ctx context.Context, id uuid.UUID, req domain.WebhookRequest) (*domain.Webhook, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+	Deliveries(ctx context.Context, webhookID uuid.UUID, limit, offset int) ([]domain.WebhookDelivery, error)
+	Redeliver(ctx context.Context, webhookID, deliveryID uuid.UUID) (*domain.WebhookDelivery, error)
+}
+
+// CreateWebhook создаёт подписку на события задач
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req domain.WebhookRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	webhook, err := h.webhookService.Create(r.Context(), req)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/webhooks/"+webhook.ID.String())
+	writeJSON(w, http.StatusCreated, webhook)
+}
+
+// ListWebhooks возвращает все подписки
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.webhookService.List(r.Context())
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, webhooks)
+}
+
+// GetWebhook возвращает подписку по ID
+func (h *Handler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidID, "invalid id")
+		return
+	}
+	webhook, err := h.webhookService.GetByID(r.Context(), id)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, webhook)
+}
+
+// UpdateWebhook заменяет настройки подписки
+func (h *Handler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidID, "invalid id")
+		return
+	}
+	var req domain.WebhookRequest
+	if !h.decodeJSON(w, r, &req) {
+		return
+	}
+	webhook, err := h.webhookService.Update(r.Context(), id, req)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, webhook)
+}
+
+// DeleteWebhook удаляет подписку вместе с журналом отправок
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidID, "invalid id")
+		return
+	}
+	if err := h.webhookService.Delete(r.Context(), id); err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusNoContent, nil)
+}
+
+// WebhookDeliveries возвращает журнал отправок подписки
+func (h *Handler) WebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	var fields []domain.FieldError
+	id, err := parseID(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidID, "invalid id")
+		return
+	}
+	limit, err := parseIntParam(r, "limit")
+	if err != nil {
+		fields = append(fields, domain.FieldError{Field: "limit", Code: "invalid_integer", Message: "invalid limit"})
+	}
+	offset, err := parseIntParam(r, "offset")
+	if err != nil {
+		fields = append(fields, domain.FieldError{Field: "offset", Code: "invalid_integer", Message: "invalid offset"})
+	}
+	if len(fields) > 0 {
+		writeValidationError(w, fields)
+		return
+	}
+
+	deliveries, err := h.webhookService.Deliveries(r.Context(), id, limit, offset)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, deliveries)
+}
+
+// RedeliverWebhook повторно отправляет событие
+func (h *Handler) RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := parseID(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidID, "invalid id")
+		return
+	}
+	deliveryID, err := parseID(r.PathValue("delivery_id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidID, "invalid delivery id")
+		return
+	}
+	delivery, err := h.webhookService.Redeliver(r.Context(), id, deliveryID)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, delivery)
+}
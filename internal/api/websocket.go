@@ -0,0 +1,487 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	"github.com/nightmaker00/go-tasks-api/internal/events"
+)
+
+const (
+	// wsMaxMessageBytes limits the size of a client message
+	wsMaxMessageBytes = 64 << 10
+	// wsMaxSubscriptions limits the subscriptions of one connection
+	wsMaxSubscriptions = 100
+	// wsWriteTimeout bounds a single frame write, a client that stalls longer is dropped
+	wsWriteTimeout = 10 * time.Second
+	// wsCloseTimeout is how long the server waits for the client to answer its close frame
+	wsCloseTimeout = time.Second
+
+	wsChannelTasks      = "tasks"
+	wsChannelTaskPrefix = "task:"
+)
+
+// client message types
+const (
+	wsSubscribe   = "subscribe"
+	wsUnsubscribe = "unsubscribe"
+)
+
+// server message types
+const (
+	wsSubscribed   = "subscribed"
+	wsUnsubscribed = "unsubscribed"
+	wsEvent        = "event"
+	wsError        = "error"
+)
+
+// errWSStopped ends a replay once the connection is closing
+var errWSStopped = errors.New("websocket stopped")
+
+// wsClientMessage is a request from the client. Channel "tasks" is a query over all
+// tasks narrowed by status and project, "task:<id>" follows a single task.
+type wsClientMessage struct {
+	Type         string `json:"type"`
+	ID           string `json:"id"`
+	Channel      string `json:"channel,omitempty"`
+	Status       string `json:"status,omitempty"`
+	Project      string `json:"project,omitempty"`
+	AfterEventID *int64 `json:"after_event_id,omitempty"`
+}
+
+// wsServerMessage is sent to the client. Seq numbers the events of a subscription
+// from 1 without gaps, so a client notices a lost message.
+type wsServerMessage struct {
+	Type    string              `json:"type"`
+	ID      string              `json:"id,omitempty"`
+	Seq     int64               `json:"seq,omitempty"`
+	Event   *domain.TaskEvent   `json:"event,omitempty"`
+	Code    string              `json:"code,omitempty"`
+	Message string              `json:"message,omitempty"`
+	Errors  []domain.FieldError `json:"errors,omitempty"`
+}
+
+// TaskWebSocket открывает WebSocket-подписку на изменения задач
+func (h *Handler) TaskWebSocket(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{
+		CheckOrigin: h.webSocketOriginAllowed,
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			if status == http.StatusForbidden {
+				writeError(w, status, codeOriginNotAllowed, "origin not allowed")
+				return
+			}
+			writeError(w, status, codeWebSocketHandshake, reason.Error())
+		},
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already answered the request
+		return
+	}
+
+	c := newWSConn(h, conn, RequestID(r.Context()))
+	if !h.trackSocket(c) {
+		c.fail(websocket.CloseGoingAway, "server is shutting down")
+		c.run()
+		return
+	}
+	defer h.untrackSocket(c)
+	c.run()
+}
+
+// webSocketOriginAllowed accepts clients without an Origin header, browsers always send one
+func (h *Handler) webSocketOriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	return originAllowed(h.cfg.WebSocketOrigins, origin)
+}
+
+// socket is an open WebSocket connection, fail makes it send a close frame and end
+type socket interface {
+	fail(code int, text string)
+}
+
+// trackSocket registers an open connection for Shutdown, it fails once Shutdown has begun
+func (h *Handler) trackSocket(c socket) bool {
+	h.socketsMu.Lock()
+	defer h.socketsMu.Unlock()
+	if h.shuttingDown {
+		return false
+	}
+	if h.sockets == nil {
+		h.sockets = make(map[socket]struct{})
+	}
+	h.sockets[c] = struct{}{}
+	h.socketsDone.Add(1)
+	return true
+}
+
+func (h *Handler) untrackSocket(c socket) {
+	h.socketsMu.Lock()
+	defer h.socketsMu.Unlock()
+	delete(h.sockets, c)
+	h.socketsDone.Done()
+}
+
+// Shutdown closes WebSocket connections with 1001 (going away) and waits for them to
+// finish. http.Server.Shutdown does not track hijacked connections, so call it after.
+func (h *Handler) Shutdown(ctx context.Context) error {
+	h.socketsMu.Lock()
+	h.shuttingDown = true
+	for c := range h.sockets {
+		c.fail(websocket.CloseGoingAway, "server is shutting down")
+	}
+	h.socketsMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.socketsDone.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// wsConn serves one connection: the reader handles client messages, the dispatcher
+// routes broker events to subscriptions and the writer owns all writes to the socket
+type wsConn struct {
+	h         *Handler
+	conn      *websocket.Conn
+	requestID string
+	send      chan wsServerMessage
+	stop      chan struct{}
+	readDone  chan struct{}
+
+	mu        sync.Mutex
+	subs      map[string]*wsSubscription
+	stopOnce  sync.Once
+	closeCode int
+	closeText string
+}
+
+type wsSubscription struct {
+	id     string
+	filter eventFilter
+	seq    int64
+	// while replaying, live events wait in pending and are sent once the log is caught up
+	replaying bool
+	pending   []domain.TaskEvent
+}
+
+func newWSConn(h *Handler, conn *websocket.Conn, requestID string) *wsConn {
+	return &wsConn{
+		h:         h,
+		conn:      conn,
+		requestID: requestID,
+		send:      make(chan wsServerMessage, h.cfg.WebSocketBuffer),
+		stop:      make(chan struct{}),
+		readDone:  make(chan struct{}),
+		subs:      make(map[string]*wsSubscription),
+	}
+}
+
+func (c *wsConn) run() {
+	sub := c.h.events.Subscribe()
+	defer sub.Close()
+
+	go c.read()
+	go c.dispatch(sub)
+	c.write()
+}
+
+// fail stops the connection, the writer sends a close frame with code unless it is 0
+func (c *wsConn) fail(code int, text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopLocked(code, text)
+}
+
+func (c *wsConn) stopLocked(code int, text string) {
+	c.stopOnce.Do(func() {
+		c.closeCode, c.closeText = code, text
+		close(c.stop)
+	})
+}
+
+// enqueueWait queues a message, waiting for room. The reader uses it, so a slow
+// client only slows down how fast its own requests are answered.
+func (c *wsConn) enqueueWait(msg wsServerMessage) bool {
+	select {
+	case c.send <- msg:
+		return true
+	case <-c.stop:
+		return false
+	}
+}
+
+func (c *wsConn) write() {
+	pingPeriod := time.Duration(c.h.cfg.WebSocketPingSeconds) * time.Second
+	ping := time.NewTicker(pingPeriod)
+	defer ping.Stop()
+	defer c.conn.Close()
+
+	for {
+		select {
+		case msg := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := c.conn.WriteJSON(msg); err != nil {
+				c.fail(0, "")
+				return
+			}
+		case <-ping.C:
+			deadline := time.Now().Add(wsWriteTimeout)
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				c.fail(0, "")
+				return
+			}
+		case <-c.stop:
+			c.mu.Lock()
+			code, text := c.closeCode, c.closeText
+			c.mu.Unlock()
+			if code == 0 {
+				return
+			}
+			deadline := time.Now().Add(wsWriteTimeout)
+			if err := c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), deadline); err != nil {
+				return
+			}
+			// wait for the client to answer, the reader returns on its close frame
+			select {
+			case <-c.readDone:
+			case <-time.After(wsCloseTimeout):
+			}
+			return
+		}
+	}
+}
+
+func (c *wsConn) read() {
+	defer close(c.readDone)
+
+	pongWait := 2 * time.Duration(c.h.cfg.WebSocketPingSeconds) * time.Second
+	c.conn.SetReadLimit(wsMaxMessageBytes)
+	_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		kind, data, err := c.conn.ReadMessage()
+		if err != nil {
+			// the default close handler has already answered a close frame
+			c.fail(0, "")
+			return
+		}
+		_ = c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		if kind != websocket.TextMessage {
+			c.fail(websocket.CloseUnsupportedData, "text messages only")
+			return
+		}
+
+		var msg wsClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.enqueueWait(wsServerMessage{Type: wsError, Code: codeInvalidJSON, Message: "invalid json"})
+			continue
+		}
+		switch msg.Type {
+		case wsSubscribe:
+			c.subscribe(msg)
+		case wsUnsubscribe:
+			c.unsubscribe(msg)
+		default:
+			c.enqueueWait(wsServerMessage{Type: wsError, ID: msg.ID, Code: codeInvalidMessage, Message: "unknown message type"})
+		}
+	}
+}
+
+func (c *wsConn) subscribe(msg wsClientMessage) {
+	filter, fields := parseWSChannel(msg)
+	if msg.ID == "" {
+		fields = append(fields, domain.FieldError{Field: "id", Code: "required", Message: "id is required"})
+	}
+	if msg.AfterEventID != nil && *msg.AfterEventID < 0 {
+		fields = append(fields, domain.FieldError{Field: "after_event_id", Code: "out_of_range", Message: "after_event_id must not be negative"})
+	}
+	if len(fields) > 0 {
+		c.enqueueWait(wsServerMessage{Type: wsError, ID: msg.ID, Code: codeValidation, Message: "invalid subscription", Errors: fields})
+		return
+	}
+
+	sub := &wsSubscription{id: msg.ID, filter: filter, replaying: true}
+	c.mu.Lock()
+	_, exists := c.subs[msg.ID]
+	full := len(c.subs) >= wsMaxSubscriptions
+	if !exists && !full {
+		c.subs[msg.ID] = sub
+	}
+	c.mu.Unlock()
+	switch {
+	case exists:
+		c.enqueueWait(wsServerMessage{Type: wsError, ID: msg.ID, Code: codeSubscriptionExists, Message: "subscription id is already used"})
+		return
+	case full:
+		c.enqueueWait(wsServerMessage{Type: wsError, ID: msg.ID, Code: codeTooManySubscriptions, Message: "too many subscriptions"})
+		return
+	}
+	if !c.enqueueWait(wsServerMessage{Type: wsSubscribed, ID: msg.ID}) {
+		return
+	}
+
+	var replayed int64
+	if msg.AfterEventID != nil {
+		var err error
+		replayed, err = c.h.replayEvents(context.Background(), *msg.AfterEventID, func(event domain.TaskEvent) error {
+			if sub.filter.match(event) && !c.sendEvent(sub, event, c.enqueueWait) {
+				return errWSStopped
+			}
+			return nil
+		}, func() error { return nil })
+		if errors.Is(err, errWSStopped) {
+			return
+		}
+		if err != nil {
+			log.Printf("replay task events (websocket %s): %v", c.requestID, err)
+			c.fail(websocket.CloseInternalServerErr, "event log is unavailable")
+			return
+		}
+	}
+
+	// hand the subscription over to the dispatcher once the events it held back are sent
+	for {
+		c.mu.Lock()
+		pending := sub.pending
+		sub.pending = nil
+		if len(pending) == 0 {
+			sub.replaying = false
+		}
+		c.mu.Unlock()
+		if len(pending) == 0 {
+			return
+		}
+		for _, event := range pending {
+			if event.ID > replayed && !c.sendEvent(sub, event, c.enqueueWait) {
+				return
+			}
+		}
+	}
+}
+
+func (c *wsConn) unsubscribe(msg wsClientMessage) {
+	c.mu.Lock()
+	_, ok := c.subs[msg.ID]
+	delete(c.subs, msg.ID)
+	c.mu.Unlock()
+	if !ok {
+		c.enqueueWait(wsServerMessage{Type: wsError, ID: msg.ID, Code: codeSubscriptionNotFound, Message: "no subscription with this id"})
+		return
+	}
+	c.enqueueWait(wsServerMessage{Type: wsUnsubscribed, ID: msg.ID})
+}
+
+// sendEvent numbers the event within the subscription and queues it
+func (c *wsConn) sendEvent(sub *wsSubscription, event domain.TaskEvent, enqueue func(wsServerMessage) bool) bool {
+	sub.seq++
+	return enqueue(wsServerMessage{Type: wsEvent, ID: sub.id, Seq: sub.seq, Event: &event})
+}
+
+func (c *wsConn) dispatch(sub *events.Subscription) {
+	for {
+		select {
+		case <-c.stop:
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				if sub.Dropped() {
+					c.fail(websocket.CloseTryAgainLater, "client is too slow")
+				} else {
+					c.fail(websocket.CloseGoingAway, "server is shutting down")
+				}
+				return
+			}
+			if !c.route(event) {
+				return
+			}
+		}
+	}
+}
+
+// route passes a live event to the matching subscriptions
+func (c *wsConn) route(event domain.TaskEvent) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, sub := range c.subs {
+		if !sub.filter.match(event) {
+			continue
+		}
+		if sub.replaying {
+			if len(sub.pending) >= cap(c.send) {
+				c.stopLocked(websocket.CloseTryAgainLater, "client is too slow")
+				return false
+			}
+			sub.pending = append(sub.pending, event)
+			continue
+		}
+		if !c.sendEvent(sub, event, c.enqueueLocked) {
+			return false
+		}
+	}
+	return true
+}
+
+// enqueueLocked queues a live event without blocking, the caller holds c.mu. A client
+// that does not read fast enough to keep the queue from filling up is disconnected
+// and resumes with after_event_id.
+func (c *wsConn) enqueueLocked(msg wsServerMessage) bool {
+	select {
+	case c.send <- msg:
+		return true
+	default:
+		c.stopLocked(websocket.CloseTryAgainLater, "client is too slow")
+		return false
+	}
+}
+
+// parseWSChannel turns the channel of a subscribe message into an event filter
+func parseWSChannel(msg wsClientMessage) (eventFilter, []domain.FieldError) {
+	var fields []domain.FieldError
+	var filter eventFilter
+	switch {
+	case msg.Channel == wsChannelTasks:
+		filter.status = domain.TaskStatus(strings.TrimSpace(msg.Status))
+		filter.project = strings.TrimPrefix(strings.TrimSpace(msg.Project), "+")
+		switch filter.status {
+		case "", domain.TaskStatusNew, domain.TaskStatusInProgress, domain.TaskStatusDone:
+		default:
+			fields = append(fields, domain.FieldError{Field: "status", Code: "invalid_enum", Message: "invalid status"})
+		}
+	case strings.HasPrefix(msg.Channel, wsChannelTaskPrefix):
+		id, err := uuid.Parse(strings.TrimPrefix(msg.Channel, wsChannelTaskPrefix))
+		if err != nil || id == uuid.Nil {
+			fields = append(fields, domain.FieldError{Field: "channel", Code: "invalid_uuid", Message: "invalid task id in channel"})
+		}
+		filter.taskID = id
+	default:
+		fields = append(fields, domain.FieldError{
+			Field:   "channel",
+			Code:    "invalid_channel",
+			Message: fmt.Sprintf("channel must be %q or %q followed by a task id", wsChannelTasks, wsChannelTaskPrefix),
+		})
+	}
+	return filter, fields
+}
@@ -1,8 +1,12 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"net/netip"
 	"os"
 	"strconv"
+	"strings"
 
 	pc "github.com/nightmaker00/go-tasks-api/pkg/db/postgres"
 )
@@ -17,6 +21,43 @@ type Config struct {
 			IdleSeconds  int
 		}
 	}
+	GRPC struct {
+		Enabled    bool
+		Port       string
+		Reflection bool
+		// AllowUnauthenticated lets gRPC listen beyond loopback while auth is off
+		AllowUnauthenticated bool
+	}
+	API         API
+	CORS        CORS
+	Validation  Validation
+	Auth        Auth
+	Compression Compression
+	Idempotency struct {
+		TTLSeconds   int
+		LeaseSeconds int
+	}
+	Events struct {
+		RetentionHours int
+		BufferSize     int
+	}
+	Outbox struct {
+		PollMilliseconds int
+		BatchSize        int
+		File             string
+	}
+	Webhooks struct {
+		Enabled           bool
+		Workers           int
+		MaxAttempts       int
+		DisableAfter      int
+		TimeoutSeconds    int
+		PollSeconds       int
+		BackoffSeconds    int
+		MaxBackoffSeconds int
+		// AllowedNetworks are internal networks (CIDR or address) webhooks may still be sent to
+		AllowedNetworks []string
+	}
 	pc.Config
 }
 
@@ -29,6 +70,47 @@ func Load() (*Config, error) {
 	cfg.Server.Timeouts.ReadSeconds = 5
 	cfg.Server.Timeouts.WriteSeconds = 10
 	cfg.Server.Timeouts.IdleSeconds = 60
+	cfg.GRPC.Enabled = false
+	cfg.GRPC.Port = "9090"
+	cfg.GRPC.Reflection = false
+
+	cfg.CORS.AllowedOrigins = []string{"*"}
+	cfg.CORS.AllowedMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+	cfg.CORS.AllowedHeaders = []string{"Content-Type", "Authorization", "Idempotency-Key", "X-Request-ID", "X-API-Key", "Last-Event-ID", "If-Match", "If-None-Match", "If-Modified-Since"}
+	cfg.CORS.ExposedHeaders = []string{"ETag", "Location", "X-Request-ID"}
+	cfg.CORS.MaxAgeSeconds = 600
+
+	cfg.Idempotency.TTLSeconds = 86400
+	cfg.Idempotency.LeaseSeconds = 60
+	cfg.Compression.Enabled = true
+	cfg.Compression.MinBytes = 1024
+	cfg.API.UpsertOnPut = false
+	cfg.API.MaxBatchSize = 500
+	cfg.API.MaxBodyBytes = 1 << 20
+	cfg.API.MaxImportBytes = 10 << 20
+	cfg.API.EventsHeartbeatSeconds = 15
+	cfg.API.WebSocketPingSeconds = 30
+	cfg.API.WebSocketBuffer = 256
+	cfg.API.GraphQL = true
+	cfg.API.GraphQLMaxDepth = 8
+	cfg.API.GraphQLMaxComplexity = 10000
+	cfg.Events.RetentionHours = 168
+	cfg.Events.BufferSize = 256
+	cfg.Outbox.PollMilliseconds = 1000
+	cfg.Outbox.BatchSize = 500
+	cfg.Webhooks.Enabled = true
+	cfg.Webhooks.Workers = 4
+	cfg.Webhooks.MaxAttempts = 8
+	cfg.Webhooks.DisableAfter = 20
+	cfg.Webhooks.TimeoutSeconds = 10
+	cfg.Webhooks.PollSeconds = 5
+	cfg.Webhooks.BackoffSeconds = 30
+	cfg.Webhooks.MaxBackoffSeconds = 3600
+	cfg.Validation.Requests = true
+	cfg.Validation.Responses = false
+	cfg.Auth.Required = false
+	cfg.Auth.PublicPaths = []string{"/swagger/", "/openapi.json", "/openapi.yaml"}
+	cfg.Auth.QueryTokenPaths = []string{"/tasks.ics", "/caldav/", "/tasks/events", "/ws", "/graphql"}
 
 	cfg.Config.Host = "localhost"
 	cfg.Config.Port = "5432"
@@ -54,6 +136,142 @@ func Load() (*Config, error) {
 	if seconds, ok := getEnvInt("SERVER_IDLE_TIMEOUT_SECONDS"); ok {
 		cfg.Server.Timeouts.IdleSeconds = seconds
 	}
+	if enabled, ok := getEnvBool("GRPC_ENABLED"); ok {
+		cfg.GRPC.Enabled = enabled
+	}
+	if port := os.Getenv("GRPC_PORT"); port != "" {
+		cfg.GRPC.Port = port
+	}
+	if reflection, ok := getEnvBool("GRPC_REFLECTION"); ok {
+		cfg.GRPC.Reflection = reflection
+	}
+	if allow, ok := getEnvBool("GRPC_ALLOW_UNAUTHENTICATED"); ok {
+		cfg.GRPC.AllowUnauthenticated = allow
+	}
+
+	if origins, ok := getEnvList("CORS_ALLOWED_ORIGINS"); ok {
+		cfg.CORS.AllowedOrigins = origins
+	}
+	if methods, ok := getEnvList("CORS_ALLOWED_METHODS"); ok {
+		cfg.CORS.AllowedMethods = methods
+	}
+	if headers, ok := getEnvList("CORS_ALLOWED_HEADERS"); ok {
+		cfg.CORS.AllowedHeaders = headers
+	}
+	if headers, ok := getEnvList("CORS_EXPOSED_HEADERS"); ok {
+		cfg.CORS.ExposedHeaders = headers
+	}
+	if seconds, ok := getEnvInt("CORS_MAX_AGE_SECONDS"); ok {
+		cfg.CORS.MaxAgeSeconds = seconds
+	}
+	if allow, ok := getEnvBool("CORS_ALLOW_CREDENTIALS"); ok {
+		cfg.CORS.AllowCredentials = allow
+	}
+
+	if upsert, ok := getEnvBool("TASKS_UPSERT_ON_PUT"); ok {
+		cfg.API.UpsertOnPut = upsert
+	}
+	if size, ok := getEnvInt("TASKS_BATCH_MAX_SIZE"); ok {
+		cfg.API.MaxBatchSize = size
+	}
+	if size, ok := getEnvInt("HTTP_MAX_BODY_BYTES"); ok {
+		cfg.API.MaxBodyBytes = int64(size)
+	}
+	if enabled, ok := getEnvBool("CALDAV_ENABLED"); ok {
+		cfg.API.CalDAV = enabled
+	}
+	if size, ok := getEnvInt("TASKS_IMPORT_MAX_BYTES"); ok {
+		cfg.API.MaxImportBytes = int64(size)
+	}
+	if seconds, ok := getEnvInt("EVENTS_HEARTBEAT_SECONDS"); ok {
+		cfg.API.EventsHeartbeatSeconds = seconds
+	}
+	if seconds, ok := getEnvInt("WS_PING_SECONDS"); ok {
+		cfg.API.WebSocketPingSeconds = seconds
+	}
+	if size, ok := getEnvInt("WS_BUFFER_SIZE"); ok {
+		cfg.API.WebSocketBuffer = size
+	}
+	if enabled, ok := getEnvBool("GRAPHQL_ENABLED"); ok {
+		cfg.API.GraphQL = enabled
+	}
+	if depth, ok := getEnvInt("GRAPHQL_MAX_DEPTH"); ok {
+		cfg.API.GraphQLMaxDepth = depth
+	}
+	if complexity, ok := getEnvInt("GRAPHQL_MAX_COMPLEXITY"); ok {
+		cfg.API.GraphQLMaxComplexity = complexity
+	}
+	if hours, ok := getEnvInt("EVENTS_RETENTION_HOURS"); ok {
+		cfg.Events.RetentionHours = hours
+	}
+	if size, ok := getEnvInt("EVENTS_BUFFER_SIZE"); ok {
+		cfg.Events.BufferSize = size
+	}
+	if ms, ok := getEnvInt("OUTBOX_POLL_MILLISECONDS"); ok {
+		cfg.Outbox.PollMilliseconds = ms
+	}
+	if size, ok := getEnvInt("OUTBOX_BATCH_SIZE"); ok {
+		cfg.Outbox.BatchSize = size
+	}
+	if path := os.Getenv("OUTBOX_FILE"); path != "" {
+		cfg.Outbox.File = path
+	}
+	if enabled, ok := getEnvBool("WEBHOOKS_ENABLED"); ok {
+		cfg.Webhooks.Enabled = enabled
+	}
+	if workers, ok := getEnvInt("WEBHOOK_WORKERS"); ok {
+		cfg.Webhooks.Workers = workers
+	}
+	if attempts, ok := getEnvInt("WEBHOOK_MAX_ATTEMPTS"); ok {
+		cfg.Webhooks.MaxAttempts = attempts
+	}
+	if failures, ok := getEnvInt("WEBHOOK_DISABLE_AFTER_FAILURES"); ok {
+		cfg.Webhooks.DisableAfter = failures
+	}
+	if seconds, ok := getEnvInt("WEBHOOK_TIMEOUT_SECONDS"); ok {
+		cfg.Webhooks.TimeoutSeconds = seconds
+	}
+	if seconds, ok := getEnvInt("WEBHOOK_POLL_SECONDS"); ok {
+		cfg.Webhooks.PollSeconds = seconds
+	}
+	if seconds, ok := getEnvInt("WEBHOOK_BACKOFF_SECONDS"); ok {
+		cfg.Webhooks.BackoffSeconds = seconds
+	}
+	if seconds, ok := getEnvInt("WEBHOOK_MAX_BACKOFF_SECONDS"); ok {
+		cfg.Webhooks.MaxBackoffSeconds = seconds
+	}
+	if networks, ok := getEnvList("WEBHOOK_ALLOWED_NETWORKS"); ok {
+		cfg.Webhooks.AllowedNetworks = networks
+	}
+	if enabled, ok := getEnvBool("VALIDATE_REQUESTS"); ok {
+		cfg.Validation.Requests = enabled
+	}
+	if enabled, ok := getEnvBool("VALIDATE_RESPONSES"); ok {
+		cfg.Validation.Responses = enabled
+	}
+	// browsers do not apply CORS to WebSocket, the handshake checks the same origins itself
+	cfg.API.WebSocketOrigins = cfg.CORS.AllowedOrigins
+	if enabled, ok := getEnvBool("COMPRESSION_ENABLED"); ok {
+		cfg.Compression.Enabled = enabled
+	}
+	if size, ok := getEnvInt("COMPRESSION_MIN_BYTES"); ok {
+		cfg.Compression.MinBytes = size
+	}
+	if seconds, ok := getEnvInt("IDEMPOTENCY_TTL_SECONDS"); ok {
+		cfg.Idempotency.TTLSeconds = seconds
+	}
+	if seconds, ok := getEnvInt("IDEMPOTENCY_LEASE_SECONDS"); ok {
+		cfg.Idempotency.LeaseSeconds = seconds
+	}
+	if required, ok := getEnvBool("AUTH_REQUIRED"); ok {
+		cfg.Auth.Required = required
+	}
+	if paths, ok := getEnvList("AUTH_PUBLIC_PATHS"); ok {
+		cfg.Auth.PublicPaths = paths
+	}
+	if paths, ok := getEnvList("AUTH_QUERY_TOKEN_PATHS"); ok {
+		cfg.Auth.QueryTokenPaths = paths
+	}
 
 	if host := os.Getenv("POSTGRES_HOST"); host != "" {
 		cfg.Config.Host = host
@@ -77,6 +295,85 @@ func Load() (*Config, error) {
 	return cfg, nil
 }
 
+// Validate checks values that config.Load cannot fix up itself, e.g. after flags overrode them
+func (c *Config) Validate() error {
+	var errs []error
+	if _, err := strconv.ParseUint(c.Server.Port, 10, 16); err != nil {
+		errs = append(errs, fmt.Errorf("server port %q is not a valid port", c.Server.Port))
+	}
+	if c.GRPC.Enabled {
+		if _, err := strconv.ParseUint(c.GRPC.Port, 10, 16); err != nil {
+			errs = append(errs, fmt.Errorf("grpc port %q is not a valid port", c.GRPC.Port))
+		} else if c.GRPC.Port == c.Server.Port {
+			errs = append(errs, fmt.Errorf("grpc port %s is already the server port", c.GRPC.Port))
+		}
+		// with auth off anyone who reaches the port can read and change every task
+		if !c.Auth.Required && !c.GRPC.AllowUnauthenticated && !isLoopback(c.Server.Address) {
+			errs = append(errs, fmt.Errorf("grpc on %q without auth: set AUTH_REQUIRED=true, listen on loopback or set GRPC_ALLOW_UNAUTHENTICATED=true", c.Server.Address))
+		}
+	}
+	if _, err := strconv.ParseUint(c.Config.Port, 10, 16); err != nil {
+		errs = append(errs, fmt.Errorf("postgres port %q is not a valid port", c.Config.Port))
+	}
+	if c.Config.Host == "" || c.Config.User == "" || c.Config.DBName == "" {
+		errs = append(errs, errors.New("postgres host, user and database are required"))
+	}
+	switch c.Config.SSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		errs = append(errs, fmt.Errorf("postgres sslmode %q is not supported", c.Config.SSLMode))
+	}
+	if c.CORS.AllowCredentials {
+		for _, origin := range c.CORS.AllowedOrigins {
+			if origin == "*" {
+				errs = append(errs, errors.New("cors allowed origins must list origins explicitly when credentials are allowed, * would let any site send them"))
+				break
+			}
+		}
+	}
+	if c.Server.Timeouts.ReadSeconds == 0 || c.Server.Timeouts.WriteSeconds == 0 {
+		errs = append(errs, errors.New("server read and write timeouts must be positive"))
+	}
+	if c.Idempotency.TTLSeconds == 0 || c.Idempotency.LeaseSeconds == 0 {
+		errs = append(errs, errors.New("idempotency ttl and lease must be positive"))
+	}
+	if c.API.MaxBatchSize == 0 {
+		errs = append(errs, errors.New("batch max size must be positive"))
+	}
+	if c.API.MaxBodyBytes <= 0 {
+		errs = append(errs, errors.New("max body bytes must be positive"))
+	}
+	if c.API.EventsHeartbeatSeconds == 0 || c.Events.BufferSize == 0 {
+		errs = append(errs, errors.New("events heartbeat and buffer size must be positive"))
+	}
+	if c.API.WebSocketPingSeconds == 0 || c.API.WebSocketBuffer == 0 {
+		errs = append(errs, errors.New("websocket ping interval and buffer size must be positive"))
+	}
+	if c.API.GraphQLMaxDepth < 0 || c.API.GraphQLMaxComplexity < 0 {
+		errs = append(errs, errors.New("graphql depth and complexity limits must not be negative"))
+	}
+	if c.Outbox.PollMilliseconds == 0 || c.Outbox.BatchSize == 0 {
+		errs = append(errs, errors.New("outbox poll interval and batch size must be positive"))
+	}
+	if c.Webhooks.Enabled {
+		w := c.Webhooks
+		if w.Workers == 0 || w.MaxAttempts == 0 || w.DisableAfter == 0 || w.TimeoutSeconds == 0 || w.PollSeconds == 0 {
+			errs = append(errs, errors.New("webhook workers, attempts, failures, timeout and poll interval must be positive"))
+		}
+		if w.BackoffSeconds == 0 || w.MaxBackoffSeconds < w.BackoffSeconds {
+			errs = append(errs, errors.New("webhook backoff must be positive and not above the max backoff"))
+		}
+	}
+	for _, network := range c.Webhooks.AllowedNetworks {
+		if _, err := netip.ParsePrefix(network); err != nil {
+			if _, err := netip.ParseAddr(network); err != nil {
+				errs = append(errs, fmt.Errorf("webhook allowed network %q must be a CIDR prefix or an address", network))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func getEnvInt(key string) (int, bool) {
 	raw := os.Getenv(key)
 	if raw == "" {
@@ -91,3 +388,42 @@ func getEnvInt(key string) (int, bool) {
 	}
 	return value, true
 }
+
+func getEnvBool(key string) (bool, bool) {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return false, false
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, false
+	}
+	return value, true
+}
+
+// getEnvList reads a comma separated list, "-" means an explicitly empty list
+func getEnvList(key string) ([]string, bool) {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return nil, false
+	}
+	if raw == "-" {
+		return []string{}, true
+	}
+	values := make([]string, 0)
+	for _, part := range strings.Split(raw, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values, true
+}
+
+// isLoopback reports whether a listen address only accepts local connections
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	addr, err := netip.ParseAddr(strings.Trim(host, "[]"))
+	return err == nil && addr.IsLoopback()
+}
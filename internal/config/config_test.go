@@ -0,0 +1,140 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(cfg *Config)
+		wantErr string
+	}{
+		{
+			name:   "defaults",
+			modify: func(cfg *Config) {},
+		},
+		{
+			name: "credentials with any origin",
+			modify: func(cfg *Config) {
+				cfg.CORS.AllowCredentials = true
+			},
+			wantErr: "cors allowed origins must list origins explicitly",
+		},
+		{
+			name: "credentials with wildcard among listed origins",
+			modify: func(cfg *Config) {
+				cfg.CORS.AllowedOrigins = []string{"https://app.example.com", "*"}
+				cfg.CORS.AllowCredentials = true
+			},
+			wantErr: "cors allowed origins must list origins explicitly",
+		},
+		{
+			name: "credentials with listed origins",
+			modify: func(cfg *Config) {
+				cfg.CORS.AllowedOrigins = []string{"https://app.example.com", "https://*.example.org"}
+				cfg.CORS.AllowCredentials = true
+			},
+		},
+		{
+			name: "invalid server port",
+			modify: func(cfg *Config) {
+				cfg.Server.Port = "http"
+			},
+			wantErr: `server port "http" is not a valid port`,
+		},
+		{
+			name: "grpc without auth on all interfaces",
+			modify: func(cfg *Config) {
+				cfg.GRPC.Enabled = true
+			},
+			wantErr: `grpc on "0.0.0.0" without auth`,
+		},
+		{
+			name: "grpc without auth on loopback",
+			modify: func(cfg *Config) {
+				cfg.GRPC.Enabled = true
+				cfg.Server.Address = "127.0.0.1"
+			},
+		},
+		{
+			name: "grpc without auth on ipv6 loopback",
+			modify: func(cfg *Config) {
+				cfg.GRPC.Enabled = true
+				cfg.Server.Address = "::1"
+			},
+		},
+		{
+			name: "grpc with auth",
+			modify: func(cfg *Config) {
+				cfg.GRPC.Enabled = true
+				cfg.Auth.Required = true
+			},
+		},
+		{
+			name: "grpc without auth allowed explicitly",
+			modify: func(cfg *Config) {
+				cfg.GRPC.Enabled = true
+				cfg.GRPC.AllowUnauthenticated = true
+			},
+		},
+		{
+			name: "webhook allowed networks",
+			modify: func(cfg *Config) {
+				cfg.Webhooks.AllowedNetworks = []string{"10.20.0.0/16", "127.0.0.1", "fd00::/8"}
+			},
+		},
+		{
+			name: "invalid webhook allowed network",
+			modify: func(cfg *Config) {
+				cfg.Webhooks.AllowedNetworks = []string{"10.20.0.0/33"}
+			},
+			wantErr: `webhook allowed network "10.20.0.0/33" must be a CIDR prefix or an address`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load()
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			tt.modify(cfg)
+
+			err = cfg.Validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("Validate: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("Validate = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadCORSFromEnv(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com, https://admin.example.com")
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	t.Setenv("CORS_EXPOSED_HEADERS", "-")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := strings.Join(cfg.CORS.AllowedOrigins, ","); got != "https://app.example.com,https://admin.example.com" {
+		t.Errorf("AllowedOrigins = %q", got)
+	}
+	if !cfg.CORS.AllowCredentials {
+		t.Error("AllowCredentials = false")
+	}
+	if len(cfg.CORS.ExposedHeaders) != 0 {
+		t.Errorf("ExposedHeaders = %q, want none", cfg.CORS.ExposedHeaders)
+	}
+	if got := strings.Join(cfg.API.WebSocketOrigins, ","); got != "https://app.example.com,https://admin.example.com" {
+		t.Errorf("WebSocketOrigins = %q", got)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
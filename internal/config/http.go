@@ -0,0 +1,63 @@
+package config
+
+// API toggles optional API behaviour
+type API struct {
+	// UpsertOnPut lets PUT /tasks/{id} create a missing task with that id
+	UpsertOnPut bool
+	// MaxBatchSize limits the number of operations in POST /tasks:batch
+	MaxBatchSize int
+	// MaxBodyBytes limits the size of JSON request bodies
+	MaxBodyBytes int64
+	// MaxImportBytes limits the size of files sent to POST /tasks/import
+	MaxImportBytes int64
+	// CalDAV serves the tasks as a read-only CalDAV calendar under /caldav/
+	CalDAV bool
+	// EventsHeartbeatSeconds is how often an idle event stream sends a keepalive comment
+	EventsHeartbeatSeconds int
+	// WebSocketPingSeconds is how often /ws pings clients, one that misses two pongs is dropped
+	WebSocketPingSeconds int
+	// WebSocketBuffer is how many messages may wait for a slow /ws client before it is dropped
+	WebSocketBuffer int
+	// WebSocketOrigins are the browser origins allowed to open /ws and /graphql, matched like CORS origins
+	WebSocketOrigins []string
+	// GraphQL serves the tasks at /graphql
+	GraphQL bool
+	// GraphQLMaxDepth and GraphQLMaxComplexity reject GraphQL operations that nest fields
+	// deeper or may resolve more fields, 0 turns a limit off
+	GraphQLMaxDepth      int
+	GraphQLMaxComplexity int
+}
+
+// CORS describes which browser origins may call the API. "*" allows any origin but is
+// rejected together with AllowCredentials, credentials are only sent to listed origins.
+type CORS struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	MaxAgeSeconds    int
+	AllowCredentials bool
+}
+
+// Validation controls checking of traffic against the API spec
+type Validation struct {
+	Requests  bool
+	Responses bool
+}
+
+type Auth struct {
+	Required bool
+	// PublicPaths are served without a key, a trailing slash matches the whole subtree
+	PublicPaths []string
+	// QueryTokenPaths also accept the key in the token query parameter or as the
+	// Basic auth password, for calendar clients that cannot send other headers.
+	// Matched like PublicPaths.
+	QueryTokenPaths []string
+}
+
+// Compression controls compression of response bodies
+type Compression struct {
+	Enabled bool
+	// MinBytes is the smallest body that is compressed, shorter ones are not worth it
+	MinBytes int
+}
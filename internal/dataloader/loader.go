@@ -0,0 +1,90 @@
+// Package dataloader batches lookups by key. Callers queue keys with Load and get a
+// thunk back; the first thunk that is called fetches every key queued so far with one
+// call of the batch function. A loader caches its results and lives for one request.
+package dataloader
+
+import (
+	"context"
+	"sync"
+)
+
+// BatchFunc fetches the values of keys. A key missing from the result has the zero value.
+type BatchFunc[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+type Loader[K comparable, V any] struct {
+	fetch    BatchFunc[K, V]
+	maxBatch int
+
+	mu      sync.Mutex
+	results map[K]*result[V]
+	pending []K
+}
+
+type result[V any] struct {
+	value V
+	err   error
+	done  bool
+}
+
+// New creates a loader that passes at most maxBatch keys to fetch at once, 0 means no limit
+func New[K comparable, V any](fetch BatchFunc[K, V], maxBatch int) *Loader[K, V] {
+	return &Loader[K, V]{fetch: fetch, maxBatch: maxBatch, results: make(map[K]*result[V])}
+}
+
+// Load queues key and returns a thunk that yields its value
+func (l *Loader[K, V]) Load(ctx context.Context, key K) func() (V, error) {
+	l.mu.Lock()
+	if _, ok := l.results[key]; !ok {
+		l.results[key] = &result[V]{}
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (V, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		res := l.results[key]
+		if !res.done {
+			l.flushLocked(ctx)
+		}
+		return res.value, res.err
+	}
+}
+
+// Prime stores a value that is already known, e.g. returned by a mutation
+func (l *Loader[K, V]) Prime(key K, value V) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if res, ok := l.results[key]; ok && !res.done {
+		// the queued key is answered by the next flush, this value is at least as recent
+		res.value, res.done = value, true
+		return
+	}
+	l.results[key] = &result[V]{value: value, done: true}
+}
+
+// flushLocked fetches the pending keys, the caller holds l.mu
+func (l *Loader[K, V]) flushLocked(ctx context.Context) {
+	pending := make([]K, 0, len(l.pending))
+	for _, key := range l.pending {
+		if !l.results[key].done {
+			pending = append(pending, key)
+		}
+	}
+	l.pending = nil
+
+	for len(pending) > 0 {
+		size := len(pending)
+		if l.maxBatch > 0 {
+			size = min(size, l.maxBatch)
+		}
+		batch := pending[:size]
+		pending = pending[size:]
+
+		values, err := l.fetch(ctx, batch)
+		for _, key := range batch {
+			res := l.results[key]
+			res.value, res.err, res.done = values[key], err, true
+		}
+	}
+}
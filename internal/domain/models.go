@@ -15,47 +15,291 @@ const (
 )
 
 // Task представляет задачу
-// @Description Задача с UUID, заголовком, описанием, статусом и временными метками
 type Task struct {
-	ID          uuid.UUID  `json:"id"`
-	Title       string     `json:"title"`
+	ID          uuid.UUID  `json:"id" format:"uuid" validate:"required"`
+	Title       string     `json:"title" validate:"required"`
 	Description string     `json:"description,omitempty"`
-	Status      TaskStatus `json:"status"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
+	Status      TaskStatus `json:"status" validate:"required"`
+	CreatedAt   time.Time  `json:"created_at" format:"date-time" validate:"required"`
+	UpdatedAt   time.Time  `json:"updated_at" format:"date-time" validate:"required"`
 }
 
 // TaskListItem представляет краткую информацию о задаче в списке
-// @Description Краткая информация о задаче для списка
 type TaskListItem struct {
-	ID     uuid.UUID  `json:"id"`
-	Title  string     `json:"title"`
-	Status TaskStatus `json:"status"`
+	ID     uuid.UUID  `json:"id" format:"uuid" validate:"required"`
+	Title  string     `json:"title" validate:"required"`
+	Status TaskStatus `json:"status" validate:"required"`
+}
+
+// TaskListVersion версия задач под фильтром списка, меняется при любом их изменении
+type TaskListVersion struct {
+	Count        int
+	LastModified time.Time
 }
 
 // CreateTaskRequest запрос на создание задачи
-// @Description Данные для создания новой задачи
 type CreateTaskRequest struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
+	ID          *uuid.UUID `json:"id,omitempty" format:"uuid"`
+	Title       string     `json:"title" validate:"required,min=1"`
+	Description string     `json:"description"`
 }
 
 // UpdateTaskRequest запрос на обновление задачи
-// @Description Данные для обновления задачи
 type UpdateTaskRequest struct {
-	Title       string  `json:"title"`
+	Title       string  `json:"title" validate:"required,min=1"`
 	Description *string `json:"description"`
-	Status      string  `json:"status"`
+	Status      string  `json:"status" validate:"required" enums:"new,in_progress,done"`
 }
 
 // CreateTaskResponse ответ при создании задачи
-// @Description UUID созданной задачи
 type CreateTaskResponse struct {
-	ID uuid.UUID `json:"id"`
+	ID uuid.UUID `json:"id" format:"uuid" validate:"required"`
 }
 
 // UpdateTaskResponse ответ при обновлении задачи
-// @Description Статус операции обновления
 type UpdateTaskResponse struct {
-	Status string `json:"status"`
+	Status string `json:"status" validate:"required"`
+}
+
+// IdempotencyRecord сохранённый результат запроса с Idempotency-Key
+type IdempotencyRecord struct {
+	// APIKeyID ключ API, с которым пришёл запрос, пустой без аутентификации
+	APIKeyID    string
+	Key         string
+	Scope       string
+	Fingerprint string
+	// LockID запрос, который выполняет ещё не завершённую запись
+	LockID      uuid.UUID
+	Completed   bool
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// APIKey ключ доступа к API, хранится только хэш
+type APIKey struct {
+	ID        uuid.UUID
+	Name      string
+	Prefix    string
+	CreatedAt time.Time
+}
+
+type BatchOperationType string
+
+const (
+	BatchOperationCreate BatchOperationType = "create"
+	BatchOperationUpdate BatchOperationType = "update"
+	BatchOperationDelete BatchOperationType = "delete"
+)
+
+type BatchMode string
+
+const (
+	BatchModeAtomic     BatchMode = "atomic"
+	BatchModeBestEffort BatchMode = "best_effort"
+)
+
+// BatchOperation одна операция пакетного запроса
+type BatchOperation struct {
+	Op          BatchOperationType `json:"op" validate:"required" enums:"create,update,delete"`
+	ID          *uuid.UUID         `json:"id,omitempty" format:"uuid"`
+	Title       string             `json:"title,omitempty"`
+	Description *string            `json:"description,omitempty"`
+	Status      string             `json:"status,omitempty" enums:"new,in_progress,done"`
+}
+
+// BatchRequest пакетный запрос
+type BatchRequest struct {
+	Mode       BatchMode        `json:"mode,omitempty" enums:"atomic,best_effort"`
+	Operations []BatchOperation `json:"operations" validate:"required,min=1"`
+}
+
+// BatchItemResult результат одной операции пакета
+type BatchItemResult struct {
+	Index  int                `json:"index" validate:"required"`
+	Op     BatchOperationType `json:"op" validate:"required"`
+	ID     *uuid.UUID         `json:"id,omitempty" format:"uuid"`
+	Status int                `json:"status" validate:"required"`
+	Code   string             `json:"code,omitempty"`
+	Error  string             `json:"error,omitempty"`
+	Errors []FieldError       `json:"errors,omitempty"`
+}
+
+// BatchResponse ответ на пакетный запрос
+type BatchResponse struct {
+	Results []BatchItemResult `json:"results"`
+}
+
+// BatchOutcome результат операции пакета на уровне сервиса
+type BatchOutcome struct {
+	ID  uuid.UUID
+	Err error
+}
+
+type ImportRowResult string
+
+const (
+	ImportRowCreated ImportRowResult = "created"
+	ImportRowSkipped ImportRowResult = "skipped"
+	ImportRowFailed  ImportRowResult = "failed"
+)
+
+// ImportRecord строка импорта до валидации, поля как в файле
+type ImportRecord struct {
+	Row         int
+	ID          string
+	Title       string
+	Description string
+	Status      string
+	CreatedAt   string
+	UpdatedAt   string
+	// ParseErrors заполняет разбор файла, такая строка сразу считается ошибочной
+	ParseErrors []FieldError
+}
+
+// ImportRowReport результат импорта строки
+type ImportRowReport struct {
+	Row    int             `json:"row" validate:"required"`
+	ID     *uuid.UUID      `json:"id,omitempty" format:"uuid"`
+	Result ImportRowResult `json:"result" validate:"required" enums:"skipped,failed"`
+	Reason string          `json:"reason,omitempty"`
+	Errors []FieldError    `json:"errors,omitempty"`
+}
+
+// ImportReport отчёт об импорте
+type ImportReport struct {
+	DryRun  bool              `json:"dry_run"`
+	Total   int               `json:"total"`
+	Created int               `json:"created"`
+	Skipped int               `json:"skipped"`
+	Failed  int               `json:"failed"`
+	Rows    []ImportRowReport `json:"rows"`
+}
+
+type TaskEventType string
+
+const (
+	TaskEventCreated TaskEventType = "task.created"
+	TaskEventUpdated TaskEventType = "task.updated"
+	TaskEventDeleted TaskEventType = "task.deleted"
+)
+
+// TaskEvent изменение задачи из журнала событий
+type TaskEvent struct {
+	ID         int64         `json:"id" validate:"required"`
+	Type       TaskEventType `json:"type" validate:"required"`
+	TaskID     uuid.UUID     `json:"task_id" format:"uuid" validate:"required"`
+	Seq        int64         `json:"seq" validate:"required"`
+	Task       Task          `json:"task" validate:"required"`
+	OccurredAt time.Time     `json:"occurred_at" format:"date-time" validate:"required"`
+}
+
+// TaskChanges изменения задач после токена
+type TaskChanges struct {
+	Upserted  []Task          `json:"upserted" validate:"required"`
+	Deleted   []TaskTombstone `json:"deleted" validate:"required"`
+	NextToken string          `json:"next_token" validate:"required"`
+	HasMore   bool            `json:"has_more"`
+}
+
+// TaskTombstone удалённая задача
+type TaskTombstone struct {
+	ID        uuid.UUID `json:"id" format:"uuid" validate:"required"`
+	DeletedAt time.Time `json:"deleted_at" format:"date-time" validate:"required"`
+}
+
+type StatsInterval string
+
+const (
+	StatsIntervalDay  StatsInterval = "day"
+	StatsIntervalWeek StatsInterval = "week"
+)
+
+// TaskStats статистика задач
+type TaskStats struct {
+	Total    int                `json:"total"`
+	ByStatus map[TaskStatus]int `json:"by_status" validate:"required"`
+	Interval StatsInterval      `json:"interval" validate:"required"`
+	From     string             `json:"from" format:"date" validate:"required"`
+	To       string             `json:"to" format:"date" validate:"required"`
+	Timeline []TaskStatsBucket  `json:"timeline" validate:"required"`
+}
+
+// TaskStatsBucket задачи, созданные и завершённые за день или неделю
+type TaskStatsBucket struct {
+	Start     string `json:"start" format:"date" validate:"required"`
+	Created   int    `json:"created"`
+	Completed int    `json:"completed"`
+}
+
+// Webhook подписка внешней системы на события задач
+type Webhook struct {
+	ID                  uuid.UUID       `json:"id" format:"uuid" validate:"required"`
+	URL                 string          `json:"url" validate:"required"`
+	EventTypes          []TaskEventType `json:"event_types" validate:"required"`
+	Status              TaskStatus      `json:"status,omitempty"`
+	Project             string          `json:"project,omitempty"`
+	Secret              string          `json:"secret,omitempty"`
+	Active              bool            `json:"active"`
+	ConsecutiveFailures int             `json:"consecutive_failures"`
+	DisabledAt          *time.Time      `json:"disabled_at,omitempty" format:"date-time"`
+	CreatedAt           time.Time       `json:"created_at" format:"date-time" validate:"required"`
+	UpdatedAt           time.Time       `json:"updated_at" format:"date-time" validate:"required"`
+}
+
+// WebhookRequest запрос на создание или замену подписки
+type WebhookRequest struct {
+	URL        string          `json:"url" validate:"required,min=1"`
+	EventTypes []TaskEventType `json:"event_types"`
+	Status     string          `json:"status,omitempty" enums:"new,in_progress,done"`
+	Project    string          `json:"project,omitempty"`
+	Secret     *string         `json:"secret,omitempty"`
+	Active     *bool           `json:"active,omitempty"`
+}
+
+type WebhookDeliveryState string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryState = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryState = "succeeded"
+	WebhookDeliveryFailed    WebhookDeliveryState = "failed"
+)
+
+// WebhookDelivery отправка события на адрес подписки
+type WebhookDelivery struct {
+	ID             uuid.UUID            `json:"id" format:"uuid" validate:"required"`
+	WebhookID      uuid.UUID            `json:"webhook_id" format:"uuid" validate:"required"`
+	EventID        int64                `json:"event_id" validate:"required"`
+	EventType      TaskEventType        `json:"event_type" validate:"required"`
+	State          WebhookDeliveryState `json:"state" validate:"required"`
+	Attempts       int                  `json:"attempts"`
+	NextAttemptAt  *time.Time           `json:"next_attempt_at,omitempty" format:"date-time"`
+	LastAttemptAt  *time.Time           `json:"last_attempt_at,omitempty" format:"date-time"`
+	ResponseStatus *int                 `json:"response_status,omitempty"`
+	LastError      string               `json:"last_error,omitempty"`
+	RedeliveryOf   *uuid.UUID           `json:"redelivery_of,omitempty" format:"uuid"`
+	CreatedAt      time.Time            `json:"created_at" format:"date-time" validate:"required"`
+	// Payload тело запроса, повторная отправка шлёт его без изменений
+	Payload []byte `json:"-"`
+}
+
+// FieldError ошибка валидации отдельного поля
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Problem описание ошибки в формате RFC 9457 (application/problem+json)
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	Error     string       `json:"error"`
 }
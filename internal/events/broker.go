@@ -0,0 +1,109 @@
+// Package events fans task events out to the subscribers of this process.
+package events
+
+import (
+	"sync"
+
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+// Broker delivers published events to every subscription. Publishing never blocks:
+// a subscriber whose buffer is full is dropped and its channel closed, it is expected
+// to reconnect and catch up from the event log.
+type Broker struct {
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	buffer int
+	closed bool
+}
+
+// NewBroker creates a broker whose subscriptions buffer up to buffer events
+func NewBroker(buffer int) *Broker {
+	if buffer <= 0 {
+		buffer = 1
+	}
+	return &Broker{subs: make(map[*Subscription]struct{}), buffer: buffer}
+}
+
+// Subscription receives events published after it was created
+type Subscription struct {
+	broker  *Broker
+	events  chan domain.TaskEvent
+	once    sync.Once
+	dropped bool
+}
+
+// Subscribe registers a subscription. After Close of the broker it returns one whose
+// channel is already closed.
+func (b *Broker) Subscribe() *Subscription {
+	sub := &Subscription{broker: b, events: make(chan domain.TaskEvent, b.buffer)}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		sub.closeEvents()
+		return sub
+	}
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+// Publish hands events to every subscription in order
+func (b *Broker) Publish(events []domain.TaskEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs {
+		if !sub.offer(events) {
+			delete(b.subs, sub)
+			sub.dropped = true
+			sub.closeEvents()
+		}
+	}
+}
+
+// Close ends every subscription, used on shutdown so streaming handlers return
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subs {
+		delete(b.subs, sub)
+		sub.closeEvents()
+	}
+}
+
+// Events is closed when the subscription ends, by Close or because it fell behind
+func (s *Subscription) Events() <-chan domain.TaskEvent {
+	return s.events
+}
+
+// Dropped reports whether the subscription ended because it fell behind,
+// as opposed to Close of the subscription or the broker
+func (s *Subscription) Dropped() bool {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	return s.dropped
+}
+
+// Close unregisters the subscription, it is safe to call more than once
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	delete(s.broker.subs, s)
+	s.closeEvents()
+}
+
+// offer queues events without blocking and reports false when the buffer is full
+func (s *Subscription) offer(events []domain.TaskEvent) bool {
+	for _, event := range events {
+		select {
+		case s.events <- event:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Subscription) closeEvents() {
+	s.once.Do(func() { close(s.events) })
+}
@@ -0,0 +1,80 @@
+package grpcapi
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/nightmaker00/go-tasks-api/internal/api"
+	"github.com/nightmaker00/go-tasks-api/internal/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// publicServices are served without a key, like the OpenAPI document of the REST API
+var publicServices = []string{
+	"/grpc.health.v1.Health/",
+	"/grpc.reflection.v1.ServerReflection/",
+	"/grpc.reflection.v1alpha.ServerReflection/",
+}
+
+// UnaryAPIKeyAuth requires a key created by "app create-api-key" in the authorization
+// ("Bearer <key>") or x-api-key metadata when cfg.Required is set
+func UnaryAPIKeyAuth(cfg config.Auth, store api.APIKeyStore) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := authenticate(ctx, cfg, store, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamAPIKeyAuth is UnaryAPIKeyAuth for streaming calls
+func StreamAPIKeyAuth(cfg config.Auth, store api.APIKeyStore) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := authenticate(stream.Context(), cfg, store, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+}
+
+func authenticate(ctx context.Context, cfg config.Auth, store api.APIKeyStore, method string) error {
+	if !cfg.Required {
+		return nil
+	}
+	for _, prefix := range publicServices {
+		if strings.HasPrefix(method, prefix) {
+			return nil
+		}
+	}
+
+	key := apiKeyFromMetadata(ctx)
+	if key == "" {
+		return newStatusError(codes.Unauthenticated, reasonUnauthorized, "api key is required", nil)
+	}
+	_, ok, err := store.Authenticate(ctx, api.HashAPIKey(key))
+	if err != nil {
+		log.Printf("authenticate api key: %v", err)
+		return newStatusError(codes.Internal, reasonInternal, "internal server error", nil)
+	}
+	if !ok {
+		return newStatusError(codes.Unauthenticated, reasonUnauthorized, "invalid api key", nil)
+	}
+	return nil
+}
+
+func apiKeyFromMetadata(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if keys := md.Get("x-api-key"); len(keys) > 0 && keys[0] != "" {
+		return keys[0]
+	}
+	for _, value := range md.Get("authorization") {
+		scheme, token, ok := strings.Cut(value, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return ""
+}
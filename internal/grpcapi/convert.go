@@ -0,0 +1,129 @@
+package grpcapi
+
+import (
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	tasksv1 "github.com/nightmaker00/go-tasks-api/pkg/pb/tasks/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var taskStatuses = map[domain.TaskStatus]tasksv1.TaskStatus{
+	domain.TaskStatusNew:        tasksv1.TaskStatus_TASK_STATUS_NEW,
+	domain.TaskStatusInProgress: tasksv1.TaskStatus_TASK_STATUS_IN_PROGRESS,
+	domain.TaskStatusDone:       tasksv1.TaskStatus_TASK_STATUS_DONE,
+}
+
+var taskEventTypes = map[domain.TaskEventType]tasksv1.TaskEventType{
+	domain.TaskEventCreated: tasksv1.TaskEventType_TASK_EVENT_TYPE_CREATED,
+	domain.TaskEventUpdated: tasksv1.TaskEventType_TASK_EVENT_TYPE_UPDATED,
+	domain.TaskEventDeleted: tasksv1.TaskEventType_TASK_EVENT_TYPE_DELETED,
+}
+
+var batchOperationTypes = map[tasksv1.BatchOperationType]domain.BatchOperationType{
+	tasksv1.BatchOperationType_BATCH_OPERATION_TYPE_CREATE: domain.BatchOperationCreate,
+	tasksv1.BatchOperationType_BATCH_OPERATION_TYPE_UPDATE: domain.BatchOperationUpdate,
+	tasksv1.BatchOperationType_BATCH_OPERATION_TYPE_DELETE: domain.BatchOperationDelete,
+}
+
+var batchModes = map[tasksv1.BatchMode]domain.BatchMode{
+	tasksv1.BatchMode_BATCH_MODE_UNSPECIFIED: domain.BatchModeAtomic,
+	tasksv1.BatchMode_BATCH_MODE_ATOMIC:      domain.BatchModeAtomic,
+	tasksv1.BatchMode_BATCH_MODE_BEST_EFFORT: domain.BatchModeBestEffort,
+}
+
+var importRowResults = map[domain.ImportRowResult]tasksv1.ImportRowResult{
+	domain.ImportRowCreated: tasksv1.ImportRowResult_IMPORT_ROW_RESULT_CREATED,
+	domain.ImportRowSkipped: tasksv1.ImportRowResult_IMPORT_ROW_RESULT_SKIPPED,
+	domain.ImportRowFailed:  tasksv1.ImportRowResult_IMPORT_ROW_RESULT_FAILED,
+}
+
+// statusName is the status as the service takes it, empty when unspecified. A value
+// outside the enum is passed on by number, the service rejects it.
+func statusName(status tasksv1.TaskStatus) string {
+	if status == tasksv1.TaskStatus_TASK_STATUS_UNSPECIFIED {
+		return ""
+	}
+	for name, value := range taskStatuses {
+		if value == status {
+			return string(name)
+		}
+	}
+	return status.String()
+}
+
+// parseID reads a required id, the error names the request field
+func parseID(field, raw string) (uuid.UUID, error) {
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		code := "invalid_uuid"
+		if raw == "" {
+			code = "required"
+		}
+		return uuid.Nil, invalidArgument(domain.FieldError{Field: field, Code: code, Message: "invalid " + field})
+	}
+	return id, nil
+}
+
+// parseOptionalID reads an id that may be left empty
+func parseOptionalID(field, raw string) (uuid.UUID, error) {
+	if raw == "" {
+		return uuid.Nil, nil
+	}
+	return parseID(field, raw)
+}
+
+func toTask(task *domain.Task) *tasksv1.Task {
+	return &tasksv1.Task{
+		Id:          task.ID.String(),
+		Title:       task.Title,
+		Description: task.Description,
+		Status:      taskStatuses[task.Status],
+		CreatedAt:   timestamppb.New(task.CreatedAt),
+		UpdatedAt:   timestamppb.New(task.UpdatedAt),
+	}
+}
+
+func toTaskEvent(event *domain.TaskEvent) *tasksv1.TaskEvent {
+	return &tasksv1.TaskEvent{
+		Id:         event.ID,
+		Type:       taskEventTypes[event.Type],
+		TaskId:     event.TaskID.String(),
+		Seq:        event.Seq,
+		Task:       toTask(&event.Task),
+		OccurredAt: timestamppb.New(event.OccurredAt),
+	}
+}
+
+func toFieldErrors(fields []domain.FieldError) []*tasksv1.FieldError {
+	if len(fields) == 0 {
+		return nil
+	}
+	out := make([]*tasksv1.FieldError, len(fields))
+	for i, field := range fields {
+		out[i] = &tasksv1.FieldError{Field: field.Field, Code: field.Code, Message: field.Message}
+	}
+	return out
+}
+
+func toImportReport(report *domain.ImportReport) *tasksv1.ImportReport {
+	out := &tasksv1.ImportReport{
+		DryRun:  report.DryRun,
+		Total:   int32(report.Total),
+		Created: int32(report.Created),
+		Skipped: int32(report.Skipped),
+		Failed:  int32(report.Failed),
+		Rows:    make([]*tasksv1.ImportRowReport, len(report.Rows)),
+	}
+	for i, row := range report.Rows {
+		out.Rows[i] = &tasksv1.ImportRowReport{
+			Row:    int32(row.Row),
+			Result: importRowResults[row.Result],
+			Reason: row.Reason,
+			Errors: toFieldErrors(row.Errors),
+		}
+		if row.ID != nil {
+			out.Rows[i].Id = row.ID.String()
+		}
+	}
+	return out
+}
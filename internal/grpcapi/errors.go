@@ -0,0 +1,105 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	"github.com/nightmaker00/go-tasks-api/internal/service"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// errorDomain is the domain of the google.rpc.ErrorInfo attached to every error
+const errorDomain = "tasks-api"
+
+// stable error reasons, the same as the codes of the REST API
+const (
+	reasonValidation         = "validation_failed"
+	reasonNotFound           = "not_found"
+	reasonTaskExists         = "task_exists"
+	reasonBatchAborted       = "batch_aborted"
+	reasonChangeTokenExpired = "change_token_expired"
+	reasonClientTooSlow      = "client_too_slow"
+	reasonUnauthorized       = "unauthorized"
+	reasonInternal           = "internal_error"
+)
+
+// serviceErrorCode maps an error of the service layer to a status code, a reason and a message
+func serviceErrorCode(err error) (codes.Code, string, string) {
+	var validation *service.ValidationError
+	switch {
+	case errors.Is(err, service.ErrTaskNotFound):
+		return codes.NotFound, reasonNotFound, "task not found"
+	case errors.Is(err, service.ErrTaskExists):
+		return codes.AlreadyExists, reasonTaskExists, "task already exists"
+	case errors.Is(err, service.ErrChangeTokenExpired):
+		return codes.FailedPrecondition, reasonChangeTokenExpired, "change token expired, sync again from scratch"
+	case errors.Is(err, service.ErrBatchAborted):
+		return codes.Aborted, reasonBatchAborted, "batch aborted"
+	case errors.As(err, &validation),
+		errors.Is(err, service.ErrInvalidTitle),
+		errors.Is(err, service.ErrInvalidStatus),
+		errors.Is(err, service.ErrInvalidLimit),
+		errors.Is(err, service.ErrInvalidOffset),
+		errors.Is(err, service.ErrInvalidID),
+		errors.Is(err, service.ErrInvalidBatch),
+		errors.Is(err, service.ErrInvalidOp):
+		return codes.InvalidArgument, reasonValidation, "invalid request"
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled, reasonInternal, err.Error()
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded, reasonInternal, err.Error()
+	default:
+		return codes.Internal, reasonInternal, "internal error"
+	}
+}
+
+func fieldErrors(err error) []domain.FieldError {
+	var validation *service.ValidationError
+	if errors.As(err, &validation) {
+		return validation.Fields
+	}
+	return nil
+}
+
+// serviceError converts an error of the service layer into a status error, the fields
+// of a validation error are attached as a google.rpc.BadRequest detail
+func serviceError(ctx context.Context, err error) error {
+	code, reason, message := serviceErrorCode(err)
+	if code == codes.Internal {
+		method, _ := grpc.Method(ctx)
+		log.Printf("grpc %s: %v", method, err)
+	}
+	return newStatusError(code, reason, message, fieldErrors(err))
+}
+
+func invalidArgument(fields ...domain.FieldError) error {
+	return newStatusError(codes.InvalidArgument, reasonValidation, "invalid request", fields)
+}
+
+// newStatusError builds a status with a google.rpc.ErrorInfo detail carrying the reason
+// and, for invalid fields, a google.rpc.BadRequest detail
+func newStatusError(code codes.Code, reason, message string, fields []domain.FieldError) error {
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: reason, Domain: errorDomain}}
+	if len(fields) > 0 {
+		violations := make([]*errdetails.BadRequest_FieldViolation, len(fields))
+		for i, field := range fields {
+			violations[i] = &errdetails.BadRequest_FieldViolation{
+				Field:       field.Field,
+				Reason:      field.Code,
+				Description: field.Message,
+			}
+		}
+		details = append(details, &errdetails.BadRequest{FieldViolations: violations})
+	}
+	st, err := status.New(code, message).WithDetails(details...)
+	if err != nil {
+		return status.Error(code, message)
+	}
+	return st.Err()
+}
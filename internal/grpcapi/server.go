@@ -0,0 +1,353 @@
+// Package grpcapi serves the task service over gRPC as tasks.v1.TasksService, next to
+// the REST API and on top of the same service layer.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/api"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	"github.com/nightmaker00/go-tasks-api/internal/events"
+	"github.com/nightmaker00/go-tasks-api/internal/todotxt"
+	tasksv1 "github.com/nightmaker00/go-tasks-api/pkg/pb/tasks/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// defaultHistoryLimit is the number of events per task GetTaskHistory returns without a limit
+	defaultHistoryLimit = 20
+	// replayPage is how many logged events WatchTasks reads at once while catching up
+	replayPage = 500
+)
+
+type Server struct {
+	tasksv1.UnimplementedTasksServiceServer
+	tasks  api.TaskService
+	events *events.Broker
+}
+
+func NewServer(tasks api.TaskService, broker *events.Broker) *Server {
+	return &Server{tasks: tasks, events: broker}
+}
+
+func (s *Server) CreateTask(ctx context.Context, req *tasksv1.CreateTaskRequest) (*tasksv1.Task, error) {
+	id, err := parseOptionalID("id", req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	id, err = s.tasks.Create(ctx, id, req.GetTitle(), req.GetDescription())
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	return s.getTask(ctx, id)
+}
+
+func (s *Server) GetTask(ctx context.Context, req *tasksv1.GetTaskRequest) (*tasksv1.Task, error) {
+	id, err := parseID("id", req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return s.getTask(ctx, id)
+}
+
+func (s *Server) getTask(ctx context.Context, id uuid.UUID) (*tasksv1.Task, error) {
+	task, err := s.tasks.GetByID(ctx, id)
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	return toTask(task), nil
+}
+
+func (s *Server) BatchGetTasks(ctx context.Context, req *tasksv1.BatchGetTasksRequest) (*tasksv1.BatchGetTasksResponse, error) {
+	ids := make([]uuid.UUID, len(req.GetIds()))
+	for i, raw := range req.GetIds() {
+		id, err := parseID("ids", raw)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	tasks, err := s.tasks.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	resp := &tasksv1.BatchGetTasksResponse{Tasks: make([]*tasksv1.Task, len(tasks))}
+	for i := range tasks {
+		resp.Tasks[i] = toTask(&tasks[i])
+	}
+	return resp, nil
+}
+
+func (s *Server) UpdateTask(ctx context.Context, req *tasksv1.UpdateTaskRequest) (*tasksv1.Task, error) {
+	id, err := parseID("id", req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.tasks.Update(ctx, id, req.GetTitle(), req.Description, statusName(req.GetStatus())); err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	return s.getTask(ctx, id)
+}
+
+func (s *Server) UpsertTask(ctx context.Context, req *tasksv1.UpsertTaskRequest) (*tasksv1.UpsertTaskResponse, error) {
+	id, err := parseID("id", req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	created, err := s.tasks.Upsert(ctx, id, req.GetTitle(), req.Description, statusName(req.GetStatus()))
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	task, err := s.getTask(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &tasksv1.UpsertTaskResponse{Task: task, Created: created}, nil
+}
+
+func (s *Server) DeleteTask(ctx context.Context, req *tasksv1.DeleteTaskRequest) (*tasksv1.DeleteTaskResponse, error) {
+	id, err := parseID("id", req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.tasks.Delete(ctx, id); err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	return &tasksv1.DeleteTaskResponse{}, nil
+}
+
+// errStreamSend marks a failed Send, the stream is broken and its error is returned as it is
+type errStreamSend struct{ err error }
+
+func (e *errStreamSend) Error() string { return e.err.Error() }
+
+func (s *Server) ListTasks(req *tasksv1.ListTasksRequest, stream grpc.ServerStreamingServer[tasksv1.Task]) error {
+	ctx := stream.Context()
+	err := s.tasks.Export(ctx, statusName(req.GetStatus()), func(task domain.Task) error {
+		if err := stream.Send(toTask(&task)); err != nil {
+			return &errStreamSend{err: err}
+		}
+		return nil
+	})
+	var sendErr *errStreamSend
+	if errors.As(err, &sendErr) {
+		return sendErr.err
+	}
+	if err != nil {
+		return serviceError(ctx, err)
+	}
+	return nil
+}
+
+func (s *Server) BatchTasks(ctx context.Context, req *tasksv1.BatchTasksRequest) (*tasksv1.BatchTasksResponse, error) {
+	mode, ok := batchModes[req.GetMode()]
+	if !ok {
+		mode = domain.BatchMode(req.GetMode().String())
+	}
+	ops := make([]domain.BatchOperation, len(req.GetOperations()))
+	for i, op := range req.GetOperations() {
+		ops[i] = domain.BatchOperation{
+			Op:          batchOperationTypes[op.GetOp()],
+			Title:       op.GetTitle(),
+			Description: op.Description,
+			Status:      statusName(op.GetStatus()),
+		}
+		if op.GetId() != "" {
+			// like a malformed JSON body of POST /tasks:batch, a malformed id rejects the whole batch
+			id, err := uuid.Parse(op.GetId())
+			if err != nil {
+				field := fmt.Sprintf("operations[%d].id", i)
+				return nil, invalidArgument(domain.FieldError{Field: field, Code: "invalid_uuid", Message: "invalid id"})
+			}
+			ops[i].ID = &id
+		}
+	}
+
+	outcomes, err := s.tasks.Batch(ctx, mode, ops)
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	resp := &tasksv1.BatchTasksResponse{Results: make([]*tasksv1.BatchResult, len(outcomes))}
+	for i, outcome := range outcomes {
+		result := &tasksv1.BatchResult{Index: int32(i), Op: req.GetOperations()[i].GetOp()}
+		if outcome.ID != uuid.Nil {
+			result.Id = outcome.ID.String()
+		}
+		if outcome.Err != nil {
+			code, reason, message := serviceErrorCode(outcome.Err)
+			result.Code, result.Reason, result.Message = int32(code), reason, message
+			result.Errors = toFieldErrors(fieldErrors(outcome.Err))
+		}
+		resp.Results[i] = result
+	}
+	return resp, nil
+}
+
+func (s *Server) ImportTasks(ctx context.Context, req *tasksv1.ImportTasksRequest) (*tasksv1.ImportReport, error) {
+	records := make([]domain.ImportRecord, len(req.GetRecords()))
+	for i, record := range req.GetRecords() {
+		records[i] = domain.ImportRecord{
+			Row:         int(record.GetRow()),
+			ID:          record.GetId(),
+			Title:       record.GetTitle(),
+			Description: record.GetDescription(),
+			Status:      record.GetStatus(),
+			CreatedAt:   record.GetCreatedAt(),
+			UpdatedAt:   record.GetUpdatedAt(),
+		}
+	}
+	report, err := s.tasks.Import(ctx, records, req.GetDryRun())
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	return toImportReport(report), nil
+}
+
+func (s *Server) GetChanges(ctx context.Context, req *tasksv1.GetChangesRequest) (*tasksv1.GetChangesResponse, error) {
+	changes, err := s.tasks.Changes(ctx, req.GetToken(), int(req.GetLimit()))
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	resp := &tasksv1.GetChangesResponse{
+		Upserted:  make([]*tasksv1.Task, len(changes.Upserted)),
+		Deleted:   make([]*tasksv1.TaskTombstone, len(changes.Deleted)),
+		NextToken: changes.NextToken,
+		HasMore:   changes.HasMore,
+	}
+	for i := range changes.Upserted {
+		resp.Upserted[i] = toTask(&changes.Upserted[i])
+	}
+	for i, tombstone := range changes.Deleted {
+		resp.Deleted[i] = &tasksv1.TaskTombstone{Id: tombstone.ID.String(), DeletedAt: timestamppb.New(tombstone.DeletedAt)}
+	}
+	return resp, nil
+}
+
+func (s *Server) GetTaskHistory(ctx context.Context, req *tasksv1.GetTaskHistoryRequest) (*tasksv1.GetTaskHistoryResponse, error) {
+	ids := make([]uuid.UUID, len(req.GetTaskIds()))
+	for i, raw := range req.GetTaskIds() {
+		id, err := parseID("task_ids", raw)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	limit := int(req.GetLimit())
+	if limit == 0 {
+		limit = defaultHistoryLimit
+	}
+	history, err := s.tasks.History(ctx, ids, limit)
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	resp := &tasksv1.GetTaskHistoryResponse{Events: make([]*tasksv1.TaskEvent, len(history))}
+	for i := range history {
+		resp.Events[i] = toTaskEvent(&history[i])
+	}
+	return resp, nil
+}
+
+// eventFilter selects the events WatchTasks sends, empty fields match everything
+type eventFilter struct {
+	status  domain.TaskStatus
+	project string
+	taskID  uuid.UUID
+}
+
+// match checks the task as the event carries it: the new state, or the last one for a deletion
+func (f eventFilter) match(event domain.TaskEvent) bool {
+	if f.status != "" && event.Task.Status != f.status {
+		return false
+	}
+	if f.taskID != uuid.Nil && event.TaskID != f.taskID {
+		return false
+	}
+	if f.project != "" && !todotxt.HasProject(event.Task.Title, f.project) {
+		return false
+	}
+	return true
+}
+
+func (s *Server) WatchTasks(req *tasksv1.WatchTasksRequest, stream grpc.ServerStreamingServer[tasksv1.TaskEvent]) error {
+	ctx := stream.Context()
+	var fields []domain.FieldError
+	filter := eventFilter{
+		status:  domain.TaskStatus(statusName(req.GetStatus())),
+		project: strings.TrimPrefix(strings.TrimSpace(req.GetProject()), "+"),
+	}
+	if _, ok := taskStatuses[filter.status]; filter.status != "" && !ok {
+		fields = append(fields, domain.FieldError{Field: "status", Code: "invalid_enum", Message: "invalid status"})
+	}
+	if raw := req.GetTaskId(); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			fields = append(fields, domain.FieldError{Field: "task_id", Code: "invalid_uuid", Message: "invalid task_id"})
+		}
+		filter.taskID = id
+	}
+	if req.AfterEventId != nil && req.GetAfterEventId() < 0 {
+		fields = append(fields, domain.FieldError{Field: "after_event_id", Code: "out_of_range", Message: "invalid after_event_id"})
+	}
+	if len(fields) > 0 {
+		return invalidArgument(fields...)
+	}
+
+	// subscribe before reading the log, so nothing committed meanwhile is missed
+	sub := s.events.Subscribe()
+	defer sub.Close()
+
+	send := func(event domain.TaskEvent) error {
+		if !filter.match(event) {
+			return nil
+		}
+		return stream.Send(toTaskEvent(&event))
+	}
+
+	// live events up to the last replayed one were already sent from the log
+	var replayed int64
+	if req.AfterEventId != nil {
+		replayed = req.GetAfterEventId()
+		for {
+			page, err := s.tasks.EventsAfter(ctx, replayed, replayPage)
+			if err != nil {
+				return serviceError(ctx, err)
+			}
+			for _, event := range page {
+				replayed = event.ID
+				if err := send(event); err != nil {
+					return err
+				}
+			}
+			if len(page) < replayPage {
+				break
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case event, ok := <-sub.Events():
+			if !ok {
+				if sub.Dropped() {
+					return newStatusError(codes.Unavailable, reasonClientTooSlow, "client is too slow, watch again with after_event_id", nil)
+				}
+				return status.Error(codes.Unavailable, "server is shutting down")
+			}
+			if event.ID <= replayed {
+				continue
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
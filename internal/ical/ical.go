@@ -0,0 +1,138 @@
+// Package ical renders tasks as RFC 5545 VTODO components.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+const (
+	ContentType = "text/calendar; charset=utf-8"
+
+	prodID        = "-//nightmaker00//go-tasks-api//EN"
+	timeLayout    = "20060102T150405Z"
+	maxLineOctets = 75
+)
+
+// statuses maps task statuses to the STATUS values of a VTODO
+var statuses = map[domain.TaskStatus]string{
+	domain.TaskStatusNew:        "NEEDS-ACTION",
+	domain.TaskStatusInProgress: "IN-PROCESS",
+	domain.TaskStatusDone:       "COMPLETED",
+}
+
+// WriteCalendar writes a VCALENDAR with a VTODO per task. Tasks have no due date,
+// so DUE is never written; a done task gets COMPLETED at its update time.
+func WriteCalendar(w io.Writer, name string, tasks []domain.Task) error {
+	enc := NewEncoder(w, name)
+	for _, task := range tasks {
+		if err := enc.Encode(task); err != nil {
+			return err
+		}
+	}
+	return enc.Close()
+}
+
+// Encoder writes the calendar of WriteCalendar a task at a time, so the tasks are
+// never all in memory
+type Encoder struct {
+	out *writer
+}
+
+// NewEncoder starts a VCALENDAR, Close ends it
+func NewEncoder(w io.Writer, name string) *Encoder {
+	out := &writer{w: bufio.NewWriter(w)}
+	out.line("BEGIN", "VCALENDAR")
+	out.line("VERSION", "2.0")
+	out.line("PRODID", prodID)
+	out.line("CALSCALE", "GREGORIAN")
+	if name != "" {
+		out.line("X-WR-CALNAME", escapeText(name))
+	}
+	return &Encoder{out: out}
+}
+
+// Encode writes the VTODO of the task and returns the first error writing to w
+func (e *Encoder) Encode(task domain.Task) error {
+	writeTodo(e.out, task)
+	return e.out.err
+}
+
+func (e *Encoder) Close() error {
+	e.out.line("END", "VCALENDAR")
+	if err := e.out.w.Flush(); err != nil {
+		return err
+	}
+	return e.out.err
+}
+
+func writeTodo(out *writer, task domain.Task) {
+	out.line("BEGIN", "VTODO")
+	out.line("UID", task.ID.String())
+	// without METHOD, DTSTAMP is the time the task was last revised (RFC 5545, 3.8.7.2)
+	out.line("DTSTAMP", formatTime(task.UpdatedAt))
+	out.line("CREATED", formatTime(task.CreatedAt))
+	out.line("LAST-MODIFIED", formatTime(task.UpdatedAt))
+	out.line("SUMMARY", escapeText(task.Title))
+	if task.Description != "" {
+		out.line("DESCRIPTION", escapeText(task.Description))
+	}
+	if status, ok := statuses[task.Status]; ok {
+		out.line("STATUS", status)
+	}
+	if task.Status == domain.TaskStatusDone {
+		out.line("COMPLETED", formatTime(task.UpdatedAt))
+		out.line("PERCENT-COMPLETE", "100")
+	}
+	out.line("END", "VTODO")
+}
+
+type writer struct {
+	w *bufio.Writer
+	// err is the first error of the underlying writer, bufio keeps returning it
+	err error
+}
+
+// line writes a content line folded at 75 octets, never inside a UTF-8 sequence
+func (o *writer) line(name, value string) {
+	line := name + ":" + value
+	width := 0
+	for len(line) > 0 {
+		limit := maxLineOctets - width
+		if len(line) <= limit {
+			o.write(line)
+			break
+		}
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		o.write(line[:cut])
+		o.write("\r\n ")
+		line = line[cut:]
+		// the leading space of a continuation line counts towards its length
+		width = 1
+	}
+	o.write("\r\n")
+}
+
+func (o *writer) write(s string) {
+	if _, err := o.w.WriteString(s); err != nil && o.err == nil {
+		o.err = err
+	}
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escapeText(value string) string {
+	return textEscaper.Replace(value)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
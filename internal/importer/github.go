@@ -0,0 +1,99 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// githubIssue covers both the REST API (snake_case) and `gh issue list --json` (camelCase)
+type githubIssue struct {
+	Number         int       `json:"number"`
+	URL            string    `json:"url"`
+	HTMLURL        string    `json:"html_url"`
+	Title          string    `json:"title"`
+	Body           string    `json:"body"`
+	State          string    `json:"state"`
+	CreatedAt      time.Time `json:"created_at"`
+	CreatedAtCamel time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	UpdatedAtCamel time.Time `json:"updatedAt"`
+	Labels         []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	// the REST API returns the number of comments here, gh the comments themselves
+	Comments    json.RawMessage `json:"comments"`
+	PullRequest json.RawMessage `json:"pull_request"`
+}
+
+type githubComment struct {
+	Author struct {
+		Login string `json:"login"`
+	} `json:"author"`
+	User struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	Body           string    `json:"body"`
+	CreatedAt      time.Time `json:"created_at"`
+	CreatedAtCamel time.Time `json:"createdAt"`
+}
+
+// ReadGitHub reads a JSON array of issues, as returned by GET /repos/{owner}/{repo}/issues
+// or by `gh issue list --state all --json number,url,title,body,state,createdAt,updatedAt,labels,comments`.
+// Pull requests are skipped.
+func ReadGitHub(r io.Reader) ([]Issue, error) {
+	var items []githubIssue
+	if err := json.NewDecoder(r).Decode(&items); err != nil {
+		return nil, fmt.Errorf("read github issues: %w", err)
+	}
+
+	issues := make([]Issue, 0, len(items))
+	for _, item := range items {
+		if len(item.PullRequest) > 0 && string(item.PullRequest) != "null" {
+			continue
+		}
+		issue := Issue{
+			Key:         firstNonEmpty(item.HTMLURL, item.URL, "#"+strconv.Itoa(item.Number)),
+			Title:       item.Title,
+			Description: item.Body,
+			Status:      item.State,
+			CreatedAt:   firstTime(item.CreatedAt, item.CreatedAtCamel),
+			UpdatedAt:   firstTime(item.UpdatedAt, item.UpdatedAtCamel),
+		}
+		for _, label := range item.Labels {
+			issue.Labels = append(issue.Labels, label.Name)
+		}
+		var comments []githubComment
+		if json.Unmarshal(item.Comments, &comments) == nil {
+			for _, comment := range comments {
+				issue.Comments = append(issue.Comments, Comment{
+					Author:    firstNonEmpty(comment.Author.Login, comment.User.Login),
+					Text:      comment.Body,
+					CreatedAt: firstTime(comment.CreatedAt, comment.CreatedAtCamel),
+				})
+			}
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func firstTime(values ...time.Time) time.Time {
+	for _, value := range values {
+		if !value.IsZero() {
+			return value
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,217 @@
+// Package importer reads export files of other trackers (Trello, Jira, GitHub Issues)
+// and turns them into import records for the task service.
+package importer
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+// Issue is a card or issue as read from the source tracker, before its status is mapped
+type Issue struct {
+	// Key identifies the issue in the source: Jira key, GitHub URL or number, Trello card id
+	Key         string
+	Title       string
+	Description string
+	// Status is the source status: Trello list name, Jira status, GitHub state
+	Status string
+	// Labels are also tried as status keys before Status, so a label can override it
+	Labels    []string
+	Comments  []Comment
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type Comment struct {
+	Author    string
+	Text      string
+	CreatedAt time.Time
+}
+
+type reader func(r io.Reader) ([]Issue, error)
+
+var readers = map[string]reader{
+	"trello":   ReadTrello,
+	"jira-csv": ReadJiraCSV,
+	"jira-xml": ReadJiraXML,
+	"github":   ReadGitHub,
+}
+
+// defaultStatuses are the usual workflow names of each source, the user mapping is merged over them
+var defaultStatuses = map[string]StatusMapping{
+	"trello": {
+		"to do": domain.TaskStatusNew, "todo": domain.TaskStatusNew, "backlog": domain.TaskStatusNew,
+		"doing": domain.TaskStatusInProgress, "in progress": domain.TaskStatusInProgress,
+		"done": domain.TaskStatusDone,
+	},
+	"jira-csv": jiraStatuses,
+	"jira-xml": jiraStatuses,
+	"github": {
+		"open": domain.TaskStatusNew, "closed": domain.TaskStatusDone,
+	},
+}
+
+var jiraStatuses = StatusMapping{
+	"open": domain.TaskStatusNew, "to do": domain.TaskStatusNew, "backlog": domain.TaskStatusNew,
+	"selected for development": domain.TaskStatusNew, "reopened": domain.TaskStatusNew,
+	"in progress": domain.TaskStatusInProgress, "in review": domain.TaskStatusInProgress,
+	"done": domain.TaskStatusDone, "closed": domain.TaskStatusDone, "resolved": domain.TaskStatusDone,
+}
+
+// Sources lists the supported source names
+func Sources() []string {
+	names := make([]string, 0, len(readers))
+	for name := range readers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Read parses an export file of the source
+func Read(source string, r io.Reader) ([]Issue, error) {
+	read, ok := readers[source]
+	if !ok {
+		return nil, fmt.Errorf("unknown source %q, want one of %s", source, strings.Join(Sources(), ", "))
+	}
+	return read(r)
+}
+
+// StatusMapping maps source statuses, compared case-insensitively, to task statuses
+type StatusMapping map[string]domain.TaskStatus
+
+// DefaultMapping returns a copy of the built-in mapping of the source
+func DefaultMapping(source string) StatusMapping {
+	mapping := make(StatusMapping)
+	for key, status := range defaultStatuses[source] {
+		mapping[key] = status
+	}
+	return mapping
+}
+
+// Merge adds the entries of other, overriding existing keys. When an entry maps to
+// something that is not a task status nothing is merged, so a typo in the mapping file
+// fails the import up front instead of every row it covers.
+func (m StatusMapping) Merge(other map[string]string) error {
+	var invalid []string
+	for key, status := range other {
+		if !ValidStatus(status) {
+			invalid = append(invalid, fmt.Sprintf("%q: %q", key, status))
+		}
+	}
+	if len(invalid) > 0 {
+		sort.Strings(invalid)
+		return fmt.Errorf("unknown task status in mapping %s, want one of %s, %s, %s", strings.Join(invalid, ", "),
+			domain.TaskStatusNew, domain.TaskStatusInProgress, domain.TaskStatusDone)
+	}
+	for key, status := range other {
+		m[normalizeKey(key)] = domain.TaskStatus(status)
+	}
+	return nil
+}
+
+// ValidStatus reports whether status is one of the task statuses
+func ValidStatus(status string) bool {
+	switch domain.TaskStatus(status) {
+	case domain.TaskStatusNew, domain.TaskStatusInProgress, domain.TaskStatusDone:
+		return true
+	}
+	return false
+}
+
+func (m StatusMapping) lookup(issue Issue) (domain.TaskStatus, bool) {
+	for _, label := range issue.Labels {
+		if status, ok := m[normalizeKey(label)]; ok {
+			return status, true
+		}
+	}
+	status, ok := m[normalizeKey(issue.Status)]
+	return status, ok
+}
+
+// Records converts issues to import records. Ids are derived from the source and the
+// issue key, so importing the same file again skips the tasks created the first time.
+// Labels and comments have no field in a task and are appended to the description.
+// An issue whose status is not in the mapping gets fallback, or fails when it is empty.
+func Records(source string, issues []Issue, mapping StatusMapping, fallback domain.TaskStatus) []domain.ImportRecord {
+	records := make([]domain.ImportRecord, 0, len(issues))
+	for i, issue := range issues {
+		record := domain.ImportRecord{
+			Row:         i + 1,
+			ID:          uuid.NewSHA1(uuid.NameSpaceURL, []byte(source+":"+issue.Key)).String(),
+			Title:       issue.Title,
+			Description: describe(issue),
+			CreatedAt:   formatTime(issue.CreatedAt),
+			UpdatedAt:   formatTime(issue.UpdatedAt),
+		}
+		status, ok := mapping.lookup(issue)
+		if !ok {
+			status = fallback
+		}
+		record.Status = string(status)
+		if status == "" {
+			record.ParseErrors = []domain.FieldError{{
+				Field:   "status",
+				Code:    "unmapped_status",
+				Message: fmt.Sprintf("status %q is not in the mapping", issue.Status),
+			}}
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func describe(issue Issue) string {
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(issue.Description))
+	if len(issue.Labels) > 0 {
+		b.WriteString("\n\nLabels: ")
+		b.WriteString(strings.Join(issue.Labels, ", "))
+	}
+	if len(issue.Comments) > 0 {
+		b.WriteString("\n\nComments:")
+		for _, comment := range issue.Comments {
+			b.WriteString("\n\n")
+			if !comment.CreatedAt.IsZero() {
+				b.WriteString(comment.CreatedAt.UTC().Format("2006-01-02 15:04 MST "))
+			}
+			if comment.Author != "" {
+				b.WriteString(comment.Author)
+			}
+			b.WriteString(":\n")
+			b.WriteString(strings.TrimSpace(comment.Text))
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// parseTime tries the layouts in order, the ones without an offset are read in loc
+func parseTime(raw string, loc *time.Location, layouts ...string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, raw, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time %q", raw)
+}
+
+func normalizeKey(key string) string {
+	return strings.ToLower(strings.TrimSpace(key))
+}
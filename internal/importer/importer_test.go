@@ -0,0 +1,258 @@
+package importer_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	"github.com/nightmaker00/go-tasks-api/internal/importer"
+)
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		source  string
+		fixture string
+		want    []importer.Issue
+	}{
+		{
+			source:  "trello",
+			fixture: "trello.json",
+			want: []importer.Issue{
+				{
+					Key:         "65a0c0805f1e2d3c4b5a6978",
+					Title:       "Buy milk",
+					Description: "2 l",
+					Status:      "Doing",
+					Labels:      []string{"home", "red"},
+					Comments: []importer.Comment{
+						{Author: "Alice", Text: "Oat milk please", CreatedAt: time.Date(2024, 1, 12, 8, 0, 0, 0, time.UTC)},
+						{Author: "Bob", Text: "Got it", CreatedAt: time.Date(2024, 1, 12, 9, 30, 0, 0, time.UTC)},
+					},
+					// the card id starts with the creation time
+					CreatedAt: time.Date(2024, 1, 12, 4, 30, 56, 0, time.UTC),
+					UpdatedAt: time.Date(2024, 1, 12, 9, 30, 0, 0, time.UTC),
+				},
+				{
+					Key:       "65a0c0905f1e2d3c4b5a6979",
+					Title:     "Paint the fence",
+					Status:    "Ideas",
+					CreatedAt: time.Date(2024, 1, 12, 4, 31, 12, 0, time.UTC),
+					UpdatedAt: time.Date(2024, 1, 12, 10, 0, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			source:  "jira-csv",
+			fixture: "jira.csv",
+			want: []importer.Issue{
+				{
+					Key:         "PROJ-1",
+					Title:       "Fix login",
+					Description: "Users see a 500, sometimes",
+					Status:      "In Progress",
+					Labels:      []string{"backend", "urgent"},
+					Comments: []importer.Comment{
+						{Author: "alice", Text: "Looking into it", CreatedAt: time.Date(2024, 1, 5, 16, 0, 0, 0, time.Local)},
+						{Text: "plain note"},
+					},
+					// CSV dates have no offset and are read in the local time zone
+					CreatedAt: time.Date(2024, 1, 5, 15, 4, 0, 0, time.Local),
+					UpdatedAt: time.Date(2024, 1, 6, 10, 15, 0, 0, time.Local),
+				},
+				{
+					Key:       "PROJ-2",
+					Title:     "Write docs",
+					Status:    "Done",
+					CreatedAt: time.Date(2024, 1, 7, 9, 0, 0, 0, time.Local),
+					UpdatedAt: time.Date(2024, 1, 8, 18, 30, 0, 0, time.Local),
+				},
+			},
+		},
+		{
+			source:  "jira-xml",
+			fixture: "jira.xml",
+			want: []importer.Issue{
+				{
+					Key:         "PROJ-1",
+					Title:       "Fix login",
+					Description: "<p>Users see a 500</p>",
+					Status:      "In Progress",
+					Labels:      []string{"backend", "urgent"},
+					Comments: []importer.Comment{
+						{Author: "alice", Text: "<p>Looking into it</p>", CreatedAt: time.Date(2024, 1, 5, 15, 0, 0, 0, time.UTC)},
+					},
+					CreatedAt: time.Date(2024, 1, 5, 14, 4, 0, 0, time.UTC),
+					UpdatedAt: time.Date(2024, 1, 6, 9, 15, 0, 0, time.UTC),
+				},
+				{
+					Key:       "PROJ-2",
+					Title:     "Write docs",
+					Status:    "Resolved",
+					CreatedAt: time.Date(2024, 1, 7, 9, 0, 0, 0, time.UTC),
+					UpdatedAt: time.Date(2024, 1, 8, 18, 30, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			// the REST API counts comments and lists pull requests too
+			source:  "github",
+			fixture: "github-rest.json",
+			want: []importer.Issue{
+				{
+					Key:         "https://github.com/acme/app/issues/12",
+					Title:       "Crash on start",
+					Description: "Stack trace attached",
+					Status:      "closed",
+					Labels:      []string{"bug"},
+					CreatedAt:   time.Date(2024, 1, 5, 10, 0, 0, 0, time.UTC),
+					UpdatedAt:   time.Date(2024, 1, 6, 11, 0, 0, 0, time.UTC),
+				},
+			},
+		},
+		{
+			source:  "github",
+			fixture: "github-gh.json",
+			want: []importer.Issue{
+				{
+					Key:       "https://github.com/acme/app/issues/7",
+					Title:     "Add dark mode",
+					Status:    "OPEN",
+					Labels:    []string{"enhancement", "in progress"},
+					Comments:  []importer.Comment{{Author: "carol", Text: "+1", CreatedAt: time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)}},
+					CreatedAt: time.Date(2024, 1, 2, 8, 0, 0, 0, time.UTC),
+					UpdatedAt: time.Date(2024, 1, 3, 9, 0, 0, 0, time.UTC),
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			issues := readFixture(t, tt.source, tt.fixture)
+			if got, want := inUTC(issues), inUTC(tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("issues =\n%+v\nwant\n%+v", got, want)
+			}
+		})
+	}
+}
+
+func TestReadRejectsMalformedFiles(t *testing.T) {
+	tests := []struct {
+		source string
+		body   string
+	}{
+		{source: "trello", body: `{"cards": [`},
+		{source: "jira-csv", body: "Key,Title\nPROJ-1,x\n"},
+		{source: "jira-csv", body: "Issue key,Summary,Created\nPROJ-1,x,yesterday\n"},
+		{source: "jira-xml", body: "<rss><channel><item><key>PROJ-1</key><created>yesterday</created></item></channel></rss>"},
+		{source: "github", body: `{"number": 1}`},
+		{source: "asana", body: `[]`},
+	}
+
+	for _, tt := range tests {
+		if _, err := importer.Read(tt.source, strings.NewReader(tt.body)); err == nil {
+			t.Errorf("%s %q: want an error", tt.source, tt.body)
+		}
+	}
+}
+
+func TestRecords(t *testing.T) {
+	issues := readFixture(t, "trello", "trello.json")
+	mapping := importer.DefaultMapping("trello")
+	if err := mapping.Merge(map[string]string{"Home": "done"}); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+
+	records := importer.Records("trello", issues, mapping, "")
+	if len(records) != 2 {
+		t.Fatalf("records = %+v, want 2", records)
+	}
+	// the label wins over the list
+	if records[0].Status != string(domain.TaskStatusDone) || len(records[0].ParseErrors) != 0 {
+		t.Errorf("labelled card: status %q, errors %+v", records[0].Status, records[0].ParseErrors)
+	}
+	wantDescription := "2 l\n\nLabels: home, red\n\nComments:\n\n" +
+		"2024-01-12 08:00 UTC Alice:\nOat milk please\n\n" +
+		"2024-01-12 09:30 UTC Bob:\nGot it"
+	if records[0].Description != wantDescription {
+		t.Errorf("description =\n%s\nwant\n%s", records[0].Description, wantDescription)
+	}
+	if records[0].CreatedAt != "2024-01-12T04:30:56Z" || records[0].UpdatedAt != "2024-01-12T09:30:00Z" {
+		t.Errorf("times = %s, %s", records[0].CreatedAt, records[0].UpdatedAt)
+	}
+	// "Ideas" is not in the mapping and there is no fallback
+	if records[1].Status != "" || len(records[1].ParseErrors) != 1 || records[1].ParseErrors[0].Code != "unmapped_status" {
+		t.Errorf("unmapped card: status %q, errors %+v", records[1].Status, records[1].ParseErrors)
+	}
+
+	again := importer.Records("trello", issues, mapping, domain.TaskStatusNew)
+	if again[0].ID != records[0].ID {
+		t.Errorf("id changed between imports: %s, %s", records[0].ID, again[0].ID)
+	}
+	if again[1].Status != string(domain.TaskStatusNew) || len(again[1].ParseErrors) != 0 {
+		t.Errorf("fallback: status %q, errors %+v", again[1].Status, again[1].ParseErrors)
+	}
+	if other := importer.Records("github", issues[:1], mapping, ""); other[0].ID == records[0].ID {
+		t.Error("the same key from another source got the same id")
+	}
+}
+
+func TestStatusMappingMerge(t *testing.T) {
+	mapping := importer.DefaultMapping("github")
+	err := mapping.Merge(map[string]string{"wontfix": "done", "triage": "blocked", "later": "Done"})
+	if err == nil {
+		t.Fatal("want an error for unknown statuses")
+	}
+	for _, entry := range []string{`"triage": "blocked"`, `"later": "Done"`} {
+		if !strings.Contains(err.Error(), entry) {
+			t.Errorf("error %q does not name %s", err, entry)
+		}
+	}
+	if !reflect.DeepEqual(mapping, importer.DefaultMapping("github")) {
+		t.Errorf("a rejected merge changed the mapping: %v", mapping)
+	}
+
+	if err := mapping.Merge(map[string]string{" WontFix ": "done", "open": "in_progress"}); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if mapping["wontfix"] != domain.TaskStatusDone || mapping["open"] != domain.TaskStatusInProgress {
+		t.Errorf("mapping = %v", mapping)
+	}
+}
+
+func readFixture(t *testing.T, source, name string) []importer.Issue {
+	t.Helper()
+	file, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	issues, err := importer.Read(source, file)
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return issues
+}
+
+// inUTC moves all times to UTC, so issues compare equal whatever zone they were parsed in
+func inUTC(issues []importer.Issue) []importer.Issue {
+	out := make([]importer.Issue, len(issues))
+	for i, issue := range issues {
+		issue.CreatedAt = issue.CreatedAt.UTC()
+		issue.UpdatedAt = issue.UpdatedAt.UTC()
+		if issue.Comments != nil {
+			comments := make([]importer.Comment, len(issue.Comments))
+			for j, comment := range issue.Comments {
+				comment.CreatedAt = comment.CreatedAt.UTC()
+				comments[j] = comment
+			}
+			issue.Comments = comments
+		}
+		out[i] = issue
+	}
+	return out
+}
@@ -0,0 +1,151 @@
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// jiraCSVLayouts are the date formats of Jira CSV exports, they depend on the
+// instance settings and carry no offset, so they are read in the local time zone
+var jiraCSVLayouts = []string{
+	"02/Jan/06 3:04 PM",
+	"02/Jan/06 15:04",
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05",
+	"02.01.2006 15:04",
+	time.RFC3339,
+}
+
+// jiraXMLLayouts are RFC 1123 dates, Jira writes the day without a leading zero
+var jiraXMLLayouts = []string{"Mon, 2 Jan 2006 15:04:05 -0700", time.RFC1123Z}
+
+// ReadJiraCSV reads a Jira CSV export (all fields). Labels and comments come in
+// repeated columns, a comment cell is "date;author;text".
+func ReadJiraCSV(r io.Reader) ([]Issue, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read jira csv header: %w", err)
+	}
+	columns := make(map[string][]int, len(header))
+	for i, name := range header {
+		name = normalizeKey(strings.TrimPrefix(name, "\ufeff"))
+		columns[name] = append(columns[name], i)
+	}
+	if len(columns["summary"]) == 0 || len(columns["issue key"]) == 0 {
+		return nil, errors.New("jira csv has no Summary or Issue key column")
+	}
+
+	issues := make([]Issue, 0)
+	for line := 2; ; line++ {
+		values, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read jira csv: %w", err)
+		}
+		all := func(column string) []string {
+			var out []string
+			for _, i := range columns[column] {
+				if i < len(values) && strings.TrimSpace(values[i]) != "" {
+					out = append(out, values[i])
+				}
+			}
+			return out
+		}
+		first := func(column string) string {
+			if found := all(column); len(found) > 0 {
+				return found[0]
+			}
+			return ""
+		}
+
+		issue := Issue{
+			Key:         first("issue key"),
+			Title:       first("summary"),
+			Description: first("description"),
+			Status:      first("status"),
+			Labels:      all("labels"),
+		}
+		if issue.CreatedAt, err = parseTime(first("created"), time.Local, jiraCSVLayouts...); err != nil {
+			return nil, fmt.Errorf("jira csv line %d: created: %w", line, err)
+		}
+		if issue.UpdatedAt, err = parseTime(first("updated"), time.Local, jiraCSVLayouts...); err != nil {
+			return nil, fmt.Errorf("jira csv line %d: updated: %w", line, err)
+		}
+		for _, cell := range all("comment") {
+			parts := strings.SplitN(cell, ";", 3)
+			if len(parts) < 3 {
+				issue.Comments = append(issue.Comments, Comment{Text: cell})
+				continue
+			}
+			created, err := parseTime(parts[0], time.Local, jiraCSVLayouts...)
+			if err != nil {
+				return nil, fmt.Errorf("jira csv line %d: comment: %w", line, err)
+			}
+			issue.Comments = append(issue.Comments, Comment{Author: parts[1], Text: parts[2], CreatedAt: created})
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+// jiraRSS is the XML export (Export → XML), an RSS feed with an item per issue
+type jiraRSS struct {
+	Items []struct {
+		Key         string   `xml:"key"`
+		Summary     string   `xml:"summary"`
+		Description string   `xml:"description"`
+		Status      string   `xml:"status"`
+		Created     string   `xml:"created"`
+		Updated     string   `xml:"updated"`
+		Labels      []string `xml:"labels>label"`
+		Comments    []struct {
+			Author  string `xml:"author,attr"`
+			Created string `xml:"created,attr"`
+			Text    string `xml:",chardata"`
+		} `xml:"comments>comment"`
+	} `xml:"channel>item"`
+}
+
+// ReadJiraXML reads a Jira XML export. Description and comments are kept as the HTML Jira writes.
+func ReadJiraXML(r io.Reader) ([]Issue, error) {
+	var feed jiraRSS
+	if err := xml.NewDecoder(r).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("read jira xml: %w", err)
+	}
+
+	issues := make([]Issue, 0, len(feed.Items))
+	for _, item := range feed.Items {
+		issue := Issue{
+			Key:         item.Key,
+			Title:       item.Summary,
+			Description: item.Description,
+			Status:      item.Status,
+			Labels:      item.Labels,
+		}
+		var err error
+		if issue.CreatedAt, err = parseTime(item.Created, time.UTC, jiraXMLLayouts...); err != nil {
+			return nil, fmt.Errorf("jira xml %s: created: %w", item.Key, err)
+		}
+		if issue.UpdatedAt, err = parseTime(item.Updated, time.UTC, jiraXMLLayouts...); err != nil {
+			return nil, fmt.Errorf("jira xml %s: updated: %w", item.Key, err)
+		}
+		for _, comment := range item.Comments {
+			created, err := parseTime(comment.Created, time.UTC, jiraXMLLayouts...)
+			if err != nil {
+				return nil, fmt.Errorf("jira xml %s: comment: %w", item.Key, err)
+			}
+			issue.Comments = append(issue.Comments, Comment{Author: comment.Author, Text: comment.Text, CreatedAt: created})
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
@@ -0,0 +1,105 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// trelloBoard is the part of the board JSON export (Menu → Print and export → JSON) we read
+type trelloBoard struct {
+	Lists []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"lists"`
+	Cards []struct {
+		ID               string    `json:"id"`
+		Name             string    `json:"name"`
+		Desc             string    `json:"desc"`
+		IDList           string    `json:"idList"`
+		DateLastActivity time.Time `json:"dateLastActivity"`
+		Labels           []struct {
+			Name  string `json:"name"`
+			Color string `json:"color"`
+		} `json:"labels"`
+	} `json:"cards"`
+	Actions []struct {
+		Type string    `json:"type"`
+		Date time.Time `json:"date"`
+		Data struct {
+			Text string `json:"text"`
+			Card struct {
+				ID string `json:"id"`
+			} `json:"card"`
+		} `json:"data"`
+		MemberCreator struct {
+			FullName string `json:"fullName"`
+		} `json:"memberCreator"`
+	} `json:"actions"`
+}
+
+// ReadTrello reads a Trello board export. The status is the name of the card's list,
+// comments come from the commentCard actions included in the export.
+func ReadTrello(r io.Reader) ([]Issue, error) {
+	var board trelloBoard
+	if err := json.NewDecoder(r).Decode(&board); err != nil {
+		return nil, fmt.Errorf("read trello board: %w", err)
+	}
+
+	lists := make(map[string]string, len(board.Lists))
+	for _, list := range board.Lists {
+		lists[list.ID] = list.Name
+	}
+	comments := make(map[string][]Comment)
+	for _, action := range board.Actions {
+		if action.Type != "commentCard" {
+			continue
+		}
+		comments[action.Data.Card.ID] = append(comments[action.Data.Card.ID], Comment{
+			Author:    action.MemberCreator.FullName,
+			Text:      action.Data.Text,
+			CreatedAt: action.Date,
+		})
+	}
+
+	issues := make([]Issue, 0, len(board.Cards))
+	for _, card := range board.Cards {
+		cardComments := comments[card.ID]
+		// actions are exported newest first
+		sort.SliceStable(cardComments, func(i, j int) bool { return cardComments[i].CreatedAt.Before(cardComments[j].CreatedAt) })
+
+		issue := Issue{
+			Key:         card.ID,
+			Title:       card.Name,
+			Description: card.Desc,
+			Status:      lists[card.IDList],
+			Comments:    cardComments,
+			CreatedAt:   trelloCreated(card.ID),
+			UpdatedAt:   card.DateLastActivity,
+		}
+		for _, label := range card.Labels {
+			name := label.Name
+			if name == "" {
+				name = label.Color
+			}
+			issue.Labels = append(issue.Labels, name)
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+// trelloCreated reads the creation time Trello encodes in the first 8 hex digits of an id
+func trelloCreated(id string) time.Time {
+	if len(id) < 8 {
+		return time.Time{}
+	}
+	seconds, err := strconv.ParseInt(id[:8], 16, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0).UTC()
+}
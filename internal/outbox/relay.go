@@ -0,0 +1,191 @@
+// Package outbox relays the task event log to sinks. The events are written in the
+// transaction of the task change, so a change is never committed without its event;
+// the relay then hands them to every sink at least once, in log order.
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+// Sink receives events in log order. An error makes the relay offer the same events
+// again later, so a sink must tolerate duplicates.
+type Sink interface {
+	Publish(ctx context.Context, events []domain.TaskEvent) error
+}
+
+// Committer is implemented by a durable sink that acts on a batch once the transaction
+// moving its position has committed, e.g. to wake up a worker for what it wrote
+type Committer interface {
+	Committed()
+}
+
+// Store keeps the positions of durable sinks
+type Store interface {
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+	EnsureCursor(ctx context.Context, sink string) error
+	LockCursor(ctx context.Context, sink string) (int64, bool, error)
+	SetCursor(ctx context.Context, sink string, lastEventID int64) error
+	LastEventID(ctx context.Context) (int64, error)
+}
+
+// EventSource reads the task event log, joining a transaction carried by ctx
+type EventSource interface {
+	EventsAfter(ctx context.Context, afterID int64, limit int) ([]domain.TaskEvent, error)
+}
+
+type Config struct {
+	// PollInterval is how often the log is checked for events of other processes
+	PollInterval time.Duration
+	// BatchSize is how many events a sink gets at once
+	BatchSize int
+}
+
+// Relay reads the event log after the position of every sink and publishes what it finds.
+// A durable sink keeps its position in Postgres and publishes in the same transaction
+// that moves it, so one relay at a time serves it and nothing is lost across restarts.
+// A local sink, such as the in-process bus, starts at the end of the log in every process.
+type Relay struct {
+	store  Store
+	source EventSource
+	cfg    Config
+	sinks  []*sinkState
+}
+
+type sinkState struct {
+	name    string
+	sink    Sink
+	durable bool
+	wake    chan struct{}
+	// cursor is the position of a local sink
+	cursor int64
+}
+
+func NewRelay(store Store, source EventSource, cfg Config) *Relay {
+	return &Relay{store: store, source: source, cfg: cfg}
+}
+
+// AddDurableSink registers a sink whose position is stored under name, before Run
+func (r *Relay) AddDurableSink(name string, sink Sink) {
+	r.sinks = append(r.sinks, &sinkState{name: name, sink: sink, durable: true, wake: make(chan struct{}, 1)})
+}
+
+// AddLocalSink registers a sink that only needs the events committed while the process runs, before Run
+func (r *Relay) AddLocalSink(name string, sink Sink) {
+	r.sinks = append(r.sinks, &sinkState{name: name, sink: sink, wake: make(chan struct{}, 1)})
+}
+
+// Notify tells the relay that events were committed, so it does not wait for the next poll
+func (r *Relay) Notify() {
+	for _, s := range r.sinks {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run relays to every sink until ctx is done
+func (r *Relay) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, s := range r.sinks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.runSink(ctx, s)
+		}()
+	}
+	wg.Wait()
+}
+
+func (r *Relay) runSink(ctx context.Context, s *sinkState) {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+	wait := func() bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		case <-s.wake:
+		}
+		return true
+	}
+
+	// the database may still be unreachable, keep trying
+	for {
+		err := r.start(ctx, s)
+		if err == nil {
+			break
+		}
+		if ctx.Err() == nil {
+			log.Printf("start outbox sink %s: %v", s.name, err)
+		}
+		if !wait() {
+			return
+		}
+	}
+
+	for {
+		more, err := r.relay(ctx, s)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("outbox sink %s: %v", s.name, err)
+		}
+		if err == nil && more {
+			continue
+		}
+		if !wait() {
+			return
+		}
+	}
+}
+
+func (r *Relay) start(ctx context.Context, s *sinkState) error {
+	if s.durable {
+		return r.store.EnsureCursor(ctx, s.name)
+	}
+	var err error
+	s.cursor, err = r.store.LastEventID(ctx)
+	return err
+}
+
+// relay publishes one batch to the sink and reports whether there may be more
+func (r *Relay) relay(ctx context.Context, s *sinkState) (bool, error) {
+	if !s.durable {
+		events, err := r.source.EventsAfter(ctx, s.cursor, r.cfg.BatchSize)
+		if err != nil || len(events) == 0 {
+			return false, err
+		}
+		if err := s.sink.Publish(ctx, events); err != nil {
+			return false, fmt.Errorf("publish: %w", err)
+		}
+		s.cursor = events[len(events)-1].ID
+		return len(events) == r.cfg.BatchSize, nil
+	}
+
+	var more, published bool
+	err := r.store.InTx(ctx, func(ctx context.Context) error {
+		cursor, locked, err := r.store.LockCursor(ctx, s.name)
+		if err != nil || !locked {
+			// another relay is publishing to this sink
+			return err
+		}
+		events, err := r.source.EventsAfter(ctx, cursor, r.cfg.BatchSize)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		if err := s.sink.Publish(ctx, events); err != nil {
+			return fmt.Errorf("publish: %w", err)
+		}
+		more, published = len(events) == r.cfg.BatchSize, true
+		return r.store.SetCursor(ctx, s.name, events[len(events)-1].ID)
+	})
+	if committer, ok := s.sink.(Committer); ok && err == nil && published {
+		committer.Committed()
+	}
+	return more, err
+}
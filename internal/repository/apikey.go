@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+type APIKeyRepository struct {
+	db *sql.DB
+}
+
+func NewAPIKeyRepository(db *sql.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+// Create stores the hash of a new key, the key itself is never persisted
+func (r *APIKeyRepository) Create(ctx context.Context, name, prefix, keyHash string) (*domain.APIKey, error) {
+	key := &domain.APIKey{Name: name, Prefix: prefix}
+	err := r.db.QueryRowContext(
+		ctx,
+		`INSERT INTO api_keys (name, prefix, key_hash) VALUES ($1, $2, $3) RETURNING id, created_at`,
+		name,
+		prefix,
+		keyHash,
+	).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("create api key: %w", err)
+	}
+	return key, nil
+}
+
+// Authenticate returns the id of the active key with the hash and reports whether there is one
+func (r *APIKeyRepository) Authenticate(ctx context.Context, keyHash string) (uuid.UUID, bool, error) {
+	var id uuid.UUID
+	err := r.db.QueryRowContext(
+		ctx,
+		`SELECT id FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL`,
+		keyHash,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, false, nil
+	}
+	if err != nil {
+		return uuid.Nil, false, fmt.Errorf("authenticate api key: %w", err)
+	}
+	return id, true, nil
+}
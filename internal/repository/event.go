@@ -0,0 +1,256 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+const (
+	// appendEventsChunk keeps multi-row event inserts below the bind parameter limit
+	appendEventsChunk = 1000
+	// eventsLockKey is the advisory lock that orders event ids by commit
+	eventsLockKey = 0x7461736b // "task"
+)
+
+// AppendEvents stores events in the transaction carried by ctx and returns them with
+// their ids, per-task sequence numbers and times. The advisory lock is held until
+// commit, so a reader that saw event N never sees an event with a smaller id appear later.
+//
+// The lock is global: task writes that log events commit one at a time from the moment
+// they append until their commit, and a slow transaction holds up all others. The
+// events are appended last for that reason. Relay cursors and Last-Event-ID rely on the
+// ordering; without the lock they would need a watermark below the oldest id still in
+// flight, which Postgres does not expose cheaply.
+func (r *TaskRepository) AppendEvents(ctx context.Context, events []domain.TaskEvent) ([]domain.TaskEvent, error) {
+	stored := make([]domain.TaskEvent, 0, len(events))
+	err := inTx(ctx, r.db, func(ctx context.Context, q querier) error {
+		if _, err := q.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, eventsLockKey); err != nil {
+			return fmt.Errorf("lock task events: %w", err)
+		}
+		seqs, err := nextSeqs(ctx, q, events)
+		if err != nil {
+			return err
+		}
+		for start := 0; start < len(events); start += appendEventsChunk {
+			chunk := events[start:min(start+appendEventsChunk, len(events))]
+
+			var query strings.Builder
+			query.WriteString(`INSERT INTO task_events (type, task_id, seq, title, description, status, task_created_at, task_updated_at) VALUES `)
+			args := make([]any, 0, len(chunk)*8)
+			for i, event := range chunk {
+				if i > 0 {
+					query.WriteString(", ")
+				}
+				n := len(args)
+				fmt.Fprintf(&query, "($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8)
+				task := event.Task
+				args = append(args, string(event.Type), event.TaskID, seqs[start+i], task.Title, toNullString(nonEmpty(task.Description)),
+					string(task.Status), task.CreatedAt.UTC(), task.UpdatedAt.UTC())
+			}
+			// rows come back in VALUES order for a plain multi-row insert
+			query.WriteString(` RETURNING id, occurred_at`)
+
+			rows, err := q.QueryContext(ctx, query.String(), args...)
+			if err != nil {
+				return fmt.Errorf("append task events: %w", err)
+			}
+			i := 0
+			for rows.Next() {
+				event := chunk[i]
+				event.Seq = seqs[start+i]
+				if err := rows.Scan(&event.ID, &event.OccurredAt); err != nil {
+					rows.Close()
+					return fmt.Errorf("scan task event: %w", err)
+				}
+				stored = append(stored, event)
+				i++
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return fmt.Errorf("iterate task events: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
+// nextSeqs reserves the next sequence numbers of every task in events with one upsert
+// and returns them in the order of events
+func nextSeqs(ctx context.Context, q querier, events []domain.TaskEvent) ([]int64, error) {
+	counts := make(map[uuid.UUID]int64)
+	var ids []string
+	var increments []int64
+	for _, event := range events {
+		counts[event.TaskID]++
+	}
+	for taskID, count := range counts {
+		ids = append(ids, taskID.String())
+		increments = append(increments, count)
+	}
+
+	rows, err := q.QueryContext(
+		ctx,
+		`INSERT INTO task_sequences (task_id, last_seq)
+		SELECT * FROM unnest($1::uuid[], $2::bigint[])
+		ON CONFLICT (task_id) DO UPDATE SET last_seq = task_sequences.last_seq + EXCLUDED.last_seq
+		RETURNING task_id, last_seq`,
+		pq.Array(ids),
+		pq.Array(increments),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("reserve task event seqs: %w", err)
+	}
+	defer rows.Close()
+
+	// next holds the first reserved number of each task
+	next := make(map[uuid.UUID]int64, len(ids))
+	for rows.Next() {
+		var taskID uuid.UUID
+		var last int64
+		if err := rows.Scan(&taskID, &last); err != nil {
+			return nil, fmt.Errorf("scan task event seq: %w", err)
+		}
+		next[taskID] = last - counts[taskID] + 1
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate task event seqs: %w", err)
+	}
+
+	seqs := make([]int64, len(events))
+	for i, event := range events {
+		seqs[i] = next[event.TaskID]
+		next[event.TaskID]++
+	}
+	return seqs, nil
+}
+
+// EventsAfter returns up to limit events with ids greater than afterID, oldest first
+func (r *TaskRepository) EventsAfter(ctx context.Context, afterID int64, limit int) ([]domain.TaskEvent, error) {
+	rows, err := conn(ctx, r.db).QueryContext(
+		ctx,
+		`SELECT id, type, task_id, seq, title, description, status, task_created_at, task_updated_at, occurred_at
+		FROM task_events WHERE id > $1 ORDER BY id ASC LIMIT $2`,
+		afterID,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list task events: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]domain.TaskEvent, 0)
+	for rows.Next() {
+		var event domain.TaskEvent
+		var description sql.NullString
+		task := &event.Task
+		err := rows.Scan(&event.ID, &event.Type, &event.TaskID, &event.Seq, &task.Title, &description, &task.Status,
+			&task.CreatedAt, &task.UpdatedAt, &event.OccurredAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan task event: %w", err)
+		}
+		task.ID = event.TaskID
+		task.Description = fromNullString(description)
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate task events: %w", err)
+	}
+	return events, nil
+}
+
+// TaskHistory returns up to limit of the newest events of every task in ids, grouped by
+// task and newest first within a task
+func (r *TaskRepository) TaskHistory(ctx context.Context, ids []uuid.UUID, limit int) ([]domain.TaskEvent, error) {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = id.String()
+	}
+	rows, err := conn(ctx, r.db).QueryContext(
+		ctx,
+		`SELECT id, type, task_id, seq, title, description, status, task_created_at, task_updated_at, occurred_at
+		FROM (
+			SELECT e.*, ROW_NUMBER() OVER (PARTITION BY task_id ORDER BY seq DESC) AS n
+			FROM task_events e WHERE task_id = ANY($1::uuid[])
+		) ranked
+		WHERE n <= $2 ORDER BY task_id, seq DESC`,
+		pq.Array(keys),
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list task history: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]domain.TaskEvent, 0)
+	for rows.Next() {
+		var event domain.TaskEvent
+		var description sql.NullString
+		task := &event.Task
+		err := rows.Scan(&event.ID, &event.Type, &event.TaskID, &event.Seq, &task.Title, &description, &task.Status,
+			&task.CreatedAt, &task.UpdatedAt, &event.OccurredAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan task event: %w", err)
+		}
+		task.ID = event.TaskID
+		task.Description = fromNullString(description)
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate task history: %w", err)
+	}
+	return events, nil
+}
+
+// DeleteEventsOlderThan drops events older than age and reports how many were removed.
+// Events a durable relay sink (the event file, webhooks) has not published yet are kept,
+// unless the sink has not moved for longer than age, e.g. because it was switched off. The highest removed id
+// is remembered, see EventLogBounds.
+func (r *TaskRepository) DeleteEventsOlderThan(ctx context.Context, age time.Duration) (int64, error) {
+	var deleted int64
+	err := conn(ctx, r.db).QueryRowContext(
+		ctx,
+		`WITH deleted AS (
+			DELETE FROM task_events e WHERE e.occurred_at < NOW() - make_interval(secs => $1)
+			AND NOT EXISTS (
+				SELECT 1 FROM outbox_cursors c
+				WHERE c.last_event_id < e.id AND c.updated_at >= NOW() - make_interval(secs => $1)
+			)
+			RETURNING id
+		), pruned AS (
+			UPDATE task_events_pruned SET last_event_id = GREATEST(last_event_id, (SELECT MAX(id) FROM deleted))
+			WHERE id = 1 AND EXISTS (SELECT 1 FROM deleted)
+		)
+		SELECT COUNT(*) FROM deleted`,
+		age.Seconds(),
+	).Scan(&deleted)
+	if err != nil {
+		return 0, fmt.Errorf("delete task events: %w", err)
+	}
+	return deleted, nil
+}
+
+// EventLogBounds returns the highest event id removed by retention and the id of the
+// newest event; the events between them are all still in the log
+func (r *TaskRepository) EventLogBounds(ctx context.Context) (int64, int64, error) {
+	var pruned, last int64
+	err := conn(ctx, r.db).QueryRowContext(
+		ctx,
+		`SELECT p.last_event_id, GREATEST(p.last_event_id, COALESCE((SELECT MAX(id) FROM task_events), 0))
+		FROM task_events_pruned p WHERE p.id = 1`,
+	).Scan(&pruned, &last)
+	if err != nil {
+		return 0, 0, fmt.Errorf("task event log bounds: %w", err)
+	}
+	return pruned, last, nil
+}
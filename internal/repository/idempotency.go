@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+type IdempotencyRepository struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepository(db *sql.DB) *IdempotencyRepository {
+	return &IdempotencyRepository{db: db}
+}
+
+// reserveAttempts bounds how often Reserve retries a record released while it was read
+const reserveAttempts = 3
+
+// Reserve claims the key for a new in-flight request until the lease runs out. An expired
+// record, a stored response past its TTL or a lease a crashed or stuck request did not
+// Renew, is taken over. When the key is held the existing record is returned with
+// reserved == false.
+func (r *IdempotencyRepository) Reserve(ctx context.Context, claim *domain.IdempotencyRecord, lease time.Duration) (*domain.IdempotencyRecord, bool, error) {
+	for attempt := 0; attempt < reserveAttempts; attempt++ {
+		result, err := r.db.ExecContext(
+			ctx,
+			`INSERT INTO idempotency_keys (api_key_id, key, scope, fingerprint, lock_id, expires_at)
+			VALUES ($1, $2, $3, $4, $5, NOW() + $6 * INTERVAL '1 millisecond')
+			ON CONFLICT (api_key_id, key, scope) DO UPDATE
+			SET fingerprint = EXCLUDED.fingerprint, lock_id = EXCLUDED.lock_id, status_code = NULL, content_type = NULL,
+				body = NULL, created_at = NOW(), expires_at = EXCLUDED.expires_at
+			WHERE idempotency_keys.expires_at < NOW()`,
+			claim.APIKeyID,
+			claim.Key,
+			claim.Scope,
+			claim.Fingerprint,
+			claim.LockID,
+			lease.Milliseconds(),
+		)
+		if err != nil {
+			return nil, false, fmt.Errorf("reserve idempotency key: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return nil, false, fmt.Errorf("reserve idempotency key rows: %w", err)
+		}
+		if affected > 0 {
+			return nil, true, nil
+		}
+
+		record := &domain.IdempotencyRecord{}
+		var lockID uuid.NullUUID
+		var statusCode sql.NullInt64
+		var contentType sql.NullString
+		err = r.db.QueryRowContext(
+			ctx,
+			`SELECT api_key_id, key, scope, fingerprint, lock_id, status_code, content_type, body, expires_at
+			FROM idempotency_keys WHERE api_key_id = $1 AND key = $2 AND scope = $3`,
+			claim.APIKeyID,
+			claim.Key,
+			claim.Scope,
+		).Scan(&record.APIKeyID, &record.Key, &record.Scope, &record.Fingerprint, &lockID, &statusCode, &contentType, &record.Body, &record.ExpiresAt)
+		if err == sql.ErrNoRows {
+			// released between insert and select, try to claim it again
+			continue
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("get idempotency key: %w", err)
+		}
+		record.LockID = lockID.UUID
+		record.Completed = statusCode.Valid
+		record.StatusCode = int(statusCode.Int64)
+		record.ContentType = fromNullString(contentType)
+		return record, false, nil
+	}
+	return nil, false, fmt.Errorf("reserve idempotency key: released %d times while reserving", reserveAttempts)
+}
+
+// Renew extends the lease of the in-flight claim. It does nothing when the request
+// already finished or another request took the record over.
+func (r *IdempotencyRepository) Renew(ctx context.Context, claim *domain.IdempotencyRecord, lease time.Duration) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		`UPDATE idempotency_keys SET expires_at = NOW() + $1 * INTERVAL '1 millisecond'
+		WHERE api_key_id = $2 AND key = $3 AND scope = $4 AND lock_id = $5 AND status_code IS NULL`,
+		lease.Milliseconds(),
+		claim.APIKeyID,
+		claim.Key,
+		claim.Scope,
+		claim.LockID,
+	)
+	if err != nil {
+		return fmt.Errorf("renew idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Complete stores the response and keeps it for ttl. It does nothing when another
+// request took the record over after the lease of claim ran out.
+func (r *IdempotencyRepository) Complete(ctx context.Context, claim *domain.IdempotencyRecord, ttl time.Duration) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		`UPDATE idempotency_keys SET status_code = $1, content_type = $2, body = $3, lock_id = NULL,
+			expires_at = NOW() + $4 * INTERVAL '1 millisecond'
+		WHERE api_key_id = $5 AND key = $6 AND scope = $7 AND lock_id = $8`,
+		claim.StatusCode,
+		claim.ContentType,
+		claim.Body,
+		ttl.Milliseconds(),
+		claim.APIKeyID,
+		claim.Key,
+		claim.Scope,
+		claim.LockID,
+	)
+	if err != nil {
+		return fmt.Errorf("complete idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Release drops the in-flight record of claim so the key can be used again right away
+func (r *IdempotencyRepository) Release(ctx context.Context, claim *domain.IdempotencyRecord) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		`DELETE FROM idempotency_keys WHERE api_key_id = $1 AND key = $2 AND scope = $3 AND lock_id = $4 AND status_code IS NULL`,
+		claim.APIKeyID,
+		claim.Key,
+		claim.Scope,
+		claim.LockID,
+	)
+	if err != nil {
+		return fmt.Errorf("release idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (r *IdempotencyRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at < NOW()`)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired idempotency keys: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("delete expired idempotency keys rows: %w", err)
+	}
+	return affected, nil
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// OutboxRepository keeps the positions of relay sinks in the task event log
+type OutboxRepository struct {
+	db *sql.DB
+}
+
+func NewOutboxRepository(db *sql.DB) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+// InTx runs fn in a transaction, repository calls made with the ctx passed to fn join it
+func (r *OutboxRepository) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return inTx(ctx, r.db, func(ctx context.Context, _ querier) error {
+		return fn(ctx)
+	})
+}
+
+// EnsureCursor creates the cursor of a sink seen for the first time at the end of the log
+func (r *OutboxRepository) EnsureCursor(ctx context.Context, sink string) error {
+	_, err := conn(ctx, r.db).ExecContext(
+		ctx,
+		`INSERT INTO outbox_cursors (sink, last_event_id) SELECT $1, COALESCE(MAX(id), 0) FROM task_events
+		ON CONFLICT (sink) DO NOTHING`,
+		sink,
+	)
+	if err != nil {
+		return fmt.Errorf("create outbox cursor: %w", err)
+	}
+	return nil
+}
+
+// LockCursor returns the id of the last event the sink published and locks it until the
+// transaction carried by ctx ends. It reports false when another relay holds the lock.
+func (r *OutboxRepository) LockCursor(ctx context.Context, sink string) (int64, bool, error) {
+	var lastEventID int64
+	err := conn(ctx, r.db).QueryRowContext(
+		ctx,
+		`SELECT last_event_id FROM outbox_cursors WHERE sink = $1 FOR UPDATE SKIP LOCKED`,
+		sink,
+	).Scan(&lastEventID)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("lock outbox cursor: %w", err)
+	}
+	return lastEventID, true, nil
+}
+
+func (r *OutboxRepository) SetCursor(ctx context.Context, sink string, lastEventID int64) error {
+	_, err := conn(ctx, r.db).ExecContext(
+		ctx,
+		`UPDATE outbox_cursors SET last_event_id = $1, updated_at = NOW() WHERE sink = $2`,
+		lastEventID,
+		sink,
+	)
+	if err != nil {
+		return fmt.Errorf("set outbox cursor: %w", err)
+	}
+	return nil
+}
+
+// LastEventID returns the id of the newest event in the log, 0 when it is empty
+func (r *OutboxRepository) LastEventID(ctx context.Context) (int64, error) {
+	var lastEventID int64
+	err := conn(ctx, r.db).QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM task_events`).Scan(&lastEventID)
+	if err != nil {
+		return 0, fmt.Errorf("last task event: %w", err)
+	}
+	return lastEventID, nil
+}
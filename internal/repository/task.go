@@ -4,39 +4,171 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/nightmaker00/go-tasks-api/internal/domain"
 )
 
+// createManyChunk keeps multi-row inserts well below the Postgres bind parameter limit
+const createManyChunk = 1000
+
 type TaskRepository struct {
 	db *sql.DB
 }
 
+// completedAtOnUpdate is completed_at after an update setting the status to $3: a task
+// that becomes done is completed now, one that stays done keeps its time
+const completedAtOnUpdate = `CASE WHEN $3 <> 'done' THEN NULL ELSE COALESCE(completed_at, NOW()) END`
+
 func NewTaskRepository(db *sql.DB) *TaskRepository {
 	return &TaskRepository{db: db}
 }
 
-func (r *TaskRepository) Create(ctx context.Context, id uuid.UUID, title string, description *string, status string) error {
+// Create inserts the task and reports false when a task with the same id already exists
+func (r *TaskRepository) Create(ctx context.Context, id uuid.UUID, title string, description *string, status string) (bool, error) {
 	desc := toNullString(description)
-	_, err := r.db.ExecContext(
+	result, err := conn(ctx, r.db).ExecContext(
 		ctx,
-		`INSERT INTO tasks (id, title, description, status) VALUES ($1, $2, $3, $4)`,
+		`INSERT INTO tasks (id, title, description, status, completed_at)
+		VALUES ($1, $2, $3, $4, CASE WHEN $4 = 'done' THEN NOW() END) ON CONFLICT (id) DO NOTHING`,
 		id,
 		title,
 		desc,
 		status,
 	)
 	if err != nil {
-		return fmt.Errorf("create task: %w", err)
+		return false, fmt.Errorf("create task: %w", err)
 	}
-	return nil
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("create task rows: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// InTx runs fn in a transaction, repository calls made with the ctx passed to fn join it
+func (r *TaskRepository) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return inTx(ctx, r.db, func(ctx context.Context, _ querier) error {
+		return fn(ctx)
+	})
+}
+
+// CreateMany inserts tasks with multi-row statements. The result reports per task
+// whether it was inserted, false means the id is already taken; inserted tasks get
+// their stored timestamps.
+func (r *TaskRepository) CreateMany(ctx context.Context, tasks []domain.Task) ([]bool, error) {
+	created := make([]bool, len(tasks))
+	for start := 0; start < len(tasks); start += createManyChunk {
+		end := min(start+createManyChunk, len(tasks))
+		chunk := tasks[start:end]
+
+		var query strings.Builder
+		query.WriteString(`INSERT INTO tasks (id, title, description, status, completed_at) VALUES `)
+		args := make([]any, 0, len(chunk)*4)
+		for i, task := range chunk {
+			if i > 0 {
+				query.WriteString(", ")
+			}
+			fmt.Fprintf(&query, "($%d, $%d, $%d, $%[4]d, CASE WHEN $%[4]d = 'done' THEN NOW() END)", len(args)+1, len(args)+2, len(args)+3, len(args)+4)
+			args = append(args, task.ID, task.Title, toNullString(nonEmpty(task.Description)), task.Status)
+		}
+		query.WriteString(` ON CONFLICT (id) DO NOTHING RETURNING id, created_at, updated_at`)
+
+		rows, err := conn(ctx, r.db).QueryContext(ctx, query.String(), args...)
+		if err != nil {
+			return nil, fmt.Errorf("create tasks: %w", err)
+		}
+		inserted, err := scanInserted(rows, len(chunk))
+		if err != nil {
+			return nil, err
+		}
+		for i := range chunk {
+			// a duplicate id inside one chunk is inserted once, the later copy is a conflict
+			if stored, ok := inserted[chunk[i].ID]; ok {
+				created[start+i] = true
+				chunk[i].CreatedAt, chunk[i].UpdatedAt = stored.CreatedAt, stored.UpdatedAt
+				delete(inserted, chunk[i].ID)
+			}
+		}
+	}
+	return created, nil
+}
+
+// BulkInsert loads tasks with COPY into a temporary table and moves them into tasks,
+// skipping ids that already exist. Zero timestamps become NOW(). The result reports
+// per task whether it was inserted; inserted tasks get their stored timestamps.
+func (r *TaskRepository) BulkInsert(ctx context.Context, tasks []domain.Task) ([]bool, error) {
+	created := make([]bool, len(tasks))
+	if len(tasks) == 0 {
+		return created, nil
+	}
+
+	err := inTx(ctx, r.db, func(ctx context.Context, q querier) error {
+		_, err := q.ExecContext(ctx, `CREATE TEMP TABLE IF NOT EXISTS tasks_import (
+			id UUID, title TEXT, description TEXT, status TEXT, created_at TIMESTAMP, updated_at TIMESTAMP
+		) ON COMMIT DROP`)
+		if err != nil {
+			return fmt.Errorf("create import table: %w", err)
+		}
+		if _, err := q.ExecContext(ctx, `TRUNCATE tasks_import`); err != nil {
+			return fmt.Errorf("truncate import table: %w", err)
+		}
+
+		stmt, err := q.PrepareContext(ctx, pq.CopyIn("tasks_import", "id", "title", "description", "status", "created_at", "updated_at"))
+		if err != nil {
+			return fmt.Errorf("prepare copy: %w", err)
+		}
+		for _, task := range tasks {
+			_, err := stmt.ExecContext(ctx, task.ID, task.Title, toNullString(nonEmpty(task.Description)),
+				string(task.Status), nullTime(task.CreatedAt), nullTime(task.UpdatedAt))
+			if err != nil {
+				stmt.Close()
+				return fmt.Errorf("copy task: %w", err)
+			}
+		}
+		if _, err := stmt.ExecContext(ctx); err != nil {
+			stmt.Close()
+			return fmt.Errorf("copy tasks: %w", err)
+		}
+		if err := stmt.Close(); err != nil {
+			return fmt.Errorf("close copy: %w", err)
+		}
+
+		// an imported done task counts as completed at its last change
+		rows, err := q.QueryContext(ctx, `INSERT INTO tasks (id, title, description, status, created_at, updated_at, completed_at)
+			SELECT id, title, description, status, COALESCE(created_at, NOW()), COALESCE(updated_at, created_at, NOW()),
+				CASE WHEN status = 'done' THEN COALESCE(updated_at, created_at, NOW()) END
+			FROM tasks_import
+			ON CONFLICT (id) DO NOTHING
+			RETURNING id, created_at, updated_at`)
+		if err != nil {
+			return fmt.Errorf("insert imported tasks: %w", err)
+		}
+		inserted, err := scanInserted(rows, len(tasks))
+		if err != nil {
+			return err
+		}
+		for i := range tasks {
+			var stored domain.Task
+			if stored, created[i] = inserted[tasks[i].ID]; created[i] {
+				tasks[i].CreatedAt, tasks[i].UpdatedAt = stored.CreatedAt, stored.UpdatedAt
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
 }
 
 func (r *TaskRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Task, error) {
 	task := &domain.Task{}
 	var description sql.NullString
-	err := r.db.QueryRowContext(
+	err := conn(ctx, r.db).QueryRowContext(
 		ctx,
 		`SELECT id, title, description, status, created_at, updated_at FROM tasks WHERE id = $1`,
 		id,
@@ -51,23 +183,77 @@ func (r *TaskRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Tas
 	return task, nil
 }
 
+// GetByIDs returns the tasks with the given ids in one query, missing ids are left out
+func (r *TaskRepository) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]domain.Task, error) {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = id.String()
+	}
+	rows, err := conn(ctx, r.db).QueryContext(
+		ctx,
+		`SELECT id, title, description, status, created_at, updated_at FROM tasks WHERE id = ANY($1::uuid[])`,
+		pq.Array(keys),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get tasks: %w", err)
+	}
+	defer rows.Close()
+
+	tasks := make([]domain.Task, 0, len(ids))
+	for rows.Next() {
+		var task domain.Task
+		var description sql.NullString
+		if err := rows.Scan(&task.ID, &task.Title, &description, &task.Status, &task.CreatedAt, &task.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan task: %w", err)
+		}
+		task.Description = fromNullString(description)
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate tasks: %w", err)
+	}
+	return tasks, nil
+}
+
 func (r *TaskRepository) Update(ctx context.Context, id uuid.UUID, title string, description *string, status string) (bool, error) {
-	tx, err := r.db.BeginTx(ctx, nil)
+	var affected int64
+	err := inTx(ctx, r.db, func(ctx context.Context, q querier) error {
+		desc := toNullString(description)
+		result, err := q.ExecContext(
+			ctx,
+			`UPDATE tasks SET title = $1, description = $2, status = $3, updated_at = NOW(), completed_at = `+completedAtOnUpdate+`
+			WHERE id = $4`,
+			title,
+			desc,
+			status,
+			id,
+		)
+		if err != nil {
+			return fmt.Errorf("update task: %w", err)
+		}
+		affected, err = result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("update task rows: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return false, fmt.Errorf("update task begin: %w", err)
+		return false, err
 	}
-	defer func() {
-		_ = tx.Rollback()
-	}()
+	return affected > 0, nil
+}
 
-	desc := toNullString(description)
-	result, err := tx.ExecContext(
+// UpdateIfUnmodified updates the task only when its updated_at still equals version
+func (r *TaskRepository) UpdateIfUnmodified(ctx context.Context, id uuid.UUID, version time.Time, title string, description *string, status string) (bool, error) {
+	result, err := conn(ctx, r.db).ExecContext(
 		ctx,
-		`UPDATE tasks SET title = $1, description = $2, status = $3, updated_at = NOW() WHERE id = $4`,
+		`UPDATE tasks SET title = $1, description = $2, status = $3, updated_at = NOW(), completed_at = `+completedAtOnUpdate+`
+		WHERE id = $4 AND updated_at = $5`,
 		title,
-		desc,
+		toNullString(description),
 		status,
 		id,
+		version,
 	)
 	if err != nil {
 		return false, fmt.Errorf("update task: %w", err)
@@ -76,29 +262,49 @@ func (r *TaskRepository) Update(ctx context.Context, id uuid.UUID, title string,
 	if err != nil {
 		return false, fmt.Errorf("update task rows: %w", err)
 	}
-	if err := tx.Commit(); err != nil {
-		return false, fmt.Errorf("update task commit: %w", err)
-	}
 	return affected > 0, nil
 }
 
-func (r *TaskRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	tx, err := r.db.BeginTx(ctx, nil)
+// Upsert creates or updates the task in one statement and reports whether it was inserted
+func (r *TaskRepository) Upsert(ctx context.Context, id uuid.UUID, title string, description *string, status string) (bool, error) {
+	desc := toNullString(description)
+	var inserted bool
+	err := conn(ctx, r.db).QueryRowContext(
+		ctx,
+		`INSERT INTO tasks (id, title, description, status, completed_at)
+		VALUES ($1, $2, $3, $4, CASE WHEN $4 = 'done' THEN NOW() END)
+		ON CONFLICT (id) DO UPDATE
+		SET title = EXCLUDED.title, description = EXCLUDED.description, status = EXCLUDED.status, updated_at = NOW(),
+			completed_at = CASE WHEN EXCLUDED.status <> 'done' THEN NULL ELSE COALESCE(tasks.completed_at, NOW()) END
+		RETURNING (xmax = 0)`,
+		id,
+		title,
+		desc,
+		status,
+	).Scan(&inserted)
 	if err != nil {
-		return fmt.Errorf("delete task begin: %w", err)
+		return false, fmt.Errorf("upsert task: %w", err)
 	}
-	defer func() {
-		_ = tx.Rollback()
-	}()
+	return inserted, nil
+}
 
-	_, err = tx.ExecContext(ctx, `DELETE FROM tasks WHERE id = $1`, id)
+// Delete removes the task and returns its last state, nil when there was no such task
+func (r *TaskRepository) Delete(ctx context.Context, id uuid.UUID) (*domain.Task, error) {
+	task := &domain.Task{}
+	var description sql.NullString
+	err := conn(ctx, r.db).QueryRowContext(
+		ctx,
+		`DELETE FROM tasks WHERE id = $1 RETURNING id, title, description, status, created_at, updated_at`,
+		id,
+	).Scan(&task.ID, &task.Title, &description, &task.Status, &task.CreatedAt, &task.UpdatedAt)
 	if err != nil {
-		return fmt.Errorf("delete task: %w", err)
-	}
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("delete task commit: %w", err)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("delete task: %w", err)
 	}
-	return nil
+	task.Description = fromNullString(description)
+	return task, nil
 }
 
 func (r *TaskRepository) List(ctx context.Context, status string, limit, offset int) ([]domain.TaskListItem, error) {
@@ -115,7 +321,7 @@ func (r *TaskRepository) List(ctx context.Context, status string, limit, offset
 	query = fmt.Sprintf(query, limitPos, offsetPos)
 	args = append(args, limit, offset)
 
-	rows, err := r.db.QueryContext(ctx, query, args...)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("list tasks: %w", err)
 	}
@@ -134,6 +340,153 @@ func (r *TaskRepository) List(ctx context.Context, status string, limit, offset
 	return items, nil
 }
 
+// ListVersion counts the tasks with the status and finds when they last changed: the
+// latest update of one of them or deletion of a task that had the status. The deletions are
+// found by the (type, occurred_at) and (type, status, occurred_at) indexes of task_events
+func (r *TaskRepository) ListVersion(ctx context.Context, status string) (domain.TaskListVersion, error) {
+	query := `SELECT COUNT(*), GREATEST(MAX(updated_at), (
+		SELECT MAX(occurred_at) FROM task_events WHERE type = $1%s
+	)) FROM tasks%s`
+	args := []any{string(domain.TaskEventDeleted)}
+	if status != "" {
+		query = fmt.Sprintf(query, ` AND status = $2`, ` WHERE status = $2`)
+		args = append(args, status)
+	} else {
+		query = fmt.Sprintf(query, "", "")
+	}
+
+	var version domain.TaskListVersion
+	var modified sql.NullTime
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, args...).Scan(&version.Count, &modified); err != nil {
+		return domain.TaskListVersion{}, fmt.Errorf("task list version: %w", err)
+	}
+	version.LastModified = modified.Time
+	return version, nil
+}
+
+// StatusCounts counts the tasks with the status by status, all tasks when status is empty
+func (r *TaskRepository) StatusCounts(ctx context.Context, status string) (map[domain.TaskStatus]int, error) {
+	query := `SELECT status, COUNT(*) FROM tasks`
+	args := []any{}
+	if status != "" {
+		query += ` WHERE status = $1`
+		args = append(args, status)
+	}
+	query += ` GROUP BY status`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("count tasks by status: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[domain.TaskStatus]int)
+	for rows.Next() {
+		var status domain.TaskStatus
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("scan task status count: %w", err)
+		}
+		counts[status] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate task status counts: %w", err)
+	}
+	return counts, nil
+}
+
+// Activity counts the tasks with the status created and completed in [from, to) by the
+// day or week ("day" or "week") they fall in, the periods without any are left out.
+// A task counts as completed at completed_at, when it last became done; editing a done
+// task does not move it.
+func (r *TaskRepository) Activity(ctx context.Context, status string, interval domain.StatsInterval, from, to time.Time) ([]domain.TaskStatsBucket, error) {
+	query := `SELECT to_char(date_trunc($1, at), 'YYYY-MM-DD') AS start, SUM(created), SUM(completed)
+		FROM (
+			SELECT created_at AS at, 1 AS created, 0 AS completed FROM tasks
+			WHERE created_at >= $2 AND created_at < $3%[1]s
+			UNION ALL
+			SELECT completed_at, 0, 1 FROM tasks
+			WHERE completed_at >= $2 AND completed_at < $3%[1]s
+		) activity
+		GROUP BY start ORDER BY start`
+	args := []any{string(interval), from, to}
+	if status != "" {
+		query = fmt.Sprintf(query, ` AND status = $4`)
+		args = append(args, status)
+	} else {
+		query = fmt.Sprintf(query, "")
+	}
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("count task activity: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := make([]domain.TaskStatsBucket, 0)
+	for rows.Next() {
+		var bucket domain.TaskStatsBucket
+		if err := rows.Scan(&bucket.Start, &bucket.Created, &bucket.Completed); err != nil {
+			return nil, fmt.Errorf("scan task activity: %w", err)
+		}
+		buckets = append(buckets, bucket)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate task activity: %w", err)
+	}
+	return buckets, nil
+}
+
+// Each streams full tasks ordered by id without loading them all into memory
+func (r *TaskRepository) Each(ctx context.Context, status string, fn func(task domain.Task) error) error {
+	query := `SELECT id, title, description, status, created_at, updated_at FROM tasks`
+	args := []any{}
+	if status != "" {
+		query += ` WHERE status = $1`
+		args = append(args, status)
+	}
+	query += ` ORDER BY id ASC`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("export tasks: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var task domain.Task
+		var description sql.NullString
+		if err := rows.Scan(&task.ID, &task.Title, &description, &task.Status, &task.CreatedAt, &task.UpdatedAt); err != nil {
+			return fmt.Errorf("scan exported task: %w", err)
+		}
+		task.Description = fromNullString(description)
+		if err := fn(task); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate exported tasks: %w", err)
+	}
+	return nil
+}
+
+// scanInserted reads the id and timestamps returned by an insert and closes rows
+func scanInserted(rows *sql.Rows, size int) (map[uuid.UUID]domain.Task, error) {
+	defer rows.Close()
+	inserted := make(map[uuid.UUID]domain.Task, size)
+	for rows.Next() {
+		var task domain.Task
+		if err := rows.Scan(&task.ID, &task.CreatedAt, &task.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan inserted task: %w", err)
+		}
+		inserted[task.ID] = task
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate inserted tasks: %w", err)
+	}
+	return inserted, nil
+}
+
 func toNullString(value *string) sql.NullString {
 	if value == nil {
 		return sql.NullString{Valid: false}
@@ -141,6 +494,21 @@ func toNullString(value *string) sql.NullString {
 	return sql.NullString{String: *value, Valid: true}
 }
 
+func nonEmpty(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// nullTime stores the zero time as NULL, timestamps are kept in UTC
+func nullTime(value time.Time) sql.NullTime {
+	if value.IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: value.UTC(), Valid: true}
+}
+
 func fromNullString(value sql.NullString) string {
 	if !value.Valid {
 		return ""
@@ -0,0 +1,256 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	"github.com/nightmaker00/go-tasks-api/migrations"
+	"github.com/nightmaker00/go-tasks-api/pkg/db/postgres"
+)
+
+// testDB connects to TEST_DATABASE_URL and empties its public schema, so it must point at a
+// database kept for tests. Without it the test is skipped.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if _, err := db.Exec(`DROP SCHEMA public CASCADE; CREATE SCHEMA public`); err != nil {
+		t.Fatalf("reset schema: %v", err)
+	}
+	return db
+}
+
+func migrator(t *testing.T, db *sql.DB) *postgres.Migrator {
+	t.Helper()
+	m, err := postgres.NewMigrator(db, migrations.FS)
+	if err != nil {
+		t.Fatalf("migrator: %v", err)
+	}
+	return m
+}
+
+func completedAt(t *testing.T, db *sql.DB, id uuid.UUID) *time.Time {
+	t.Helper()
+	var at sql.NullTime
+	if err := db.QueryRow(`SELECT completed_at FROM tasks WHERE id = $1`, id).Scan(&at); err != nil {
+		t.Fatalf("completed_at of %s: %v", id, err)
+	}
+	if !at.Valid {
+		return nil
+	}
+	return &at.Time
+}
+
+// TestCompletedAtSQL pins the rules the Postgres tests below check, so they are not changed
+// by accident where no test database is at hand
+func TestCompletedAtSQL(t *testing.T) {
+	if want := `CASE WHEN $3 <> 'done' THEN NULL ELSE COALESCE(completed_at, NOW()) END`; completedAtOnUpdate != want {
+		t.Errorf("completedAtOnUpdate = %s, want %s", completedAtOnUpdate, want)
+	}
+
+	up, err := migrations.FS.ReadFile("000009_task_completed_at.up.sql")
+	if err != nil {
+		t.Fatalf("read migration: %v", err)
+	}
+	for _, clause := range []string{
+		// the last event that made the task done
+		"SELECT MAX(e.occurred_at) FROM task_events e",
+		"e.status = 'done'",
+		// created done, or done after an event that was not
+		"e.type = 'task.created'",
+		"p.seq = e.seq - 1 AND p.status <> 'done'",
+		// tasks whose events retention removed
+		"t.updated_at",
+		"WHERE t.status = 'done'",
+	} {
+		if !strings.Contains(string(up), clause) {
+			t.Errorf("000009_task_completed_at.up.sql lost %q", clause)
+		}
+	}
+}
+
+func TestCompletedAtBackfill(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	m := migrator(t, db)
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	// back to the schema before completed_at, with tasks and events from that time
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	steps := 0
+	for _, status := range statuses {
+		if status.Version >= 9 && status.AppliedAt != nil {
+			steps++
+		}
+	}
+	if _, err := m.Down(ctx, steps); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+
+	at := func(value string) time.Time {
+		parsed, err := time.Parse(time.DateTime, value)
+		if err != nil {
+			t.Fatalf("time %q: %v", value, err)
+		}
+		return parsed
+	}
+	type event struct {
+		kind   string
+		status string
+		at     string
+	}
+	tasks := []struct {
+		name   string
+		status string
+		events []event
+		want   *time.Time
+	}{
+		{
+			name: "done, then edited", status: "done",
+			events: []event{{"task.created", "new", "2024-03-01 09:00:00"}, {"task.updated", "done", "2024-03-02 09:00:00"}, {"task.updated", "done", "2024-03-03 09:00:00"}},
+			want:   ptr(at("2024-03-02 09:00:00")),
+		},
+		{
+			name: "created done", status: "done",
+			events: []event{{"task.created", "done", "2024-03-01 10:00:00"}},
+			want:   ptr(at("2024-03-01 10:00:00")),
+		},
+		{
+			name: "reopened and done again", status: "done",
+			events: []event{{"task.created", "new", "2024-03-01 09:00:00"}, {"task.updated", "done", "2024-03-02 09:00:00"},
+				{"task.updated", "in_progress", "2024-03-03 09:00:00"}, {"task.updated", "done", "2024-03-04 09:00:00"}},
+			want: ptr(at("2024-03-04 09:00:00")),
+		},
+		{
+			name: "events pruned", status: "done",
+			want: ptr(at("2024-03-05 12:00:00")),
+		},
+		{
+			name: "reopened", status: "in_progress",
+			events: []event{{"task.created", "done", "2024-03-01 09:00:00"}, {"task.updated", "in_progress", "2024-03-02 09:00:00"}},
+		},
+	}
+
+	ids := make([]uuid.UUID, len(tasks))
+	for i, task := range tasks {
+		ids[i] = uuid.New()
+		// times go in as text, a time.Time would be shifted by the time zone of the session
+		_, err := db.Exec(`INSERT INTO tasks (id, title, status, created_at, updated_at) VALUES ($1, $2, $3, $4::timestamp, $4::timestamp)`,
+			ids[i], task.name, task.status, "2024-03-05 12:00:00")
+		if err != nil {
+			t.Fatalf("insert task: %v", err)
+		}
+		for seq, e := range task.events {
+			_, err := db.Exec(`INSERT INTO task_events (type, task_id, seq, title, status, task_created_at, task_updated_at, occurred_at)
+				VALUES ($1, $2, $3, $4, $5, $6::timestamp, $6::timestamp, $6::timestamp)`, e.kind, ids[i], seq+1, task.name, e.status, e.at)
+			if err != nil {
+				t.Fatalf("insert event: %v", err)
+			}
+		}
+	}
+
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	for i, task := range tasks {
+		got := completedAt(t, db, ids[i])
+		switch {
+		case task.want == nil && got != nil:
+			t.Errorf("%s: completed at %v, want none", task.name, got)
+		case task.want != nil && (got == nil || !got.Equal(*task.want)):
+			t.Errorf("%s: completed at %v, want %v", task.name, got, task.want)
+		}
+	}
+}
+
+func TestCompletedAtFollowsStatus(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	if _, err := migrator(t, db).Up(ctx); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	repo := NewTaskRepository(db)
+
+	id := uuid.New()
+	if _, err := repo.Create(ctx, id, "task", nil, string(domain.TaskStatusNew)); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if got := completedAt(t, db, id); got != nil {
+		t.Fatalf("new task completed at %v", got)
+	}
+
+	if _, err := repo.Update(ctx, id, "task", nil, string(domain.TaskStatusDone)); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	done := completedAt(t, db, id)
+	if done == nil {
+		t.Fatalf("done task has no completed_at")
+	}
+
+	// editing a done task keeps the time, also through an upsert
+	if _, err := repo.Update(ctx, id, "renamed", nil, string(domain.TaskStatusDone)); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if _, err := repo.Upsert(ctx, id, "renamed again", nil, string(domain.TaskStatusDone)); err != nil {
+		t.Fatalf("upsert: %v", err)
+	}
+	if got := completedAt(t, db, id); got == nil || !got.Equal(*done) {
+		t.Errorf("completed at %v after edits, want %v", got, done)
+	}
+
+	task, err := repo.GetByID(ctx, id)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if _, err := repo.UpdateIfUnmodified(ctx, id, task.UpdatedAt, "task", nil, string(domain.TaskStatusInProgress)); err != nil {
+		t.Fatalf("update if unmodified: %v", err)
+	}
+	if got := completedAt(t, db, id); got != nil {
+		t.Errorf("reopened task completed at %v", got)
+	}
+
+	created := uuid.New()
+	if _, err := repo.Create(ctx, created, "created done", nil, string(domain.TaskStatusDone)); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if got := completedAt(t, db, created); got == nil {
+		t.Errorf("task created done has no completed_at")
+	}
+
+	now := time.Now().UTC()
+	from := now.Add(-24 * time.Hour)
+	buckets, err := repo.Activity(ctx, "", domain.StatsIntervalDay, from, now.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("activity: %v", err)
+	}
+	var createdCount, completedCount int
+	for _, bucket := range buckets {
+		createdCount += bucket.Created
+		completedCount += bucket.Completed
+	}
+	// the reopened task is not completed, the one created done is
+	if createdCount != 2 || completedCount != 1 {
+		t.Errorf("created %d, completed %d in %+v", createdCount, completedCount, buckets)
+	}
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
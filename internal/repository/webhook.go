@@ -0,0 +1,349 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+const webhookColumns = `id, url, event_types, status, project, secret, active, consecutive_failures, disabled_at, created_at, updated_at`
+
+const deliveryColumns = `id, webhook_id, event_id, event_type, state, attempts, next_attempt_at, last_attempt_at,
+	response_status, last_error, redelivery_of, created_at, payload`
+
+type WebhookRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+func (r *WebhookRepository) Create(ctx context.Context, webhook *domain.Webhook) error {
+	err := conn(ctx, r.db).QueryRowContext(
+		ctx,
+		`INSERT INTO webhooks (id, url, event_types, status, project, secret, active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at, updated_at`,
+		webhook.ID,
+		webhook.URL,
+		pq.Array(eventTypeStrings(webhook.EventTypes)),
+		toNullString(nonEmpty(string(webhook.Status))),
+		toNullString(nonEmpty(webhook.Project)),
+		webhook.Secret,
+		webhook.Active,
+	).Scan(&webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("create webhook: %w", err)
+	}
+	return nil
+}
+
+func (r *WebhookRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Webhook, error) {
+	row := conn(ctx, r.db).QueryRowContext(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id = $1`, id)
+	webhook, err := scanWebhook(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+// List returns all webhooks, only the active ones with activeOnly
+func (r *WebhookRepository) List(ctx context.Context, activeOnly bool) ([]domain.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks`
+	if activeOnly {
+		query += ` WHERE active`
+	}
+	query += ` ORDER BY created_at ASC, id ASC`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := make([]domain.Webhook, 0)
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, *webhook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// Update replaces the settings of the webhook. Turning it active again clears the
+// failure counter, so a webhook disabled after failures gets a fresh start.
+func (r *WebhookRepository) Update(ctx context.Context, webhook *domain.Webhook) (bool, error) {
+	row := conn(ctx, r.db).QueryRowContext(
+		ctx,
+		`UPDATE webhooks SET url = $1, event_types = $2, status = $3, project = $4, secret = $5, active = $6,
+			consecutive_failures = CASE WHEN $6 AND NOT active THEN 0 ELSE consecutive_failures END,
+			disabled_at = CASE WHEN $6 THEN NULL ELSE disabled_at END,
+			updated_at = NOW()
+		WHERE id = $7
+		RETURNING `+webhookColumns,
+		webhook.URL,
+		pq.Array(eventTypeStrings(webhook.EventTypes)),
+		toNullString(nonEmpty(string(webhook.Status))),
+		toNullString(nonEmpty(webhook.Project)),
+		webhook.Secret,
+		webhook.Active,
+		webhook.ID,
+	)
+	updated, err := scanWebhook(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("update webhook: %w", err)
+	}
+	*webhook = *updated
+	return true, nil
+}
+
+func (r *WebhookRepository) Delete(ctx context.Context, id uuid.UUID) (bool, error) {
+	result, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return false, fmt.Errorf("delete webhook: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("delete webhook rows: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// Deliveries lists the deliveries of a webhook, newest first
+func (r *WebhookRepository) Deliveries(ctx context.Context, webhookID uuid.UUID, limit, offset int) ([]domain.WebhookDelivery, error) {
+	rows, err := conn(ctx, r.db).QueryContext(
+		ctx,
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE webhook_id = $1
+		ORDER BY created_at DESC, id DESC LIMIT $2 OFFSET $3`,
+		webhookID,
+		limit,
+		offset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := make([]domain.WebhookDelivery, 0)
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// Redeliver queues a new delivery with the payload of an earlier one, nil when the
+// webhook has no such delivery
+func (r *WebhookRepository) Redeliver(ctx context.Context, webhookID, deliveryID uuid.UUID) (*domain.WebhookDelivery, error) {
+	row := conn(ctx, r.db).QueryRowContext(
+		ctx,
+		`INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, payload, next_attempt_at, redelivery_of)
+		SELECT $1, webhook_id, event_id, event_type, payload, NOW(), id
+		FROM webhook_deliveries WHERE id = $2 AND webhook_id = $3
+		RETURNING `+deliveryColumns,
+		uuid.New(),
+		deliveryID,
+		webhookID,
+	)
+	delivery, err := scanDelivery(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("redeliver webhook delivery: %w", err)
+	}
+	return delivery, nil
+}
+
+// CreateDeliveries queues deliveries with multi-row statements
+func (r *WebhookRepository) CreateDeliveries(ctx context.Context, deliveries []domain.WebhookDelivery) error {
+	for start := 0; start < len(deliveries); start += createManyChunk {
+		chunk := deliveries[start:min(start+createManyChunk, len(deliveries))]
+
+		var query strings.Builder
+		query.WriteString(`INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, payload, next_attempt_at) VALUES `)
+		args := make([]any, 0, len(chunk)*5)
+		for i, delivery := range chunk {
+			if i > 0 {
+				query.WriteString(", ")
+			}
+			n := len(args)
+			fmt.Fprintf(&query, "($%d, $%d, $%d, $%d, $%d, NOW())", n+1, n+2, n+3, n+4, n+5)
+			args = append(args, delivery.ID, delivery.WebhookID, delivery.EventID, string(delivery.EventType), delivery.Payload)
+		}
+		if _, err := conn(ctx, r.db).ExecContext(ctx, query.String(), args...); err != nil {
+			return fmt.Errorf("create webhook deliveries: %w", err)
+		}
+	}
+	return nil
+}
+
+// ClaimDue picks up to limit pending deliveries that are due, of active webhooks, and
+// moves their next attempt lease into the future. Another dispatcher skips them, and
+// if this one dies mid-attempt they become due again once the lease runs out.
+func (r *WebhookRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]domain.WebhookDelivery, error) {
+	rows, err := conn(ctx, r.db).QueryContext(
+		ctx,
+		`UPDATE webhook_deliveries SET next_attempt_at = NOW() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT d.id FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+			WHERE d.state = 'pending' AND d.next_attempt_at <= NOW() AND w.active
+			ORDER BY d.next_attempt_at, d.event_id
+			LIMIT $1
+			FOR UPDATE OF d SKIP LOCKED
+		)
+		RETURNING `+deliveryColumns,
+		limit,
+		lease.Seconds(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("claim webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := make([]domain.WebhookDelivery, 0)
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan claimed delivery: %w", err)
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate claimed deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// RecordAttempt stores the outcome of an attempt; a delivery still pending is retried
+// after retryIn. A success resets the failure counter of the webhook, a failure raises
+// it and disables the webhook once it reaches disableAfter.
+func (r *WebhookRepository) RecordAttempt(ctx context.Context, delivery *domain.WebhookDelivery, retryIn time.Duration, disableAfter int) error {
+	return inTx(ctx, r.db, func(ctx context.Context, q querier) error {
+		var responseStatus sql.NullInt64
+		if delivery.ResponseStatus != nil {
+			responseStatus = sql.NullInt64{Int64: int64(*delivery.ResponseStatus), Valid: true}
+		}
+		_, err := q.ExecContext(
+			ctx,
+			`UPDATE webhook_deliveries SET state = $1, attempts = $2, last_attempt_at = NOW(),
+				next_attempt_at = CASE WHEN $1 = 'pending' THEN NOW() + make_interval(secs => $3) END,
+				response_status = $4, last_error = $5
+			WHERE id = $6`,
+			string(delivery.State),
+			delivery.Attempts,
+			retryIn.Seconds(),
+			responseStatus,
+			toNullString(nonEmpty(delivery.LastError)),
+			delivery.ID,
+		)
+		if err != nil {
+			return fmt.Errorf("record webhook attempt: %w", err)
+		}
+
+		if delivery.State == domain.WebhookDeliverySucceeded {
+			_, err = q.ExecContext(ctx, `UPDATE webhooks SET consecutive_failures = 0 WHERE id = $1`, delivery.WebhookID)
+		} else {
+			_, err = q.ExecContext(
+				ctx,
+				`UPDATE webhooks SET consecutive_failures = consecutive_failures + 1,
+					active = active AND consecutive_failures + 1 < $2,
+					disabled_at = CASE WHEN active AND consecutive_failures + 1 >= $2 THEN NOW() ELSE disabled_at END
+				WHERE id = $1`,
+				delivery.WebhookID,
+				disableAfter,
+			)
+		}
+		if err != nil {
+			return fmt.Errorf("update webhook failures: %w", err)
+		}
+		return nil
+	})
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanWebhook(row rowScanner) (*domain.Webhook, error) {
+	webhook := &domain.Webhook{}
+	var eventTypes []string
+	var status, project sql.NullString
+	var disabledAt sql.NullTime
+	err := row.Scan(&webhook.ID, &webhook.URL, pq.Array(&eventTypes), &status, &project, &webhook.Secret,
+		&webhook.Active, &webhook.ConsecutiveFailures, &disabledAt, &webhook.CreatedAt, &webhook.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	webhook.EventTypes = make([]domain.TaskEventType, len(eventTypes))
+	for i, eventType := range eventTypes {
+		webhook.EventTypes[i] = domain.TaskEventType(eventType)
+	}
+	webhook.Status = domain.TaskStatus(fromNullString(status))
+	webhook.Project = fromNullString(project)
+	if disabledAt.Valid {
+		webhook.DisabledAt = &disabledAt.Time
+	}
+	return webhook, nil
+}
+
+func scanDelivery(row rowScanner) (*domain.WebhookDelivery, error) {
+	delivery := &domain.WebhookDelivery{}
+	var nextAttempt, lastAttempt sql.NullTime
+	var responseStatus sql.NullInt64
+	var lastError sql.NullString
+	var redeliveryOf uuid.NullUUID
+	err := row.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.EventType, &delivery.State,
+		&delivery.Attempts, &nextAttempt, &lastAttempt, &responseStatus, &lastError, &redeliveryOf,
+		&delivery.CreatedAt, &delivery.Payload)
+	if err != nil {
+		return nil, err
+	}
+	if nextAttempt.Valid {
+		delivery.NextAttemptAt = &nextAttempt.Time
+	}
+	if lastAttempt.Valid {
+		delivery.LastAttemptAt = &lastAttempt.Time
+	}
+	if responseStatus.Valid {
+		status := int(responseStatus.Int64)
+		delivery.ResponseStatus = &status
+	}
+	delivery.LastError = fromNullString(lastError)
+	if redeliveryOf.Valid {
+		delivery.RedeliveryOf = &redeliveryOf.UUID
+	}
+	return delivery, nil
+}
+
+func eventTypeStrings(eventTypes []domain.TaskEventType) []string {
+	values := make([]string, len(eventTypes))
+	for i, eventType := range eventTypes {
+		values[i] = string(eventType)
+	}
+	return values
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+const (
+	defaultChangesLimit = 1000
+	maxChangesLimit     = 1000
+)
+
+var (
+	ErrInvalidChangeToken = errors.New("invalid change token")
+	ErrChangeTokenExpired = errors.New("change token expired")
+)
+
+// Changes returns the tasks changed after the token, each in its latest state or as a
+// tombstone, read from at most limit logged events. An empty token returns no changes,
+// only the token of the current end of the log to start syncing from.
+func (s *taskService) Changes(ctx context.Context, token string, limit int) (*domain.TaskChanges, error) {
+	v := &ValidationError{}
+	since, err := parseChangeToken(token)
+	if err != nil {
+		v.add("since", "invalid_token", err)
+	}
+	if limit == 0 {
+		limit = defaultChangesLimit
+	}
+	if limit < 0 || limit > maxChangesLimit {
+		v.add("limit", "out_of_range", ErrInvalidLimit)
+	}
+	if err := v.orNil(); err != nil {
+		return nil, err
+	}
+
+	initial := strings.TrimSpace(token) == ""
+	changes := &domain.TaskChanges{Upserted: []domain.Task{}, Deleted: []domain.TaskTombstone{}}
+	var events []domain.TaskEvent
+	if !initial {
+		if events, err = s.repo.EventsAfter(ctx, since, limit); err != nil {
+			return nil, err
+		}
+	}
+	// bounds are read after the events, so pruning in between is noticed
+	pruned, last, err := s.repo.EventLogBounds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if initial {
+		changes.NextToken = changeToken(last)
+		return changes, nil
+	}
+	if since < pruned || since > last {
+		return nil, ErrChangeTokenExpired
+	}
+
+	// the latest event of a task decides, tasks keep the order of their latest event
+	latest := make(map[uuid.UUID]int, len(events))
+	for i, event := range events {
+		latest[event.TaskID] = i
+	}
+	for i, event := range events {
+		if latest[event.TaskID] != i {
+			continue
+		}
+		if event.Type == domain.TaskEventDeleted {
+			changes.Deleted = append(changes.Deleted, domain.TaskTombstone{ID: event.TaskID, DeletedAt: event.OccurredAt})
+		} else {
+			changes.Upserted = append(changes.Upserted, event.Task)
+		}
+	}
+
+	changes.NextToken = changeToken(since)
+	if len(events) > 0 {
+		changes.NextToken = changeToken(events[len(events)-1].ID)
+	}
+	changes.HasMore = len(events) == limit
+	return changes, nil
+}
+
+// change tokens are event ids, clients treat them as opaque strings
+func changeToken(eventID int64) string {
+	return strconv.FormatInt(eventID, 10)
+}
+
+func parseChangeToken(token string) (int64, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(token, 10, 64)
+	if err != nil || id < 0 {
+		return 0, ErrInvalidChangeToken
+	}
+	return id, nil
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+const (
+	// maxEventsPage limits the number of events read from the log at once
+	maxEventsPage = 1000
+	// maxHistoryLimit limits the number of events returned per task by History
+	maxHistoryLimit = 100
+)
+
+var ErrInvalidEventID = errors.New("invalid event id")
+
+// EventNotifier is told after a transaction that stored events commits, so whoever
+// relays the event log does not have to wait for its next poll
+type EventNotifier interface {
+	Notify()
+}
+
+type recorderKey struct{}
+
+// eventRecorder collects the events of one transaction
+type eventRecorder struct {
+	events []domain.TaskEvent
+}
+
+func (r *eventRecorder) record(eventType domain.TaskEventType, task domain.Task) {
+	r.events = append(r.events, domain.TaskEvent{Type: eventType, TaskID: task.ID, Task: task})
+}
+
+// inTx runs fn in a transaction and appends the events fn records to the event log
+// before commit, the log is the outbox that is relayed to subscribers. A nested call
+// joins the outer transaction and its events are stored with the outer ones.
+func (s *taskService) inTx(ctx context.Context, fn func(ctx context.Context, events *eventRecorder) error) error {
+	if events, ok := ctx.Value(recorderKey{}).(*eventRecorder); ok {
+		return fn(ctx, events)
+	}
+
+	events := &eventRecorder{}
+	err := s.repo.InTx(ctx, func(ctx context.Context) error {
+		if err := fn(context.WithValue(ctx, recorderKey{}, events), events); err != nil {
+			return err
+		}
+		if len(events.events) == 0 {
+			return nil
+		}
+		_, err := s.repo.AppendEvents(ctx, events.events)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if s.notifier != nil && len(events.events) > 0 {
+		s.notifier.Notify()
+	}
+	return nil
+}
+
+// EventsAfter returns up to limit events from the log with ids greater than afterID
+func (s *taskService) EventsAfter(ctx context.Context, afterID int64, limit int) ([]domain.TaskEvent, error) {
+	v := &ValidationError{}
+	if afterID < 0 {
+		v.add("last_event_id", "out_of_range", ErrInvalidEventID)
+	}
+	if limit <= 0 || limit > maxEventsPage {
+		v.add("limit", "out_of_range", ErrInvalidLimit)
+	}
+	if err := v.orNil(); err != nil {
+		return nil, err
+	}
+	return s.repo.EventsAfter(ctx, afterID, limit)
+}
+
+// History returns up to limit of the newest logged events of each task, grouped by task
+// and newest first within a task. Events removed by retention are not returned.
+func (s *taskService) History(ctx context.Context, ids []uuid.UUID, limit int) ([]domain.TaskEvent, error) {
+	if limit <= 0 || limit > maxHistoryLimit {
+		return nil, invalidField("limit", "out_of_range", ErrInvalidLimit)
+	}
+	if len(ids) == 0 {
+		return []domain.TaskEvent{}, nil
+	}
+	return s.repo.TaskHistory(ctx, ids, limit)
+}
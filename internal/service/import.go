@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+var (
+	ErrInvalidTimestamp = errors.New("invalid timestamp")
+	errImportDryRun     = errors.New("import dry run")
+)
+
+// Import validates every record with the rules of Create, plus status and timestamps,
+// and bulk inserts the valid ones. Records whose id already exists, in the database or
+// earlier in the same import, are skipped. With dryRun the insert runs in a transaction
+// that is rolled back, so the report is exactly what a real import would produce.
+func (s *taskService) Import(ctx context.Context, records []domain.ImportRecord, dryRun bool) (*domain.ImportReport, error) {
+	report := &domain.ImportReport{DryRun: dryRun, Total: len(records), Rows: make([]domain.ImportRowReport, 0)}
+
+	tasks := make([]domain.Task, 0, len(records))
+	rows := make([]int, 0, len(records))
+	seen := make(map[uuid.UUID]struct{}, len(records))
+	for _, record := range records {
+		task, err := prepareImportRecord(record)
+		if err != nil {
+			report.Failed++
+			report.Rows = append(report.Rows, domain.ImportRowReport{
+				Row:    record.Row,
+				Result: domain.ImportRowFailed,
+				Reason: "validation failed",
+				Errors: validationFields(err),
+			})
+			continue
+		}
+		if _, ok := seen[task.ID]; ok {
+			report.Skipped++
+			report.Rows = append(report.Rows, importSkipped(record.Row, task.ID, "duplicate id in import"))
+			continue
+		}
+		seen[task.ID] = struct{}{}
+		tasks = append(tasks, task)
+		rows = append(rows, record.Row)
+	}
+
+	err := s.inTx(ctx, func(ctx context.Context, events *eventRecorder) error {
+		created, err := s.repo.BulkInsert(ctx, tasks)
+		if err != nil {
+			return err
+		}
+		for i, ok := range created {
+			if ok {
+				report.Created++
+				events.record(domain.TaskEventCreated, tasks[i])
+				continue
+			}
+			report.Skipped++
+			report.Rows = append(report.Rows, importSkipped(rows[i], tasks[i].ID, "task already exists"))
+		}
+		if dryRun {
+			return errImportDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errImportDryRun) {
+		return nil, err
+	}
+	sort.Slice(report.Rows, func(i, j int) bool { return report.Rows[i].Row < report.Rows[j].Row })
+	return report, nil
+}
+
+func prepareImportRecord(record domain.ImportRecord) (domain.Task, error) {
+	v := &ValidationError{Fields: append([]domain.FieldError(nil), record.ParseErrors...)}
+	if len(record.ParseErrors) > 0 {
+		return domain.Task{}, v
+	}
+
+	task := domain.Task{
+		Title:  strings.TrimSpace(record.Title),
+		Status: domain.TaskStatus(strings.TrimSpace(record.Status)),
+	}
+	if task.Status == "" {
+		task.Status = domain.TaskStatusNew
+	}
+	v.merge(validateTask(task.Title, string(task.Status)))
+	if desc := normalizeDescription(record.Description); desc != nil {
+		task.Description = *desc
+	}
+
+	if raw := strings.TrimSpace(record.ID); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil || id == uuid.Nil {
+			v.add("id", "invalid_uuid", ErrInvalidID)
+		}
+		task.ID = id
+	} else {
+		task.ID = uuid.New()
+	}
+
+	var err error
+	if task.CreatedAt, err = parseImportTime(record.CreatedAt); err != nil {
+		v.add("created_at", "invalid_timestamp", ErrInvalidTimestamp)
+	}
+	if task.UpdatedAt, err = parseImportTime(record.UpdatedAt); err != nil {
+		v.add("updated_at", "invalid_timestamp", ErrInvalidTimestamp)
+	}
+	return task, v.orNil()
+}
+
+// parseImportTime accepts RFC 3339 as written by the export, empty means now
+func parseImportTime(raw string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, raw)
+}
+
+func importSkipped(row int, id uuid.UUID, reason string) domain.ImportRowReport {
+	return domain.ImportRowReport{Row: row, ID: &id, Result: domain.ImportRowSkipped, Reason: reason}
+}
+
+func validationFields(err error) []domain.FieldError {
+	var v *ValidationError
+	if errors.As(err, &v) {
+		return v.Fields
+	}
+	return nil
+}
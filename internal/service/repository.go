@@ -2,15 +2,30 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/nightmaker00/go-tasks-api/internal/domain"
 )
 
 type TaskRepository interface {
-	Create(ctx context.Context, id uuid.UUID, title string, description *string, status string) error
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+	CreateMany(ctx context.Context, tasks []domain.Task) ([]bool, error)
+	BulkInsert(ctx context.Context, tasks []domain.Task) ([]bool, error)
+	Create(ctx context.Context, id uuid.UUID, title string, description *string, status string) (bool, error)
 	GetByID(ctx context.Context, id uuid.UUID) (*domain.Task, error)
+	GetByIDs(ctx context.Context, ids []uuid.UUID) ([]domain.Task, error)
 	Update(ctx context.Context, id uuid.UUID, title string, description *string, status string) (bool, error)
-	Delete(ctx context.Context, id uuid.UUID) error
+	UpdateIfUnmodified(ctx context.Context, id uuid.UUID, version time.Time, title string, description *string, status string) (bool, error)
+	Upsert(ctx context.Context, id uuid.UUID, title string, description *string, status string) (bool, error)
+	Delete(ctx context.Context, id uuid.UUID) (*domain.Task, error)
 	List(ctx context.Context, status string, limit, offset int) ([]domain.TaskListItem, error)
+	ListVersion(ctx context.Context, status string) (domain.TaskListVersion, error)
+	StatusCounts(ctx context.Context, status string) (map[domain.TaskStatus]int, error)
+	Activity(ctx context.Context, status string, interval domain.StatsInterval, from, to time.Time) ([]domain.TaskStatsBucket, error)
+	Each(ctx context.Context, status string, fn func(task domain.Task) error) error
+	AppendEvents(ctx context.Context, events []domain.TaskEvent) ([]domain.TaskEvent, error)
+	EventsAfter(ctx context.Context, afterID int64, limit int) ([]domain.TaskEvent, error)
+	TaskHistory(ctx context.Context, ids []uuid.UUID, limit int) ([]domain.TaskEvent, error)
+	EventLogBounds(ctx context.Context) (int64, int64, error)
 }
@@ -0,0 +1,447 @@
+// Package servicetest provides in-memory repositories for tests of the services and of
+// the layers built on them. They follow the semantics of the Postgres repositories.
+package servicetest
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	"github.com/nightmaker00/go-tasks-api/internal/service"
+)
+
+var _ service.TaskRepository = (*TaskRepository)(nil)
+
+type txKey struct{}
+
+// TaskRepository keeps tasks and their event log in memory. A transaction holds a lock
+// until it ends, like the advisory lock of the event log, and restores the state it
+// started with when fn fails.
+type TaskRepository struct {
+	// Now is the clock of the repository, time.Now when nil
+	Now func() time.Time
+
+	tx sync.Mutex
+	mu sync.RWMutex
+	// tasks keep their completion time in completed, like the completed_at column
+	tasks     map[uuid.UUID]domain.Task
+	completed map[uuid.UUID]time.Time
+	events    []domain.TaskEvent
+	seqs      map[uuid.UUID]int64
+	lastID    int64
+	pruned    int64
+}
+
+func NewTaskRepository() *TaskRepository {
+	return &TaskRepository{
+		tasks:     make(map[uuid.UUID]domain.Task),
+		completed: make(map[uuid.UUID]time.Time),
+		seqs:      make(map[uuid.UUID]int64),
+	}
+}
+
+// now has the microsecond precision of Postgres timestamps
+func (r *TaskRepository) now() time.Time {
+	if r.Now != nil {
+		return r.Now().UTC().Truncate(time.Microsecond)
+	}
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+type snapshot struct {
+	tasks     map[uuid.UUID]domain.Task
+	completed map[uuid.UUID]time.Time
+	events    []domain.TaskEvent
+	seqs      map[uuid.UUID]int64
+	lastID    int64
+}
+
+func (r *TaskRepository) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(txKey{}) != nil {
+		return fn(ctx)
+	}
+	r.tx.Lock()
+	defer r.tx.Unlock()
+
+	r.mu.RLock()
+	saved := snapshot{
+		tasks:     copyMap(r.tasks),
+		completed: copyMap(r.completed),
+		events:    append([]domain.TaskEvent(nil), r.events...),
+		seqs:      copyMap(r.seqs),
+		lastID:    r.lastID,
+	}
+	r.mu.RUnlock()
+
+	if err := fn(context.WithValue(ctx, txKey{}, true)); err != nil {
+		r.mu.Lock()
+		r.tasks, r.completed, r.events, r.seqs, r.lastID = saved.tasks, saved.completed, saved.events, saved.seqs, saved.lastID
+		r.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func copyMap[K comparable, V any](m map[K]V) map[K]V {
+	out := make(map[K]V, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// Put stores tasks as they are, timestamps included, without logging events
+func (r *TaskRepository) Put(tasks ...domain.Task) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, task := range tasks {
+		r.tasks[task.ID] = task
+		r.setCompleted(task.ID, task.Status, task.UpdatedAt)
+	}
+}
+
+// CompletedAt returns when the task was last completed, false when it is not done
+func (r *TaskRepository) CompletedAt(id uuid.UUID) (time.Time, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	at, ok := r.completed[id]
+	return at, ok
+}
+
+// SetCompletedAt moves the completion time of a done task, e.g. into the past for stats
+func (r *TaskRepository) SetCompletedAt(id uuid.UUID, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.completed[id]; ok {
+		r.completed[id] = at.UTC()
+	}
+}
+
+func (r *TaskRepository) setCompleted(id uuid.UUID, status domain.TaskStatus, at time.Time) {
+	switch {
+	case status != domain.TaskStatusDone:
+		delete(r.completed, id)
+	case r.completed[id].IsZero():
+		r.completed[id] = at
+	}
+}
+
+func (r *TaskRepository) Create(ctx context.Context, id uuid.UUID, title string, description *string, status string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tasks[id]; ok {
+		return false, nil
+	}
+	now := r.now()
+	r.tasks[id] = domain.Task{ID: id, Title: title, Description: deref(description), Status: domain.TaskStatus(status), CreatedAt: now, UpdatedAt: now}
+	r.setCompleted(id, domain.TaskStatus(status), now)
+	return true, nil
+}
+
+func (r *TaskRepository) CreateMany(ctx context.Context, tasks []domain.Task) ([]bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	created := make([]bool, len(tasks))
+	now := r.now()
+	for i := range tasks {
+		if _, ok := r.tasks[tasks[i].ID]; ok {
+			continue
+		}
+		tasks[i].CreatedAt, tasks[i].UpdatedAt = now, now
+		r.tasks[tasks[i].ID] = tasks[i]
+		r.setCompleted(tasks[i].ID, tasks[i].Status, now)
+		created[i] = true
+	}
+	return created, nil
+}
+
+func (r *TaskRepository) BulkInsert(ctx context.Context, tasks []domain.Task) ([]bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	created := make([]bool, len(tasks))
+	now := r.now()
+	for i := range tasks {
+		if _, ok := r.tasks[tasks[i].ID]; ok {
+			continue
+		}
+		if tasks[i].CreatedAt.IsZero() {
+			tasks[i].CreatedAt = now
+		}
+		if tasks[i].UpdatedAt.IsZero() {
+			tasks[i].UpdatedAt = tasks[i].CreatedAt
+		}
+		r.tasks[tasks[i].ID] = tasks[i]
+		r.setCompleted(tasks[i].ID, tasks[i].Status, tasks[i].UpdatedAt)
+		created[i] = true
+	}
+	return created, nil
+}
+
+func (r *TaskRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Task, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	task, ok := r.tasks[id]
+	if !ok {
+		return nil, nil
+	}
+	return &task, nil
+}
+
+func (r *TaskRepository) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]domain.Task, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tasks := make([]domain.Task, 0, len(ids))
+	for _, id := range ids {
+		if task, ok := r.tasks[id]; ok {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks, nil
+}
+
+func (r *TaskRepository) Update(ctx context.Context, id uuid.UUID, title string, description *string, status string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	task, ok := r.tasks[id]
+	if !ok {
+		return false, nil
+	}
+	now := r.now()
+	task.Title, task.Description, task.Status, task.UpdatedAt = title, deref(description), domain.TaskStatus(status), now
+	r.tasks[id] = task
+	r.setCompleted(id, task.Status, now)
+	return true, nil
+}
+
+func (r *TaskRepository) UpdateIfUnmodified(ctx context.Context, id uuid.UUID, version time.Time, title string, description *string, status string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	task, ok := r.tasks[id]
+	if !ok || !task.UpdatedAt.Equal(version) {
+		return false, nil
+	}
+	now := r.now()
+	task.Title, task.Description, task.Status, task.UpdatedAt = title, deref(description), domain.TaskStatus(status), now
+	r.tasks[id] = task
+	r.setCompleted(id, task.Status, now)
+	return true, nil
+}
+
+func (r *TaskRepository) Upsert(ctx context.Context, id uuid.UUID, title string, description *string, status string) (bool, error) {
+	r.mu.Lock()
+	_, exists := r.tasks[id]
+	r.mu.Unlock()
+	if exists {
+		_, err := r.Update(ctx, id, title, description, status)
+		return false, err
+	}
+	return r.Create(ctx, id, title, description, status)
+}
+
+func (r *TaskRepository) Delete(ctx context.Context, id uuid.UUID) (*domain.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	task, ok := r.tasks[id]
+	if !ok {
+		return nil, nil
+	}
+	delete(r.tasks, id)
+	delete(r.completed, id)
+	return &task, nil
+}
+
+// sorted returns the tasks with the status ordered by id, like ORDER BY id on uuid
+func (r *TaskRepository) sorted(status string) []domain.Task {
+	tasks := make([]domain.Task, 0, len(r.tasks))
+	for _, task := range r.tasks {
+		if status == "" || string(task.Status) == status {
+			tasks = append(tasks, task)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return strings.Compare(tasks[i].ID.String(), tasks[j].ID.String()) < 0
+	})
+	return tasks
+}
+
+func (r *TaskRepository) List(ctx context.Context, status string, limit, offset int) ([]domain.TaskListItem, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	items := make([]domain.TaskListItem, 0)
+	tasks := r.sorted(status)
+	for i := offset; i < len(tasks) && i < offset+limit; i++ {
+		items = append(items, domain.TaskListItem{ID: tasks[i].ID, Title: tasks[i].Title, Status: tasks[i].Status})
+	}
+	return items, nil
+}
+
+func (r *TaskRepository) ListVersion(ctx context.Context, status string) (domain.TaskListVersion, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var version domain.TaskListVersion
+	for _, task := range r.tasks {
+		if status == "" || string(task.Status) == status {
+			version.Count++
+			if task.UpdatedAt.After(version.LastModified) {
+				version.LastModified = task.UpdatedAt
+			}
+		}
+	}
+	for _, event := range r.events {
+		if event.Type == domain.TaskEventDeleted && (status == "" || string(event.Task.Status) == status) &&
+			event.OccurredAt.After(version.LastModified) {
+			version.LastModified = event.OccurredAt
+		}
+	}
+	return version, nil
+}
+
+func (r *TaskRepository) StatusCounts(ctx context.Context, status string) (map[domain.TaskStatus]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	counts := make(map[domain.TaskStatus]int)
+	for _, task := range r.tasks {
+		if status == "" || string(task.Status) == status {
+			counts[task.Status]++
+		}
+	}
+	return counts, nil
+}
+
+func (r *TaskRepository) Activity(ctx context.Context, status string, interval domain.StatsInterval, from, to time.Time) ([]domain.TaskStatsBucket, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	byStart := make(map[string]*domain.TaskStatsBucket)
+	bucket := func(at time.Time) *domain.TaskStatsBucket {
+		start := truncate(at.UTC(), interval).Format(time.DateOnly)
+		if byStart[start] == nil {
+			byStart[start] = &domain.TaskStatsBucket{Start: start}
+		}
+		return byStart[start]
+	}
+	for id, task := range r.tasks {
+		if status != "" && string(task.Status) != status {
+			continue
+		}
+		if !task.CreatedAt.Before(from) && task.CreatedAt.Before(to) {
+			bucket(task.CreatedAt).Created++
+		}
+		if at, ok := r.completed[id]; ok && !at.Before(from) && at.Before(to) {
+			bucket(at).Completed++
+		}
+	}
+	buckets := make([]domain.TaskStatsBucket, 0, len(byStart))
+	for _, b := range byStart {
+		buckets = append(buckets, *b)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Start < buckets[j].Start })
+	return buckets, nil
+}
+
+// truncate works like date_trunc, weeks start on Monday
+func truncate(at time.Time, interval domain.StatsInterval) time.Time {
+	day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+	if interval == domain.StatsIntervalWeek {
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return day
+}
+
+func (r *TaskRepository) Each(ctx context.Context, status string, fn func(task domain.Task) error) error {
+	r.mu.RLock()
+	tasks := r.sorted(status)
+	r.mu.RUnlock()
+	for _, task := range tasks {
+		if err := fn(task); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *TaskRepository) AppendEvents(ctx context.Context, events []domain.TaskEvent) ([]domain.TaskEvent, error) {
+	if ctx.Value(txKey{}) == nil {
+		return nil, errors.New("append task events outside a transaction")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := make([]domain.TaskEvent, 0, len(events))
+	now := r.now()
+	for _, event := range events {
+		r.lastID++
+		r.seqs[event.TaskID]++
+		event.ID, event.Seq, event.OccurredAt = r.lastID, r.seqs[event.TaskID], now
+		r.events = append(r.events, event)
+		stored = append(stored, event)
+	}
+	return stored, nil
+}
+
+func (r *TaskRepository) EventsAfter(ctx context.Context, afterID int64, limit int) ([]domain.TaskEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	events := make([]domain.TaskEvent, 0)
+	for _, event := range r.events {
+		if event.ID > afterID && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (r *TaskRepository) TaskHistory(ctx context.Context, ids []uuid.UUID, limit int) ([]domain.TaskEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	sorted := append([]uuid.UUID(nil), ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].String() < sorted[j].String() })
+	events := make([]domain.TaskEvent, 0)
+	for _, id := range sorted {
+		n := 0
+		for i := len(r.events) - 1; i >= 0 && n < limit; i-- {
+			if r.events[i].TaskID == id {
+				events = append(events, r.events[i])
+				n++
+			}
+		}
+	}
+	return events, nil
+}
+
+func (r *TaskRepository) EventLogBounds(ctx context.Context) (int64, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pruned, max(r.pruned, r.lastID), nil
+}
+
+// Prune drops the events up to and including id, like retention does
+func (r *TaskRepository) Prune(id int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kept := r.events[:0]
+	for _, event := range r.events {
+		if event.ID > id {
+			kept = append(kept, event)
+		}
+	}
+	r.events = kept
+	r.pruned = max(r.pruned, id)
+}
+
+// Events returns the whole event log, oldest first
+func (r *TaskRepository) Events() []domain.TaskEvent {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]domain.TaskEvent(nil), r.events...)
+}
+
+func deref(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
@@ -0,0 +1,284 @@
+package servicetest
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	"github.com/nightmaker00/go-tasks-api/internal/service"
+	"github.com/nightmaker00/go-tasks-api/internal/webhook"
+)
+
+var (
+	_ service.WebhookRepository = (*WebhookRepository)(nil)
+	_ webhook.Store             = (*WebhookRepository)(nil)
+)
+
+// WebhookRepository keeps webhooks and their deliveries in memory. It is also the
+// store of the dispatcher, with due times read from Now.
+type WebhookRepository struct {
+	// Now is the clock of the repository, time.Now when nil
+	Now func() time.Time
+
+	mu         sync.Mutex
+	webhooks   map[uuid.UUID]domain.Webhook
+	deliveries []domain.WebhookDelivery
+}
+
+func NewWebhookRepository() *WebhookRepository {
+	return &WebhookRepository{webhooks: make(map[uuid.UUID]domain.Webhook)}
+}
+
+func (r *WebhookRepository) now() time.Time {
+	if r.Now != nil {
+		return r.Now().UTC()
+	}
+	return time.Now().UTC()
+}
+
+func (r *WebhookRepository) Create(ctx context.Context, webhook *domain.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	webhook.CreatedAt = r.now()
+	webhook.UpdatedAt = webhook.CreatedAt
+	r.webhooks[webhook.ID] = cloneWebhook(*webhook)
+	return nil
+}
+
+func (r *WebhookRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	webhook, ok := r.webhooks[id]
+	if !ok {
+		return nil, nil
+	}
+	webhook = cloneWebhook(webhook)
+	return &webhook, nil
+}
+
+func (r *WebhookRepository) List(ctx context.Context, activeOnly bool) ([]domain.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	webhooks := make([]domain.Webhook, 0, len(r.webhooks))
+	for _, webhook := range r.webhooks {
+		if !activeOnly || webhook.Active {
+			webhooks = append(webhooks, cloneWebhook(webhook))
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		if !webhooks[i].CreatedAt.Equal(webhooks[j].CreatedAt) {
+			return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+		}
+		return webhooks[i].ID.String() < webhooks[j].ID.String()
+	})
+	return webhooks, nil
+}
+
+// Update replaces the settings; turning a webhook active again clears its failures
+func (r *WebhookRepository) Update(ctx context.Context, webhook *domain.Webhook) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current, ok := r.webhooks[webhook.ID]
+	if !ok {
+		return false, nil
+	}
+	if webhook.Active {
+		if !current.Active {
+			current.ConsecutiveFailures = 0
+		}
+		current.DisabledAt = nil
+	}
+	current.URL = webhook.URL
+	current.EventTypes = webhook.EventTypes
+	current.Status = webhook.Status
+	current.Project = webhook.Project
+	current.Secret = webhook.Secret
+	current.Active = webhook.Active
+	current.UpdatedAt = r.now()
+	r.webhooks[webhook.ID] = current
+	*webhook = cloneWebhook(current)
+	return true, nil
+}
+
+func (r *WebhookRepository) Delete(ctx context.Context, id uuid.UUID) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.webhooks[id]; !ok {
+		return false, nil
+	}
+	delete(r.webhooks, id)
+	kept := r.deliveries[:0]
+	for _, delivery := range r.deliveries {
+		if delivery.WebhookID != id {
+			kept = append(kept, delivery)
+		}
+	}
+	r.deliveries = kept
+	return true, nil
+}
+
+func (r *WebhookRepository) Deliveries(ctx context.Context, webhookID uuid.UUID, limit, offset int) ([]domain.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	deliveries := make([]domain.WebhookDelivery, 0)
+	// deliveries are kept oldest first
+	for i := len(r.deliveries) - 1; i >= 0; i-- {
+		if r.deliveries[i].WebhookID == webhookID {
+			deliveries = append(deliveries, r.deliveries[i])
+		}
+	}
+	if offset >= len(deliveries) {
+		return deliveries[:0], nil
+	}
+	deliveries = deliveries[offset:]
+	if limit < len(deliveries) {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (r *WebhookRepository) Redeliver(ctx context.Context, webhookID, deliveryID uuid.UUID) (*domain.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, delivery := range r.deliveries {
+		if delivery.ID != deliveryID || delivery.WebhookID != webhookID {
+			continue
+		}
+		now := r.now()
+		original := delivery.ID
+		redelivery := domain.WebhookDelivery{
+			ID:            uuid.New(),
+			WebhookID:     webhookID,
+			EventID:       delivery.EventID,
+			EventType:     delivery.EventType,
+			State:         domain.WebhookDeliveryPending,
+			NextAttemptAt: &now,
+			RedeliveryOf:  &original,
+			CreatedAt:     now,
+			Payload:       delivery.Payload,
+		}
+		r.deliveries = append(r.deliveries, redelivery)
+		return &redelivery, nil
+	}
+	return nil, nil
+}
+
+func (r *WebhookRepository) CreateDeliveries(ctx context.Context, deliveries []domain.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	for _, delivery := range deliveries {
+		delivery.State = domain.WebhookDeliveryPending
+		delivery.NextAttemptAt = &now
+		delivery.CreatedAt = now
+		r.deliveries = append(r.deliveries, delivery)
+	}
+	return nil
+}
+
+// ClaimDue leases the due pending deliveries of active webhooks, earliest first
+func (r *WebhookRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]domain.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	due := make([]int, 0)
+	for i, delivery := range r.deliveries {
+		if delivery.State == domain.WebhookDeliveryPending && delivery.NextAttemptAt != nil &&
+			!delivery.NextAttemptAt.After(now) && r.webhooks[delivery.WebhookID].Active {
+			due = append(due, i)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		a, b := r.deliveries[due[i]], r.deliveries[due[j]]
+		if !a.NextAttemptAt.Equal(*b.NextAttemptAt) {
+			return a.NextAttemptAt.Before(*b.NextAttemptAt)
+		}
+		return a.EventID < b.EventID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	leased := now.Add(lease)
+	claimed := make([]domain.WebhookDelivery, 0, len(due))
+	for _, i := range due {
+		r.deliveries[i].NextAttemptAt = &leased
+		claimed = append(claimed, r.deliveries[i])
+	}
+	return claimed, nil
+}
+
+// RecordAttempt stores the outcome like the Postgres repository: failures in a row
+// disable the webhook once they reach disableAfter, a success resets them
+func (r *WebhookRepository) RecordAttempt(ctx context.Context, delivery *domain.WebhookDelivery, retryIn time.Duration, disableAfter int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	for i := range r.deliveries {
+		if r.deliveries[i].ID != delivery.ID {
+			continue
+		}
+		stored := &r.deliveries[i]
+		stored.State = delivery.State
+		stored.Attempts = delivery.Attempts
+		stored.LastAttemptAt = &now
+		stored.NextAttemptAt = nil
+		if delivery.State == domain.WebhookDeliveryPending {
+			next := now.Add(retryIn)
+			stored.NextAttemptAt = &next
+		}
+		stored.ResponseStatus = delivery.ResponseStatus
+		stored.LastError = delivery.LastError
+	}
+	hook, ok := r.webhooks[delivery.WebhookID]
+	if !ok {
+		return nil
+	}
+	if delivery.State == domain.WebhookDeliverySucceeded {
+		hook.ConsecutiveFailures = 0
+	} else {
+		hook.ConsecutiveFailures++
+		if hook.Active && hook.ConsecutiveFailures >= disableAfter {
+			hook.Active = false
+			hook.DisabledAt = &now
+		}
+	}
+	r.webhooks[delivery.WebhookID] = hook
+	return nil
+}
+
+// Delivery returns the stored delivery, nil when there is none
+func (r *WebhookRepository) Delivery(id uuid.UUID) *domain.WebhookDelivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, delivery := range r.deliveries {
+		if delivery.ID == id {
+			return &delivery
+		}
+	}
+	return nil
+}
+
+// PutDelivery stores a delivery as it is, pending ones without a next attempt become due now
+func (r *WebhookRepository) PutDelivery(delivery domain.WebhookDelivery) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if delivery.CreatedAt.IsZero() {
+		delivery.CreatedAt = r.now()
+	}
+	if delivery.State == "" {
+		delivery.State = domain.WebhookDeliveryPending
+	}
+	if delivery.State == domain.WebhookDeliveryPending && delivery.NextAttemptAt == nil {
+		now := r.now()
+		delivery.NextAttemptAt = &now
+	}
+	r.deliveries = append(r.deliveries, delivery)
+}
+
+func cloneWebhook(webhook domain.Webhook) domain.Webhook {
+	webhook.EventTypes = append([]domain.TaskEventType(nil), webhook.EventTypes...)
+	return webhook
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+const (
+	// defaultStatsDays and defaultStatsWeeks are the periods covered without from
+	defaultStatsDays  = 30
+	defaultStatsWeeks = 12
+	// maxStatsBuckets bounds the days or weeks of one timeline
+	maxStatsBuckets = 366
+)
+
+// statsStatuses are always counted, the ones without tasks as 0
+var statsStatuses = []domain.TaskStatus{domain.TaskStatusNew, domain.TaskStatusInProgress, domain.TaskStatusDone}
+
+var (
+	ErrInvalidInterval = errors.New("invalid interval")
+	ErrInvalidRange    = errors.New("invalid date range")
+)
+
+// Stats counts the tasks with the status, all tasks when status is empty, and the ones
+// created and completed on each day or week from from to to, both dates included. A zero
+// to is today, a zero from covers the default period before it. With weeks the range is
+// widened to whole weeks starting on Monday.
+func (s *taskService) Stats(ctx context.Context, status string, interval domain.StatsInterval, from, to time.Time) (*domain.TaskStats, error) {
+	v := &ValidationError{}
+	if status != "" && !isValidStatus(status) {
+		v.add("status", "invalid_enum", ErrInvalidStatus)
+	}
+	if interval == "" {
+		interval = domain.StatsIntervalDay
+	}
+	step := 1
+	switch interval {
+	case domain.StatsIntervalDay:
+	case domain.StatsIntervalWeek:
+		step = 7
+	default:
+		v.add("interval", "invalid_enum", ErrInvalidInterval)
+	}
+	if err := v.orNil(); err != nil {
+		return nil, err
+	}
+
+	if to.IsZero() {
+		to = time.Now().UTC()
+	}
+	to = startOfDay(to)
+	if from.IsZero() {
+		from = to.AddDate(0, 0, 1-defaultStatsDays)
+		if interval == domain.StatsIntervalWeek {
+			from = to.AddDate(0, 0, 7*(1-defaultStatsWeeks))
+		}
+	}
+	from = startOfDay(from)
+	if interval == domain.StatsIntervalWeek {
+		from = startOfWeek(from)
+		to = startOfWeek(to).AddDate(0, 0, 6)
+	}
+	if from.After(to) {
+		return nil, invalidField("from", "out_of_range", ErrInvalidRange)
+	}
+	// weeks span whole multiples of 7 days here
+	buckets := (int(to.Sub(from).Hours()/24) + 1) / step
+	if buckets > maxStatsBuckets {
+		return nil, invalidField("from", "out_of_range", ErrInvalidRange)
+	}
+
+	counts, err := s.repo.StatusCounts(ctx, status)
+	if err != nil {
+		return nil, err
+	}
+	activity, err := s.repo.Activity(ctx, status, interval, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &domain.TaskStats{
+		ByStatus: make(map[domain.TaskStatus]int, len(statsStatuses)),
+		Interval: interval,
+		From:     from.Format(time.DateOnly),
+		To:       to.Format(time.DateOnly),
+		Timeline: make([]domain.TaskStatsBucket, 0, buckets),
+	}
+	for _, status := range statsStatuses {
+		stats.ByStatus[status] = counts[status]
+		stats.Total += counts[status]
+	}
+
+	// the repository leaves out the days and weeks without tasks
+	found := make(map[string]domain.TaskStatsBucket, len(activity))
+	for _, bucket := range activity {
+		found[bucket.Start] = bucket
+	}
+	for start := from; !start.After(to); start = start.AddDate(0, 0, step) {
+		key := start.Format(time.DateOnly)
+		bucket, ok := found[key]
+		if !ok {
+			bucket = domain.TaskStatsBucket{Start: key}
+		}
+		stats.Timeline = append(stats.Timeline, bucket)
+	}
+	return stats, nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// startOfWeek is the Monday of the week, like date_trunc('week', ...) in Postgres
+func startOfWeek(t time.Time) time.Time {
+	return t.AddDate(0, 0, -(int(t.Weekday())+6)%7)
+}
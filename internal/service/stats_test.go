@@ -0,0 +1,166 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	"github.com/nightmaker00/go-tasks-api/internal/service"
+	"github.com/nightmaker00/go-tasks-api/internal/service/servicetest"
+)
+
+// statsClock lets a test make changes at chosen times
+type statsClock struct {
+	repo *servicetest.TaskRepository
+	svc  interface {
+		Create(ctx context.Context, id uuid.UUID, title, description string) (uuid.UUID, error)
+		Update(ctx context.Context, id uuid.UUID, title string, description *string, status string) error
+		Stats(ctx context.Context, status string, interval domain.StatsInterval, from, to time.Time) (*domain.TaskStats, error)
+	}
+	now time.Time
+}
+
+func newStatsClock() *statsClock {
+	c := &statsClock{repo: servicetest.NewTaskRepository()}
+	c.repo.Now = func() time.Time { return c.now }
+	c.svc = service.NewTaskService(c.repo, nil)
+	return c
+}
+
+func (c *statsClock) create(t *testing.T, at string) uuid.UUID {
+	t.Helper()
+	c.now = mustTime(t, at)
+	id, err := c.svc.Create(context.Background(), uuid.Nil, "task", "")
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	return id
+}
+
+func (c *statsClock) update(t *testing.T, at string, id uuid.UUID, title string, status domain.TaskStatus) {
+	t.Helper()
+	c.now = mustTime(t, at)
+	if err := c.svc.Update(context.Background(), id, title, nil, string(status)); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+}
+
+func mustTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	at, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		t.Fatalf("time %q: %v", value, err)
+	}
+	return at.UTC()
+}
+
+func TestStatsCountsCompletionsWhenTasksBecomeDone(t *testing.T) {
+	c := newStatsClock()
+	a := c.create(t, "2024-03-04T09:00:00Z")
+	b := c.create(t, "2024-03-04T10:00:00Z")
+	d := c.create(t, "2024-03-04T23:59:59.999Z")
+	e := c.create(t, "2024-03-05T00:00:00Z")
+
+	// the last moment of a day and the first of the next
+	c.update(t, "2024-03-05T23:59:59.999999Z", a, "task", domain.TaskStatusDone)
+	c.update(t, "2024-03-06T00:00:00Z", b, "task", domain.TaskStatusDone)
+	// editing a done task does not complete it again
+	c.update(t, "2024-03-07T12:00:00Z", a, "renamed", domain.TaskStatusDone)
+	// done and reopened, not completed
+	c.update(t, "2024-03-06T08:00:00Z", d, "task", domain.TaskStatusDone)
+	c.update(t, "2024-03-06T09:00:00Z", d, "task", domain.TaskStatusInProgress)
+	// reopened and done again counts on the day it became done last
+	c.update(t, "2024-03-06T10:00:00Z", e, "task", domain.TaskStatusDone)
+	c.update(t, "2024-03-06T11:00:00Z", e, "task", domain.TaskStatusNew)
+	c.update(t, "2024-03-07T00:00:01Z", e, "task", domain.TaskStatusDone)
+
+	stats, err := c.svc.Stats(context.Background(), "", domain.StatsIntervalDay, mustTime(t, "2024-03-04T00:00:00Z"), mustTime(t, "2024-03-08T00:00:00Z"))
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	want := []domain.TaskStatsBucket{
+		{Start: "2024-03-04", Created: 3},
+		{Start: "2024-03-05", Created: 1, Completed: 1},
+		{Start: "2024-03-06", Completed: 1},
+		{Start: "2024-03-07", Completed: 1},
+		{Start: "2024-03-08"},
+	}
+	assertTimeline(t, stats.Timeline, want)
+	if stats.Total != 4 || stats.ByStatus[domain.TaskStatusDone] != 3 || stats.ByStatus[domain.TaskStatusInProgress] != 1 {
+		t.Errorf("total %d, by status %v", stats.Total, stats.ByStatus)
+	}
+	if at, ok := c.repo.CompletedAt(a); !ok || !at.Equal(mustTime(t, "2024-03-05T23:59:59.999999Z")) {
+		t.Errorf("completed at %v, %v", at, ok)
+	}
+
+	// a status filter keeps the completions of the tasks that have it
+	stats, err = c.svc.Stats(context.Background(), string(domain.TaskStatusInProgress), domain.StatsIntervalDay,
+		mustTime(t, "2024-03-04T00:00:00Z"), mustTime(t, "2024-03-08T00:00:00Z"))
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	assertTimeline(t, stats.Timeline, []domain.TaskStatsBucket{
+		{Start: "2024-03-04", Created: 1},
+		{Start: "2024-03-05"},
+		{Start: "2024-03-06"},
+		{Start: "2024-03-07"},
+		{Start: "2024-03-08"},
+	})
+}
+
+func TestStatsBucketsByWeek(t *testing.T) {
+	c := newStatsClock()
+	// Monday 2024-03-04 starts a week, Sunday 2024-03-10 ends it
+	a := c.create(t, "2024-03-04T00:00:00Z")
+	b := c.create(t, "2024-03-10T23:59:59Z")
+	c.create(t, "2024-03-11T00:00:00Z")
+	c.update(t, "2024-03-10T23:00:00Z", a, "task", domain.TaskStatusDone)
+	c.update(t, "2024-03-11T00:00:00Z", b, "task", domain.TaskStatusDone)
+
+	// from and to are widened to whole weeks
+	stats, err := c.svc.Stats(context.Background(), "", domain.StatsIntervalWeek, mustTime(t, "2024-03-06T00:00:00Z"), mustTime(t, "2024-03-13T00:00:00Z"))
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.From != "2024-03-04" || stats.To != "2024-03-17" {
+		t.Errorf("range %s..%s, want 2024-03-04..2024-03-17", stats.From, stats.To)
+	}
+	assertTimeline(t, stats.Timeline, []domain.TaskStatsBucket{
+		{Start: "2024-03-04", Created: 2, Completed: 1},
+		{Start: "2024-03-11", Created: 1, Completed: 1},
+	})
+}
+
+func TestStatsCountsImportedCompletions(t *testing.T) {
+	repo := servicetest.NewTaskRepository()
+	svc := service.NewTaskService(repo, nil)
+	// an imported done task was completed at its last change
+	repo.Put(domain.Task{
+		ID: uuid.New(), Title: "old", Status: domain.TaskStatusDone,
+		CreatedAt: mustTime(t, "2024-01-01T08:00:00Z"), UpdatedAt: mustTime(t, "2024-01-03T08:00:00Z"),
+	})
+
+	stats, err := svc.Stats(context.Background(), "", domain.StatsIntervalDay, mustTime(t, "2024-01-01T00:00:00Z"), mustTime(t, "2024-01-03T00:00:00Z"))
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	assertTimeline(t, stats.Timeline, []domain.TaskStatsBucket{
+		{Start: "2024-01-01", Created: 1},
+		{Start: "2024-01-02"},
+		{Start: "2024-01-03", Completed: 1},
+	})
+}
+
+func assertTimeline(t *testing.T, got, want []domain.TaskStatsBucket) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("timeline = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("timeline[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
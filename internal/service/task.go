@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/nightmaker00/go-tasks-api/internal/domain"
@@ -11,31 +12,54 @@ import (
 
 var (
 	ErrTaskNotFound  = errors.New("task not found")
+	ErrTaskExists    = errors.New("task already exists")
+	ErrTaskModified  = errors.New("task was modified")
 	ErrInvalidStatus = errors.New("invalid status")
 	ErrInvalidTitle  = errors.New("invalid title")
 	ErrInvalidLimit  = errors.New("invalid limit")
 	ErrInvalidOffset = errors.New("invalid offset")
+	ErrInvalidID     = errors.New("invalid id")
+	ErrInvalidBatch  = errors.New("invalid batch")
+	ErrInvalidOp     = errors.New("invalid operation")
+	ErrBatchAborted  = errors.New("batch aborted")
+	errBatchRollback = errors.New("batch rollback")
 	maxListLimit     = 1000
 	defaultListLimit = 100
 )
 
 type taskService struct {
-	repo TaskRepository
+	repo     TaskRepository
+	notifier EventNotifier
 }
 
-func NewTaskService(repo TaskRepository) *taskService {
-	return &taskService{repo: repo}
+// NewTaskService creates the service, notifier may be nil when no relay runs in this
+// process, a running server still picks the events up with its next poll
+func NewTaskService(repo TaskRepository, notifier EventNotifier) *taskService {
+	return &taskService{repo: repo, notifier: notifier}
 }
 
-func (s *taskService) Create(ctx context.Context, title string, description string) (uuid.UUID, error) {
+// Create stores a new task. A zero id means the server generates one.
+func (s *taskService) Create(ctx context.Context, id uuid.UUID, title string, description string) (uuid.UUID, error) {
 	title = strings.TrimSpace(title)
 	if title == "" {
-		return uuid.Nil, ErrInvalidTitle
+		return uuid.Nil, invalidField("title", "required", ErrInvalidTitle)
 	}
 
 	desc := normalizeDescription(description)
-	id := uuid.New()
-	if err := s.repo.Create(ctx, id, title, desc, string(domain.TaskStatusNew)); err != nil {
+	if id == uuid.Nil {
+		id = uuid.New()
+	}
+	err := s.inTx(ctx, func(ctx context.Context, events *eventRecorder) error {
+		created, err := s.repo.Create(ctx, id, title, desc, string(domain.TaskStatusNew))
+		if err != nil {
+			return err
+		}
+		if !created {
+			return ErrTaskExists
+		}
+		return s.recordTask(ctx, events, domain.TaskEventCreated, id)
+	})
+	if err != nil {
 		return uuid.Nil, err
 	}
 	return id, nil
@@ -52,49 +76,361 @@ func (s *taskService) GetByID(ctx context.Context, id uuid.UUID) (*domain.Task,
 	return task, nil
 }
 
+// GetByIDs returns the tasks with the given ids in one lookup, missing ids are left out
+func (s *taskService) GetByIDs(ctx context.Context, ids []uuid.UUID) ([]domain.Task, error) {
+	if len(ids) == 0 {
+		return []domain.Task{}, nil
+	}
+	return s.repo.GetByIDs(ctx, ids)
+}
+
 func (s *taskService) Update(ctx context.Context, id uuid.UUID, title string, description *string, status string) error {
 	title = strings.TrimSpace(title)
-	if title == "" {
-		return ErrInvalidTitle
+	if err := validateTask(title, status); err != nil {
+		return err
 	}
-	if !isValidStatus(status) {
-		return ErrInvalidStatus
+
+	desc := normalizeDescriptionPtr(description)
+	return s.inTx(ctx, func(ctx context.Context, events *eventRecorder) error {
+		updated, err := s.repo.Update(ctx, id, title, desc, status)
+		if err != nil {
+			return err
+		}
+		if !updated {
+			return ErrTaskNotFound
+		}
+		return s.recordTask(ctx, events, domain.TaskEventUpdated, id)
+	})
+}
+
+// UpdateIfUnmodified updates the task only while it is still in version, the updated_at
+// the caller read it with. A task changed since fails with ErrTaskModified.
+func (s *taskService) UpdateIfUnmodified(ctx context.Context, id uuid.UUID, version time.Time, title string, description *string, status string) error {
+	title = strings.TrimSpace(title)
+	if err := validateTask(title, status); err != nil {
+		return err
+	}
+
+	desc := normalizeDescriptionPtr(description)
+	return s.inTx(ctx, func(ctx context.Context, events *eventRecorder) error {
+		updated, err := s.repo.UpdateIfUnmodified(ctx, id, version, title, desc, status)
+		if err != nil {
+			return err
+		}
+		if !updated {
+			task, err := s.repo.GetByID(ctx, id)
+			if err != nil {
+				return err
+			}
+			if task == nil {
+				return ErrTaskNotFound
+			}
+			return ErrTaskModified
+		}
+		return s.recordTask(ctx, events, domain.TaskEventUpdated, id)
+	})
+}
+
+// Upsert updates the task or creates it with the given id, reporting whether it was created
+func (s *taskService) Upsert(ctx context.Context, id uuid.UUID, title string, description *string, status string) (bool, error) {
+	title = strings.TrimSpace(title)
+	if err := validateTask(title, status); err != nil {
+		return false, err
 	}
 
 	desc := normalizeDescriptionPtr(description)
-	updated, err := s.repo.Update(ctx, id, title, desc, status)
+	var created bool
+	err := s.inTx(ctx, func(ctx context.Context, events *eventRecorder) error {
+		var err error
+		if created, err = s.repo.Upsert(ctx, id, title, desc, status); err != nil {
+			return err
+		}
+		eventType := domain.TaskEventUpdated
+		if created {
+			eventType = domain.TaskEventCreated
+		}
+		return s.recordTask(ctx, events, eventType, id)
+	})
+	return created, err
+}
+
+// Delete removes the task, deleting a missing task is not an error
+func (s *taskService) Delete(ctx context.Context, id uuid.UUID) error {
+	return s.inTx(ctx, func(ctx context.Context, events *eventRecorder) error {
+		return s.deleteTask(ctx, events, id)
+	})
+}
+
+func (s *taskService) deleteTask(ctx context.Context, events *eventRecorder, id uuid.UUID) error {
+	task, err := s.repo.Delete(ctx, id)
 	if err != nil {
 		return err
 	}
-	if !updated {
-		return ErrTaskNotFound
+	if task != nil {
+		events.record(domain.TaskEventDeleted, *task)
 	}
 	return nil
 }
 
-func (s *taskService) Delete(ctx context.Context, id uuid.UUID) error {
-	err := s.repo.Delete(ctx, id)
+// recordTask records an event with the state of the task as the transaction sees it
+func (s *taskService) recordTask(ctx context.Context, events *eventRecorder, eventType domain.TaskEventType, id uuid.UUID) error {
+	task, err := s.repo.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
+	if task == nil {
+		return ErrTaskNotFound
+	}
+	events.record(eventType, *task)
 	return nil
 }
 
 func (s *taskService) List(ctx context.Context, status string, limit, offset int) ([]domain.TaskListItem, error) {
+	limit, err := listParams(status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.List(ctx, status, limit, offset)
+}
+
+// ListVersion describes the tasks List pages through with the status, it changes
+// whenever one of them is created, updated or deleted. The page is checked like in
+// List, so a request List would reject is not answered as unchanged.
+func (s *taskService) ListVersion(ctx context.Context, status string, limit, offset int) (domain.TaskListVersion, error) {
+	if _, err := listParams(status, limit, offset); err != nil {
+		return domain.TaskListVersion{}, err
+	}
+	return s.repo.ListVersion(ctx, status)
+}
+
+// listParams validates the filter and page of a list and returns the limit, the
+// default one for 0
+func listParams(status string, limit, offset int) (int, error) {
+	v := &ValidationError{}
 	if status != "" && !isValidStatus(status) {
-		return nil, ErrInvalidStatus
+		v.add("status", "invalid_enum", ErrInvalidStatus)
 	}
 	if limit == 0 {
 		limit = defaultListLimit
 	}
 	if limit < 0 || limit > maxListLimit {
-		return nil, ErrInvalidLimit
+		v.add("limit", "out_of_range", ErrInvalidLimit)
 	}
 	if offset < 0 {
-		return nil, ErrInvalidOffset
+		v.add("offset", "out_of_range", ErrInvalidOffset)
 	}
+	return limit, v.orNil()
+}
 
-	return s.repo.List(ctx, status, limit, offset)
+// Export calls fn for every task with the status, all tasks when status is empty
+func (s *taskService) Export(ctx context.Context, status string, fn func(task domain.Task) error) error {
+	if status != "" && !isValidStatus(status) {
+		return invalidField("status", "invalid_enum", ErrInvalidStatus)
+	}
+	return s.repo.Each(ctx, status, fn)
+}
+
+// Batch applies operations in order. In atomic mode a failing operation rolls back the
+// whole batch and every other operation is reported as ErrBatchAborted; in best effort
+// mode each operation succeeds or fails on its own.
+func (s *taskService) Batch(ctx context.Context, mode domain.BatchMode, ops []domain.BatchOperation) ([]domain.BatchOutcome, error) {
+	v := &ValidationError{}
+	if len(ops) == 0 {
+		v.add("operations", "required", ErrInvalidBatch)
+	}
+	if mode == "" {
+		mode = domain.BatchModeAtomic
+	}
+	if mode != domain.BatchModeAtomic && mode != domain.BatchModeBestEffort {
+		v.add("mode", "invalid_enum", ErrInvalidBatch)
+	}
+	if err := v.orNil(); err != nil {
+		return nil, err
+	}
+
+	prepared := make([]domain.BatchOperation, len(ops))
+	outcomes := make([]domain.BatchOutcome, len(ops))
+	valid := true
+	for i, op := range ops {
+		prepared[i], outcomes[i] = prepareBatchOperation(op)
+		if outcomes[i].Err != nil {
+			valid = false
+		}
+	}
+
+	if mode == domain.BatchModeBestEffort {
+		s.applyBatch(ctx, prepared, outcomes, false)
+		return outcomes, nil
+	}
+
+	if !valid {
+		abortBatch(outcomes)
+		return outcomes, nil
+	}
+	err := s.inTx(ctx, func(ctx context.Context, _ *eventRecorder) error {
+		return s.applyBatch(ctx, prepared, outcomes, true)
+	})
+	if errors.Is(err, errBatchRollback) {
+		abortBatch(outcomes)
+		return outcomes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return outcomes, nil
+}
+
+func prepareBatchOperation(op domain.BatchOperation) (domain.BatchOperation, domain.BatchOutcome) {
+	var outcome domain.BatchOutcome
+	v := &ValidationError{}
+	if op.ID != nil {
+		if *op.ID == uuid.Nil {
+			v.add("id", "invalid", ErrInvalidID)
+		}
+		outcome.ID = *op.ID
+	}
+
+	switch op.Op {
+	case domain.BatchOperationCreate:
+		if op.ID == nil {
+			id := uuid.New()
+			op.ID = &id
+			outcome.ID = id
+		}
+		op.Title = strings.TrimSpace(op.Title)
+		if op.Title == "" {
+			v.add("title", "required", ErrInvalidTitle)
+		}
+		op.Description = normalizeDescriptionPtr(op.Description)
+		op.Status = string(domain.TaskStatusNew)
+	case domain.BatchOperationUpdate:
+		if op.ID == nil {
+			v.add("id", "required", ErrInvalidID)
+		}
+		op.Title = strings.TrimSpace(op.Title)
+		v.merge(validateTask(op.Title, op.Status))
+		op.Description = normalizeDescriptionPtr(op.Description)
+	case domain.BatchOperationDelete:
+		if op.ID == nil {
+			v.add("id", "required", ErrInvalidID)
+		}
+	default:
+		v.add("op", "invalid_enum", ErrInvalidOp)
+	}
+	outcome.Err = v.orNil()
+	return op, outcome
+}
+
+// applyBatch executes valid operations, grouping consecutive creates into one insert.
+// Each operation or group runs in its own transaction unless ctx already carries one.
+// With stopOnError it returns errBatchRollback at the first failed operation.
+func (s *taskService) applyBatch(ctx context.Context, ops []domain.BatchOperation, outcomes []domain.BatchOutcome, stopOnError bool) error {
+	for i := 0; i < len(ops); {
+		if outcomes[i].Err != nil {
+			i++
+			continue
+		}
+
+		if ops[i].Op == domain.BatchOperationCreate {
+			end := i
+			tasks := make([]domain.Task, 0)
+			for end < len(ops) && ops[end].Op == domain.BatchOperationCreate && outcomes[end].Err == nil {
+				op := ops[end]
+				task := domain.Task{ID: *op.ID, Title: op.Title, Status: domain.TaskStatus(op.Status)}
+				if op.Description != nil {
+					task.Description = *op.Description
+				}
+				tasks = append(tasks, task)
+				end++
+			}
+			var created []bool
+			err := s.inTx(ctx, func(ctx context.Context, events *eventRecorder) error {
+				var err error
+				if created, err = s.repo.CreateMany(ctx, tasks); err != nil {
+					return err
+				}
+				for j, ok := range created {
+					if ok {
+						events.record(domain.TaskEventCreated, tasks[j])
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				if stopOnError {
+					return err
+				}
+				for j := i; j < end; j++ {
+					outcomes[j].Err = err
+				}
+				i = end
+				continue
+			}
+			for j, ok := range created {
+				if !ok {
+					outcomes[i+j].Err = ErrTaskExists
+					if stopOnError {
+						return errBatchRollback
+					}
+				}
+			}
+			i = end
+			continue
+		}
+
+		op := ops[i]
+		err := s.inTx(ctx, func(ctx context.Context, events *eventRecorder) error {
+			switch op.Op {
+			case domain.BatchOperationUpdate:
+				updated, err := s.repo.Update(ctx, *op.ID, op.Title, op.Description, op.Status)
+				if err != nil {
+					return err
+				}
+				if !updated {
+					return ErrTaskNotFound
+				}
+				return s.recordTask(ctx, events, domain.TaskEventUpdated, *op.ID)
+			case domain.BatchOperationDelete:
+				return s.deleteTask(ctx, events, *op.ID)
+			}
+			return nil
+		})
+		if err != nil {
+			if stopOnError && !isClientError(err) {
+				return err
+			}
+			outcomes[i].Err = err
+			if stopOnError {
+				return errBatchRollback
+			}
+		}
+		i++
+	}
+	return nil
+}
+
+// abortBatch marks every operation that did not fail itself as aborted
+func abortBatch(outcomes []domain.BatchOutcome) {
+	for i := range outcomes {
+		if outcomes[i].Err == nil {
+			outcomes[i].Err = ErrBatchAborted
+		}
+	}
+}
+
+func isClientError(err error) bool {
+	return errors.Is(err, ErrTaskNotFound) || errors.Is(err, ErrTaskExists)
+}
+
+func validateTask(title, status string) error {
+	v := &ValidationError{}
+	if title == "" {
+		v.add("title", "required", ErrInvalidTitle)
+	}
+	if !isValidStatus(status) {
+		v.add("status", "invalid_enum", ErrInvalidStatus)
+	}
+	return v.orNil()
 }
 
 func isValidStatus(status string) bool {
@@ -0,0 +1,101 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	"github.com/nightmaker00/go-tasks-api/internal/service"
+	"github.com/nightmaker00/go-tasks-api/internal/service/servicetest"
+)
+
+func TestCreateWithID(t *testing.T) {
+	existing := uuid.New()
+	tests := []struct {
+		name    string
+		id      uuid.UUID
+		title   string
+		wantErr error
+	}{
+		{name: "server generated id", title: "a"},
+		{name: "client id", id: uuid.New(), title: "a"},
+		{name: "taken id", id: existing, title: "a", wantErr: service.ErrTaskExists},
+		{name: "blank title", id: uuid.New(), title: "  ", wantErr: service.ErrInvalidTitle},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := servicetest.NewTaskRepository()
+			repo.Put(domain.Task{ID: existing, Title: "taken", Status: domain.TaskStatusNew})
+			svc := service.NewTaskService(repo, nil)
+
+			id, err := svc.Create(context.Background(), tt.id, tt.title, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Create error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if len(repo.Events()) != 0 {
+					t.Errorf("a failed create logged %d events", len(repo.Events()))
+				}
+				return
+			}
+			if tt.id != uuid.Nil && id != tt.id {
+				t.Errorf("id = %s, want %s", id, tt.id)
+			}
+			task, err := svc.GetByID(context.Background(), id)
+			if err != nil {
+				t.Fatalf("GetByID: %v", err)
+			}
+			if task.Status != domain.TaskStatusNew {
+				t.Errorf("status = %s, want new", task.Status)
+			}
+			if events := repo.Events(); len(events) != 1 || events[0].Type != domain.TaskEventCreated {
+				t.Errorf("events = %+v, want one task.created", events)
+			}
+		})
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	existing := uuid.New()
+	tests := []struct {
+		name        string
+		id          uuid.UUID
+		status      string
+		wantCreated bool
+		wantEvent   domain.TaskEventType
+		wantErr     error
+	}{
+		{name: "missing task is created", id: uuid.New(), status: "new", wantCreated: true, wantEvent: domain.TaskEventCreated},
+		{name: "existing task is updated", id: existing, status: "done", wantEvent: domain.TaskEventUpdated},
+		{name: "invalid status", id: existing, status: "later", wantErr: service.ErrInvalidStatus},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := servicetest.NewTaskRepository()
+			repo.Put(domain.Task{ID: existing, Title: "old", Status: domain.TaskStatusNew})
+			svc := service.NewTaskService(repo, nil)
+
+			created, err := svc.Upsert(context.Background(), tt.id, " title ", nil, tt.status)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Upsert error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if created != tt.wantCreated {
+				t.Errorf("created = %v, want %v", created, tt.wantCreated)
+			}
+			task, _ := repo.GetByID(context.Background(), tt.id)
+			if task == nil || task.Title != "title" || string(task.Status) != tt.status {
+				t.Errorf("task = %+v", task)
+			}
+			if events := repo.Events(); len(events) != 1 || events[0].Type != tt.wantEvent {
+				t.Errorf("events = %+v, want one %s", events, tt.wantEvent)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+// ValidationError collects every invalid field of a request. It unwraps to the
+// sentinel errors of the fields, so errors.Is(err, ErrInvalidTitle) keeps working.
+type ValidationError struct {
+	Fields []domain.FieldError
+	errs   []error
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		messages = append(messages, field.Field+": "+field.Message)
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) Unwrap() []error {
+	return e.errs
+}
+
+func (e *ValidationError) add(field, code string, err error) {
+	e.Fields = append(e.Fields, domain.FieldError{Field: field, Code: code, Message: err.Error()})
+	e.errs = append(e.errs, err)
+}
+
+func (e *ValidationError) merge(err error) {
+	if other, ok := err.(*ValidationError); ok {
+		e.Fields = append(e.Fields, other.Fields...)
+		e.errs = append(e.errs, other.errs...)
+	}
+}
+
+// orNil returns nil when no field failed, so callers can return it directly
+func (e *ValidationError) orNil() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+func invalidField(field, code string, err error) error {
+	v := &ValidationError{}
+	v.add(field, code, err)
+	return v
+}
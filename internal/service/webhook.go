@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+const (
+	webhookSecretPrefix = "whsec_"
+	minWebhookSecret    = 16
+	maxDeliveriesLimit  = 100
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrInvalidURL       = errors.New("invalid url")
+	ErrInvalidEventType = errors.New("invalid event type")
+	ErrInvalidSecret    = errors.New("invalid secret")
+	ErrForbiddenURL     = errors.New("url points to an address webhooks may not be sent to")
+)
+
+type WebhookRepository interface {
+	Create(ctx context.Context, webhook *domain.Webhook) error
+	GetByID(ctx context.Context, id uuid.UUID) (*domain.Webhook, error)
+	List(ctx context.Context, activeOnly bool) ([]domain.Webhook, error)
+	Update(ctx context.Context, webhook *domain.Webhook) (bool, error)
+	Delete(ctx context.Context, id uuid.UUID) (bool, error)
+	Deliveries(ctx context.Context, webhookID uuid.UUID, limit, offset int) ([]domain.WebhookDelivery, error)
+	Redeliver(ctx context.Context, webhookID, deliveryID uuid.UUID) (*domain.WebhookDelivery, error)
+}
+
+// WebhookTargets checks where a webhook URL points, webhook.TargetPolicy implements it
+type WebhookTargets interface {
+	CheckURL(ctx context.Context, rawURL string) error
+}
+
+type webhookService struct {
+	repo    WebhookRepository
+	targets WebhookTargets
+}
+
+func NewWebhookService(repo WebhookRepository, targets WebhookTargets) *webhookService {
+	return &webhookService{repo: repo, targets: targets}
+}
+
+// Create registers a webhook. The result carries the secret, the only time it is shown
+// unless the caller chose it.
+func (s *webhookService) Create(ctx context.Context, req domain.WebhookRequest) (*domain.Webhook, error) {
+	webhook, err := s.prepare(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	webhook.ID = uuid.New()
+	if webhook.Secret == "" {
+		if webhook.Secret, err = newWebhookSecret(); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.repo.Create(ctx, webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (s *webhookService) GetByID(ctx context.Context, id uuid.UUID) (*domain.Webhook, error) {
+	webhook, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if webhook == nil {
+		return nil, ErrWebhookNotFound
+	}
+	webhook.Secret = ""
+	return webhook, nil
+}
+
+func (s *webhookService) List(ctx context.Context) ([]domain.Webhook, error) {
+	webhooks, err := s.repo.List(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	return webhooks, nil
+}
+
+// Update replaces the settings of the webhook, a missing secret keeps the current one
+func (s *webhookService) Update(ctx context.Context, id uuid.UUID, req domain.WebhookRequest) (*domain.Webhook, error) {
+	webhook, err := s.prepare(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	webhook.ID = id
+	if webhook.Secret == "" {
+		current, err := s.repo.GetByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil {
+			return nil, ErrWebhookNotFound
+		}
+		webhook.Secret = current.Secret
+	}
+	updated, err := s.repo.Update(ctx, webhook)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, ErrWebhookNotFound
+	}
+	webhook.Secret = ""
+	return webhook, nil
+}
+
+func (s *webhookService) Delete(ctx context.Context, id uuid.UUID) error {
+	deleted, err := s.repo.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// Deliveries lists the deliveries of the webhook, newest first
+func (s *webhookService) Deliveries(ctx context.Context, webhookID uuid.UUID, limit, offset int) ([]domain.WebhookDelivery, error) {
+	v := &ValidationError{}
+	if limit == 0 {
+		limit = maxDeliveriesLimit
+	}
+	if limit < 0 || limit > maxDeliveriesLimit {
+		v.add("limit", "out_of_range", ErrInvalidLimit)
+	}
+	if offset < 0 {
+		v.add("offset", "out_of_range", ErrInvalidOffset)
+	}
+	if err := v.orNil(); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.GetByID(ctx, webhookID); err != nil {
+		return nil, err
+	}
+	return s.repo.Deliveries(ctx, webhookID, limit, offset)
+}
+
+// Redeliver queues the payload of a delivery again as a new delivery
+func (s *webhookService) Redeliver(ctx context.Context, webhookID, deliveryID uuid.UUID) (*domain.WebhookDelivery, error) {
+	if _, err := s.GetByID(ctx, webhookID); err != nil {
+		return nil, err
+	}
+	delivery, err := s.repo.Redeliver(ctx, webhookID, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if delivery == nil {
+		return nil, ErrDeliveryNotFound
+	}
+	return delivery, nil
+}
+
+// prepare validates the request; the URL must resolve only to addresses the targets allow
+func (s *webhookService) prepare(ctx context.Context, req domain.WebhookRequest) (*domain.Webhook, error) {
+	v := &ValidationError{}
+	webhook := &domain.Webhook{
+		URL:     strings.TrimSpace(req.URL),
+		Status:  domain.TaskStatus(strings.TrimSpace(req.Status)),
+		Project: strings.TrimPrefix(strings.TrimSpace(req.Project), "+"),
+		Active:  req.Active == nil || *req.Active,
+	}
+
+	target, err := url.Parse(webhook.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		v.add("url", "invalid_url", ErrInvalidURL)
+	} else if err := s.targets.CheckURL(ctx, webhook.URL); err != nil {
+		v.add("url", "forbidden_target", fmt.Errorf("%w: %v", ErrForbiddenURL, err))
+	}
+	if webhook.Status != "" && !isValidStatus(string(webhook.Status)) {
+		v.add("status", "invalid_enum", ErrInvalidStatus)
+	}
+
+	seen := make(map[domain.TaskEventType]bool)
+	for _, eventType := range req.EventTypes {
+		switch eventType {
+		case domain.TaskEventCreated, domain.TaskEventUpdated, domain.TaskEventDeleted:
+		default:
+			v.add("event_types", "invalid_enum", ErrInvalidEventType)
+			continue
+		}
+		if !seen[eventType] {
+			seen[eventType] = true
+			webhook.EventTypes = append(webhook.EventTypes, eventType)
+		}
+	}
+	if len(webhook.EventTypes) == 0 {
+		webhook.EventTypes = []domain.TaskEventType{domain.TaskEventCreated, domain.TaskEventUpdated, domain.TaskEventDeleted}
+	}
+
+	if req.Secret != nil {
+		webhook.Secret = strings.TrimSpace(*req.Secret)
+		if len(webhook.Secret) < minWebhookSecret {
+			v.add("secret", "too_short", fmt.Errorf("%w: at least %d characters", ErrInvalidSecret, minWebhookSecret))
+		}
+	}
+	return webhook, v.orNil()
+}
+
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("generate webhook secret: %w", err)
+	}
+	return webhookSecretPrefix + hex.EncodeToString(secret), nil
+}
@@ -0,0 +1,177 @@
+// Package todotxt converts tasks to and from the todo.txt line format
+// (https://github.com/todotxt/todo.txt).
+//
+// A task becomes one line: the completion marker and dates, then the title, then the
+// extras the format has no place for — desc: (URL-escaped description), status:in_progress
+// and id:. Priority, +project, @context and other key:value extras are kept in the title
+// as written, so a line read with Parse is written back the same by Format, with the
+// extras of this package moved to the end. Dates have day precision, and the update
+// time is kept only as the completion date of a done task.
+//
+// Title words Parse would take for something else get a leading backslash, which Parse
+// removes: a first word that is x or a date, and words shaped like id:, status: or desc:.
+// A word that already starts with backslashes before such a shape gets one more.
+package todotxt
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+const (
+	dateLayout = "2006-01-02"
+
+	keyID          = "id"
+	keyStatus      = "status"
+	keyDescription = "desc"
+)
+
+var (
+	priorityPrefix = regexp.MustCompile(`^\([A-Z]\) `)
+	// extraWord matches a title word that reads as an extra of this package, escaped or not
+	extraWord = regexp.MustCompile(`^\\*(` + keyID + `|` + keyStatus + `|` + keyDescription + `):.`)
+)
+
+// Format renders the task as a todo.txt line, without the trailing newline
+func Format(task domain.Task) string {
+	title := strings.Join(strings.Fields(task.Title), " ")
+	parts := make([]string, 0, 8)
+	if task.Status == domain.TaskStatusDone {
+		parts = append(parts, "x")
+		// a creation date needs a completion date before it
+		switch {
+		case !task.UpdatedAt.IsZero():
+			parts = append(parts, formatDate(task.UpdatedAt))
+		case !task.CreatedAt.IsZero():
+			parts = append(parts, formatDate(task.CreatedAt))
+		}
+	} else if priority := priorityPrefix.FindString(title); priority != "" {
+		// the priority goes before the creation date, a completed task keeps it in the text
+		parts = append(parts, strings.TrimSpace(priority))
+		title = title[len(priority):]
+	}
+	if !task.CreatedAt.IsZero() {
+		parts = append(parts, formatDate(task.CreatedAt))
+	}
+	parts = append(parts, escapeTitle(title))
+
+	if task.Description != "" {
+		parts = append(parts, keyDescription+":"+url.PathEscape(task.Description))
+	}
+	if task.Status != domain.TaskStatusNew && task.Status != domain.TaskStatusDone {
+		parts = append(parts, keyStatus+":"+string(task.Status))
+	}
+	if task.ID != uuid.Nil {
+		parts = append(parts, keyID+":"+task.ID.String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// Parse reads a todo.txt line into an import record, the caller sets Row.
+// Values the format allows but the task model does not, like a bad id, end up
+// in the record and fail its validation.
+func Parse(line string) domain.ImportRecord {
+	record := domain.ImportRecord{Status: string(domain.TaskStatusNew)}
+	tokens := strings.Fields(line)
+
+	var priority string
+	switch {
+	case len(tokens) > 0 && tokens[0] == "x":
+		record.Status = string(domain.TaskStatusDone)
+		tokens = tokens[1:]
+		// the first date of a completed task is the completion date
+		if len(tokens) > 0 && isDate(tokens[0]) {
+			record.UpdatedAt = parseDate(tokens[0])
+			tokens = tokens[1:]
+		}
+	case len(tokens) > 0 && priorityPrefix.MatchString(tokens[0]+" "):
+		priority = tokens[0]
+		tokens = tokens[1:]
+	}
+	if len(tokens) > 0 && isDate(tokens[0]) {
+		record.CreatedAt = parseDate(tokens[0])
+		tokens = tokens[1:]
+	}
+
+	text := make([]string, 0, len(tokens)+1)
+	if priority != "" {
+		text = append(text, priority)
+	}
+	for i, token := range tokens {
+		key, value, _ := strings.Cut(token, ":")
+		switch {
+		case strings.HasPrefix(token, `\`) && (i == 0 && isMarker(token) || extraWord.MatchString(token)):
+			text = append(text, token[1:])
+		case value == "":
+			text = append(text, token)
+		case key == keyID:
+			record.ID = value
+		case key == keyStatus:
+			record.Status = value
+		case key == keyDescription:
+			description, err := url.PathUnescape(value)
+			if err != nil {
+				record.ParseErrors = append(record.ParseErrors, domain.FieldError{
+					Field:   "description",
+					Code:    "invalid_escape",
+					Message: fmt.Sprintf("desc: %v", err),
+				})
+			}
+			record.Description = description
+		default:
+			text = append(text, token)
+		}
+	}
+	record.Title = strings.Join(text, " ")
+	return record
+}
+
+// escapeTitle puts a backslash before the title words Parse would not read back as text
+func escapeTitle(title string) string {
+	words := strings.Fields(title)
+	for i, word := range words {
+		if i == 0 && isMarker(word) || extraWord.MatchString(word) {
+			words[i] = `\` + word
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// isMarker reports whether the word, without leading backslashes, is x or a date,
+// which Parse reads as the completion marker or a date when it comes first
+func isMarker(word string) bool {
+	word = strings.TrimLeft(word, `\`)
+	return word == "x" || isDate(word)
+}
+
+// HasProject reports whether the title carries the +project tag, case-insensitively
+func HasProject(title, project string) bool {
+	project = strings.TrimPrefix(project, "+")
+	for _, token := range strings.Fields(title) {
+		if strings.EqualFold(token, "+"+project) {
+			return true
+		}
+	}
+	return false
+}
+
+func isDate(token string) bool {
+	_, err := time.Parse(dateLayout, token)
+	return err == nil
+}
+
+// parseDate returns a date as the RFC 3339 timestamp of its midnight in UTC
+func parseDate(token string) string {
+	t, _ := time.Parse(dateLayout, token)
+	return t.Format(time.RFC3339)
+}
+
+func formatDate(t time.Time) string {
+	return t.UTC().Format(dateLayout)
+}
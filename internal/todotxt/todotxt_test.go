@@ -0,0 +1,201 @@
+package todotxt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+)
+
+func TestRoundTrip(t *testing.T) {
+	id := uuid.MustParse("6f1c1f5e-8f5a-4b1e-9a57-6f1d9f0f6a11")
+	created := time.Date(2024, 1, 1, 15, 30, 0, 0, time.UTC)
+	updated := time.Date(2024, 1, 5, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		task domain.Task
+		line string
+	}{
+		{
+			name: "new task",
+			task: domain.Task{ID: id, Title: "(A) Call mom +family @phone due:2024-02-01", Status: domain.TaskStatusNew, CreatedAt: created, UpdatedAt: updated},
+			line: "(A) 2024-01-01 Call mom +family @phone due:2024-02-01 id:" + id.String(),
+		},
+		{
+			name: "done task with description",
+			task: domain.Task{ID: id, Title: "Pay bills", Description: "by the 10th, 100%", Status: domain.TaskStatusDone, CreatedAt: created, UpdatedAt: updated},
+			line: "x 2024-01-05 2024-01-01 Pay bills desc:by%20the%2010th%2C%20100%25 id:" + id.String(),
+		},
+		{
+			name: "in progress",
+			task: domain.Task{Title: "Write report", Status: domain.TaskStatusInProgress},
+			line: "Write report status:in_progress",
+		},
+		{
+			name: "done without a creation date",
+			task: domain.Task{Title: "Pay bills", Status: domain.TaskStatusDone, UpdatedAt: updated},
+			line: "x 2024-01-05 Pay bills",
+		},
+		{
+			name: "title starting with x",
+			task: domain.Task{Title: "x marks the spot", Status: domain.TaskStatusNew},
+			line: `\x marks the spot`,
+		},
+		{
+			name: "title starting with a date",
+			task: domain.Task{Title: "2024-03-01 deadline", Status: domain.TaskStatusNew},
+			line: `\2024-03-01 deadline`,
+		},
+		{
+			name: "done title starting with a date",
+			task: domain.Task{Title: "2024-03-01 deadline", Status: domain.TaskStatusDone, UpdatedAt: updated},
+			line: `x 2024-01-05 \2024-03-01 deadline`,
+		},
+		{
+			name: "title starting with a date after the priority",
+			task: domain.Task{Title: "(B) 2024-03-01 deadline", Status: domain.TaskStatusNew},
+			line: `(B) \2024-03-01 deadline`,
+		},
+		{
+			name: "title starting with an escaped x",
+			task: domain.Task{Title: `\x`, Status: domain.TaskStatusNew, CreatedAt: created},
+			line: `2024-01-01 \\x`,
+		},
+		{
+			name: "x later in the title",
+			task: domain.Task{Title: "Fix x 2024-01-01", Status: domain.TaskStatusNew},
+			line: "Fix x 2024-01-01",
+		},
+		{
+			name: "extras in the title",
+			task: domain.Task{ID: id, Title: `Ask about status:blocked id:42 desc:none \id:7`, Status: domain.TaskStatusInProgress},
+			line: `Ask about \status:blocked \id:42 \desc:none \\id:7 status:in_progress id:` + id.String(),
+		},
+		{
+			name: "empty keys stay text",
+			task: domain.Task{Title: "id: status:", Status: domain.TaskStatusNew},
+			line: "id: status:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line := Format(tt.task)
+			if line != tt.line {
+				t.Errorf("Format = %q, want %q", line, tt.line)
+			}
+
+			record := Parse(line)
+			if len(record.ParseErrors) > 0 {
+				t.Fatalf("Parse errors: %+v", record.ParseErrors)
+			}
+			if record.Title != tt.task.Title || record.Description != tt.task.Description || record.Status != string(tt.task.Status) {
+				t.Errorf("Parse = title %q, description %q, status %q; want %q, %q, %q",
+					record.Title, record.Description, record.Status, tt.task.Title, tt.task.Description, tt.task.Status)
+			}
+			wantID := ""
+			if tt.task.ID != uuid.Nil {
+				wantID = tt.task.ID.String()
+			}
+			if record.ID != wantID {
+				t.Errorf("id = %q, want %q", record.ID, wantID)
+			}
+			if want := dayOf(tt.task.CreatedAt); record.CreatedAt != want {
+				t.Errorf("created = %q, want %q", record.CreatedAt, want)
+			}
+			wantUpdated := ""
+			if tt.task.Status == domain.TaskStatusDone {
+				wantUpdated = dayOf(tt.task.UpdatedAt)
+			}
+			if record.UpdatedAt != wantUpdated {
+				t.Errorf("updated = %q, want %q", record.UpdatedAt, wantUpdated)
+			}
+
+			if again := Format(taskOf(t, record)); again != line {
+				t.Errorf("Format(Parse(line)) = %q, want %q", again, line)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		line string
+		want domain.ImportRecord
+	}{
+		{
+			line: "x 2024-01-05 Pay bills",
+			want: domain.ImportRecord{Title: "Pay bills", Status: "done", UpdatedAt: "2024-01-05T00:00:00Z"},
+		},
+		{
+			line: "x 2024-01-05 2024-01-01 Pay bills",
+			want: domain.ImportRecord{Title: "Pay bills", Status: "done", CreatedAt: "2024-01-01T00:00:00Z", UpdatedAt: "2024-01-05T00:00:00Z"},
+		},
+		{
+			line: "x Pay bills",
+			want: domain.ImportRecord{Title: "Pay bills", Status: "done"},
+		},
+		{
+			line: "(A) 2024-01-01 Call mom",
+			want: domain.ImportRecord{Title: "(A) Call mom", Status: "new", CreatedAt: "2024-01-01T00:00:00Z"},
+		},
+		{
+			line: "xylophone lessons",
+			want: domain.ImportRecord{Title: "xylophone lessons", Status: "new"},
+		},
+		{
+			line: `Keep \backslashes and \\x in the middle`,
+			want: domain.ImportRecord{Title: `Keep \backslashes and \\x in the middle`, Status: "new"},
+		},
+		{
+			line: "Buy milk status:unknown id:not-a-uuid",
+			want: domain.ImportRecord{Title: "Buy milk", Status: "unknown", ID: "not-a-uuid"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got := Parse(tt.line)
+			if got.Title != tt.want.Title || got.Status != tt.want.Status || got.ID != tt.want.ID ||
+				got.CreatedAt != tt.want.CreatedAt || got.UpdatedAt != tt.want.UpdatedAt {
+				t.Errorf("Parse = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if record := Parse("Buy milk desc:%zz"); len(record.ParseErrors) != 1 || record.ParseErrors[0].Field != "description" {
+		t.Errorf("bad escape: errors = %+v", record.ParseErrors)
+	}
+}
+
+func dayOf(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Truncate(24 * time.Hour).Format(time.RFC3339)
+}
+
+// taskOf turns a parsed record back into a task, as the import would
+func taskOf(t *testing.T, record domain.ImportRecord) domain.Task {
+	t.Helper()
+	task := domain.Task{Title: record.Title, Description: record.Description, Status: domain.TaskStatus(record.Status)}
+	if record.ID != "" {
+		task.ID = uuid.MustParse(record.ID)
+	}
+	for _, field := range []struct {
+		raw string
+		to  *time.Time
+	}{{record.CreatedAt, &task.CreatedAt}, {record.UpdatedAt, &task.UpdatedAt}} {
+		if field.raw == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, field.raw)
+		if err != nil {
+			t.Fatalf("parse %q: %v", field.raw, err)
+		}
+		*field.to = parsed
+	}
+	return task
+}
@@ -0,0 +1,308 @@
+// Package webhook turns task events into signed HTTP deliveries to subscribed URLs.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	"github.com/nightmaker00/go-tasks-api/internal/todotxt"
+)
+
+const (
+	// maxErrorLength bounds the error text stored with a delivery
+	maxErrorLength = 500
+	userAgent      = "go-tasks-api-webhooks"
+)
+
+// Store keeps webhooks and their deliveries
+type Store interface {
+	List(ctx context.Context, activeOnly bool) ([]domain.Webhook, error)
+	CreateDeliveries(ctx context.Context, deliveries []domain.WebhookDelivery) error
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]domain.WebhookDelivery, error)
+	RecordAttempt(ctx context.Context, delivery *domain.WebhookDelivery, retryIn time.Duration, disableAfter int) error
+}
+
+type Config struct {
+	// Workers is how many deliveries are sent at once
+	Workers int
+	// MaxAttempts is how many times a delivery is tried before it is marked failed
+	MaxAttempts int
+	// DisableAfter is how many failed attempts in a row disable a webhook
+	DisableAfter int
+	Timeout      time.Duration
+	PollInterval time.Duration
+	// BackoffBase is the delay before the first retry, it doubles up to BackoffMax
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// Targets checks every address a delivery connects to, internal ones are refused when nil
+	Targets *TargetPolicy
+}
+
+// Dispatcher queues a delivery for every matching webhook when events are logged and
+// sends the queued deliveries. It is registered as a durable outbox sink: deliveries
+// are queued in the transaction that moves its position in outbox_cursors, so pending
+// retries survive restarts and several instances can run side by side.
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	cfg    Config
+	wake   chan struct{}
+}
+
+// NewDispatcher creates a dispatcher, register it with outbox.Relay.AddDurableSink
+func NewDispatcher(store Store, cfg Config) *Dispatcher {
+	targets := cfg.Targets
+	if targets == nil {
+		targets = &TargetPolicy{resolver: net.DefaultResolver}
+	}
+	dialer := &net.Dialer{Timeout: cfg.Timeout, Control: targets.Control}
+	return &Dispatcher{
+		store: store,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			// no proxy: the address checked must be the receiver's
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				ForceAttemptHTTP2:   true,
+				MaxIdleConns:        100,
+				IdleConnTimeout:     90 * time.Second,
+				TLSHandshakeTimeout: 10 * time.Second,
+			},
+			// a redirect is answered like any other non-2xx status
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		cfg:  cfg,
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// Publish queues deliveries for the events in the transaction carried by ctx
+func (d *Dispatcher) Publish(ctx context.Context, logged []domain.TaskEvent) error {
+	webhooks, err := d.store.List(ctx, true)
+	if err != nil {
+		return err
+	}
+	var deliveries []domain.WebhookDelivery
+	for _, event := range logged {
+		var payload []byte
+		for _, webhook := range webhooks {
+			if !matches(webhook, event) {
+				continue
+			}
+			if payload == nil {
+				if payload, err = json.Marshal(event); err != nil {
+					return fmt.Errorf("encode task event %d: %w", event.ID, err)
+				}
+			}
+			deliveries = append(deliveries, domain.WebhookDelivery{
+				ID:        uuid.New(),
+				WebhookID: webhook.ID,
+				EventID:   event.ID,
+				EventType: event.Type,
+				Payload:   payload,
+			})
+		}
+	}
+	return d.store.CreateDeliveries(ctx, deliveries)
+}
+
+// Committed wakes up the delivery loop once queued deliveries can be claimed
+func (d *Dispatcher) Committed() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends due deliveries until ctx is done. Deliveries queued by other instances
+// and retries are picked up every PollInterval.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.runOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (d *Dispatcher) runOnce(ctx context.Context) {
+	for {
+		more, err := d.deliverDue(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("webhook delivery: %v", err)
+			}
+			return
+		}
+		if !more {
+			return
+		}
+	}
+}
+
+// matches checks the event against the filters of the webhook; events from before
+// the webhook was created are not sent to it
+func matches(webhook domain.Webhook, event domain.TaskEvent) bool {
+	if event.OccurredAt.Before(webhook.CreatedAt) {
+		return false
+	}
+	if webhook.Status != "" && event.Task.Status != webhook.Status {
+		return false
+	}
+	if webhook.Project != "" && !todotxt.HasProject(event.Task.Title, webhook.Project) {
+		return false
+	}
+	for _, eventType := range webhook.EventTypes {
+		if eventType == event.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// deliverDue sends one batch of due deliveries and reports whether the batch was full
+func (d *Dispatcher) deliverDue(ctx context.Context) (bool, error) {
+	batch := d.cfg.Workers * 4
+	// the lease outlasts an attempt, so only a crashed dispatcher lets it run out
+	lease := 2*d.cfg.Timeout + time.Minute
+	due, err := d.store.ClaimDue(ctx, batch, lease)
+	if err != nil {
+		return false, err
+	}
+
+	webhooks, err := d.store.List(ctx, true)
+	if err != nil {
+		return false, err
+	}
+	active := make(map[uuid.UUID]domain.Webhook, len(webhooks))
+	for _, webhook := range webhooks {
+		active[webhook.ID] = webhook
+	}
+
+	sem := make(chan struct{}, d.cfg.Workers)
+	var wg sync.WaitGroup
+	for i := range due {
+		delivery := &due[i]
+		webhook, ok := active[delivery.WebhookID]
+		if !ok {
+			// disabled or deleted since the claim, the lease keeps it until it is active again
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			d.attempt(ctx, webhook, delivery)
+		}()
+	}
+	wg.Wait()
+	return len(due) == batch, ctx.Err()
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, webhook domain.Webhook, delivery *domain.WebhookDelivery) {
+	status, err := d.send(ctx, webhook.URL, webhook.Secret, delivery)
+	if ctx.Err() != nil {
+		// shutting down, the lease runs out and the attempt is made again
+		return
+	}
+	delivery.Attempts++
+	delivery.ResponseStatus = nil
+	delivery.LastError = ""
+	if status != 0 {
+		delivery.ResponseStatus = &status
+	}
+	var retryIn time.Duration
+	switch {
+	case err == nil:
+		delivery.State = domain.WebhookDeliverySucceeded
+	case delivery.Attempts >= d.cfg.MaxAttempts:
+		delivery.State = domain.WebhookDeliveryFailed
+		delivery.LastError = truncate(err.Error())
+	default:
+		delivery.State = domain.WebhookDeliveryPending
+		delivery.LastError = truncate(err.Error())
+		retryIn = d.backoff(delivery.Attempts)
+	}
+	if err := d.store.RecordAttempt(ctx, delivery, retryIn, d.cfg.DisableAfter); err != nil {
+		log.Printf("record webhook delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// send posts the payload and returns the response status, an error for anything but 2xx
+func (d *Dispatcher) send(ctx context.Context, url, secret string, delivery *domain.WebhookDelivery) (int, error) {
+	req, err := NewRequest(ctx, url, secret, delivery, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// drain a little so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay before the retry after attempt n: BackoffBase doubled for
+// every earlier attempt, capped at BackoffMax, with up to 20% jitter either way
+func (d *Dispatcher) backoff(n int) time.Duration {
+	delay := d.cfg.BackoffBase
+	for i := 1; i < n && delay < d.cfg.BackoffMax; i++ {
+		delay *= 2
+	}
+	delay = min(delay, d.cfg.BackoffMax)
+	jitter := time.Duration(rand.Int64N(int64(delay)/5*2+1)) - delay/5
+	return delay + jitter
+}
+
+// NewRequest builds the signed delivery request
+func NewRequest(ctx context.Context, url, secret string, delivery *domain.WebhookDelivery, now time.Time) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return nil, fmt.Errorf("build webhook request: %w", err)
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(EventHeader, string(delivery.EventType))
+	req.Header.Set(DeliveryHeader, delivery.ID.String())
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(secret, timestamp, delivery.Payload))
+	return req, nil
+}
+
+func truncate(message string) string {
+	if len(message) <= maxErrorLength {
+		return message
+	}
+	return strings.ToValidUTF8(message[:maxErrorLength], "")
+}
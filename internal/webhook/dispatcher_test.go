@@ -0,0 +1,425 @@
+package webhook_test
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/domain"
+	"github.com/nightmaker00/go-tasks-api/internal/service/servicetest"
+	"github.com/nightmaker00/go-tasks-api/internal/webhook"
+)
+
+const testSecret = "whsec_0123456789abcdef"
+
+// clock is the time of the webhook repository, tests move it past the retry delays
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// receiver answers deliveries with the statuses in order, repeating the last one
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests []receivedRequest
+}
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	r := &receiver{statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		r.requests = append(r.requests, receivedRequest{header: req.Header.Clone(), body: body})
+		status := r.statuses[min(len(r.requests), len(r.statuses))-1]
+		r.mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) received() []receivedRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedRequest(nil), r.requests...)
+}
+
+type dispatcherTest struct {
+	dispatcher *webhook.Dispatcher
+	webhooks   *servicetest.WebhookRepository
+	clock      *clock
+	hook       *domain.Webhook
+	lastEvent  int64
+}
+
+// startDispatcher runs a dispatcher for one webhook posting to url; cfg fills in the
+// fields left zero
+func startDispatcher(t *testing.T, url string, cfg webhook.Config) *dispatcherTest {
+	t.Helper()
+	// the webhook is created before the events sent to it
+	clk := &clock{now: time.Now().Add(-time.Hour)}
+	webhooks := servicetest.NewWebhookRepository()
+	webhooks.Now = clk.Now
+	hook := &domain.Webhook{
+		ID:         uuid.New(),
+		URL:        url,
+		EventTypes: []domain.TaskEventType{domain.TaskEventCreated, domain.TaskEventUpdated},
+		Secret:     testSecret,
+		Active:     true,
+	}
+	if err := webhooks.Create(context.Background(), hook); err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+
+	cfg.Workers = cmp.Or(cfg.Workers, 2)
+	cfg.MaxAttempts = cmp.Or(cfg.MaxAttempts, 5)
+	cfg.DisableAfter = cmp.Or(cfg.DisableAfter, 100)
+	cfg.Timeout = cmp.Or(cfg.Timeout, 5*time.Second)
+	cfg.PollInterval = 5 * time.Millisecond
+	cfg.BackoffBase = cmp.Or(cfg.BackoffBase, time.Minute)
+	cfg.BackoffMax = cmp.Or(cfg.BackoffMax, time.Hour)
+	dispatcher := webhook.NewDispatcher(webhooks, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		dispatcher.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return &dispatcherTest{dispatcher: dispatcher, webhooks: webhooks, clock: clk, hook: hook}
+}
+
+// loopback lets the dispatcher reach the httptest receiver
+func loopback(t *testing.T) *webhook.TargetPolicy {
+	t.Helper()
+	policy, err := webhook.NewTargetPolicy([]string{"127.0.0.1", "::1"}, nil)
+	if err != nil {
+		t.Fatalf("target policy: %v", err)
+	}
+	return policy
+}
+
+// createTask hands the dispatcher the event of a new task the way the outbox relay does
+func (d *dispatcherTest) createTask(t *testing.T, title string) uuid.UUID {
+	t.Helper()
+	d.lastEvent++
+	now := time.Now().UTC()
+	task := domain.Task{ID: uuid.New(), Title: title, Status: domain.TaskStatusNew, CreatedAt: now, UpdatedAt: now}
+	event := domain.TaskEvent{ID: d.lastEvent, Type: domain.TaskEventCreated, TaskID: task.ID, Seq: 1, Task: task, OccurredAt: now}
+	if err := d.dispatcher.Publish(context.Background(), []domain.TaskEvent{event}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	d.dispatcher.Committed()
+	return task.ID
+}
+
+func (d *dispatcherTest) deliveries(t *testing.T) []domain.WebhookDelivery {
+	t.Helper()
+	deliveries, err := d.webhooks.Deliveries(context.Background(), d.hook.ID, 100, 0)
+	if err != nil {
+		t.Fatalf("deliveries: %v", err)
+	}
+	return deliveries
+}
+
+// eventually fails the test when cond does not hold within a few seconds
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDispatcherSignsDeliveries(t *testing.T) {
+	recv := newReceiver(t, http.StatusOK)
+	d := startDispatcher(t, recv.URL+"/hook", webhook.Config{Targets: loopback(t)})
+	taskID := d.createTask(t, "Buy milk")
+
+	eventually(t, "the delivery", func() bool { return len(recv.received()) == 1 })
+	req := recv.received()[0]
+
+	var event domain.TaskEvent
+	if err := json.Unmarshal(req.body, &event); err != nil {
+		t.Fatalf("payload: %v", err)
+	}
+	if event.Type != domain.TaskEventCreated || event.TaskID != taskID || event.Task.Title != "Buy milk" {
+		t.Errorf("payload = %+v", event)
+	}
+	if req.header.Get(webhook.EventHeader) != string(domain.TaskEventCreated) || req.header.Get("Content-Type") != "application/json" {
+		t.Errorf("headers = %v", req.header)
+	}
+
+	timestamp, signature := req.header.Get(webhook.TimestampHeader), req.header.Get(webhook.SignatureHeader)
+	if err := webhook.Verify(testSecret, timestamp, signature, req.body, 5*time.Minute, time.Now()); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+	tampered := append([]byte(nil), req.body...)
+	tampered[len(tampered)-2] = ' '
+	for name, err := range map[string]error{
+		"other secret":    webhook.Verify("whsec_other_secret_123", timestamp, signature, req.body, 5*time.Minute, time.Now()),
+		"tampered body":   webhook.Verify(testSecret, timestamp, signature, tampered, 5*time.Minute, time.Now()),
+		"other timestamp": webhook.Verify(testSecret, "1", signature, req.body, 5*time.Minute, time.Now()),
+		"no prefix":       webhook.Verify(testSecret, timestamp, strings.TrimPrefix(signature, "sha256="), req.body, 5*time.Minute, time.Now()),
+	} {
+		if !errors.Is(err, webhook.ErrInvalidSignature) {
+			t.Errorf("%s: err = %v, want ErrInvalidSignature", name, err)
+		}
+	}
+	if err := webhook.Verify(testSecret, timestamp, signature, req.body, 5*time.Minute, time.Now().Add(10*time.Minute)); !errors.Is(err, webhook.ErrStaleTimestamp) {
+		t.Errorf("replayed later: err = %v, want ErrStaleTimestamp", err)
+	}
+
+	eventually(t, "the recorded success", func() bool {
+		deliveries := d.deliveries(t)
+		return len(deliveries) == 1 && deliveries[0].State == domain.WebhookDeliverySucceeded
+	})
+	delivery := d.deliveries(t)[0]
+	if req.header.Get(webhook.DeliveryHeader) != delivery.ID.String() || delivery.Attempts != 1 ||
+		delivery.ResponseStatus == nil || *delivery.ResponseStatus != http.StatusOK {
+		t.Errorf("delivery = %+v, header %s", delivery, req.header.Get(webhook.DeliveryHeader))
+	}
+}
+
+func TestDispatcherRetriesWithBackoff(t *testing.T) {
+	recv := newReceiver(t, http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusOK)
+	d := startDispatcher(t, recv.URL, webhook.Config{Targets: loopback(t), BackoffBase: time.Minute, BackoffMax: 10 * time.Minute})
+	d.createTask(t, "Buy milk")
+
+	// attempt n waits BackoffBase doubled n-1 times, give or take 20%
+	for attempt, delay := range []time.Duration{time.Minute, 2 * time.Minute} {
+		eventually(t, "a failed attempt", func() bool {
+			deliveries := d.deliveries(t)
+			return len(deliveries) == 1 && deliveries[0].Attempts == attempt+1
+		})
+		delivery := d.deliveries(t)[0]
+		if delivery.State != domain.WebhookDeliveryPending || delivery.LastError == "" || delivery.ResponseStatus == nil {
+			t.Fatalf("after attempt %d: %+v", attempt+1, delivery)
+		}
+		wait := delivery.NextAttemptAt.Sub(*delivery.LastAttemptAt)
+		if wait < delay*8/10 || wait > delay*12/10 {
+			t.Errorf("after attempt %d the retry waits %v, want about %v", attempt+1, wait, delay)
+		}
+
+		// not due yet
+		d.clock.Advance(wait / 2)
+		time.Sleep(50 * time.Millisecond)
+		if got := len(recv.received()); got != attempt+1 {
+			t.Fatalf("%d requests before the retry was due, want %d", got, attempt+1)
+		}
+		d.clock.Advance(wait)
+	}
+
+	eventually(t, "the success", func() bool {
+		deliveries := d.deliveries(t)
+		return len(deliveries) == 1 && deliveries[0].State == domain.WebhookDeliverySucceeded
+	})
+	delivery := d.deliveries(t)[0]
+	if delivery.Attempts != 3 || delivery.LastError != "" || delivery.NextAttemptAt != nil {
+		t.Errorf("delivery = %+v", delivery)
+	}
+	requests := recv.received()
+	for _, req := range requests {
+		if req.header.Get(webhook.DeliveryHeader) != delivery.ID.String() || string(req.body) != string(requests[0].body) {
+			t.Errorf("a retry changed the delivery id or the body")
+		}
+	}
+}
+
+func TestDispatcherGivesUpAfterMaxAttempts(t *testing.T) {
+	recv := newReceiver(t, http.StatusBadGateway)
+	d := startDispatcher(t, recv.URL, webhook.Config{Targets: loopback(t), MaxAttempts: 2})
+	d.createTask(t, "Buy milk")
+
+	eventually(t, "the first attempt", func() bool { return len(recv.received()) == 1 })
+	eventually(t, "the retry to be scheduled", func() bool { return d.deliveries(t)[0].Attempts == 1 })
+	d.clock.Advance(time.Hour)
+	eventually(t, "the failure", func() bool { return d.deliveries(t)[0].State == domain.WebhookDeliveryFailed })
+
+	delivery := d.deliveries(t)[0]
+	if delivery.Attempts != 2 || delivery.NextAttemptAt != nil || delivery.LastError != "unexpected status 502" {
+		t.Errorf("delivery = %+v", delivery)
+	}
+	d.clock.Advance(24 * time.Hour)
+	time.Sleep(50 * time.Millisecond)
+	if got := len(recv.received()); got != 2 {
+		t.Errorf("%d requests, want 2", got)
+	}
+}
+
+func TestDispatcherDisablesFailingWebhook(t *testing.T) {
+	recv := newReceiver(t, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusOK)
+	d := startDispatcher(t, recv.URL, webhook.Config{Targets: loopback(t), Workers: 1, DisableAfter: 3})
+	for _, title := range []string{"a", "b", "c"} {
+		d.createTask(t, title)
+	}
+
+	eventually(t, "the webhook to be disabled", func() bool {
+		hook, _ := d.webhooks.GetByID(context.Background(), d.hook.ID)
+		return !hook.Active
+	})
+	hook, _ := d.webhooks.GetByID(context.Background(), d.hook.ID)
+	if hook.ConsecutiveFailures != 3 || hook.DisabledAt == nil {
+		t.Errorf("disabled webhook = %+v", hook)
+	}
+	// the retries come due but a disabled webhook gets nothing
+	d.clock.Advance(time.Hour)
+	time.Sleep(50 * time.Millisecond)
+	if got := len(recv.received()); got != 3 {
+		t.Fatalf("%d requests to a disabled webhook, want 3", got)
+	}
+
+	hook.Active = true
+	if _, err := d.webhooks.Update(context.Background(), hook); err != nil {
+		t.Fatalf("enable webhook: %v", err)
+	}
+	eventually(t, "the queued deliveries", func() bool {
+		for _, delivery := range d.deliveries(t) {
+			if delivery.State != domain.WebhookDeliverySucceeded {
+				return false
+			}
+		}
+		return true
+	})
+	hook, _ = d.webhooks.GetByID(context.Background(), d.hook.ID)
+	if !hook.Active || hook.ConsecutiveFailures != 0 {
+		t.Errorf("enabled webhook = %+v", hook)
+	}
+}
+
+func TestDispatcherRedelivers(t *testing.T) {
+	recv := newReceiver(t, http.StatusOK)
+	d := startDispatcher(t, recv.URL, webhook.Config{Targets: loopback(t)})
+	d.createTask(t, "Buy milk")
+	eventually(t, "the delivery", func() bool {
+		deliveries := d.deliveries(t)
+		return len(deliveries) == 1 && deliveries[0].State == domain.WebhookDeliverySucceeded
+	})
+	original := d.deliveries(t)[0]
+
+	redelivery, err := d.webhooks.Redeliver(context.Background(), d.hook.ID, original.ID)
+	if err != nil || redelivery == nil {
+		t.Fatalf("redeliver: %v", err)
+	}
+	eventually(t, "the redelivery", func() bool {
+		delivery := d.webhooks.Delivery(redelivery.ID)
+		return delivery.State == domain.WebhookDeliverySucceeded
+	})
+
+	requests := recv.received()
+	if len(requests) != 2 {
+		t.Fatalf("%d requests, want 2", len(requests))
+	}
+	if string(requests[1].body) != string(requests[0].body) {
+		t.Errorf("redelivered body %s, want %s", requests[1].body, requests[0].body)
+	}
+	if requests[1].header.Get(webhook.DeliveryHeader) != redelivery.ID.String() || *redelivery.RedeliveryOf != original.ID {
+		t.Errorf("redelivery %+v sent as %s", redelivery, requests[1].header.Get(webhook.DeliveryHeader))
+	}
+	if err := webhook.Verify(testSecret, requests[1].header.Get(webhook.TimestampHeader), requests[1].header.Get(webhook.SignatureHeader),
+		requests[1].body, time.Minute, time.Now()); err != nil {
+		t.Errorf("verify redelivery: %v", err)
+	}
+}
+
+func TestDispatcherRefusesInternalTargets(t *testing.T) {
+	recv := newReceiver(t, http.StatusOK)
+	// no allowlist, the loopback receiver is off limits
+	d := startDispatcher(t, recv.URL, webhook.Config{})
+	d.createTask(t, "Buy milk")
+
+	eventually(t, "the failed attempt", func() bool {
+		deliveries := d.deliveries(t)
+		return len(deliveries) == 1 && deliveries[0].Attempts == 1
+	})
+	delivery := d.deliveries(t)[0]
+	if !strings.Contains(delivery.LastError, webhook.ErrForbiddenTarget.Error()) || delivery.ResponseStatus != nil {
+		t.Errorf("delivery = %+v, want a refused connection", delivery)
+	}
+	if got := len(recv.received()); got != 0 {
+		t.Errorf("the receiver got %d requests", got)
+	}
+}
+
+func TestDispatcherPublishQueuesMatchingWebhooks(t *testing.T) {
+	ctx := context.Background()
+	webhooks := servicetest.NewWebhookRepository()
+	created := time.Now().UTC()
+	hooks := []domain.Webhook{
+		{ID: uuid.New(), URL: "https://a.example.com", EventTypes: []domain.TaskEventType{domain.TaskEventCreated, domain.TaskEventUpdated}, Active: true},
+		{ID: uuid.New(), URL: "https://b.example.com", EventTypes: []domain.TaskEventType{domain.TaskEventUpdated}, Project: "home", Active: true},
+		{ID: uuid.New(), URL: "https://c.example.com", EventTypes: []domain.TaskEventType{domain.TaskEventUpdated}, Status: domain.TaskStatusDone, Active: true},
+		{ID: uuid.New(), URL: "https://d.example.com", EventTypes: []domain.TaskEventType{domain.TaskEventUpdated}, Active: false},
+	}
+	for i := range hooks {
+		if err := webhooks.Create(ctx, &hooks[i]); err != nil {
+			t.Fatalf("create webhook: %v", err)
+		}
+	}
+
+	task := domain.Task{ID: uuid.New(), Title: "Buy milk +home", Status: domain.TaskStatusNew}
+	done := task
+	done.Status = domain.TaskStatusDone
+	dispatcher := webhook.NewDispatcher(webhooks, webhook.Config{})
+	err := dispatcher.Publish(ctx, []domain.TaskEvent{
+		{ID: 1, Type: domain.TaskEventCreated, TaskID: task.ID, Seq: 1, Task: task, OccurredAt: created.Add(-time.Minute)},
+		{ID: 2, Type: domain.TaskEventCreated, TaskID: task.ID, Seq: 2, Task: task, OccurredAt: created.Add(time.Second)},
+		{ID: 3, Type: domain.TaskEventUpdated, TaskID: task.ID, Seq: 3, Task: done, OccurredAt: created.Add(time.Second)},
+	})
+	if err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	// the event from before the webhooks were created is not queued
+	want := map[string][]int64{"a": {2, 3}, "b": {3}, "c": {3}, "d": nil}
+	for i, name := range []string{"a", "b", "c", "d"} {
+		deliveries, err := webhooks.Deliveries(ctx, hooks[i].ID, 100, 0)
+		if err != nil {
+			t.Fatalf("deliveries: %v", err)
+		}
+		var got []int64
+		for _, delivery := range deliveries {
+			got = append(got, delivery.EventID)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, want[name]) {
+			t.Errorf("webhook %s got events %v, want %v", name, got, want[name])
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// ErrForbiddenTarget is returned for a webhook URL or connection to an internal address
+var ErrForbiddenTarget = errors.New("webhook target address is not allowed")
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), some clouds serve
+// instance metadata from it
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// Resolver looks up the addresses of a host, *net.Resolver implements it
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// TargetPolicy keeps deliveries away from loopback, private, link-local and other
+// internal addresses, so a webhook cannot be used to probe the network the server
+// runs in. Networks in the allowlist are let through.
+type TargetPolicy struct {
+	allowed  []netip.Prefix
+	resolver Resolver
+}
+
+// NewTargetPolicy parses the allowlist, CIDR prefixes or single addresses. A nil
+// resolver means net.DefaultResolver.
+func NewTargetPolicy(allowed []string, resolver Resolver) (*TargetPolicy, error) {
+	prefixes, err := ParseNetworks(allowed)
+	if err != nil {
+		return nil, err
+	}
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &TargetPolicy{allowed: prefixes, resolver: resolver}, nil
+}
+
+// ParseNetworks reads CIDR prefixes, a single address stands for itself
+func ParseNetworks(networks []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(networks))
+	for _, network := range networks {
+		network = strings.TrimSpace(network)
+		if network == "" {
+			continue
+		}
+		if prefix, err := netip.ParsePrefix(network); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(network)
+		if err != nil {
+			return nil, fmt.Errorf("network %q: want a CIDR prefix or an address", network)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// CheckURL resolves the host of the URL and fails when any of its addresses is not allowed
+func (p *TargetPolicy) CheckURL(ctx context.Context, rawURL string) error {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := target.Hostname()
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return p.CheckAddr(addr)
+	}
+	addrs, err := p.resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if err := p.CheckAddr(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckAddr fails for internal addresses outside the allowlist
+func (p *TargetPolicy) CheckAddr(addr netip.Addr) error {
+	addr = addr.Unmap()
+	for _, prefix := range p.allowed {
+		if prefix.Contains(addr) {
+			return nil
+		}
+	}
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() || sharedAddressSpace.Contains(addr) {
+		return fmt.Errorf("%w: %s", ErrForbiddenTarget, addr)
+	}
+	return nil
+}
+
+// Control is a net.Dialer.Control hook that checks the address actually connected to,
+// so a host that resolves differently after registration is still refused
+func (p *TargetPolicy) Control(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrForbiddenTarget, address)
+	}
+	return p.CheckAddr(addrPort.Addr())
+}
@@ -0,0 +1,110 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+// hostsResolver resolves the hosts it lists and fails for the rest
+type hostsResolver map[string][]string
+
+func (h hostsResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	addrs, ok := h[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	out := make([]netip.Addr, 0, len(addrs))
+	for _, addr := range addrs {
+		out = append(out, netip.MustParseAddr(addr))
+	}
+	return out, nil
+}
+
+func TestTargetPolicyCheckURL(t *testing.T) {
+	resolver := hostsResolver{
+		"hooks.example.com":    {"203.0.113.10", "2001:db8::10"},
+		"metadata.example.com": {"169.254.169.254"},
+		"mixed.example.com":    {"203.0.113.10", "10.1.2.3"},
+		"office.example.com":   {"10.20.0.7"},
+	}
+	tests := []struct {
+		url       string
+		allowed   []string
+		forbidden bool
+		wantErr   bool
+	}{
+		{url: "https://hooks.example.com/tasks"},
+		{url: "http://203.0.113.10:8080/tasks"},
+		{url: "http://127.0.0.1/tasks", forbidden: true},
+		{url: "http://[::1]:9000/", forbidden: true},
+		{url: "http://[::ffff:127.0.0.1]/", forbidden: true},
+		{url: "http://0.0.0.0/", forbidden: true},
+		{url: "http://192.168.1.1/", forbidden: true},
+		{url: "http://[fd00::1]/", forbidden: true},
+		{url: "http://100.100.100.200/", forbidden: true},
+		{url: "http://metadata.example.com/latest", forbidden: true},
+		{url: "http://mixed.example.com/", forbidden: true},
+		{url: "http://office.example.com/", forbidden: true},
+		{url: "http://office.example.com/", allowed: []string{"10.20.0.0/16"}},
+		{url: "http://127.0.0.1:8080/", allowed: []string{"127.0.0.1"}},
+		{url: "http://127.0.0.2:8080/", allowed: []string{"127.0.0.1"}, forbidden: true},
+		{url: "http://unknown.example.com/", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			policy, err := NewTargetPolicy(tt.allowed, resolver)
+			if err != nil {
+				t.Fatalf("policy: %v", err)
+			}
+			err = policy.CheckURL(context.Background(), tt.url)
+			if got := errors.Is(err, ErrForbiddenTarget); got != tt.forbidden {
+				t.Fatalf("err = %v, forbidden = %v, want %v", err, got, tt.forbidden)
+			}
+			if !tt.forbidden && (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTargetPolicyControl(t *testing.T) {
+	policy, err := NewTargetPolicy([]string{"192.168.5.0/24"}, hostsResolver{})
+	if err != nil {
+		t.Fatalf("policy: %v", err)
+	}
+	for address, forbidden := range map[string]bool{
+		"203.0.113.10:443":     false,
+		"192.168.5.20:80":      false,
+		"192.168.6.20:80":      true,
+		"169.254.169.254:80":   true,
+		"[::1]:443":            true,
+		"[2001:db8::10]:443":   false,
+		"not an address:12345": true,
+	} {
+		if err := policy.Control("tcp", address, nil); errors.Is(err, ErrForbiddenTarget) != forbidden {
+			t.Errorf("%s: err = %v, want forbidden %v", address, err, forbidden)
+		}
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	prefixes, err := ParseNetworks([]string{"10.0.0.0/8", " 127.0.0.1 ", "", "fd00::/8", "192.168.1.77/24"})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := []string{"10.0.0.0/8", "127.0.0.1/32", "fd00::/8", "192.168.1.0/24"}
+	if len(prefixes) != len(want) {
+		t.Fatalf("prefixes = %v, want %v", prefixes, want)
+	}
+	for i := range want {
+		if prefixes[i].String() != want[i] {
+			t.Errorf("prefixes[%d] = %s, want %s", i, prefixes[i], want[i])
+		}
+	}
+	if _, err := ParseNetworks([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("want an error for a bad prefix")
+	}
+}
@@ -0,0 +1,18 @@
+CREATE TABLE idempotency_keys (
+    -- the API key of the caller, '' without authentication, so callers cannot replay each other's responses
+    api_key_id TEXT NOT NULL DEFAULT '',
+    key TEXT NOT NULL,
+    scope TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    -- the request holding an in-flight record, a retry that took it over gets a new one
+    lock_id UUID,
+    status_code INTEGER,
+    content_type TEXT,
+    body BYTEA,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    -- the end of the lease while in flight, of the stored response once completed
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (api_key_id, key, scope)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
@@ -0,0 +1,13 @@
+CREATE TABLE task_events (
+    id BIGSERIAL PRIMARY KEY,
+    type TEXT NOT NULL,
+    task_id UUID NOT NULL,
+    title TEXT NOT NULL,
+    description TEXT,
+    status TEXT NOT NULL,
+    task_created_at TIMESTAMP NOT NULL,
+    task_updated_at TIMESTAMP NOT NULL,
+    occurred_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_task_events_occurred_at ON task_events (occurred_at);
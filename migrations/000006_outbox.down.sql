@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS outbox_cursors;
+DROP TABLE IF EXISTS task_sequences;
+DROP INDEX IF EXISTS idx_task_events_task_seq;
+ALTER TABLE task_events DROP COLUMN IF EXISTS seq;
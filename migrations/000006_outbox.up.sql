@@ -0,0 +1,26 @@
+-- task_events is written in the transaction of the task change, so it doubles as the
+-- outbox; seq numbers the events of each task from 1
+ALTER TABLE task_events ADD COLUMN seq BIGINT;
+
+UPDATE task_events e SET seq = numbered.seq
+FROM (SELECT id, ROW_NUMBER() OVER (PARTITION BY task_id ORDER BY id) AS seq FROM task_events) numbered
+WHERE e.id = numbered.id;
+
+ALTER TABLE task_events ALTER COLUMN seq SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_task_events_task_seq ON task_events (task_id, seq);
+
+-- the last seq handed out per task, it outlives the events removed by retention
+CREATE TABLE task_sequences (
+    task_id UUID PRIMARY KEY,
+    last_seq BIGINT NOT NULL
+);
+
+INSERT INTO task_sequences (task_id, last_seq) SELECT task_id, MAX(seq) FROM task_events GROUP BY task_id;
+
+-- the last event each durable relay sink has published
+CREATE TABLE outbox_cursors (
+    sink TEXT PRIMARY KEY,
+    last_event_id BIGINT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
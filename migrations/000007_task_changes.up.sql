@@ -0,0 +1,8 @@
+-- the highest event id removed by retention, change tokens up to it can no longer be served
+CREATE TABLE task_events_pruned (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    last_event_id BIGINT NOT NULL
+);
+
+-- without a record of earlier pruning, everything before the oldest event counts as removed
+INSERT INTO task_events_pruned (id, last_event_id) SELECT 1, COALESCE(MIN(id) - 1, 0) FROM task_events;
@@ -0,0 +1,13 @@
+CREATE TABLE webhook_cursor (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    last_event_id BIGINT NOT NULL
+);
+
+INSERT INTO webhook_cursor (id, last_event_id)
+SELECT 1, COALESCE(
+    (SELECT last_event_id FROM outbox_cursors WHERE sink = 'webhooks'),
+    (SELECT MAX(id) FROM task_events),
+    0
+);
+
+DELETE FROM outbox_cursors WHERE sink = 'webhooks';
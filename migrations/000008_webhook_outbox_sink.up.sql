@@ -0,0 +1,5 @@
+-- webhooks are queued by a durable relay sink, its position moves to outbox_cursors
+INSERT INTO outbox_cursors (sink, last_event_id) SELECT 'webhooks', last_event_id FROM webhook_cursor
+ON CONFLICT (sink) DO NOTHING;
+
+DROP TABLE IF EXISTS webhook_cursor;
@@ -0,0 +1,15 @@
+-- when the task last became done, NULL while it is not done
+ALTER TABLE tasks ADD COLUMN completed_at TIMESTAMP;
+
+-- the event log knows when a done task last became done: an event after one that was
+-- not done, or its creation as done; tasks whose events are gone fall back to their last change
+UPDATE tasks t SET completed_at = COALESCE(
+    (SELECT MAX(e.occurred_at) FROM task_events e
+     WHERE e.task_id = t.id AND e.status = 'done' AND (e.type = 'task.created' OR EXISTS (
+         SELECT 1 FROM task_events p WHERE p.task_id = t.id AND p.seq = e.seq - 1 AND p.status <> 'done'
+     ))),
+    t.updated_at
+)
+WHERE t.status = 'done';
+
+CREATE INDEX IF NOT EXISTS idx_tasks_completed_at ON tasks (completed_at) WHERE completed_at IS NOT NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_task_events_type_status_occurred_at;
+DROP INDEX IF EXISTS idx_task_events_type_occurred_at;
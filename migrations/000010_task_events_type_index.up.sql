@@ -0,0 +1,3 @@
+-- list versions look up the latest deletion, with or without a status filter, see ListVersion
+CREATE INDEX IF NOT EXISTS idx_task_events_type_occurred_at ON task_events (type, occurred_at);
+CREATE INDEX IF NOT EXISTS idx_task_events_type_status_occurred_at ON task_events (type, status, occurred_at);
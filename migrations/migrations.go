@@ -0,0 +1,9 @@
+// Package migrations embeds the SQL migrations so the server binary can apply them.
+package migrations
+
+import "embed"
+
+// FS holds NNNNNN_name.up.sql and NNNNNN_name.down.sql pairs
+//
+//go:embed *.sql
+var FS embed.FS
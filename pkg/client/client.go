@@ -0,0 +1,402 @@
+// Package client is a Go client for the tasks REST API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultTimeout    = 30 * time.Second
+	defaultMaxRetries = 3
+	defaultMinBackoff = 200 * time.Millisecond
+	defaultMaxBackoff = 5 * time.Second
+	defaultPageSize   = 100
+	maxErrorBodyBytes = 1 << 20
+	// patchAttempts bounds how often Patch reads the task again after a concurrent change
+	patchAttempts = 3
+)
+
+// AuthFunc adds credentials to every outgoing request
+type AuthFunc func(req *http.Request)
+
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	auth       AuthFunc
+	userAgent  string
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+type Option func(*Client)
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+func WithAuth(auth AuthFunc) Option {
+	return func(c *Client) {
+		c.auth = auth
+	}
+}
+
+func WithBearerToken(token string) Option {
+	return WithAuth(func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer "+token)
+	})
+}
+
+func WithAPIKey(header, key string) Option {
+	return WithAuth(func(req *http.Request) {
+		req.Header.Set(header, key)
+	})
+}
+
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithRetry sets how many times 5xx, 429, a 409 for a request with the same Idempotency-Key
+// still in progress and network failures are retried and the bounds of the exponential backoff between attempts. maxRetries 0 disables retries.
+func WithRetry(maxRetries int, minBackoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.minBackoff = minBackoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+func New(baseURL string, opts ...Option) (*Client, error) {
+	parsed, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("parse base url: %w", err)
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("base url %q must be absolute", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    parsed,
+		httpClient: &http.Client{Timeout: defaultTimeout},
+		userAgent:  "go-tasks-api-client",
+		maxRetries: defaultMaxRetries,
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Create creates a task. Every call sends a fresh Idempotency-Key, so retries
+// after a timeout never create duplicates.
+func (c *Client) Create(ctx context.Context, req CreateTaskRequest) (uuid.UUID, error) {
+	var resp createTaskResponse
+	headers := http.Header{"Idempotency-Key": {uuid.NewString()}}
+	if err := c.do(ctx, http.MethodPost, "/tasks", nil, headers, req, &resp); err != nil {
+		return uuid.Nil, err
+	}
+	return resp.ID, nil
+}
+
+func (c *Client) Get(ctx context.Context, id uuid.UUID) (*Task, error) {
+	task, _, err := c.get(ctx, id)
+	return task, err
+}
+
+// get returns the task with its ETag, empty when the server sends none
+func (c *Client) get(ctx context.Context, id uuid.UUID) (*Task, string, error) {
+	task := &Task{}
+	header, err := c.roundTrip(ctx, http.MethodGet, "/tasks/"+id.String(), nil, nil, nil, task)
+	if err != nil {
+		return nil, "", err
+	}
+	return task, header.Get("ETag"), nil
+}
+
+// Update replaces title, description and status of the task
+func (c *Client) Update(ctx context.Context, id uuid.UUID, req UpdateTaskRequest) error {
+	return c.do(ctx, http.MethodPut, "/tasks/"+id.String(), nil, nil, req, nil)
+}
+
+// Patch changes only the set fields. The API has no PATCH endpoint, so the task is read
+// and written back with PUT and If-Match. When someone else changes the task in between,
+// the task is read again and the fields applied to it; after patchAttempts such conflicts
+// the error matches ErrPreconditionFailed.
+func (c *Client) Patch(ctx context.Context, id uuid.UUID, req PatchTaskRequest) (*Task, error) {
+	var err error
+	for attempt := 0; attempt < patchAttempts; attempt++ {
+		var task *Task
+		var etag string
+		if task, etag, err = c.get(ctx, id); err != nil {
+			return nil, err
+		}
+		if req.Title != nil {
+			task.Title = *req.Title
+		}
+		if req.Description != nil {
+			task.Description = *req.Description
+		}
+		if req.Status != nil {
+			task.Status = *req.Status
+		}
+		description := task.Description
+		update := UpdateTaskRequest{Title: task.Title, Description: &description, Status: task.Status}
+
+		var headers http.Header
+		if etag != "" {
+			headers = http.Header{"If-Match": {etag}}
+		}
+		err = c.do(ctx, http.MethodPut, "/tasks/"+id.String(), nil, headers, update, nil)
+		if err == nil {
+			return task, nil
+		}
+		if !errors.Is(err, ErrPreconditionFailed) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+func (c *Client) Delete(ctx context.Context, id uuid.UUID) error {
+	return c.do(ctx, http.MethodDelete, "/tasks/"+id.String(), nil, nil, nil, nil)
+}
+
+// List returns a single page of tasks
+func (c *Client) List(ctx context.Context, opts ListOptions) ([]TaskListItem, error) {
+	query := url.Values{}
+	if opts.Status != "" {
+		query.Set("status", string(opts.Status))
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Offset > 0 {
+		query.Set("offset", strconv.Itoa(opts.Offset))
+	}
+
+	items := make([]TaskListItem, 0)
+	if err := c.do(ctx, http.MethodGet, "/tasks", query, nil, nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// ListAll walks every page starting at opts.Offset, opts.Limit is the page size
+func (c *Client) ListAll(ctx context.Context, opts ListOptions) *TaskIterator {
+	if opts.Limit <= 0 {
+		opts.Limit = defaultPageSize
+	}
+	return &TaskIterator{ctx: ctx, client: c, opts: opts}
+}
+
+// TaskIterator pages through List results:
+//
+//	it := c.ListAll(ctx, client.ListOptions{})
+//	for it.Next() {
+//		item := it.Item()
+//	}
+//	if err := it.Err(); err != nil { ... }
+type TaskIterator struct {
+	ctx    context.Context
+	client *Client
+	opts   ListOptions
+	page   []TaskListItem
+	pos    int
+	item   TaskListItem
+	done   bool
+	err    error
+}
+
+func (it *TaskIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.pos >= len(it.page) {
+		if it.done {
+			return false
+		}
+		page, err := it.client.List(it.ctx, it.opts)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page = page
+		it.pos = 0
+		it.opts.Offset += len(page)
+		it.done = len(page) < it.opts.Limit
+		if len(page) == 0 {
+			return false
+		}
+	}
+	it.item = it.page[it.pos]
+	it.pos++
+	return true
+}
+
+func (it *TaskIterator) Item() TaskListItem {
+	return it.item
+}
+
+func (it *TaskIterator) Err() error {
+	return it.err
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, headers http.Header, in, out any) error {
+	_, err := c.roundTrip(ctx, method, path, query, headers, in, out)
+	return err
+}
+
+// roundTrip sends the request, retrying it when allowed, decodes a successful response
+// into out and returns its header
+func (c *Client) roundTrip(ctx context.Context, method, path string, query url.Values, headers http.Header, in, out any) (http.Header, error) {
+	var payload []byte
+	if in != nil {
+		var err error
+		payload, err = json.Marshal(in)
+		if err != nil {
+			return nil, fmt.Errorf("encode request: %w", err)
+		}
+	}
+
+	target := *c.baseURL
+	target.Path = c.baseURL.Path + path
+	target.RawQuery = query.Encode()
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, target.String(), headers, payload)
+		if err == nil && resp.StatusCode < http.StatusBadRequest {
+			defer resp.Body.Close()
+			return resp.Header, decodeBody(resp, out)
+		}
+
+		var retryAfter time.Duration
+		if err == nil {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+			resp.Body.Close()
+			apiErr := decodeError(resp, body)
+			if !retryable(apiErr) {
+				return nil, apiErr
+			}
+			err = apiErr
+			retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		} else if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if attempt >= c.maxRetries {
+			return nil, err
+		}
+		if waitErr := sleep(ctx, max(retryAfter, c.backoff(attempt))); waitErr != nil {
+			return nil, waitErr
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, target string, headers http.Header, payload []byte) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+	for key, values := range headers {
+		req.Header[key] = values
+	}
+	if c.auth != nil {
+		c.auth(req)
+	}
+
+	return c.httpClient.Do(req)
+}
+
+func decodeBody(resp *http.Response, out any) error {
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// retryable reports whether the response may succeed when sent again. A 409 for an
+// idempotency key still in progress is retried with the same key, so it returns the
+// result of the first request once that one finishes.
+func retryable(err *Error) bool {
+	if err.StatusCode == http.StatusConflict {
+		return err.Code == codeIdempotencyInProgress
+	}
+	return err.StatusCode == http.StatusTooManyRequests || err.StatusCode >= http.StatusInternalServerError
+}
+
+// backoff grows exponentially from minBackoff with full jitter
+func (c *Client) backoff(attempt int) time.Duration {
+	limit := c.minBackoff << attempt
+	if limit <= 0 || limit > c.maxBackoff {
+		limit = c.maxBackoff
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(limit))) + c.minBackoff/2
+}
+
+func parseRetryAfter(raw string) time.Duration {
+	if raw == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(raw); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(raw); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// IsNotFound reports whether err means the task does not exist
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
@@ -0,0 +1,306 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nightmaker00/go-tasks-api/internal/api"
+	"github.com/nightmaker00/go-tasks-api/internal/config"
+	"github.com/nightmaker00/go-tasks-api/internal/events"
+	"github.com/nightmaker00/go-tasks-api/internal/service"
+	"github.com/nightmaker00/go-tasks-api/internal/service/servicetest"
+	"github.com/nightmaker00/go-tasks-api/pkg/client"
+)
+
+// newTestClient serves the real api.Handler on the in-memory repository, wrap may put
+// a handler in front of it to fail or count requests
+func newTestClient(t *testing.T, wrap func(next http.Handler) http.Handler) (*client.Client, *servicetest.TaskRepository) {
+	t.Helper()
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	repo := servicetest.NewTaskRepository()
+	broker := events.NewBroker(cfg.Events.BufferSize)
+	t.Cleanup(broker.Close)
+	mux := http.NewServeMux()
+	api.NewHandler(service.NewTaskService(repo, nil), nil, broker, cfg.API).RegisterRoutes(mux)
+
+	var handler http.Handler = api.WithRequestID(mux)
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	c, err := client.New(server.URL, client.WithRetry(3, time.Millisecond, 5*time.Millisecond))
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	return c, repo
+}
+
+func TestClientCRUD(t *testing.T) {
+	c, _ := newTestClient(t, nil)
+	ctx := context.Background()
+
+	id, err := c.Create(ctx, client.CreateTaskRequest{Title: "Buy milk", Description: "2 l"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	task, err := c.Get(ctx, id)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if task.Title != "Buy milk" || task.Description != "2 l" || task.Status != client.TaskStatusNew {
+		t.Errorf("created task = %+v", task)
+	}
+
+	description := "3 l"
+	if err := c.Update(ctx, id, client.UpdateTaskRequest{Title: "Buy more milk", Description: &description, Status: client.TaskStatusInProgress}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	done := client.TaskStatusDone
+	if _, err := c.Patch(ctx, id, client.PatchTaskRequest{Status: &done}); err != nil {
+		t.Fatalf("patch: %v", err)
+	}
+	task, err = c.Get(ctx, id)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if task.Title != "Buy more milk" || task.Description != "3 l" || task.Status != client.TaskStatusDone {
+		t.Errorf("patched task = %+v", task)
+	}
+
+	if err := c.Delete(ctx, id); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := c.Get(ctx, id); !client.IsNotFound(err) {
+		t.Errorf("get after delete: err = %v, want not found", err)
+	}
+}
+
+func TestClientPatchRetriesOnConcurrentChange(t *testing.T) {
+	var id uuid.UUID
+	var repo *servicetest.TaskRepository
+	var puts atomic.Int32
+	c, repo := newTestClient(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// someone else renames the task between the first read and write of Patch
+			if r.Method == http.MethodPut && puts.Add(1) == 1 {
+				description := ""
+				if _, err := repo.Update(r.Context(), id, "Renamed", &description, "new"); err != nil {
+					t.Errorf("concurrent update: %v", err)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	ctx := context.Background()
+
+	var err error
+	if id, err = c.Create(ctx, client.CreateTaskRequest{Title: "Original"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	status := client.TaskStatusInProgress
+	patched, err := c.Patch(ctx, id, client.PatchTaskRequest{Status: &status})
+	if err != nil {
+		t.Fatalf("patch: %v", err)
+	}
+	if puts.Load() != 2 {
+		t.Errorf("PUT sent %d times, want 2", puts.Load())
+	}
+	if patched.Title != "Renamed" || patched.Status != client.TaskStatusInProgress {
+		t.Errorf("patched task = %+v, want the concurrent title kept", patched)
+	}
+}
+
+func TestClientListAll(t *testing.T) {
+	var lists atomic.Int32
+	c, _ := newTestClient(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet && r.URL.Path == "/tasks" {
+				lists.Add(1)
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	ctx := context.Background()
+
+	created := make(map[uuid.UUID]bool)
+	for i := 0; i < 7; i++ {
+		id, err := c.Create(ctx, client.CreateTaskRequest{Title: "task"})
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		created[id] = true
+	}
+
+	it := c.ListAll(ctx, client.ListOptions{Limit: 3})
+	seen := 0
+	for it.Next() {
+		if !created[it.Item().ID] {
+			t.Errorf("unexpected task %s", it.Item().ID)
+		}
+		delete(created, it.Item().ID)
+		seen++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("iterate: %v", err)
+	}
+	if seen != 7 || len(created) != 0 {
+		t.Errorf("iterated %d tasks, %d missing", seen, len(created))
+	}
+	if lists.Load() != 3 {
+		t.Errorf("listed %d pages, want 3", lists.Load())
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	tests := []struct {
+		name string
+		// failures are the statuses answered before the request reaches the API
+		failures   []int
+		retryAfter string
+		wantCalls  int32
+		wantErr    error
+		minElapsed time.Duration
+	}{
+		{name: "5xx then success", failures: []int{http.StatusServiceUnavailable, http.StatusBadGateway}, wantCalls: 3},
+		{name: "429 waits for Retry-After", failures: []int{http.StatusTooManyRequests}, retryAfter: "1", wantCalls: 2, minElapsed: time.Second},
+		{name: "retries run out", failures: []int{500, 500, 500, 500}, wantCalls: 4, wantErr: client.ErrServer},
+		{name: "4xx is not retried", failures: []int{http.StatusForbidden}, wantCalls: 1, wantErr: client.ErrUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			c, _ := newTestClient(t, func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					n := int(calls.Add(1))
+					if n <= len(tt.failures) {
+						if tt.retryAfter != "" {
+							w.Header().Set("Retry-After", tt.retryAfter)
+						}
+						http.Error(w, "failure", tt.failures[n-1])
+						return
+					}
+					next.ServeHTTP(w, r)
+				})
+			})
+
+			start := time.Now()
+			_, err := c.List(context.Background(), client.ListOptions{})
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("list: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if calls.Load() != tt.wantCalls {
+				t.Errorf("sent %d requests, want %d", calls.Load(), tt.wantCalls)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minElapsed {
+				t.Errorf("retried after %v, want at least %v", elapsed, tt.minElapsed)
+			}
+		})
+	}
+}
+
+func TestClientRetriesIdempotencyInProgress(t *testing.T) {
+	tests := []struct {
+		name string
+		// code is the problem code of the 409 answered to the first request
+		code       string
+		wantCalls  int32
+		wantErr    error
+		minElapsed time.Duration
+	}{
+		{name: "in progress waits for Retry-After", code: "idempotency_in_progress", wantCalls: 2, minElapsed: time.Second},
+		{name: "other conflict is not retried", code: "idempotency_key_reused", wantCalls: 1, wantErr: client.ErrConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			var mu sync.Mutex
+			var keys []string
+			c, _ := newTestClient(t, func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					mu.Lock()
+					keys = append(keys, r.Header.Get("Idempotency-Key"))
+					mu.Unlock()
+					if calls.Add(1) == 1 {
+						w.Header().Set("Content-Type", "application/problem+json")
+						w.Header().Set("Retry-After", "1")
+						w.WriteHeader(http.StatusConflict)
+						_, _ = w.Write([]byte(`{"status": 409, "code": "` + tt.code + `", "detail": "conflict"}`))
+						return
+					}
+					next.ServeHTTP(w, r)
+				})
+			})
+
+			start := time.Now()
+			_, err := c.Create(context.Background(), client.CreateTaskRequest{Title: "a"})
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if calls.Load() != tt.wantCalls {
+				t.Errorf("sent %d requests, want %d", calls.Load(), tt.wantCalls)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, key := range keys {
+				if key == "" || key != keys[0] {
+					t.Errorf("idempotency keys = %q, want the same key on every attempt", keys)
+					break
+				}
+			}
+			if elapsed := time.Since(start); elapsed < tt.minElapsed {
+				t.Errorf("retried after %v, want at least %v", elapsed, tt.minElapsed)
+			}
+		})
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	c, _ := newTestClient(t, nil)
+	ctx := context.Background()
+	id := uuid.New()
+	if _, err := c.Create(ctx, client.CreateTaskRequest{ID: &id, Title: "a"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	_, err := c.Create(ctx, client.CreateTaskRequest{ID: &id, Title: "b"})
+	if !errors.Is(err, client.ErrConflict) {
+		t.Errorf("duplicate id: err = %v, want ErrConflict", err)
+	}
+
+	_, err = c.Get(ctx, uuid.New())
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("missing task: err = %v, want *client.Error matching ErrNotFound", err)
+	}
+	if apiErr.Code != "not_found" || apiErr.RequestID == "" {
+		t.Errorf("missing task: code = %q, request id = %q", apiErr.Code, apiErr.RequestID)
+	}
+
+	err = c.Update(ctx, id, client.UpdateTaskRequest{Title: "a", Status: "archived"})
+	if !errors.As(err, &apiErr) || !errors.Is(err, client.ErrValidation) {
+		t.Fatalf("invalid status: err = %v, want ErrValidation", err)
+	}
+	if len(apiErr.Fields) == 0 || apiErr.Fields[0].Field != "status" {
+		t.Errorf("invalid status: fields = %+v", apiErr.Fields)
+	}
+}
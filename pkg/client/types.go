@@ -0,0 +1,61 @@
+package client
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type TaskStatus string
+
+const (
+	TaskStatusNew        TaskStatus = "new"
+	TaskStatusInProgress TaskStatus = "in_progress"
+	TaskStatusDone       TaskStatus = "done"
+)
+
+type Task struct {
+	ID          uuid.UUID  `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description,omitempty"`
+	Status      TaskStatus `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+type TaskListItem struct {
+	ID     uuid.UUID  `json:"id"`
+	Title  string     `json:"title"`
+	Status TaskStatus `json:"status"`
+}
+
+type CreateTaskRequest struct {
+	// ID is optional, the server generates one when it is empty
+	ID          *uuid.UUID `json:"id,omitempty"`
+	Title       string     `json:"title"`
+	Description string     `json:"description,omitempty"`
+}
+
+type UpdateTaskRequest struct {
+	Title       string     `json:"title"`
+	Description *string    `json:"description"`
+	Status      TaskStatus `json:"status"`
+}
+
+// PatchTaskRequest changes only the fields that are set
+type PatchTaskRequest struct {
+	Title       *string
+	Description *string
+	Status      *TaskStatus
+}
+
+type ListOptions struct {
+	Status TaskStatus
+	// Limit is the page size, zero means the server default
+	Limit  int
+	Offset int
+}
+
+type createTaskResponse struct {
+	ID uuid.UUID `json:"id"`
+}